@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+)
+
+// explanation is the response of the /api/v1/explain endpoint.
+type explanation struct {
+	TakenAt   time.Time           `json:"taken_at"`
+	Query     string              `json:"query"`
+	Decisions []explainedDecision `json:"decisions"`
+}
+
+type explainedDecision struct {
+	Stage         string `json:"stage"`
+	Cluster       string `json:"cluster,omitempty"`
+	ContainerId   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Name          string `json:"name,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Value         string `json:"value,omitempty"`
+	Code          string `json:"code"`
+	Reason        string `json:"reason"`
+	Published     bool   `json:"published"`
+	Against       *struct {
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		Value         string `json:"value"`
+		Hostname      string `json:"hostname"`
+		ContainerName string `json:"container_name"`
+	} `json:"against,omitempty"`
+}
+
+// ExplainFunc asks the daemon serving on server why the records of query were
+// or were not published.
+type ExplainFunc func(ctx context.Context, server, query string) (explanation, error)
+
+// apiClient calls the daemon's HTTP server, authenticating with the
+// credentials it is configured with.
+type apiClient struct {
+	http     *http.Client
+	token    string
+	username string
+	password string
+}
+
+// newAPIClient returns a client for the server cfg configures. Over TLS it
+// trusts the system roots, the server's own certificate (for a self-signed
+// one) and caFile, if set.
+func newAPIClient(cfg *config.HTTPConfig, caFile string, insecureSkipVerify bool) (*apiClient, error) {
+	token, password, err := cfg.Auth.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	c := &apiClient{http: http.DefaultClient, token: token, username: cfg.Auth.Username, password: password}
+	if !cfg.TLS.Enabled() && caFile == "" && !insecureSkipVerify {
+		return c, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, f := range []string{cfg.TLS.CertFile, caFile} {
+		if f == "" {
+			continue
+		}
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", f)
+		}
+	}
+	c.http = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            pool,
+		InsecureSkipVerify: insecureSkipVerify, //nolint:gosec // opt-in via flag for self-signed setups
+	}}}
+	return c, nil
+}
+
+// authorize adds the client's credentials to req: the bearer token if set,
+// else the basic-auth user.
+func (c *apiClient) authorize(req *http.Request) {
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// explain is an ExplainFunc.
+func (c *apiClient) explain(ctx context.Context, server, query string) (explanation, error) {
+	var out explanation
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+"/api/v1/explain?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return out, err
+	}
+	c.authorize(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return out, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return out, fmt.Errorf("decode response: %w", err)
+	}
+	return out, nil
+}
+
+// explainTimeout bounds how long the explain subcommand waits for the daemon.
+const explainTimeout = 10 * time.Second
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <name|container>",
+	Short: "Explain why a record was or was not published",
+	Long: "Asks the running daemon, through its HTTP server, what its latest reconciliation pass decided about " +
+		"the records of a DNS name, a container name or a container id prefix, and why: labels it could not use, " +
+		"conflicts with other containers' records, validation failures, and what each cluster's plan does.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		server, _ := cmd.Flags().GetString("server")
+		if server == "" {
+			server = serverURL(cfg.HTTP.ListenAddr, cfg.HTTP.TLS.Enabled())
+		}
+		caFile, _ := cmd.Flags().GetString("ca-file")
+		insecure, _ := cmd.Flags().GetBool("insecure-skip-verify")
+		client, err := newAPIClient(&cfg.HTTP, caFile, insecure)
+		if err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		return runExplain(cmd.Context(), server, args[0], client.explain, output, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	explainCmd.Flags().String("server", "", "Base URL of the daemon's HTTP server (default: derived from http.listen_addr and http.tls)")
+	explainCmd.Flags().String("ca-file", "", "Extra CA bundle (PEM) to verify the daemon's TLS certificate against")
+	explainCmd.Flags().Bool("insecure-skip-verify", false, "Skip verification of the daemon's TLS certificate (insecure)")
+	explainCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	rootCmd.AddCommand(explainCmd)
+}
+
+// serverURL turns a listen address such as ":8080" into a URL to reach it
+// from the same host, over https when the server uses TLS.
+func serverURL(listenAddr string, useTLS bool) string {
+	scheme := "http://"
+	if useTLS {
+		scheme = "https://"
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return scheme + listenAddr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
+
+func runExplain(ctx context.Context, server, query string, explain ExplainFunc, output string, w io.Writer) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output format %q (want table or json)", output)
+	}
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+	ex, err := explain(ctx, server, query)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", server, err)
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ex)
+	}
+	writeExplanation(w, ex, time.Now())
+	return nil
+}
+
+// writeExplanation renders ex as a table of decisions in pipeline order.
+func writeExplanation(w io.Writer, ex explanation, now time.Time) {
+	fmt.Fprintf(w, "as of the pass %s:\n", formatAge(ex.TakenAt, now))
+	if len(ex.Decisions) == 0 {
+		fmt.Fprintf(w, "  nothing is known about %q: no tracked container has a record by that name, "+
+			"and no container by that name or id has labels under the configured prefix\n", ex.Query)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  STAGE\tCLUSTER\tCONTAINER\tRECORD\tPUBLISHED\tCODE\tREASON")
+	for _, d := range ex.Decisions {
+		record := "-"
+		if d.Name != "" || d.Value != "" {
+			record = strings.TrimSpace(fmt.Sprintf("%s %s %s", orDash(d.Name), d.Type, d.Value))
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			d.Stage, orDash(d.Cluster), orDash(d.ContainerName), record, d.Published, d.Code, d.Reason)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+)
+
+func explainOf(ex explanation, err error) ExplainFunc {
+	return func(ctx context.Context, server, query string) (explanation, error) {
+		return ex, err
+	}
+}
+
+func testExplanation() explanation {
+	return explanation{
+		TakenAt: time.Now().Add(-3 * time.Second),
+		Query:   "app.example.com",
+		Decisions: []explainedDecision{
+			{Stage: "filter", ContainerName: "late", Name: "app.example.com", Type: "A", Value: "10.0.0.2", Code: "lost_on_age", Reason: "conflicts with an older container"},
+			{Stage: "reconcile", Cluster: "default", ContainerName: "web", Name: "app.example.com", Type: "A", Value: "10.0.0.1", Code: "added", Reason: "added to the registry", Published: true},
+		},
+	}
+}
+
+func TestRunExplain_Table(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := runExplain(context.Background(), "http://localhost:8080", "app.example.com", explainOf(testExplanation(), nil), "table", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"3s ago", "STAGE", "filter", "late", "app.example.com A 10.0.0.2", "lost_on_age", "conflicts with an older container", "default", "added"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunExplain_JSON(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := runExplain(context.Background(), "http://localhost:8080", "app.example.com", explainOf(testExplanation(), nil), "json", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got explanation
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if len(got.Decisions) != 2 || !got.Decisions[1].Published {
+		t.Errorf("unexpected explanation %+v", got)
+	}
+}
+
+func TestRunExplain_NothingKnown(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := runExplain(context.Background(), "http://localhost:8080", "nope", explainOf(explanation{TakenAt: time.Now(), Query: "nope"}, nil), "table", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `nothing is known about "nope"`) {
+		t.Errorf("expected a hint when nothing matches, got:\n%s", out.String())
+	}
+}
+
+func TestRunExplain_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		explain ExplainFunc
+		output  string
+	}{
+		{"bad output format", explainOf(explanation{}, nil), "yaml"},
+		{"server error", explainOf(explanation{}, errors.New("connection refused")), "table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runExplain(context.Background(), "http://localhost:8080", "x", tt.explain, tt.output, &bytes.Buffer{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestAPIClient_Explain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/explain" || r.URL.Query().Get("q") != "my app" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer s3cret" {
+			t.Errorf("expected the configured token, got %q", got)
+		}
+		_ = json.NewEncoder(w).Encode(testExplanation())
+	}))
+	defer srv.Close()
+	client, err := newAPIClient(&config.HTTPConfig{Auth: config.HTTPAuthConfig{Token: "s3cret"}}, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := client.explain(context.Background(), srv.URL+"/", "my app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Decisions) != 2 {
+		t.Errorf("unexpected explanation %+v", got)
+	}
+}
+
+func TestAPIClient_Explain_BasicAuthOverTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ops" || pass != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(testExplanation())
+	}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := newAPIClient(&config.HTTPConfig{Auth: config.HTTPAuthConfig{Username: "ops", Password: "hunter2"}}, caFile, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := client.explain(context.Background(), srv.URL, "app"); err != nil {
+		t.Errorf("expected the CA file to be trusted and basic auth sent, got %v", err)
+	}
+}
+
+func TestAPIClient_Explain_NotReady(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("no reconciliation pass has run yet"))
+	}))
+	defer srv.Close()
+	client, _ := newAPIClient(&config.HTTPConfig{}, "", false)
+
+	_, err := client.explain(context.Background(), srv.URL, "app")
+	if err == nil || !strings.Contains(err.Error(), "no reconciliation pass has run yet") {
+		t.Errorf("expected the server's message in the error, got %v", err)
+	}
+}
+
+func TestNewAPIClient_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		cfg    config.HTTPConfig
+		caFile string
+	}{
+		"missing token file": {cfg: config.HTTPConfig{Auth: config.HTTPAuthConfig{TokenFile: filepath.Join(dir, "token")}}},
+		"missing CA file":    {caFile: filepath.Join(dir, "missing.pem")},
+		"CA file not PEM":    {caFile: notPEM},
+	} {
+		if _, err := newAPIClient(&tc.cfg, tc.caFile, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	tests := map[string]string{
+		":8080":          "http://localhost:8080",
+		"0.0.0.0:9090":   "http://localhost:9090",
+		"127.0.0.1:8080": "http://127.0.0.1:8080",
+		"[::]:8080":      "http://localhost:8080",
+	}
+	for in, want := range tests {
+		if got := serverURL(in, false); got != want {
+			t.Errorf("serverURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := serverURL(":8443", true); got != "https://localhost:8443" {
+		t.Errorf("expected https with TLS, got %q", got)
+	}
+}
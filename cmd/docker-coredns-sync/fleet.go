@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/app"
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
+)
+
+// FleetFunc lists the sync instances heartbeating in each configured cluster.
+type FleetFunc func(ctx context.Context, cfg *config.Config, log zerolog.Logger) ([]domain.ClusterFleet, error)
+
+var defaultFleetFunc FleetFunc = func(ctx context.Context, cfg *config.Config, log zerolog.Logger) ([]domain.ClusterFleet, error) {
+	return app.Fleet(ctx, cfg, log, app.DefaultFactories())
+}
+
+// fleetTimeout bounds how long the fleet subcommand waits for the registry.
+const fleetTimeout = 10 * time.Second
+
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "List every sync instance heartbeating in the registry",
+	Long: "Reads the heartbeat of every docker-coredns-sync instance sharing this host's registry " +
+		"and prints each one's version, start time, host IPs, records owned, dry-run flag and last successful reconciliation.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		output, _ := cmd.Flags().GetString("output")
+		return runFleet(cmd.Context(), cfg, defaultFleetFunc, output, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	fleetCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	rootCmd.AddCommand(fleetCmd)
+}
+
+func runFleet(ctx context.Context, cfg *config.Config, list FleetFunc, output string, w io.Writer) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output format %q (want table or json)", output)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fleetTimeout)
+	defer cancel()
+	log, err := logger.SetupLogger(&cfg.Logging)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	fleet, err := list(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to read the fleet: %w", err)
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fleet); err != nil {
+			return err
+		}
+	} else {
+		writeFleetTable(w, fleet, time.Now())
+	}
+
+	// The view is still useful when some clusters are unreachable; fail only
+	// when none could be read.
+	var errs []error
+	for _, cf := range fleet {
+		if cf.Err == "" {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("cluster %s: %s", cf.Cluster, cf.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// writeFleetTable renders fleet as one table per cluster.
+func writeFleetTable(w io.Writer, fleet []domain.ClusterFleet, now time.Time) {
+	for i, cf := range fleet {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "cluster %s:\n", cf.Cluster)
+		if cf.Err != "" {
+			fmt.Fprintf(w, "  error: %s\n", cf.Err)
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  HOSTNAME\tVERSION\tSTARTED\tIPV4\tIPV6\tRECORDS\tLAST RECONCILE")
+		for _, h := range cf.Hosts {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				h.Hostname, orDash(h.Version), formatStarted(h.StartedAt), orDash(h.HostIPv4), orDash(h.HostIPv6),
+				h.RecordsOwned, formatAge(h.LastReconcile, now))
+		}
+		_ = tw.Flush()
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatStarted(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatAge renders how long ago t was, to the second.
+func formatAge(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func fleetOf(fleet []domain.ClusterFleet, err error) FleetFunc {
+	return func(ctx context.Context, cfg *config.Config, log zerolog.Logger) ([]domain.ClusterFleet, error) {
+		return fleet, err
+	}
+}
+
+func TestRunFleet_Table(t *testing.T) {
+	fleet := []domain.ClusterFleet{{Cluster: "default", Hosts: []domain.HostStatus{
+		{Hostname: "host-1", Version: "v1.0.0", HostIPv4: "10.0.0.1", RecordsOwned: 3, LastReconcile: time.Now().Add(-5 * time.Second)},
+		{Hostname: "old-host"},
+	}}}
+	var out bytes.Buffer
+
+	if err := runFleet(context.Background(), testConfig(), fleetOf(fleet, nil), "table", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"cluster default:", "HOSTNAME", "host-1", "v1.0.0", "10.0.0.1", "5s ago", "old-host", "never"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunFleet_JSON(t *testing.T) {
+	fleet := []domain.ClusterFleet{{Cluster: "default", Hosts: []domain.HostStatus{{Hostname: "host-1", RecordsOwned: 3}}}}
+	var out bytes.Buffer
+
+	if err := runFleet(context.Background(), testConfig(), fleetOf(fleet, nil), "json", &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []domain.ClusterFleet
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if len(got) != 1 || got[0].Hosts[0].RecordsOwned != 3 {
+		t.Errorf("unexpected fleet %+v", got)
+	}
+}
+
+func TestRunFleet_PartialFailureSucceeds(t *testing.T) {
+	fleet := []domain.ClusterFleet{
+		{Cluster: "a", Hosts: []domain.HostStatus{{Hostname: "host-1"}}},
+		{Cluster: "b", Hosts: []domain.HostStatus{}, Err: "etcd unavailable"},
+	}
+	var out bytes.Buffer
+
+	if err := runFleet(context.Background(), testConfig(), fleetOf(fleet, nil), "table", &out); err != nil {
+		t.Fatalf("expected the readable clusters to be enough, got %v", err)
+	}
+	if !strings.Contains(out.String(), "error: etcd unavailable") {
+		t.Errorf("expected the unreachable cluster to be shown, got:\n%s", out.String())
+	}
+}
+
+func TestRunFleet_Errors(t *testing.T) {
+	unreachable := []domain.ClusterFleet{{Cluster: "a", Hosts: []domain.HostStatus{}, Err: "etcd unavailable"}}
+	tests := []struct {
+		name   string
+		list   FleetFunc
+		output string
+	}{
+		{"bad output format", fleetOf(nil, nil), "yaml"},
+		{"connect error", fleetOf(nil, errors.New("boom")), "table"},
+		{"every cluster unreachable", fleetOf(unreachable, nil), "table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runFleet(context.Background(), testConfig(), tt.list, tt.output, &bytes.Buffer{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
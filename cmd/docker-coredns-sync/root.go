@@ -26,6 +26,18 @@ type AppRunner interface {
 	Close() error
 }
 
+// reconcileTrigger is implemented by apps that can run a reconciliation pass
+// on demand, which SIGHUP requests.
+type reconcileTrigger interface {
+	TriggerReconcile()
+}
+
+// breakerOverrider is implemented by apps with a removal breaker, which
+// SIGUSR1 overrides.
+type breakerOverrider interface {
+	OverrideBreaker() bool
+}
+
 type AppFactory func(cfg *config.Config, log zerolog.Logger) (AppRunner, error)
 
 var defaultAppFactory AppFactory = func(cfg *config.Config, log zerolog.Logger) (AppRunner, error) {
@@ -33,7 +45,10 @@ var defaultAppFactory AppFactory = func(cfg *config.Config, log zerolog.Logger)
 }
 
 func runWithDeps(cfg *config.Config, factory AppFactory, sigCh <-chan os.Signal) error {
-	logInstance := logger.SetupLogger(&cfg.Logging)
+	logInstance, err := logger.SetupLogger(&cfg.Logging)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
 
 	application, err := factory(cfg, logInstance)
 	if err != nil {
@@ -49,10 +64,27 @@ func runWithDeps(cfg *config.Config, factory AppFactory, sigCh <-chan os.Signal)
 	defer stop()
 
 	go func() {
-		sig, ok := <-sigCh
-		if ok {
+		for sig := range sigCh {
+			// SIGHUP asks for an immediate reconciliation instead of shutdown.
+			if sig == syscall.SIGHUP {
+				if t, ok := application.(reconcileTrigger); ok {
+					logInstance.Info().Msgf("Received signal: %v; triggering reconciliation", sig)
+					t.TriggerReconcile()
+					continue
+				}
+			}
+			// SIGUSR1 lets removals blocked by the removal breaker proceed.
+			if sig == syscall.SIGUSR1 {
+				if o, ok := application.(breakerOverrider); ok && o.OverrideBreaker() {
+					logInstance.Warn().Msgf("Received signal: %v; overriding the removal breaker", sig)
+				} else {
+					logInstance.Info().Msgf("Received signal: %v; no removal breaker is tripped", sig)
+				}
+				continue
+			}
 			logInstance.Info().Msgf("Received signal: %v", sig)
 			stop()
+			return
 		}
 	}()
 
@@ -79,9 +111,12 @@ var rootCmd = &cobra.Command{
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := cmd.Context().Value(configKey).(*config.Config)
+		if drain, _ := cmd.Flags().GetBool("drain"); drain {
+			cfg.App.DeregisterOnShutdown = true
+		}
 
 		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
 
 		return runWithDeps(cfg, defaultAppFactory, sigCh)
 	},
@@ -105,9 +140,34 @@ func init() {
 	rootCmd.PersistentFlags().String("app.hostname", "", "Logical hostname of this instance")
 	viper.BindPFlag("app.hostname", rootCmd.PersistentFlags().Lookup("app.hostname"))
 
-	rootCmd.PersistentFlags().Int("app.poll-interval", 0, "Polling interval (in seconds) for reconciliation")
+	rootCmd.PersistentFlags().Int("app.poll-interval", 0, "Interval (in seconds) at which a failed reconciliation is retried")
 	viper.BindPFlag("app.poll_interval", rootCmd.PersistentFlags().Lookup("app.poll-interval"))
 
+	rootCmd.PersistentFlags().Float64("app.reconcile-safety-interval", 0, "Interval (in seconds) of the periodic safety-net reconciliation")
+	viper.BindPFlag("app.reconcile_safety_interval", rootCmd.PersistentFlags().Lookup("app.reconcile-safety-interval"))
+
+	rootCmd.PersistentFlags().Float64("app.reconcile-debounce", 0, "Quiet period (in seconds) after a container event before reconciling")
+	viper.BindPFlag("app.reconcile_debounce", rootCmd.PersistentFlags().Lookup("app.reconcile-debounce"))
+
+	rootCmd.PersistentFlags().Float64("app.reconcile-max-delay", 0, "Longest (in seconds) a stream of container events can postpone reconciliation")
+	viper.BindPFlag("app.reconcile_max_delay", rootCmd.PersistentFlags().Lookup("app.reconcile-max-delay"))
+	rootCmd.PersistentFlags().Float64("app.gc-interval", 0, "Minimum interval (in seconds) between cross-host garbage collections of orphaned records (0 = every pass)")
+	viper.BindPFlag("app.gc_interval", rootCmd.PersistentFlags().Lookup("app.gc-interval"))
+
+	rootCmd.PersistentFlags().Float64("app.startup-grace", 0, "Extra delay (in seconds) after startup before removing this host's stale records")
+	viper.BindPFlag("app.startup_grace", rootCmd.PersistentFlags().Lookup("app.startup-grace"))
+
+	rootCmd.PersistentFlags().Bool("app.deregister-on-shutdown", false, "Remove this host's records on graceful shutdown instead of keeping them across restarts")
+	viper.BindPFlag("app.deregister_on_shutdown", rootCmd.PersistentFlags().Lookup("app.deregister-on-shutdown"))
+
+	rootCmd.PersistentFlags().Float64("app.deregister-timeout", 0, "Longest (in seconds) removing this host's records on shutdown may take")
+	viper.BindPFlag("app.deregister_timeout", rootCmd.PersistentFlags().Lookup("app.deregister-timeout"))
+
+	rootCmd.PersistentFlags().Float64("app.stop-grace-period", 0, "Time (in seconds) the container runtime waits after SIGTERM before killing the process")
+	viper.BindPFlag("app.stop_grace_period", rootCmd.PersistentFlags().Lookup("app.stop-grace-period"))
+
+	rootCmd.Flags().Bool("drain", false, "Drain this host: remove its records on shutdown (same as --app.deregister-on-shutdown)")
+
 	rootCmd.PersistentFlags().Bool("app.dry-run", false, "Log planned etcd changes without applying them")
 	viper.BindPFlag("app.dry_run", rootCmd.PersistentFlags().Lookup("app.dry-run"))
 
@@ -119,6 +179,18 @@ func init() {
 	rootCmd.PersistentFlags().Int("app.heartbeat-ttl", 0, "Lease TTL (seconds) for this host's liveness key; also the grace period before peers GC a stopped host's records")
 	viper.BindPFlag("app.heartbeat_ttl", rootCmd.PersistentFlags().Lookup("app.heartbeat-ttl"))
 
+	rootCmd.PersistentFlags().Int("app.breaker.max-removals", 0, "Most of this host's records one pass may remove before the removal breaker trips (0 = no limit)")
+	viper.BindPFlag("app.breaker.max_removals", rootCmd.PersistentFlags().Lookup("app.breaker.max-removals"))
+
+	rootCmd.PersistentFlags().Float64("app.breaker.max-removal-percent", 0, "Largest percentage of this host's records one pass may remove before the removal breaker trips (0 = no limit)")
+	viper.BindPFlag("app.breaker.max_removal_percent", rootCmd.PersistentFlags().Lookup("app.breaker.max-removal-percent"))
+
+	rootCmd.PersistentFlags().Int("app.breaker.max-gc-removals", 0, "Most orphaned records of dead hosts one pass may garbage-collect before the removal breaker trips (0 = no limit)")
+	viper.BindPFlag("app.breaker.max_gc_removals", rootCmd.PersistentFlags().Lookup("app.breaker.max-gc-removals"))
+
+	rootCmd.PersistentFlags().Float64("app.breaker.max-gc-removal-percent", 0, "Largest percentage of other hosts' records one pass may garbage-collect before the removal breaker trips (0 = no limit)")
+	viper.BindPFlag("app.breaker.max_gc_removal_percent", rootCmd.PersistentFlags().Lookup("app.breaker.max-gc-removal-percent"))
+
 	// EtcdConfig Flags
 	rootCmd.PersistentFlags().StringArray("etcd-endpoints", []string{"http://localhost:2379"}, "etcd endpoints to connect to (can specify multiple times)")
 	viper.BindPFlag("etcd.endpoints", rootCmd.PersistentFlags().Lookup("etcd-endpoints"))
@@ -154,10 +226,57 @@ func init() {
 	rootCmd.PersistentFlags().Float64("etcd.lock-retry-interval", 0, "Interval (in seconds) to retry etcd lock acquisition")
 	viper.BindPFlag("etcd.lock_retry_interval", rootCmd.PersistentFlags().Lookup("etcd.lock-retry-interval"))
 
-	// LoggingConfig Flag
+	rootCmd.PersistentFlags().Bool("etcd.lease-records", false, "Attach records to this host's heartbeat lease so etcd removes them when the host goes away")
+	viper.BindPFlag("etcd.lease_records", rootCmd.PersistentFlags().Lookup("etcd.lease-records"))
+
+	rootCmd.PersistentFlags().Bool("etcd.watch-cache", false, "Serve registry listings from a watch-maintained in-memory mirror instead of listing the prefix every pass")
+	viper.BindPFlag("etcd.watch_cache", rootCmd.PersistentFlags().Lookup("etcd.watch-cache"))
+
+	// RegistryConfig Flags
+	rootCmd.PersistentFlags().String("registry.backend", "", "Registry backend to publish records to (etcd or redis)")
+	viper.BindPFlag("registry.backend", rootCmd.PersistentFlags().Lookup("registry.backend"))
+
+	// RedisConfig Flags
+	rootCmd.PersistentFlags().String("redis.address", "", "Redis server address (host:port)")
+	viper.BindPFlag("redis.address", rootCmd.PersistentFlags().Lookup("redis.address"))
+
+	rootCmd.PersistentFlags().String("redis.username", "", "Username for Redis ACL authentication")
+	viper.BindPFlag("redis.username", rootCmd.PersistentFlags().Lookup("redis.username"))
+
+	// As with etcd, there is intentionally no --redis.password flag; use the
+	// DOCKER_COREDNS_SYNC_REDIS_PASSWORD env var or the config file instead.
+
+	rootCmd.PersistentFlags().Int("redis.db", 0, "Redis logical database number")
+	viper.BindPFlag("redis.db", rootCmd.PersistentFlags().Lookup("redis.db"))
+
+	rootCmd.PersistentFlags().String("redis.key-prefix", "", "Prefix of the Redis zone hash keys (must match the coredns-redis plugin's key_prefix)")
+	viper.BindPFlag("redis.key_prefix", rootCmd.PersistentFlags().Lookup("redis.key-prefix"))
+
+	rootCmd.PersistentFlags().String("redis.key-suffix", "", "Suffix of the Redis zone hash keys (must match the coredns-redis plugin's key_suffix)")
+	viper.BindPFlag("redis.key_suffix", rootCmd.PersistentFlags().Lookup("redis.key-suffix"))
+
+	rootCmd.PersistentFlags().Float64("redis.lock-ttl", 0, "TTL (in seconds) for Redis locks")
+	viper.BindPFlag("redis.lock_ttl", rootCmd.PersistentFlags().Lookup("redis.lock-ttl"))
+
+	rootCmd.PersistentFlags().Float64("redis.lock-timeout", 0, "Timeout (in seconds) for acquiring Redis locks")
+	viper.BindPFlag("redis.lock_timeout", rootCmd.PersistentFlags().Lookup("redis.lock-timeout"))
+
+	rootCmd.PersistentFlags().Float64("redis.lock-retry-interval", 0, "Interval (in seconds) to retry Redis lock acquisition")
+	viper.BindPFlag("redis.lock_retry_interval", rootCmd.PersistentFlags().Lookup("redis.lock-retry-interval"))
+
+	// LoggingConfig Flags
 	rootCmd.PersistentFlags().String("log.level", "", "Log level (e.g., TRACE, DEBUG, INFO, WARN, ERROR, FATAL)")
 	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log.level"))
 
+	rootCmd.PersistentFlags().String("log.format", "", "Log format: console or json")
+	viper.BindPFlag("log.format", rootCmd.PersistentFlags().Lookup("log.format"))
+
+	rootCmd.PersistentFlags().String("log.output", "", "Log output: stdout, stderr or file")
+	viper.BindPFlag("log.output", rootCmd.PersistentFlags().Lookup("log.output"))
+
+	rootCmd.PersistentFlags().String("log.file", "", "Log file path, written when log.output is file")
+	viper.BindPFlag("log.file", rootCmd.PersistentFlags().Lookup("log.file"))
+
 	// HTTPConfig Flags
 	rootCmd.PersistentFlags().Bool("http.enabled", false, "Enable the HTTP server for health/readiness endpoints")
 	viper.BindPFlag("http.enabled", rootCmd.PersistentFlags().Lookup("http.enabled"))
@@ -165,9 +284,50 @@ func init() {
 	rootCmd.PersistentFlags().String("http.listen-addr", "", "Listen address for the HTTP server (e.g., :8080)")
 	viper.BindPFlag("http.listen_addr", rootCmd.PersistentFlags().Lookup("http.listen-addr"))
 
+	rootCmd.PersistentFlags().String("http.tls.cert-file", "", "Serve the HTTP server over TLS with this certificate (PEM)")
+	viper.BindPFlag("http.tls.cert_file", rootCmd.PersistentFlags().Lookup("http.tls.cert-file"))
+
+	rootCmd.PersistentFlags().String("http.tls.key-file", "", "Private key (PEM) for http.tls.cert-file")
+	viper.BindPFlag("http.tls.key_file", rootCmd.PersistentFlags().Lookup("http.tls.key-file"))
+
+	rootCmd.PersistentFlags().String("http.tls.client-ca-file", "", "CA bundle (PEM) to verify HTTP client certificates against; a verified certificate authenticates the request")
+	viper.BindPFlag("http.tls.client_ca_file", rootCmd.PersistentFlags().Lookup("http.tls.client-ca-file"))
+
+	rootCmd.PersistentFlags().Bool("http.tls.require-client-cert", false, "Reject HTTP clients without a certificate verified against http.tls.client-ca-file")
+	viper.BindPFlag("http.tls.require_client_cert", rootCmd.PersistentFlags().Lookup("http.tls.require-client-cert"))
+
+	// Note: like the etcd password, http.auth.token and http.auth.password
+	// have no flag; set them via env vars or the config file, or point the
+	// *-file flags at a file such as a Docker secret.
+	rootCmd.PersistentFlags().String("http.auth.token-file", "", "File holding the bearer token accepted by the HTTP server")
+	viper.BindPFlag("http.auth.token_file", rootCmd.PersistentFlags().Lookup("http.auth.token-file"))
+
+	rootCmd.PersistentFlags().String("http.auth.username", "", "Basic-auth username accepted by the HTTP server")
+	viper.BindPFlag("http.auth.username", rootCmd.PersistentFlags().Lookup("http.auth.username"))
+
+	rootCmd.PersistentFlags().String("http.auth.password-file", "", "File holding the basic-auth password for http.auth.username")
+	viper.BindPFlag("http.auth.password_file", rootCmd.PersistentFlags().Lookup("http.auth.password-file"))
+
 	// MetricsConfig Flag
 	rootCmd.PersistentFlags().Bool("metrics.enabled", false, "Expose the Prometheus /metrics endpoint on the HTTP server")
 	viper.BindPFlag("metrics.enabled", rootCmd.PersistentFlags().Lookup("metrics.enabled"))
+
+	// AuditConfig Flags
+	rootCmd.PersistentFlags().String("audit.file", "", "Append an audit log of every registry write to this file, as JSON lines")
+	viper.BindPFlag("audit.file", rootCmd.PersistentFlags().Lookup("audit.file"))
+
+	rootCmd.PersistentFlags().Bool("audit.stdout", false, "Write the audit log of every registry write to stdout, as JSON lines")
+	viper.BindPFlag("audit.stdout", rootCmd.PersistentFlags().Lookup("audit.stdout"))
+
+	// TracingConfig Flags
+	rootCmd.PersistentFlags().Bool("tracing.enabled", false, "Export OpenTelemetry traces of event handling, reconciliation and registry calls over OTLP/HTTP")
+	viper.BindPFlag("tracing.enabled", rootCmd.PersistentFlags().Lookup("tracing.enabled"))
+
+	rootCmd.PersistentFlags().String("tracing.endpoint", "", "OTLP/HTTP URL spans are posted to (e.g. http://otel-collector:4318/v1/traces; default from OTEL_EXPORTER_OTLP_* env vars)")
+	viper.BindPFlag("tracing.endpoint", rootCmd.PersistentFlags().Lookup("tracing.endpoint"))
+
+	rootCmd.PersistentFlags().Float64("tracing.sample-ratio", 0, "Fraction of traces to sample, between 0 and 1")
+	viper.BindPFlag("tracing.sample_ratio", rootCmd.PersistentFlags().Lookup("tracing.sample-ratio"))
 }
 
 // Execute runs the root command.
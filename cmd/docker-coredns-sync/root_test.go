@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -39,10 +40,13 @@ func (m *mockAppRunner) Close() error {
 func testConfig() *config.Config {
 	return &config.Config{
 		App: config.AppConfig{
-			DockerLabelPrefix: "coredns",
-			HostIPv4:          "192.168.1.1",
-			Hostname:          "test-host",
-			PollInterval:      5,
+			DockerLabelPrefix:       "coredns",
+			HostIPv4:                "192.168.1.1",
+			Hostname:                "test-host",
+			PollInterval:            5,
+			ReconcileSafetyInterval: 300,
+			DeregisterTimeout:       8,
+			StopGracePeriod:         10,
 		},
 		Etcd: config.EtcdConfig{
 			Endpoints:         []string{"http://localhost:2379"},
@@ -164,6 +168,121 @@ func TestRunWithDeps_SignalHandling(t *testing.T) {
 	}
 }
 
+type triggeringAppRunner struct {
+	mockAppRunner
+	triggered chan struct{}
+}
+
+func (m *triggeringAppRunner) TriggerReconcile() {
+	m.triggered <- struct{}{}
+}
+
+func TestRunWithDeps_SIGHUPTriggersReconcile(t *testing.T) {
+	cfg := testConfig()
+
+	runStarted := make(chan struct{})
+	mockApp := &triggeringAppRunner{
+		mockAppRunner: mockAppRunner{
+			runFunc: func(ctx context.Context) error {
+				close(runStarted)
+				<-ctx.Done()
+				return nil
+			},
+		},
+		triggered: make(chan struct{}, 1),
+	}
+	factory := func(cfg *config.Config, log zerolog.Logger) (AppRunner, error) {
+		return mockApp, nil
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runWithDeps(cfg, factory, sigCh)
+	}()
+
+	<-runStarted
+	sigCh <- syscall.SIGHUP
+	select {
+	case <-mockApp.triggered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected SIGHUP to trigger a reconciliation")
+	}
+	select {
+	case <-done:
+		t.Fatal("expected SIGHUP not to stop the app")
+	default:
+	}
+
+	sigCh <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error after signal, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for runWithDeps to complete")
+	}
+}
+
+type overridingAppRunner struct {
+	mockAppRunner
+	overridden chan struct{}
+}
+
+func (m *overridingAppRunner) OverrideBreaker() bool {
+	m.overridden <- struct{}{}
+	return true
+}
+
+func TestRunWithDeps_SIGUSR1OverridesBreaker(t *testing.T) {
+	cfg := testConfig()
+
+	runStarted := make(chan struct{})
+	mockApp := &overridingAppRunner{
+		mockAppRunner: mockAppRunner{
+			runFunc: func(ctx context.Context) error {
+				close(runStarted)
+				<-ctx.Done()
+				return nil
+			},
+		},
+		overridden: make(chan struct{}, 1),
+	}
+	factory := func(cfg *config.Config, log zerolog.Logger) (AppRunner, error) {
+		return mockApp, nil
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runWithDeps(cfg, factory, sigCh)
+	}()
+
+	<-runStarted
+	sigCh <- syscall.SIGUSR1
+	select {
+	case <-mockApp.overridden:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected SIGUSR1 to override the removal breaker")
+	}
+	select {
+	case <-done:
+		t.Fatal("expected SIGUSR1 not to stop the app")
+	default:
+	}
+
+	sigCh <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error after signal, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for runWithDeps to complete")
+	}
+}
+
 func TestRunWithDeps_CloseError(t *testing.T) {
 	cfg := testConfig()
 
@@ -201,12 +320,19 @@ func TestInit_FlagsRegistered(t *testing.T) {
 		"app.host-ipv6",
 		"app.hostname",
 		"app.poll-interval",
+		"app.reconcile-safety-interval",
+		"app.deregister-on-shutdown",
+		"app.deregister-timeout",
+		"app.stop-grace-period",
 		"etcd-endpoints",
 		"etcd.path-prefix",
 		"etcd.lock-ttl",
 		"etcd.lock-timeout",
 		"etcd.lock-retry-interval",
 		"log.level",
+		"log.format",
+		"log.output",
+		"log.file",
 	}
 
 	for _, name := range expectedFlags {
@@ -217,6 +343,15 @@ func TestInit_FlagsRegistered(t *testing.T) {
 	}
 }
 
+func TestInit_DrainFlagIsLocal(t *testing.T) {
+	if rootCmd.Flags().Lookup("drain") == nil {
+		t.Error("expected the --drain flag to be registered")
+	}
+	if rootCmd.PersistentFlags().Lookup("drain") != nil {
+		t.Error("expected --drain to apply to the daemon only, not its subcommands")
+	}
+}
+
 func TestRootCmd_Properties(t *testing.T) {
 	if rootCmd.Use != "docker-coredns-sync" {
 		t.Errorf("expected Use to be 'docker-coredns-sync', got %q", rootCmd.Use)
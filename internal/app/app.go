@@ -2,39 +2,59 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/audit"
+	"github.com/auto-dns/docker-coredns-sync/internal/buildinfo"
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/core"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/auto-dns/docker-coredns-sync/internal/event"
 	"github.com/auto-dns/docker-coredns-sync/internal/httpserver"
 	"github.com/auto-dns/docker-coredns-sync/internal/metrics"
+	"github.com/auto-dns/docker-coredns-sync/internal/notify"
 	"github.com/auto-dns/docker-coredns-sync/internal/registry"
 	"github.com/auto-dns/docker-coredns-sync/internal/state"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
 	dockerCli "github.com/docker/docker/client"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type App struct {
 	dockerClient io.Closer
-	etcdClient   io.Closer
+	etcdClients  []io.Closer
+	redisClient  io.Closer
+	watchCaches  []watchCache
 	engine       *core.SyncEngine
 	httpServer   *httpserver.Server
 	status       *httpserver.Status
+	notifier     *notify.Notifier
+	audits       []*audit.Log
+	tracer       *sdktrace.TracerProvider
 	logger       zerolog.Logger
 }
 
+// watchCache is a registry whose listing cache runs for the app's lifetime.
+type watchCache interface {
+	StartWatchCache(ctx context.Context)
+}
+
 type DockerClientFactory func() (*dockerCli.Client, error)
 type EtcdClientFactory func(cfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error)
+type RedisClientFactory func(cfg *config.RedisConfig, dialTimeout time.Duration) (*redis.Client, error)
 
 type ClientFactories struct {
 	DockerClientFactory DockerClientFactory
 	EtcdClientFactory   EtcdClientFactory
+	RedisClientFactory  RedisClientFactory
 }
 
 func DefaultFactories() ClientFactories {
@@ -55,26 +75,58 @@ func DefaultFactories() ClientFactories {
 				TLS:         tlsCfg,
 			})
 		},
+		RedisClientFactory: func(cfg *config.RedisConfig, dialTimeout time.Duration) (*redis.Client, error) {
+			return redis.NewClient(&redis.Options{
+				Addr:        cfg.Address,
+				Username:    cfg.Username,
+				Password:    cfg.Password,
+				DB:          cfg.DB,
+				DialTimeout: dialTimeout,
+			}), nil
+		},
 	}
 }
 
 func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories ClientFactories) (*App, error) {
+	// Read the HTTP server's secrets and certificates first, so a missing file
+	// fails startup before any client connects.
+	var (
+		auth   httpserver.Auth
+		tlsCfg *tls.Config
+	)
+	if cfg.HTTPServerEnabled() {
+		var err error
+		if auth, err = httpAuth(&cfg.HTTP); err != nil {
+			return nil, err
+		}
+		if tlsCfg, err = cfg.HTTP.TLS.ServerTLS(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The tracer provider is shared by the engine, the registries and the
+	// Docker generator; without tracing they trace with a no-op one.
+	var tp *sdktrace.TracerProvider
+	if cfg.Tracing.Enabled {
+		var err error
+		if tp, err = tracing.NewProvider(context.Background(), &cfg.Tracing, cfg.App.Hostname); err != nil {
+			return nil, err
+		}
+	}
+
 	dockerClient, err := factories.DockerClientFactory()
 	if err != nil {
+		shutdownTracer(tp)
 		return nil, err
 	}
 
-	// Warn when etcd credentials would be sent over an unencrypted connection.
-	if cfg.Etcd.Username != "" && !cfg.Etcd.UsesTLS() {
-		logger.Warn().Msg("etcd username/password configured without TLS or an https:// endpoint: credentials will be sent in plaintext")
-	}
-
 	// metrics is created when the /metrics endpoint is enabled; it is fed by the
 	// engine (reconcile outcomes), the registry (etcd op/lock errors), and the
 	// Docker generator (disconnects).
 	var m *metrics.Metrics
 	if cfg.Metrics.Enabled {
 		m = metrics.New()
+		m.SetLabelLimits(cfg.Metrics.MaxHosts, cfg.Metrics.MaxContainers)
 	}
 
 	// Status backs the health endpoints; it is shared by the engine (reconcile
@@ -82,8 +134,9 @@ func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories Clien
 	var status *httpserver.Status
 	if cfg.HTTP.Enabled {
 		// Consider the daemon stale if a reconciliation has not succeeded within
-		// a few poll intervals.
-		readyThreshold := 3 * time.Duration(cfg.App.PollInterval) * time.Second
+		// a safety-net interval and a few retries.
+		readyThreshold := time.Duration(cfg.App.ReconcileSafetyInterval*float64(time.Second)) +
+			3*time.Duration(cfg.App.PollInterval)*time.Second
 		status = httpserver.NewStatus(readyThreshold)
 	}
 
@@ -102,27 +155,42 @@ func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories Clien
 	if m != nil {
 		genOpts = append(genOpts, event.WithDisconnectObserver(m.IncDockerDisconnect))
 	}
+	if tp != nil {
+		genOpts = append(genOpts, event.WithTracerProvider(tp))
+	}
 	gen := event.NewDockerGenerator(dockerClient, logger, genOpts...)
 
-	etcdClient, err := factories.EtcdClientFactory(&cfg.Etcd, 2*time.Second)
-	if err != nil {
-		_ = dockerClient.Close()
-		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+	app := &App{
+		dockerClient: dockerClient,
+		tracer:       tp,
+		logger:       logger,
 	}
 
-	reg := registry.NewEtcdRegistry(etcdClient, &cfg.Etcd, cfg.App.Hostname, cfg.App.HeartbeatTTL, logger)
-	if m != nil {
-		reg.SetMetrics(m)
+	if len(cfg.Notifications.Webhooks) > 0 {
+		notifier, err := newNotifier(cfg, logger, m)
+		if err != nil {
+			_ = app.Close()
+			return nil, err
+		}
+		app.notifier = notifier
+	}
+	if cfg.Audit.Enabled() {
+		audits, err := newAudits(&cfg.Audit)
+		if err != nil {
+			_ = app.Close()
+			return nil, err
+		}
+		app.audits = audits
 	}
-	memState := state.NewMemoryState()
-	engine := core.NewSyncEngine(logger, &cfg.App, gen, reg, memState)
 
-	app := &App{
-		dockerClient: dockerClient,
-		etcdClient:   etcdClient,
-		engine:       engine,
-		logger:       logger,
+	clusters, err := app.connectClusters(cfg, logger, factories, m, tp)
+	if err != nil {
+		_ = app.Close()
+		return nil, err
 	}
+	memState := state.NewMemoryState()
+	engine := core.NewMultiClusterSyncEngine(logger, &cfg.App, gen, clusters, memState)
+	app.engine = engine
 
 	// In dry-run the daemon intentionally writes nothing, so neither readiness
 	// nor metrics should report it as a ready, successfully-syncing instance.
@@ -133,6 +201,15 @@ func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories Clien
 		engine.SetMetrics(m)
 		m.SetDryRun(cfg.App.DryRun)
 	}
+	if app.notifier != nil {
+		engine.AddChangeSink(app.notifier)
+	}
+	for _, a := range app.audits {
+		engine.AddAuditSink(a)
+	}
+	if tp != nil {
+		engine.SetTracerProvider(tp)
+	}
 	if status != nil {
 		status.SetDryRun(cfg.App.DryRun)
 		engine.SetReconcileReporter(status)
@@ -146,10 +223,31 @@ func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories Clien
 		if m != nil {
 			metricsHandler = m.Handler()
 		}
-		httpServer, err := httpserver.NewServer(cfg.HTTP.ListenAddr, status, metricsHandler, logger)
+		opts := []httpserver.HandlerOption{httpserver.WithAuth(auth)}
+		if tlsCfg != nil {
+			opts = append(opts, httpserver.WithTLS(tlsCfg))
+		}
+		if status != nil {
+			opts = append(opts, httpserver.WithFleet(engine.Fleet), httpserver.WithSnapshot(engine.Snapshot))
+			streamOpts := []httpserver.EventStreamOption{httpserver.WithClientBuffer(cfg.HTTP.EventsBufferSize)}
+			if m != nil {
+				streamOpts = append(streamOpts, httpserver.WithDropObserver(m.IncEventDropped))
+			}
+			events := httpserver.NewEventStream(streamOpts...)
+			engine.AddChangeSink(events)
+			opts = append(opts, httpserver.WithEvents(events))
+			// Without a credential, "auth" could not be enforced: rather than
+			// serve the admin routes, breaker override included, to anyone,
+			// leave them out.
+			if auth.Enabled() || cfg.HTTP.Auth.Policy.Admin == config.HTTPPolicyOpen {
+				opts = append(opts, httpserver.WithAdmin(engine), httpserver.WithBreakerOverride(engine.OverrideBreaker))
+			} else {
+				logger.Info().Msg("no http.auth credential or http.tls.client_ca_file is set: the /admin and /override-breaker endpoints are disabled")
+			}
+		}
+		httpServer, err := httpserver.NewServer(cfg.HTTP.ListenAddr, status, metricsHandler, logger, opts...)
 		if err != nil {
-			_ = dockerClient.Close()
-			_ = etcdClient.Close()
+			_ = app.Close()
 			return nil, err
 		}
 		app.httpServer = httpServer
@@ -158,6 +256,149 @@ func NewWithFactories(cfg *config.Config, logger zerolog.Logger, factories Clien
 	return app, nil
 }
 
+// connectClusters creates the client and registry of every configured
+// cluster, keeping the clients for Close. m and tp may be nil.
+func (a *App) connectClusters(cfg *config.Config, logger zerolog.Logger, factories ClientFactories, m *metrics.Metrics, tp *sdktrace.TracerProvider) ([]core.Cluster, error) {
+	// Every registry publishes this host's details in its heartbeat.
+	info := domain.HostStatus{
+		Version:   buildinfo.Version(),
+		StartedAt: time.Now(),
+		HostIPv4:  cfg.App.HostIPv4,
+		HostIPv6:  cfg.App.HostIPv6,
+	}
+	var clusters []core.Cluster
+	switch cfg.Registry.Backend {
+	case config.RegistryBackendRedis:
+		redisClient, err := factories.RedisClientFactory(&cfg.Redis, 2*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+		a.redisClient = redisClient
+		redisReg := registry.NewRedisRegistry(redisClient, &cfg.Redis, cfg.App.Hostname, cfg.App.HeartbeatTTL, logger)
+		redisReg.SetHostStatus(info)
+		if m != nil {
+			redisReg.SetMetrics(m)
+		}
+		clusters = append(clusters, core.Cluster{Name: config.RedisClusterName, Registry: redisReg})
+	default:
+		// Each etcd cluster gets its own client and registry; the engine
+		// reconciles them independently.
+		for _, ecfg := range cfg.Etcd.ResolvedClusters() {
+			// Warn when etcd credentials would be sent over an unencrypted connection.
+			if ecfg.Username != "" && !ecfg.UsesTLS() {
+				logger.Warn().Str("cluster", ecfg.Name).Msg("etcd username/password configured without TLS or an https:// endpoint: credentials will be sent in plaintext")
+			}
+			etcdClient, err := factories.EtcdClientFactory(&ecfg.EtcdConfig, 2*time.Second)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to etcd cluster %q: %w", ecfg.Name, err)
+			}
+			a.etcdClients = append(a.etcdClients, etcdClient)
+			clusterLogger := logger.With().Str("cluster", ecfg.Name).Logger()
+			etcdReg := registry.NewEtcdRegistry(etcdClient, &ecfg.EtcdConfig, cfg.App.Hostname, cfg.App.HeartbeatTTL, clusterLogger)
+			etcdReg.SetHostStatus(info)
+			if m != nil {
+				etcdReg.SetMetrics(m)
+				etcdReg.SetCacheMetrics(m.ClusterCache(ecfg.Name))
+				etcdReg.SetHeartbeatMetrics(m.ClusterHeartbeats(ecfg.Name))
+			}
+			if tp != nil {
+				etcdReg.SetTracerProvider(tp)
+			}
+			if ecfg.WatchCache {
+				a.watchCaches = append(a.watchCaches, etcdReg)
+			}
+			clusters = append(clusters, core.Cluster{Name: ecfg.Name, Registry: etcdReg})
+		}
+	}
+	return clusters, nil
+}
+
+// newNotifier builds the webhook notifier from cfg.Notifications, counting
+// deliveries in m if set.
+func newNotifier(cfg *config.Config, logger zerolog.Logger, m *metrics.Metrics) (*notify.Notifier, error) {
+	n := cfg.Notifications
+	webhooks := make([]notify.Webhook, 0, len(n.Webhooks))
+	for _, w := range n.Webhooks {
+		webhooks = append(webhooks, notify.Webhook{Name: w.Name, URL: w.URL, Events: w.Events, Template: w.Template, Headers: w.Headers})
+	}
+	opts := []notify.Option{
+		notify.WithQueueSize(n.QueueSize),
+		notify.WithTimeout(time.Duration(n.Timeout * float64(time.Second))),
+		notify.WithRetries(n.MaxRetries,
+			time.Duration(n.RetryInitialBackoff*float64(time.Second)),
+			time.Duration(n.RetryMaxBackoff*float64(time.Second)),
+		),
+	}
+	if m != nil {
+		opts = append(opts, notify.WithDeliveryObserver(m.ObserveWebhookDelivery))
+	}
+	return notify.New(cfg.App.Hostname, webhooks, logger.With().Str("component", "notify").Logger(), opts...)
+}
+
+// tracerShutdownTimeout bounds how long Close waits to export the spans still
+// buffered.
+const tracerShutdownTimeout = 5 * time.Second
+
+// shutdownTracer flushes and stops tp, if set.
+func shutdownTracer(tp *sdktrace.TracerProvider) error {
+	if tp == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	return tp.Shutdown(ctx)
+}
+
+// newAudits opens the audit logs cfg asks for: its file, stdout, or both.
+func newAudits(cfg *config.AuditConfig) ([]*audit.Log, error) {
+	var audits []*audit.Log
+	if cfg.File != "" {
+		f, err := audit.OpenFile(cfg.File, audit.WithRotation(cfg.MaxSizeMB, cfg.MaxBackups))
+		if err != nil {
+			return nil, err
+		}
+		audits = append(audits, f)
+	}
+	if cfg.Stdout {
+		audits = append(audits, audit.Stdout())
+	}
+	return audits, nil
+}
+
+// httpAuth builds the HTTP server's authentication from cfg, reading the
+// secrets set as files.
+func httpAuth(cfg *config.HTTPConfig) (httpserver.Auth, error) {
+	token, password, err := cfg.Auth.Secrets()
+	if err != nil {
+		return httpserver.Auth{}, err
+	}
+	return httpserver.Auth{
+		Token:       token,
+		Username:    cfg.Auth.Username,
+		Password:    password,
+		ClientCerts: cfg.TLS.ClientCAFile != "",
+		Policies: map[httpserver.RouteGroup]httpserver.Policy{
+			httpserver.RouteProbes:  httpserver.Policy(cfg.Auth.Policy.Probes),
+			httpserver.RouteMetrics: httpserver.Policy(cfg.Auth.Policy.Metrics),
+			httpserver.RouteAPI:     httpserver.Policy(cfg.Auth.Policy.API),
+			httpserver.RouteAdmin:   httpserver.Policy(cfg.Auth.Policy.Admin),
+		},
+	}, nil
+}
+
+// Fleet connects to the configured registry and lists the sync instances
+// heartbeating in each cluster, without starting this host's own sync. It
+// backs the fleet subcommand.
+func Fleet(ctx context.Context, cfg *config.Config, logger zerolog.Logger, factories ClientFactories) ([]domain.ClusterFleet, error) {
+	a := &App{logger: logger}
+	defer func() { _ = a.Close() }()
+	clusters, err := a.connectClusters(cfg, logger, factories, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return core.GetFleet(ctx, clusters), nil
+}
+
 func New(cfg *config.Config, logger zerolog.Logger) (*App, error) {
 	return NewWithFactories(cfg, logger, DefaultFactories())
 }
@@ -170,9 +411,26 @@ func (a *App) Run(ctx context.Context) error {
 	if a.httpServer != nil {
 		a.httpServer.Start(ctx)
 	}
+	if a.notifier != nil {
+		a.notifier.Start(ctx)
+	}
+	for _, c := range a.watchCaches {
+		c.StartWatchCache(ctx)
+	}
 	return a.engine.Run(ctx)
 }
 
+// TriggerReconcile requests an immediate reconciliation pass.
+func (a *App) TriggerReconcile() {
+	a.engine.TriggerReconcile()
+}
+
+// OverrideBreaker lets removals blocked by the removal breaker proceed on
+// the next pass, and reports whether any were blocked.
+func (a *App) OverrideBreaker() bool {
+	return a.engine.OverrideBreaker()
+}
+
 func (a *App) Close() error {
 	var err error
 
@@ -181,16 +439,30 @@ func (a *App) Close() error {
 			err = errors.Join(err, fmt.Errorf("close docker client: %w", e))
 		}
 	}
-	if a.etcdClient != nil {
-		if e := a.etcdClient.Close(); e != nil {
+	for _, c := range a.etcdClients {
+		if e := c.Close(); e != nil {
 			err = errors.Join(err, fmt.Errorf("close etcd client: %w", e))
 		}
 	}
+	if a.redisClient != nil {
+		if e := a.redisClient.Close(); e != nil {
+			err = errors.Join(err, fmt.Errorf("close redis client: %w", e))
+		}
+	}
 	if a.httpServer != nil {
 		if e := a.httpServer.Close(); e != nil {
 			err = errors.Join(err, fmt.Errorf("close HTTP server: %w", e))
 		}
 	}
+	for _, l := range a.audits {
+		if e := l.Close(); e != nil {
+			err = errors.Join(err, fmt.Errorf("close audit log: %w", e))
+		}
+	}
+	// Last, so the spans of the shutdown itself are exported.
+	if e := shutdownTracer(a.tracer); e != nil {
+		err = errors.Join(err, fmt.Errorf("flush traces: %w", e))
+	}
 
 	return err
 }
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/httpserver"
 	dockerCli "github.com/docker/docker/client"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -28,10 +34,13 @@ func (m *mockCloseable) Close() error {
 func testConfig() *config.Config {
 	return &config.Config{
 		App: config.AppConfig{
-			DockerLabelPrefix: "coredns",
-			HostIPv4:          "192.168.1.1",
-			Hostname:          "test-host",
-			PollInterval:      5,
+			DockerLabelPrefix:       "coredns",
+			HostIPv4:                "192.168.1.1",
+			Hostname:                "test-host",
+			PollInterval:            5,
+			ReconcileSafetyInterval: 300,
+			DeregisterTimeout:       8,
+			StopGracePeriod:         10,
 		},
 		Etcd: config.EtcdConfig{
 			Endpoints:         []string{"http://localhost:2379"},
@@ -140,6 +149,171 @@ func TestNewWithFactories_MetricsEnabled(t *testing.T) {
 	}
 }
 
+func TestNewWithFactories_AdminRoutesNeedCredential(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no credential", "", http.StatusNotFound},
+		{"token", "s3cret", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.HTTP.Enabled = true
+			cfg.HTTP.ListenAddr = freePort(t)
+			cfg.HTTP.Auth.Token = tc.token
+			cfg.HTTP.Auth.Policy = config.HTTPPolicyConfig{Probes: "open", Metrics: "open", API: "auth", Admin: "auth"}
+			factories := ClientFactories{
+				DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+				EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+					return &clientv3.Client{}, nil
+				},
+			}
+
+			app, err := NewWithFactories(cfg, testLogger(), factories)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			app.httpServer.Start(ctx)
+
+			// Neither route may let an unauthenticated caller override the
+			// removal breaker.
+			for _, path := range []string{"/override-breaker", "/admin/override-breaker"} {
+				resp, err := http.Post("http://"+cfg.HTTP.ListenAddr+path, "", nil)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tc.want {
+					t.Errorf("%s: expected %d, got %d", path, tc.want, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithFactories_HTTPAuthTokenFileError(t *testing.T) {
+	cfg := testConfig()
+	cfg.HTTP.Enabled = true
+	cfg.HTTP.ListenAddr = freePort(t)
+	cfg.HTTP.Auth.TokenFile = filepath.Join(t.TempDir(), "missing")
+
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			return &clientv3.Client{}, nil
+		},
+	}
+
+	if _, err := NewWithFactories(cfg, testLogger(), factories); err == nil || !strings.Contains(err.Error(), "http.auth.token_file") {
+		t.Errorf("expected the unreadable token file to fail startup, got %v", err)
+	}
+}
+
+func TestNewWithFactories_WebhookTemplateError(t *testing.T) {
+	cfg := testConfig()
+	cfg.Notifications.Webhooks = []config.WebhookConfig{{Name: "slack", URL: "https://hooks.example.com/x", Template: "{{.Summary"}}
+
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			return &clientv3.Client{}, nil
+		},
+	}
+
+	if _, err := NewWithFactories(cfg, testLogger(), factories); err == nil || !strings.Contains(err.Error(), "notifications.webhooks[slack].template") {
+		t.Errorf("expected the bad template to fail startup, got %v", err)
+	}
+}
+
+func TestNewWithFactories_AuditFileError(t *testing.T) {
+	cfg := testConfig()
+	cfg.Audit.File = t.TempDir() // a directory cannot be opened for appending
+
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			return &clientv3.Client{}, nil
+		},
+	}
+
+	if _, err := NewWithFactories(cfg, testLogger(), factories); err == nil || !strings.Contains(err.Error(), "audit log") {
+		t.Errorf("expected an unwritable audit file to fail startup, got %v", err)
+	}
+}
+
+func TestNewAudits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	audits, err := newAudits(&config.AuditConfig{File: path, Stdout: true, MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		for _, a := range audits {
+			_ = a.Close()
+		}
+	}()
+	if len(audits) != 2 {
+		t.Errorf("expected a file and a stdout audit log, got %d", len(audits))
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the audit file created, got %v", err)
+	}
+}
+
+func TestNewWithFactories_Tracing(t *testing.T) {
+	cfg := testConfig()
+	cfg.Tracing = config.TracingConfig{Enabled: true, Endpoint: "http://127.0.0.1:4318/v1/traces", SampleRatio: 1, Timeout: 1}
+
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			return &clientv3.Client{}, nil
+		},
+	}
+
+	app, err := NewWithFactories(cfg, testLogger(), factories)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.tracer == nil {
+		t.Fatal("expected a tracer provider when tracing is enabled")
+	}
+	if err := shutdownTracer(app.tracer); err != nil {
+		t.Errorf("expected an idle provider to shut down cleanly, got %v", err)
+	}
+	if err := shutdownTracer(nil); err != nil {
+		t.Errorf("expected no error without a provider, got %v", err)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.HTTPConfig{
+		TLS: config.HTTPTLSConfig{ClientCAFile: "ca.pem"},
+		Auth: config.HTTPAuthConfig{
+			TokenFile: tokenFile,
+			Policy:    config.HTTPPolicyConfig{Probes: "open", Metrics: "open", API: "auth", Admin: "auth"},
+		},
+	}
+
+	auth, err := httpAuth(&cfg)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth.Token != "s3cret" || !auth.ClientCerts || auth.Policies[httpserver.RouteProbes] != httpserver.PolicyOpen || auth.Policies[httpserver.RouteAdmin] != httpserver.PolicyAuth {
+		t.Errorf("unexpected auth %+v", auth)
+	}
+}
+
 func TestNewWithFactories_WarnsPlaintextCredentials(t *testing.T) {
 	cfg := testConfig()
 	cfg.Etcd.Username = "admin"
@@ -228,6 +402,64 @@ func TestNewWithFactories_EtcdClientError(t *testing.T) {
 	}
 }
 
+func TestNewWithFactories_MultipleEtcdClusters(t *testing.T) {
+	cfg := testConfig()
+	cfg.Etcd.Clusters = []config.EtcdClusterConfig{
+		{Name: "site-a", Endpoints: []string{"http://etcd-a:2379"}},
+		{Name: "site-b", Endpoints: []string{"http://etcd-b:2379"}},
+	}
+
+	var endpoints []string
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			endpoints = append(endpoints, ecfg.Endpoints[0])
+			return &clientv3.Client{}, nil
+		},
+	}
+
+	app, err := NewWithFactories(cfg, testLogger(), factories)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(app.etcdClients) != 2 {
+		t.Fatalf("expected one etcd client per cluster, got %d", len(app.etcdClients))
+	}
+	if len(endpoints) != 2 || endpoints[0] != "http://etcd-a:2379" || endpoints[1] != "http://etcd-b:2379" {
+		t.Errorf("expected a client per cluster endpoint, got %v", endpoints)
+	}
+}
+
+func TestNewWithFactories_EtcdClusterErrorClosesEarlierClients(t *testing.T) {
+	cfg := testConfig()
+	cfg.Etcd.Clusters = []config.EtcdClusterConfig{
+		{Name: "site-a", Endpoints: []string{"http://etcd-a:2379"}},
+		{Name: "site-b", Endpoints: []string{"http://etcd-b:2379"}},
+	}
+
+	first := clientv3.NewCtxClient(context.Background())
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			if ecfg.Endpoints[0] == "http://etcd-b:2379" {
+				return nil, errors.New("etcd connection failed")
+			}
+			return first, nil
+		},
+	}
+
+	app, err := NewWithFactories(cfg, testLogger(), factories)
+	if err == nil || app != nil {
+		t.Fatalf("expected error and nil app, got (%v, %v)", app, err)
+	}
+	if !strings.Contains(err.Error(), `etcd cluster "site-b"`) {
+		t.Errorf("expected the error to name the failing cluster, got %v", err)
+	}
+	if first.Ctx().Err() == nil {
+		t.Error("expected the already-created site-a client to be closed")
+	}
+}
+
 func TestDefaultFactories(t *testing.T) {
 	factories := DefaultFactories()
 
@@ -237,6 +469,59 @@ func TestDefaultFactories(t *testing.T) {
 	if factories.EtcdClientFactory == nil {
 		t.Error("expected EtcdClientFactory to be set")
 	}
+	if factories.RedisClientFactory == nil {
+		t.Error("expected RedisClientFactory to be set")
+	}
+}
+
+func TestNewWithFactories_RedisBackend(t *testing.T) {
+	cfg := testConfig()
+	cfg.Registry.Backend = config.RegistryBackendRedis
+	cfg.Redis = config.RedisConfig{Address: "127.0.0.1:0", KeyPrefix: "_dns:", Zones: []string{"example.com"}}
+
+	etcdCalled := false
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			etcdCalled = true
+			return &clientv3.Client{}, nil
+		},
+		RedisClientFactory: DefaultFactories().RedisClientFactory,
+	}
+
+	app, err := NewWithFactories(cfg, testLogger(), factories)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if etcdCalled {
+		t.Error("expected no etcd client for the redis backend")
+	}
+	if app.redisClient == nil || len(app.etcdClients) != 0 {
+		t.Errorf("expected only the redis client to be wired (redis=%v, etcd=%v)", app.redisClient, app.etcdClients)
+	}
+	if err := app.redisClient.Close(); err != nil {
+		t.Errorf("close redis client: %v", err)
+	}
+}
+
+func TestNewWithFactories_RedisClientError(t *testing.T) {
+	cfg := testConfig()
+	cfg.Registry.Backend = config.RegistryBackendRedis
+
+	factories := ClientFactories{
+		DockerClientFactory: func() (*dockerCli.Client, error) { return &dockerCli.Client{}, nil },
+		RedisClientFactory: func(rcfg *config.RedisConfig, dialTimeout time.Duration) (*redis.Client, error) {
+			return nil, errors.New("redis connection failed")
+		},
+	}
+
+	app, err := NewWithFactories(cfg, testLogger(), factories)
+	if err == nil || app != nil {
+		t.Fatalf("expected error and nil app, got (%v, %v)", app, err)
+	}
+	if !strings.Contains(err.Error(), "failed to connect to redis") {
+		t.Errorf("expected redis error message, got %v", err)
+	}
 }
 
 func TestApp_Close_Success(t *testing.T) {
@@ -245,7 +530,7 @@ func TestApp_Close_Success(t *testing.T) {
 
 	app := &App{
 		dockerClient: dockerClient,
-		etcdClient:   etcdClient,
+		etcdClients:  []io.Closer{etcdClient},
 		logger:       testLogger(),
 	}
 
@@ -268,7 +553,7 @@ func TestApp_Close_DockerError(t *testing.T) {
 
 	app := &App{
 		dockerClient: dockerClient,
-		etcdClient:   etcdClient,
+		etcdClients:  []io.Closer{etcdClient},
 		logger:       testLogger(),
 	}
 
@@ -288,7 +573,7 @@ func TestApp_Close_EtcdError(t *testing.T) {
 
 	app := &App{
 		dockerClient: dockerClient,
-		etcdClient:   etcdClient,
+		etcdClients:  []io.Closer{etcdClient},
 		logger:       testLogger(),
 	}
 
@@ -308,7 +593,7 @@ func TestApp_Close_BothErrors(t *testing.T) {
 
 	app := &App{
 		dockerClient: dockerClient,
-		etcdClient:   etcdClient,
+		etcdClients:  []io.Closer{etcdClient},
 		logger:       testLogger(),
 	}
 
@@ -328,7 +613,7 @@ func TestApp_Close_BothErrors(t *testing.T) {
 func TestApp_Close_NilClients(t *testing.T) {
 	app := &App{
 		dockerClient: nil,
-		etcdClient:   nil,
+		etcdClients:  nil,
 		logger:       testLogger(),
 	}
 
@@ -342,7 +627,7 @@ func TestApp_Close_NilClients(t *testing.T) {
 func TestApp_Run(t *testing.T) {
 	app := &App{
 		dockerClient: &mockCloseable{},
-		etcdClient:   &mockCloseable{},
+		etcdClients:  []io.Closer{&mockCloseable{}},
 		engine:       nil,
 		logger:       testLogger(),
 	}
@@ -372,3 +657,34 @@ func TestNew_CallsDefaultFactories(t *testing.T) {
 	// The test passes regardless - we just want coverage of the New function
 	_ = err
 }
+
+func TestFleet_ConnectErrorClosesClients(t *testing.T) {
+	cfg := testConfig()
+	cfg.Etcd.Clusters = []config.EtcdClusterConfig{
+		{Name: "site-a", Endpoints: []string{"http://etcd-a:2379"}},
+		{Name: "site-b", Endpoints: []string{"http://etcd-b:2379"}},
+	}
+
+	first := clientv3.NewCtxClient(context.Background())
+	factories := ClientFactories{
+		// The fleet view needs no Docker connection.
+		DockerClientFactory: func() (*dockerCli.Client, error) {
+			t.Error("expected Docker not to be contacted")
+			return nil, errors.New("unexpected")
+		},
+		EtcdClientFactory: func(ecfg *config.EtcdConfig, dialTimeout time.Duration) (*clientv3.Client, error) {
+			if ecfg.Endpoints[0] == "http://etcd-b:2379" {
+				return nil, errors.New("etcd connection failed")
+			}
+			return first, nil
+		},
+	}
+
+	_, err := Fleet(context.Background(), cfg, testLogger(), factories)
+	if err == nil || !strings.Contains(err.Error(), `etcd cluster "site-b"`) {
+		t.Fatalf("expected the failing cluster to be named, got %v", err)
+	}
+	if first.Ctx().Err() == nil {
+		t.Error("expected the already-created site-a client to be closed")
+	}
+}
@@ -0,0 +1,155 @@
+// Package audit writes the engine's audit log: one JSON document per line for
+// every registry write this instance makes, saying what was written, why, and
+// at which registry revision. The log goes to its own file, rotated by size,
+// and/or to stdout, apart from the daemon's logs.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/rotate"
+)
+
+// Defaults used by OpenFile when no option overrides them. These mirror the
+// viper defaults in internal/config (audit.*); keep them in sync.
+const (
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+)
+
+var stdout io.Writer = os.Stdout
+
+// recordJSON is a record as the audit log shows it.
+type recordJSON struct {
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Value         string    `json:"value"`
+	TTL           uint32    `json:"ttl,omitempty"`
+	Hostname      string    `json:"hostname"`
+	ContainerId   string    `json:"container_id,omitempty"`
+	ContainerName string    `json:"container_name,omitempty"`
+	Created       time.Time `json:"created,omitzero"`
+	Force         bool      `json:"force,omitempty"`
+}
+
+// entryJSON is one line of the audit log.
+type entryJSON struct {
+	Time     time.Time   `json:"time"`
+	Host     string      `json:"host"`
+	Cluster  string      `json:"cluster"`
+	Op       string      `json:"op"`
+	Reason   string      `json:"reason"`
+	Detail   string      `json:"detail,omitempty"`
+	Trigger  string      `json:"trigger,omitempty"`
+	Before   *recordJSON `json:"before"`
+	After    *recordJSON `json:"after"`
+	Revision int64       `json:"revision,omitempty"`
+}
+
+func toRecordJSON(ri *domain.RecordIntent) *recordJSON {
+	if ri == nil {
+		return nil
+	}
+	return &recordJSON{
+		Name:          ri.Record.Name,
+		Type:          string(ri.Record.Kind),
+		Value:         ri.Record.Value,
+		TTL:           ri.TTL,
+		Hostname:      ri.Hostname,
+		ContainerId:   ri.ContainerId,
+		ContainerName: ri.ContainerName,
+		Created:       ri.Created,
+		Force:         ri.Force,
+	}
+}
+
+// Log writes audit entries to w as JSON lines. It implements the engine's
+// audit sink and is safe for concurrent use.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// New returns a Log writing to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Stdout returns a Log writing to the process's stdout.
+func Stdout() *Log {
+	return New(stdout)
+}
+
+// FileOption configures the file of OpenFile.
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	maxSizeMB, maxBackups int
+}
+
+// WithRotation rotates the file once it would exceed maxSizeMB megabytes,
+// keeping maxBackups rotated files. maxSizeMB 0 never rotates.
+func WithRotation(maxSizeMB, maxBackups int) FileOption {
+	return func(o *fileOptions) {
+		if maxSizeMB >= 0 {
+			o.maxSizeMB = maxSizeMB
+		}
+		if maxBackups >= 0 {
+			o.maxBackups = maxBackups
+		}
+	}
+}
+
+// OpenFile returns a Log appending to the file at path, rotated by size.
+// Close closes the file.
+func OpenFile(path string, opts ...FileOption) (*Log, error) {
+	o := fileOptions{maxSizeMB: defaultMaxSizeMB, maxBackups: defaultMaxBackups}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := rotate.Open(path, o.maxSizeMB, o.maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	return &Log{w: f, c: f}, nil
+}
+
+// Audit appends e to the log as one line.
+func (l *Log) Audit(e domain.AuditEntry) error {
+	line, err := json.Marshal(entryJSON{
+		Time:     e.Time,
+		Host:     e.Host,
+		Cluster:  e.Cluster,
+		Op:       string(e.Op),
+		Reason:   e.Reason,
+		Detail:   e.Detail,
+		Trigger:  e.Trigger,
+		Before:   toRecordJSON(e.Before),
+		After:    toRecordJSON(e.After),
+		Revision: e.Revision,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(line)
+	return err
+}
+
+// Close closes the file of a Log returned by OpenFile; it is a no-op for the
+// others.
+func (l *Log) Close() error {
+	if l.c == nil {
+		return nil
+	}
+	return l.c.Close()
+}
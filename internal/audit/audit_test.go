@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func intent(name, value, host string) *domain.RecordIntent {
+	return &domain.RecordIntent{
+		Record:        domain.Record{Name: name, Kind: domain.RecordA, Value: value},
+		Hostname:      host,
+		ContainerName: "web",
+	}
+}
+
+var eviction = domain.AuditEntry{
+	Time:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	Host:     "host-a",
+	Cluster:  "default",
+	Op:       domain.MutationRemove,
+	Reason:   string(domain.RemovalEvicted),
+	Detail:   "forced",
+	Trigger:  "event",
+	Before:   intent("app.example.com", "10.0.0.2", "host-b"),
+	After:    intent("app.example.com", "10.0.0.1", "host-a"),
+	Revision: 42,
+}
+
+func TestLog_WritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+
+	if err := l.Audit(eviction); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Audit(domain.AuditEntry{Op: domain.MutationRegister, Reason: string(domain.RegistrationContainer), After: intent("b.example.com", "10.0.0.3", "host-a")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("expected a JSON line, got %s", lines[0])
+	}
+	before, _ := got["before"].(map[string]any)
+	after, _ := got["after"].(map[string]any)
+	if got["op"] != "remove" || got["reason"] != "evicted" || got["revision"] != float64(42) || got["time"] != "2026-01-02T03:04:05Z" ||
+		before["hostname"] != "host-b" || after["value"] != "10.0.0.1" {
+		t.Errorf("unexpected entry %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"before":null`) {
+		t.Errorf("expected a registration to have no before, got %s", lines[1])
+	}
+}
+
+func TestStdout(t *testing.T) {
+	var buf bytes.Buffer
+	old := stdout
+	stdout = &buf
+	defer func() { stdout = old }()
+
+	if err := Stdout().Audit(eviction); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+		t.Errorf("expected a JSON line on stdout, got %q", buf.String())
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	l, err := OpenFile(path, WithRotation(1, 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = l.Audit(eviction)
+	if err := l.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"revision":42`) {
+		t.Errorf("expected the entry in the file, got %q, %v", b, err)
+	}
+	if err := l.Audit(eviction); err == nil {
+		t.Error("expected a write after Close to fail")
+	}
+}
+
+func TestOpenFile_Error(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenFile(dir); err == nil {
+		t.Error("expected an error opening a directory")
+	}
+}
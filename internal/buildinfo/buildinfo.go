@@ -0,0 +1,24 @@
+// Package buildinfo reports the version of the running binary.
+package buildinfo
+
+import "runtime/debug"
+
+// version is set at build time with
+// -ldflags "-X github.com/auto-dns/docker-coredns-sync/internal/buildinfo.version=<version>".
+var version string
+
+// Version returns the version the binary was built as: the one stamped in at
+// link time, else the module version recorded by `go install`, else "dev".
+func Version() string {
+	if version != "" {
+		return version
+	}
+	return moduleVersion(debug.ReadBuildInfo())
+}
+
+func moduleVersion(info *debug.BuildInfo, ok bool) string {
+	if ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
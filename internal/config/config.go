@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,20 +15,49 @@ import (
 
 // Config is the top-level configuration struct.
 type Config struct {
-	App     AppConfig     `mapstructure:"app"`
-	Etcd    EtcdConfig    `mapstructure:"etcd"`
-	Logging LoggingConfig `mapstructure:"log"`
-	HTTP    HTTPConfig    `mapstructure:"http"`
-	Metrics MetricsConfig `mapstructure:"metrics"`
-	Docker  DockerConfig  `mapstructure:"docker"`
+	App      AppConfig      `mapstructure:"app"`
+	Registry RegistryConfig `mapstructure:"registry"`
+	Etcd     EtcdConfig     `mapstructure:"etcd"`
+	Redis    RedisConfig    `mapstructure:"redis"`
+	Logging  LoggingConfig  `mapstructure:"log"`
+	HTTP     HTTPConfig     `mapstructure:"http"`
+	Metrics  MetricsConfig  `mapstructure:"metrics"`
+	Docker   DockerConfig   `mapstructure:"docker"`
+
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	Audit         AuditConfig         `mapstructure:"audit"`
+	Tracing       TracingConfig       `mapstructure:"tracing"`
 }
 
+// Registry backends selectable via registry.backend.
+const (
+	RegistryBackendEtcd  = "etcd"
+	RegistryBackendRedis = "redis"
+)
+
+// RegistryConfig selects the store records are published to. The etcd backend
+// writes the SkyDNS layout read by the CoreDNS etcd plugin; the redis backend
+// writes the hash layout read by the external coredns-redis plugin.
+type RegistryConfig struct {
+	Backend string `mapstructure:"backend"`
+}
+
+// RedisMetaKeyPrefix is the Redis key prefix under which per-host heartbeat and
+// lock keys are written. validate() enforces that redis.key_prefix does not
+// match it, or the coredns-redis plugin would load these keys as zones.
+const RedisMetaKeyPrefix = "docker-coredns-sync:"
+
 // HeartbeatKeyPrefix is the etcd key prefix under which per-host liveness
 // (heartbeat) keys are written. It lives deliberately outside etcd.path_prefix
 // so CoreDNS never serves these keys and record listing never parses them;
 // validate() enforces that the two prefixes do not overlap.
 const HeartbeatKeyPrefix = "/docker-coredns-sync/heartbeat"
 
+// GCLeaderKeyPrefix is the etcd key prefix of the election that picks the one
+// host running cross-host garbage collection. Like HeartbeatKeyPrefix it must
+// not overlap etcd.path_prefix.
+const GCLeaderKeyPrefix = "/docker-coredns-sync/gc-leader"
+
 // DockerConfig configures the Docker event subscription, including the
 // reconnect behavior when the event stream drops.
 type DockerConfig struct {
@@ -39,15 +69,313 @@ type DockerConfig struct {
 // HTTPConfig configures the auxiliary HTTP server that serves the
 // health/readiness and metrics endpoints.
 type HTTPConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	ListenAddr string `mapstructure:"listen_addr"`
+	Enabled    bool           `mapstructure:"enabled"`
+	ListenAddr string         `mapstructure:"listen_addr"`
+	TLS        HTTPTLSConfig  `mapstructure:"tls"`
+	Auth       HTTPAuthConfig `mapstructure:"auth"`
+	// EventsBufferSize is how many events a client of /api/v1/events may fall
+	// behind by before events are dropped for it.
+	EventsBufferSize int `mapstructure:"events_buffer_size"`
+}
+
+// HTTPTLSConfig serves the HTTP server over TLS. With ClientCAFile set, client
+// certificates signed by one of its CAs are verified and authenticate the
+// request; RequireClientCert rejects any connection without one.
+type HTTPTLSConfig struct {
+	CertFile          string `mapstructure:"cert_file"`
+	KeyFile           string `mapstructure:"key_file"`
+	ClientCAFile      string `mapstructure:"client_ca_file"`
+	RequireClientCert bool   `mapstructure:"require_client_cert"`
+}
+
+// Enabled reports whether the HTTP server is served over TLS.
+func (t HTTPTLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// HTTP route policies selectable via http.auth.policy.*.
+const (
+	HTTPPolicyOpen = "open"
+	HTTPPolicyAuth = "auth"
+)
+
+// HTTPAuthConfig holds the credentials the HTTP server accepts — a bearer
+// token, a basic-auth user, or both — and which routes require them. Secrets
+// can be read from a file instead, such as a Docker secret; the file's
+// trailing newline is ignored.
+type HTTPAuthConfig struct {
+	Token        string           `mapstructure:"token"`
+	TokenFile    string           `mapstructure:"token_file"`
+	Username     string           `mapstructure:"username"`
+	Password     string           `mapstructure:"password"`
+	PasswordFile string           `mapstructure:"password_file"`
+	Policy       HTTPPolicyConfig `mapstructure:"policy"`
+}
+
+// HTTPPolicyConfig sets, per group of routes, whether a request must be
+// authenticated ("auth") or not ("open"). Policies only apply once a
+// credential or client CA is configured; until then every route is open,
+// except that the /admin routes are not served.
+type HTTPPolicyConfig struct {
+	// Probes covers /healthz and /readyz.
+	Probes string `mapstructure:"probes"`
+	// Metrics covers /metrics.
+	Metrics string `mapstructure:"metrics"`
+	// API covers /fleet and the /api/v1 routes.
+	API string `mapstructure:"api"`
+	// Admin covers the /admin routes and /override-breaker.
+	Admin string `mapstructure:"admin"`
+}
+
+// Configured reports whether a token or a basic-auth user is set.
+func (a HTTPAuthConfig) Configured() bool {
+	return a.Token != "" || a.TokenFile != "" || a.Username != ""
+}
+
+// Secrets returns the bearer token and basic-auth password, reading each from
+// its file when one is set.
+func (a HTTPAuthConfig) Secrets() (token, password string, err error) {
+	token, err = secretValue(a.Token, a.TokenFile)
+	if err != nil {
+		return "", "", fmt.Errorf("read http.auth.token_file: %w", err)
+	}
+	password, err = secretValue(a.Password, a.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("read http.auth.password_file: %w", err)
+	}
+	return token, password, nil
+}
+
+// secretValue returns value, or the contents of file without its trailing
+// newline when file is set.
+func secretValue(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimRight(string(b), "\r\n")
+	if v == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return v, nil
+}
+
+// ServerTLS builds the *tls.Config the HTTP server is served with, or returns
+// (nil, nil) when TLS is not enabled.
+func (t HTTPTLSConfig) ServerTLS() (*tls.Config, error) {
+	if !t.Enabled() {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load http server keypair: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read http client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in http client CA file %q", t.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if t.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// validate checks that the TLS files come in usable combinations.
+func (t HTTPTLSConfig) validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("http.tls.cert_file and http.tls.key_file must be set together")
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		return fmt.Errorf("http.tls.client_ca_file requires http.tls.cert_file and http.tls.key_file")
+	}
+	if t.RequireClientCert && t.ClientCAFile == "" {
+		return fmt.Errorf("http.tls.require_client_cert requires http.tls.client_ca_file")
+	}
+	return nil
+}
+
+// validate checks that each secret has one source, that a basic-auth user
+// has a password, and that every policy is known.
+func (a HTTPAuthConfig) validate() error {
+	if a.Token != "" && a.TokenFile != "" {
+		return fmt.Errorf("http.auth.token and http.auth.token_file are mutually exclusive")
+	}
+	if a.Password != "" && a.PasswordFile != "" {
+		return fmt.Errorf("http.auth.password and http.auth.password_file are mutually exclusive")
+	}
+	hasPassword := a.Password != "" || a.PasswordFile != ""
+	if a.Username == "" && hasPassword {
+		return fmt.Errorf("http.auth.password requires http.auth.username")
+	}
+	if a.Username != "" && !hasPassword {
+		return fmt.Errorf("http.auth.username requires http.auth.password or http.auth.password_file")
+	}
+	for key, policy := range map[string]string{
+		"probes":  a.Policy.Probes,
+		"metrics": a.Policy.Metrics,
+		"api":     a.Policy.API,
+		"admin":   a.Policy.Admin,
+	} {
+		if policy != HTTPPolicyOpen && policy != HTTPPolicyAuth {
+			return fmt.Errorf("http.auth.policy.%s must be %q or %q, got: %q", key, HTTPPolicyOpen, HTTPPolicyAuth, policy)
+		}
+	}
+	return nil
+}
+
+// NotificationsConfig configures the outbound webhooks notified of changes.
+// The delivery settings are shared by every webhook; each has its own queue of
+// QueueSize notifications.
+type NotificationsConfig struct {
+	Webhooks            []WebhookConfig `mapstructure:"webhooks"`
+	QueueSize           int             `mapstructure:"queue_size"`
+	Timeout             float64         `mapstructure:"timeout"` // seconds
+	MaxRetries          int             `mapstructure:"max_retries"`
+	RetryInitialBackoff float64         `mapstructure:"retry_initial_backoff"` // seconds
+	RetryMaxBackoff     float64         `mapstructure:"retry_max_backoff"`     // seconds
+}
+
+// WebhookConfig is one webhook. Events selects the notifications sent to it
+// (all of conflict, eviction and gc when empty) and Template renders the
+// request body (a JSON document when empty).
+type WebhookConfig struct {
+	Name     string            `mapstructure:"name"`
+	URL      string            `mapstructure:"url"`
+	Events   []string          `mapstructure:"events"`
+	Template string            `mapstructure:"template"`
+	Headers  map[string]string `mapstructure:"headers"`
+}
+
+// validate checks every webhook and the delivery settings. Webhook names must
+// be unique, as they label the delivery metrics.
+func (n *NotificationsConfig) validate() error {
+	seen := make(map[string]struct{}, len(n.Webhooks))
+	for i, w := range n.Webhooks {
+		if !isValidClusterName(w.Name) {
+			return fmt.Errorf("notifications.webhooks[%d].name must be non-empty and contain only letters, digits, '-' and '_', got: %q", i, w.Name)
+		}
+		if _, dup := seen[w.Name]; dup {
+			return fmt.Errorf("notifications.webhooks contains duplicate name %q", w.Name)
+		}
+		seen[w.Name] = struct{}{}
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notifications.webhooks[%s].url must be an http or https URL, got: %q", w.Name, w.URL)
+		}
+	}
+	if n.QueueSize <= 0 {
+		return fmt.Errorf("notifications.queue_size must be greater than 0")
+	}
+	if n.Timeout <= 0 {
+		return fmt.Errorf("notifications.timeout must be greater than 0")
+	}
+	if n.MaxRetries < 0 {
+		return fmt.Errorf("notifications.max_retries cannot be negative")
+	}
+	if n.RetryInitialBackoff <= 0 {
+		return fmt.Errorf("notifications.retry_initial_backoff must be greater than 0")
+	}
+	if n.RetryMaxBackoff < n.RetryInitialBackoff {
+		return fmt.Errorf("notifications.retry_max_backoff must be >= notifications.retry_initial_backoff")
+	}
+	return nil
+}
+
+// AuditConfig configures the audit log of every registry write this instance
+// makes, as JSON lines. File is appended to and rotated once it would exceed
+// MaxSizeMB, keeping MaxBackups rotated files; Stdout writes the log to stdout
+// as well, which the daemon's own logs must then leave. Both are off by
+// default.
+type AuditConfig struct {
+	File       string `mapstructure:"file"`
+	Stdout     bool   `mapstructure:"stdout"`
+	MaxSizeMB  int    `mapstructure:"max_size_mb"`
+	MaxBackups int    `mapstructure:"max_backups"`
+}
+
+// Enabled reports whether the audit log goes anywhere.
+func (a *AuditConfig) Enabled() bool {
+	return a.File != "" || a.Stdout
+}
+
+// validate checks the audit settings against logOutput, where the daemon's
+// own logs go, so the two never interleave on stdout.
+func (a *AuditConfig) validate(logOutput string) error {
+	if a.Stdout && logOutput == LogOutputStdout {
+		return fmt.Errorf("audit.stdout cannot be set while log.output is %q; send logs to %q or a %q", LogOutputStdout, LogOutputStderr, LogOutputFile)
+	}
+	if a.MaxSizeMB < 0 {
+		return fmt.Errorf("audit.max_size_mb cannot be negative")
+	}
+	if a.MaxBackups < 0 {
+		return fmt.Errorf("audit.max_backups cannot be negative")
+	}
+	return nil
+}
+
+// TracingConfig configures OpenTelemetry tracing, exported over OTLP/HTTP.
+// Endpoint is the full URL spans are posted to; when empty the exporter
+// follows the OTEL_EXPORTER_OTLP_* environment variables. SampleRatio is the
+// fraction of traces kept, and Headers are sent with every export, e.g. for
+// authentication.
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint"`
+	SampleRatio float64           `mapstructure:"sample_ratio"`
+	Timeout     float64           `mapstructure:"timeout"` // seconds
+	Headers     map[string]string `mapstructure:"headers"`
+}
+
+func (t *TracingConfig) validate() error {
+	if t.Endpoint != "" {
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tracing.endpoint must be an http or https URL, got: %q", t.Endpoint)
+		}
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got: %v", t.SampleRatio)
+	}
+	if t.Timeout <= 0 {
+		return fmt.Errorf("tracing.timeout must be greater than 0")
+	}
+	return nil
 }
 
 // MetricsConfig gates the Prometheus /metrics endpoint, which is served on the
 // shared HTTP server (see HTTPConfig). When enabled, the HTTP server starts
-// even if http.enabled is false.
+// even if http.enabled is false. MaxHosts and MaxContainers bound the distinct
+// hosts and containers the per-host and per-container metrics report, the
+// others being folded into one series; 0 means no limit.
 type MetricsConfig struct {
-	Enabled bool `mapstructure:"enabled"`
+	Enabled       bool `mapstructure:"enabled"`
+	MaxHosts      int  `mapstructure:"max_hosts"`
+	MaxContainers int  `mapstructure:"max_containers"`
+}
+
+func (m *MetricsConfig) validate() error {
+	if m.MaxHosts < 0 {
+		return fmt.Errorf("metrics.max_hosts cannot be negative")
+	}
+	if m.MaxContainers < 0 {
+		return fmt.Errorf("metrics.max_containers cannot be negative")
+	}
+	return nil
 }
 
 // AppConfig holds application-specific configuration.
@@ -56,7 +384,42 @@ type AppConfig struct {
 	HostIPv4          string `mapstructure:"host_ipv4"`
 	HostIPv6          string `mapstructure:"host_ipv6"`
 	Hostname          string `mapstructure:"hostname"`
-	PollInterval      int    `mapstructure:"poll_interval"`
+	// PollInterval is how often, in seconds, a failed reconciliation pass is
+	// retried, e.g. while the registry is unreachable. Readiness fails after
+	// three retries without success.
+	PollInterval int `mapstructure:"poll_interval"`
+	// ReconcileSafetyInterval is the period, in seconds, of the safety-net
+	// reconciliation pass that repairs drift container events cannot see.
+	// Events trigger their own passes (see ReconcileDebounce), so it can be
+	// minutes long.
+	ReconcileSafetyInterval float64 `mapstructure:"reconcile_safety_interval"`
+	// ReconcileDebounce is how long, in seconds, a container event waits for
+	// further events before triggering a reconciliation pass, so a burst of
+	// events (e.g. a compose project starting) is applied in one pass.
+	ReconcileDebounce float64 `mapstructure:"reconcile_debounce"`
+	// ReconcileMaxDelay caps, in seconds, how long a steady stream of events
+	// can postpone the pass triggered by the first of them.
+	ReconcileMaxDelay float64 `mapstructure:"reconcile_max_delay"`
+	// GCInterval is the minimum time, in seconds, between two cross-host
+	// garbage collections of orphaned records. Zero collects on every pass.
+	// With etcd, only the host elected GC leader collects.
+	GCInterval float64 `mapstructure:"gc_interval"`
+	// StartupGrace is how long, in seconds, this host waits after starting
+	// before removing its own stale records, on top of waiting for the
+	// initial container listing to complete. Additions are not delayed.
+	StartupGrace float64 `mapstructure:"startup_grace"`
+	// DeregisterOnShutdown, when true, makes a graceful shutdown remove
+	// every record this host owns, e.g. to drain a host being
+	// decommissioned. By default records are kept across restarts.
+	DeregisterOnShutdown bool `mapstructure:"deregister_on_shutdown"`
+	// DeregisterTimeout bounds, in seconds, how long removing this host's
+	// records on shutdown may take, across all clusters. It must stay below
+	// StopGracePeriod, or the process is killed while deregistering.
+	DeregisterTimeout float64 `mapstructure:"deregister_timeout"`
+	// StopGracePeriod is how long, in seconds, the container runtime waits
+	// after SIGTERM before killing the process: 10 for `docker stop`, or the
+	// service's stop_grace_period in Compose.
+	StopGracePeriod float64 `mapstructure:"stop_grace_period"`
 	// DryRun, when true, makes the reconciliation loop log the planned
 	// changes without writing to or removing anything from etcd.
 	DryRun bool `mapstructure:"dry_run"`
@@ -69,6 +432,41 @@ type AppConfig struct {
 	// records owned by a host that has stopped renewing. Heartbeating is always
 	// on; this value must be greater than zero.
 	HeartbeatTTL int `mapstructure:"heartbeat_ttl"`
+	// Breaker caps how many records one reconciliation pass may remove.
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
+
+// BreakerConfig holds the limits of the removal circuit breaker. A pass that
+// would remove more of this host's records, or more orphaned records of dead
+// hosts, than allowed applies everything but those removals until an operator
+// overrides the breaker. A zero limit is disabled. Removals replaced by a
+// record added under the same name do not count.
+type BreakerConfig struct {
+	// MaxRemovals and MaxRemovalPercent limit the removals of this host's
+	// own records, the latter as a percentage of the records it owns.
+	MaxRemovals       int     `mapstructure:"max_removals"`
+	MaxRemovalPercent float64 `mapstructure:"max_removal_percent"`
+	// MaxGCRemovals and MaxGCRemovalPercent limit cross-host garbage
+	// collection, the latter as a percentage of the records other hosts own.
+	MaxGCRemovals       int     `mapstructure:"max_gc_removals"`
+	MaxGCRemovalPercent float64 `mapstructure:"max_gc_removal_percent"`
+}
+
+// validate checks the breaker limits.
+func (b BreakerConfig) validate() error {
+	if b.MaxRemovals < 0 {
+		return fmt.Errorf("app.breaker.max_removals cannot be negative")
+	}
+	if b.MaxRemovalPercent < 0 || b.MaxRemovalPercent > 100 {
+		return fmt.Errorf("app.breaker.max_removal_percent must be between 0 and 100")
+	}
+	if b.MaxGCRemovals < 0 {
+		return fmt.Errorf("app.breaker.max_gc_removals cannot be negative")
+	}
+	if b.MaxGCRemovalPercent < 0 || b.MaxGCRemovalPercent > 100 {
+		return fmt.Errorf("app.breaker.max_gc_removal_percent must be between 0 and 100")
+	}
+	return nil
 }
 
 // EtcdConfig holds etcd-related configuration.
@@ -81,6 +479,72 @@ type EtcdConfig struct {
 	LockTTL           float64       `mapstructure:"lock_ttl"`
 	LockTimeout       float64       `mapstructure:"lock_timeout"`
 	LockRetryInterval float64       `mapstructure:"lock_retry_interval"`
+	// LeaseRecords attaches every record this host writes to its heartbeat
+	// lease, so etcd deletes them once the host stops renewing it — even when
+	// no peer is left to garbage-collect them.
+	LeaseRecords bool `mapstructure:"lease_records"`
+	// WatchCache serves List from an in-memory mirror of path_prefix that is
+	// kept current by an etcd watch, instead of reading the whole prefix on
+	// every reconciliation pass.
+	WatchCache bool `mapstructure:"watch_cache"`
+	// Clusters, when non-empty, mirrors every record to each of the named etcd
+	// clusters instead of the single cluster described by Endpoints. Settings
+	// a cluster leaves unset are inherited from the fields above.
+	Clusters []EtcdClusterConfig `mapstructure:"clusters"`
+}
+
+// EtcdClusterConfig describes one named etcd cluster records are mirrored to.
+// PathPrefix, credentials and TLS fall back to the top-level etcd settings when
+// empty; the lock settings are always shared.
+type EtcdClusterConfig struct {
+	Name       string        `mapstructure:"name"`
+	Endpoints  []string      `mapstructure:"endpoints"`
+	PathPrefix string        `mapstructure:"path_prefix"`
+	Username   string        `mapstructure:"username"`
+	Password   string        `mapstructure:"password"`
+	TLS        EtcdTLSConfig `mapstructure:"tls"`
+}
+
+// NamedEtcdConfig is a fully resolved etcd cluster configuration.
+type NamedEtcdConfig struct {
+	Name string
+	EtcdConfig
+}
+
+// DefaultEtcdClusterName names the single cluster used when etcd.clusters is
+// not set.
+const DefaultEtcdClusterName = "default"
+
+// RedisClusterName names the single cluster of the redis registry backend.
+const RedisClusterName = "redis"
+
+// ResolvedClusters returns the etcd clusters records are published to, each
+// with the top-level defaults applied. Without etcd.clusters it returns the
+// top-level configuration as a single cluster named DefaultEtcdClusterName.
+func (c *EtcdConfig) ResolvedClusters() []NamedEtcdConfig {
+	base := *c
+	base.Clusters = nil
+	if len(c.Clusters) == 0 {
+		return []NamedEtcdConfig{{Name: DefaultEtcdClusterName, EtcdConfig: base}}
+	}
+	out := make([]NamedEtcdConfig, 0, len(c.Clusters))
+	for _, cl := range c.Clusters {
+		resolved := base
+		resolved.Endpoints = cl.Endpoints
+		if cl.PathPrefix != "" {
+			resolved.PathPrefix = cl.PathPrefix
+		}
+		// Credentials are inherited as a pair so a cluster never combines its
+		// own username with another cluster's password.
+		if cl.Username != "" || cl.Password != "" {
+			resolved.Username, resolved.Password = cl.Username, cl.Password
+		}
+		if cl.TLS.Configured() {
+			resolved.TLS = cl.TLS
+		}
+		out = append(out, NamedEtcdConfig{Name: cl.Name, EtcdConfig: resolved})
+	}
+	return out
 }
 
 // EtcdTLSConfig configures TLS for the etcd client connection. It is required
@@ -154,9 +618,83 @@ func (c *EtcdConfig) ClientTLS() (*tls.Config, error) {
 	return cfg, nil
 }
 
-// LoggingConfig holds the logging-related configuration.
+// RedisConfig holds the configuration of the Redis registry backend. Records
+// are written in the coredns-redis plugin layout: one hash per zone, keyed
+// KeyPrefix+zone+KeySuffix, with one field per name relative to the zone.
+type RedisConfig struct {
+	Address  string `mapstructure:"address"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// KeyPrefix and KeySuffix must match the plugin's key_prefix/key_suffix.
+	KeyPrefix string `mapstructure:"key_prefix"`
+	KeySuffix string `mapstructure:"key_suffix"`
+	// Zones lists the zones served by the plugin. A record is written to the
+	// longest zone its name falls under; names outside every zone are rejected.
+	Zones             []string `mapstructure:"zones"`
+	LockTTL           float64  `mapstructure:"lock_ttl"`
+	LockTimeout       float64  `mapstructure:"lock_timeout"`
+	LockRetryInterval float64  `mapstructure:"lock_retry_interval"`
+}
+
+// Log formats selectable via log.format.
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// Log outputs selectable via log.output.
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+)
+
+// LoggingConfig holds the logging-related configuration. Format selects
+// human-readable console lines or one JSON document per line; Output where
+// they go. With LogOutputFile, File is appended to and rotated once it would
+// exceed MaxSizeMB, keeping MaxBackups rotated files. SampleEvery, when above
+// 1, keeps only one in SampleEvery debug and trace messages once SampleBurst
+// of them have been logged in the current second.
 type LoggingConfig struct {
-	Level string `mapstructure:"level"`
+	Level       string `mapstructure:"level"`
+	Format      string `mapstructure:"format"`
+	Output      string `mapstructure:"output"`
+	File        string `mapstructure:"file"`
+	MaxSizeMB   int    `mapstructure:"max_size_mb"`
+	MaxBackups  int    `mapstructure:"max_backups"`
+	SampleEvery int    `mapstructure:"sample_every"`
+	SampleBurst int    `mapstructure:"sample_burst"`
+}
+
+func (l *LoggingConfig) validate() error {
+	switch l.Format {
+	case LogFormatConsole, LogFormatJSON:
+	default:
+		return fmt.Errorf("log.format must be %q or %q, got: %q", LogFormatConsole, LogFormatJSON, l.Format)
+	}
+	switch l.Output {
+	case LogOutputStdout, LogOutputStderr:
+	case LogOutputFile:
+		if strings.TrimSpace(l.File) == "" {
+			return fmt.Errorf("log.file cannot be empty when log.output is %q", LogOutputFile)
+		}
+	default:
+		return fmt.Errorf("log.output must be %q, %q or %q, got: %q", LogOutputStdout, LogOutputStderr, LogOutputFile, l.Output)
+	}
+	if l.MaxSizeMB < 0 {
+		return fmt.Errorf("log.max_size_mb cannot be negative")
+	}
+	if l.MaxBackups < 0 {
+		return fmt.Errorf("log.max_backups cannot be negative")
+	}
+	if l.SampleEvery < 0 {
+		return fmt.Errorf("log.sample_every cannot be negative")
+	}
+	if l.SampleBurst < 0 {
+		return fmt.Errorf("log.sample_burst cannot be negative")
+	}
+	return nil
 }
 
 // HTTPServerEnabled reports whether the auxiliary HTTP server should run, i.e.
@@ -213,27 +751,88 @@ func initConfig() error {
 	viper.SetDefault("app.host_ipv6", "")
 	viper.SetDefault("app.hostname", "")
 	viper.SetDefault("app.poll_interval", 5)
+	viper.SetDefault("app.reconcile_safety_interval", 300.0)
+	viper.SetDefault("app.reconcile_debounce", 0.25)
+	viper.SetDefault("app.reconcile_max_delay", 2.0)
+	viper.SetDefault("app.gc_interval", 30.0)
+	viper.SetDefault("app.startup_grace", 0.0)
+	viper.SetDefault("app.deregister_on_shutdown", false)
+	viper.SetDefault("app.deregister_timeout", 8.0)
+	viper.SetDefault("app.stop_grace_period", 10.0)
 	viper.SetDefault("app.dry_run", false)
 	viper.SetDefault("app.record_ttl", 0)
 	viper.SetDefault("app.heartbeat_ttl", 30)
+	viper.SetDefault("app.breaker.max_removals", 0)
+	viper.SetDefault("app.breaker.max_removal_percent", 0.0)
+	viper.SetDefault("app.breaker.max_gc_removals", 0)
+	viper.SetDefault("app.breaker.max_gc_removal_percent", 0.0)
+	viper.SetDefault("registry.backend", RegistryBackendEtcd)
 	viper.SetDefault("etcd.endpoints", []string{"http://localhost:2379"})
 	viper.SetDefault("etcd.path_prefix", "/skydns")
 	viper.SetDefault("etcd.lock_ttl", 5.0)
 	viper.SetDefault("etcd.lock_timeout", 2.0)
 	viper.SetDefault("etcd.lock_retry_interval", 0.1)
+	viper.SetDefault("redis.address", "localhost:6379")
+	viper.SetDefault("redis.username", "")
+	viper.SetDefault("redis.password", "")
+	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.key_prefix", "_dns:")
+	viper.SetDefault("redis.key_suffix", "")
+	viper.SetDefault("redis.zones", []string{})
+	viper.SetDefault("redis.lock_ttl", 5.0)
+	viper.SetDefault("redis.lock_timeout", 2.0)
+	viper.SetDefault("redis.lock_retry_interval", 0.1)
 	viper.SetDefault("log.level", "INFO")
+	viper.SetDefault("log.format", LogFormatConsole)
+	viper.SetDefault("log.output", LogOutputStdout)
+	viper.SetDefault("log.file", "")
+	viper.SetDefault("log.max_size_mb", 100)
+	viper.SetDefault("log.max_backups", 5)
+	viper.SetDefault("log.sample_every", 0)
+	viper.SetDefault("log.sample_burst", 100)
 	viper.SetDefault("etcd.username", "")
 	viper.SetDefault("etcd.password", "")
 	viper.SetDefault("etcd.tls.ca_file", "")
 	viper.SetDefault("etcd.tls.cert_file", "")
 	viper.SetDefault("etcd.tls.key_file", "")
 	viper.SetDefault("etcd.tls.insecure_skip_verify", false)
+	viper.SetDefault("etcd.lease_records", false)
+	viper.SetDefault("etcd.watch_cache", false)
 	viper.SetDefault("http.enabled", false)
 	viper.SetDefault("http.listen_addr", ":8080")
+	viper.SetDefault("http.tls.cert_file", "")
+	viper.SetDefault("http.tls.key_file", "")
+	viper.SetDefault("http.tls.client_ca_file", "")
+	viper.SetDefault("http.tls.require_client_cert", false)
+	viper.SetDefault("http.auth.token", "")
+	viper.SetDefault("http.auth.token_file", "")
+	viper.SetDefault("http.auth.username", "")
+	viper.SetDefault("http.auth.password", "")
+	viper.SetDefault("http.auth.password_file", "")
+	viper.SetDefault("http.auth.policy.probes", HTTPPolicyOpen)
+	viper.SetDefault("http.auth.policy.metrics", HTTPPolicyOpen)
+	viper.SetDefault("http.auth.policy.api", HTTPPolicyAuth)
+	viper.SetDefault("http.auth.policy.admin", HTTPPolicyAuth)
+	viper.SetDefault("http.events_buffer_size", 256)
 	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.max_hosts", 100)
+	viper.SetDefault("metrics.max_containers", 100)
 	viper.SetDefault("docker.event_buffer_size", 100)
 	viper.SetDefault("docker.reconnect_initial_backoff", 1.0)
 	viper.SetDefault("docker.reconnect_max_backoff", 30.0)
+	viper.SetDefault("notifications.queue_size", 100)
+	viper.SetDefault("notifications.timeout", 5.0)
+	viper.SetDefault("notifications.max_retries", 5)
+	viper.SetDefault("notifications.retry_initial_backoff", 1.0)
+	viper.SetDefault("notifications.retry_max_backoff", 60.0)
+	viper.SetDefault("audit.file", "")
+	viper.SetDefault("audit.stdout", false)
+	viper.SetDefault("audit.max_size_mb", 100)
+	viper.SetDefault("audit.max_backups", 5)
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.endpoint", "")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("tracing.timeout", 10.0)
 
 	// Read config file if it exists
 	if err := viper.ReadInConfig(); err != nil {
@@ -262,68 +861,207 @@ func (c *Config) validate() error {
 	if c.App.PollInterval <= 0 {
 		return fmt.Errorf("app.poll_interval must be greater than 0")
 	}
+	if c.App.ReconcileSafetyInterval <= 0 {
+		return fmt.Errorf("app.reconcile_safety_interval must be greater than 0")
+	}
+	if c.App.ReconcileDebounce < 0 {
+		return fmt.Errorf("app.reconcile_debounce cannot be negative")
+	}
+	if c.App.ReconcileMaxDelay < c.App.ReconcileDebounce {
+		return fmt.Errorf("app.reconcile_max_delay must be at least app.reconcile_debounce")
+	}
+	if c.App.GCInterval < 0 {
+		return fmt.Errorf("app.gc_interval cannot be negative")
+	}
+	if c.App.StartupGrace < 0 {
+		return fmt.Errorf("app.startup_grace cannot be negative")
+	}
+	if c.App.DeregisterTimeout <= 0 {
+		return fmt.Errorf("app.deregister_timeout must be greater than 0")
+	}
+	if c.App.DeregisterTimeout >= c.App.StopGracePeriod {
+		return fmt.Errorf("app.deregister_timeout must be less than app.stop_grace_period (%gs), or the process is killed while deregistering", c.App.StopGracePeriod)
+	}
 	if c.App.HeartbeatTTL <= 0 {
 		return fmt.Errorf("app.heartbeat_ttl must be greater than 0")
 	}
-	if len(c.Etcd.Endpoints) == 0 {
+	if err := c.App.Breaker.validate(); err != nil {
+		return err
+	}
+	switch c.Registry.Backend {
+	case "", RegistryBackendEtcd:
+		if err := c.Etcd.validateClusters(); err != nil {
+			return err
+		}
+	case RegistryBackendRedis:
+		if err := c.Redis.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("registry.backend must be %q or %q, got: %q", RegistryBackendEtcd, RegistryBackendRedis, c.Registry.Backend)
+	}
+	validLevels := map[string]struct{}{
+		"TRACE": {}, "DEBUG": {}, "INFO": {}, "WARN": {}, "ERROR": {}, "FATAL": {},
+	}
+	if _, ok := validLevels[strings.ToUpper(c.Logging.Level)]; !ok {
+		return fmt.Errorf("log.level must be a valid log level, got: %s", c.Logging.Level)
+	}
+	if err := c.Logging.validate(); err != nil {
+		return err
+	}
+	if c.HTTPServerEnabled() && strings.TrimSpace(c.HTTP.ListenAddr) == "" {
+		return fmt.Errorf("http.listen_addr cannot be empty when http.enabled or metrics.enabled is true")
+	}
+	if err := c.HTTP.TLS.validate(); err != nil {
+		return err
+	}
+	if err := c.HTTP.Auth.validate(); err != nil {
+		return err
+	}
+	if c.HTTP.EventsBufferSize <= 0 {
+		return fmt.Errorf("http.events_buffer_size must be greater than 0")
+	}
+	if c.Docker.EventBufferSize <= 0 {
+		return fmt.Errorf("docker.event_buffer_size must be greater than 0")
+	}
+	if c.Docker.ReconnectInitialBackoff <= 0 {
+		return fmt.Errorf("docker.reconnect_initial_backoff must be greater than 0")
+	}
+	if c.Docker.ReconnectMaxBackoff < c.Docker.ReconnectInitialBackoff {
+		return fmt.Errorf("docker.reconnect_max_backoff must be >= docker.reconnect_initial_backoff")
+	}
+	if err := c.Metrics.validate(); err != nil {
+		return err
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return err
+	}
+	if err := c.Audit.validate(c.Logging.Output); err != nil {
+		return err
+	}
+	if err := c.Tracing.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateClusters checks every resolved etcd cluster. Cluster names must be
+// unique, as they label per-cluster health and metrics.
+func (c *EtcdConfig) validateClusters() error {
+	if len(c.Clusters) == 0 {
+		return c.validate()
+	}
+	seen := make(map[string]struct{}, len(c.Clusters))
+	for i, cl := range c.ResolvedClusters() {
+		if !isValidClusterName(cl.Name) {
+			return fmt.Errorf("etcd.clusters[%d].name must be non-empty and contain only letters, digits, '-' and '_', got: %q", i, cl.Name)
+		}
+		if _, dup := seen[cl.Name]; dup {
+			return fmt.Errorf("etcd.clusters contains duplicate name %q", cl.Name)
+		}
+		seen[cl.Name] = struct{}{}
+		if err := cl.validate(); err != nil {
+			return fmt.Errorf("etcd.clusters[%s]: %w", cl.Name, err)
+		}
+	}
+	return nil
+}
+
+func isValidClusterName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks the etcd backend settings.
+func (c *EtcdConfig) validate() error {
+	if len(c.Endpoints) == 0 {
 		return fmt.Errorf("etcd.endpoints must have at least one endpoint")
 	}
-	for _, e := range c.Etcd.Endpoints {
+	for _, e := range c.Endpoints {
 		if !strings.HasPrefix(e, "http://") && !strings.HasPrefix(e, "https://") {
 			return fmt.Errorf("invalid endpoint: %s", e)
 		}
 	}
-	if c.Etcd.PathPrefix == "" {
+	if c.PathPrefix == "" {
 		return fmt.Errorf("etcd.path_prefix cannot be empty")
 	}
-	// The heartbeat keys must not fall under path_prefix (or vice versa), or
-	// CoreDNS would try to serve them and List() would parse them as DNS records.
-	if pp := strings.TrimSuffix(c.Etcd.PathPrefix, "/"); pp == "" ||
-		strings.HasPrefix(HeartbeatKeyPrefix+"/", pp+"/") ||
-		strings.HasPrefix(pp+"/", HeartbeatKeyPrefix+"/") {
-		return fmt.Errorf("etcd.path_prefix %q overlaps the reserved heartbeat key prefix %q; choose a non-overlapping prefix", c.Etcd.PathPrefix, HeartbeatKeyPrefix)
+	// The heartbeat and election keys must not fall under path_prefix (or
+	// vice versa), or CoreDNS would try to serve them and List() would parse
+	// them as DNS records.
+	pp := strings.TrimSuffix(c.PathPrefix, "/")
+	for _, reserved := range []string{HeartbeatKeyPrefix, GCLeaderKeyPrefix} {
+		if pp == "" || strings.HasPrefix(reserved+"/", pp+"/") || strings.HasPrefix(pp+"/", reserved+"/") {
+			return fmt.Errorf("etcd.path_prefix %q overlaps the reserved key prefix %q; choose a non-overlapping prefix", c.PathPrefix, reserved)
+		}
 	}
-	if (c.Etcd.TLS.CertFile == "") != (c.Etcd.TLS.KeyFile == "") {
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
 		return fmt.Errorf("etcd.tls.cert_file and etcd.tls.key_file must be provided together")
 	}
-	if c.Etcd.TLS.InsecureSkipVerify && c.Etcd.TLS.CAFile != "" {
+	if c.TLS.InsecureSkipVerify && c.TLS.CAFile != "" {
 		return fmt.Errorf("etcd.tls.insecure_skip_verify cannot be combined with etcd.tls.ca_file: the CA would be ignored, giving a false sense of verification")
 	}
-	if c.Etcd.TLS.Configured() && !c.Etcd.hasHTTPSEndpoint() {
+	if c.TLS.Configured() && !c.hasHTTPSEndpoint() {
 		return fmt.Errorf("etcd.tls.* is configured but no etcd.endpoints uses https://; the TLS settings would be silently ignored")
 	}
-	if c.Etcd.Username != "" && c.Etcd.Password == "" {
+	if c.Username != "" && c.Password == "" {
 		return fmt.Errorf("etcd.password must be set when etcd.username is provided")
 	}
-	if c.Etcd.Password != "" && c.Etcd.Username == "" {
+	if c.Password != "" && c.Username == "" {
 		return fmt.Errorf("etcd.username must be set when etcd.password is provided")
 	}
-	if c.Etcd.LockTTL <= 0 {
+	if c.LockTTL <= 0 {
 		return fmt.Errorf("etcd.lock_ttl must be > 0")
 	}
-	if c.Etcd.LockTimeout <= 0 {
+	if c.LockTimeout <= 0 {
 		return fmt.Errorf("etcd.lock_timeout must be > 0")
 	}
-	if c.Etcd.LockRetryInterval <= 0 {
+	if c.LockRetryInterval <= 0 {
 		return fmt.Errorf("etcd.lock_retry_interval must be > 0")
 	}
-	validLevels := map[string]struct{}{
-		"TRACE": {}, "DEBUG": {}, "INFO": {}, "WARN": {}, "ERROR": {}, "FATAL": {},
+	return nil
+}
+
+// validate checks the redis backend settings.
+func (c *RedisConfig) validate() error {
+	if strings.TrimSpace(c.Address) == "" {
+		return fmt.Errorf("redis.address cannot be empty")
 	}
-	if _, ok := validLevels[strings.ToUpper(c.Logging.Level)]; !ok {
-		return fmt.Errorf("log.level must be a valid log level, got: %s", c.Logging.Level)
+	if c.DB < 0 {
+		return fmt.Errorf("redis.db must be >= 0")
 	}
-	if c.HTTPServerEnabled() && strings.TrimSpace(c.HTTP.ListenAddr) == "" {
-		return fmt.Errorf("http.listen_addr cannot be empty when http.enabled or metrics.enabled is true")
+	if len(c.Zones) == 0 {
+		return fmt.Errorf("redis.zones must list at least one zone")
 	}
-	if c.Docker.EventBufferSize <= 0 {
-		return fmt.Errorf("docker.event_buffer_size must be greater than 0")
+	for _, z := range c.Zones {
+		if strings.Trim(strings.TrimSpace(z), ".") == "" {
+			return fmt.Errorf("redis.zones contains an empty zone")
+		}
 	}
-	if c.Docker.ReconnectInitialBackoff <= 0 {
-		return fmt.Errorf("docker.reconnect_initial_backoff must be greater than 0")
+	// The plugin loads every key matching key_prefix*key_suffix as a zone, so
+	// our own heartbeat/lock keys must never match that pattern.
+	if c.KeyPrefix == "" || strings.HasPrefix(RedisMetaKeyPrefix, c.KeyPrefix) {
+		return fmt.Errorf("redis.key_prefix %q would match the reserved key prefix %q; choose a non-empty, non-overlapping prefix", c.KeyPrefix, RedisMetaKeyPrefix)
 	}
-	if c.Docker.ReconnectMaxBackoff < c.Docker.ReconnectInitialBackoff {
-		return fmt.Errorf("docker.reconnect_max_backoff must be >= docker.reconnect_initial_backoff")
+	if c.Username != "" && c.Password == "" {
+		return fmt.Errorf("redis.password must be set when redis.username is provided")
+	}
+	if c.LockTTL <= 0 {
+		return fmt.Errorf("redis.lock_ttl must be > 0")
+	}
+	if c.LockTimeout <= 0 {
+		return fmt.Errorf("redis.lock_timeout must be > 0")
+	}
+	if c.LockRetryInterval <= 0 {
+		return fmt.Errorf("redis.lock_retry_interval must be > 0")
 	}
 	return nil
 }
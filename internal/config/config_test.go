@@ -1,9 +1,18 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,12 +20,15 @@ import (
 func validConfig() *Config {
 	return &Config{
 		App: AppConfig{
-			DockerLabelPrefix: "coredns",
-			HostIPv4:          "192.168.1.1",
-			HostIPv6:          "::1",
-			Hostname:          "test-host",
-			PollInterval:      5,
-			HeartbeatTTL:      30,
+			DockerLabelPrefix:       "coredns",
+			HostIPv4:                "192.168.1.1",
+			HostIPv6:                "::1",
+			Hostname:                "test-host",
+			PollInterval:            5,
+			ReconcileSafetyInterval: 300,
+			DeregisterTimeout:       8,
+			StopGracePeriod:         10,
+			HeartbeatTTL:            30,
 		},
 		Etcd: EtcdConfig{
 			Endpoints:         []string{"http://localhost:2379"},
@@ -26,13 +38,37 @@ func validConfig() *Config {
 			LockRetryInterval: 0.1,
 		},
 		Logging: LoggingConfig{
-			Level: "INFO",
+			Level:       "INFO",
+			Format:      LogFormatConsole,
+			Output:      LogOutputStdout,
+			MaxSizeMB:   100,
+			MaxBackups:  5,
+			SampleBurst: 100,
 		},
 		Docker: DockerConfig{
 			EventBufferSize:         100,
 			ReconnectInitialBackoff: 1.0,
 			ReconnectMaxBackoff:     30.0,
 		},
+		HTTP: HTTPConfig{
+			EventsBufferSize: 256,
+			Auth: HTTPAuthConfig{Policy: HTTPPolicyConfig{
+				Probes:  HTTPPolicyOpen,
+				Metrics: HTTPPolicyOpen,
+				API:     HTTPPolicyAuth,
+				Admin:   HTTPPolicyAuth,
+			}},
+		},
+		Notifications: NotificationsConfig{
+			QueueSize:           100,
+			Timeout:             5,
+			MaxRetries:          5,
+			RetryInitialBackoff: 1,
+			RetryMaxBackoff:     60,
+		},
+		Metrics: MetricsConfig{MaxHosts: 100, MaxContainers: 100},
+		Audit:   AuditConfig{MaxSizeMB: 100, MaxBackups: 5},
+		Tracing: TracingConfig{SampleRatio: 1, Timeout: 10},
 	}
 }
 
@@ -155,6 +191,76 @@ func TestConfig_Validate_NegativePollInterval(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate_ZeroReconcileSafetyInterval(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.ReconcileSafetyInterval = 0
+
+	err := cfg.validate()
+
+	if err == nil {
+		t.Error("expected error for zero ReconcileSafetyInterval")
+	}
+}
+
+func TestConfig_Validate_NegativeReconcileDebounce(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.ReconcileDebounce = -1
+
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error for negative ReconcileDebounce")
+	}
+}
+
+func TestConfig_Validate_ReconcileMaxDelayBelowDebounce(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.ReconcileDebounce = 1
+	cfg.App.ReconcileMaxDelay = 0.5
+
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error when ReconcileMaxDelay is shorter than ReconcileDebounce")
+	}
+}
+
+func TestConfig_Validate_NegativeGCInterval(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.GCInterval = -1
+
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error for negative GCInterval")
+	}
+}
+
+func TestConfig_Validate_DeregisterTimeout(t *testing.T) {
+	tests := map[string]func(*AppConfig){
+		"zero timeout":              func(a *AppConfig) { a.DeregisterTimeout = 0 },
+		"timeout equal to grace":    func(a *AppConfig) { a.DeregisterTimeout, a.StopGracePeriod = 10, 10 },
+		"timeout beyond the grace":  func(a *AppConfig) { a.DeregisterTimeout, a.StopGracePeriod = 30, 10 },
+		"grace period left at zero": func(a *AppConfig) { a.StopGracePeriod = 0 },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		mutate(&cfg.App)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.App.DeregisterTimeout, cfg.App.StopGracePeriod = 50, 60
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected a longer timeout to pass with a longer grace period, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_NegativeStartupGrace(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.StartupGrace = -1
+
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error for negative StartupGrace")
+	}
+}
+
 func TestConfig_Validate_ZeroHeartbeatTTL(t *testing.T) {
 	cfg := validConfig()
 	cfg.App.HeartbeatTTL = 0
@@ -173,6 +279,30 @@ func TestConfig_Validate_NegativeHeartbeatTTL(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate_Breaker(t *testing.T) {
+	tests := []struct {
+		name    string
+		breaker BreakerConfig
+		wantErr bool
+	}{
+		{"disabled", BreakerConfig{}, false},
+		{"limits", BreakerConfig{MaxRemovals: 10, MaxRemovalPercent: 50, MaxGCRemovals: 20, MaxGCRemovalPercent: 100}, false},
+		{"negative max_removals", BreakerConfig{MaxRemovals: -1}, true},
+		{"percent above 100", BreakerConfig{MaxRemovalPercent: 101}, true},
+		{"negative max_gc_removals", BreakerConfig{MaxGCRemovals: -1}, true},
+		{"negative gc percent", BreakerConfig{MaxGCRemovalPercent: -5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.App.Breaker = tt.breaker
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestConfig_Validate_NoEndpoints(t *testing.T) {
 	cfg := validConfig()
 	cfg.Etcd.Endpoints = []string{}
@@ -248,6 +378,7 @@ func TestConfig_Validate_PathPrefixOverlapsHeartbeat(t *testing.T) {
 		HeartbeatKeyPrefix,           // exact match
 		"/docker-coredns-sync",       // parent of the heartbeat prefix
 		HeartbeatKeyPrefix + "/host", // child of the heartbeat prefix
+		GCLeaderKeyPrefix,            // the GC election prefix
 	} {
 		t.Run(pp, func(t *testing.T) {
 			cfg := validConfig()
@@ -315,6 +446,164 @@ func TestConfig_Validate_HTTPEnabledRequiresListenAddr(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate_Notifications(t *testing.T) {
+	hook := WebhookConfig{Name: "slack", URL: "https://hooks.example.com/x"}
+	tests := map[string]func(*NotificationsConfig){
+		"missing name":      func(n *NotificationsConfig) { n.Webhooks = []WebhookConfig{{URL: hook.URL}} },
+		"invalid name":      func(n *NotificationsConfig) { n.Webhooks = []WebhookConfig{{Name: "a b", URL: hook.URL}} },
+		"duplicate name":    func(n *NotificationsConfig) { n.Webhooks = []WebhookConfig{hook, hook} },
+		"missing url":       func(n *NotificationsConfig) { n.Webhooks = []WebhookConfig{{Name: "slack"}} },
+		"non-http url":      func(n *NotificationsConfig) { n.Webhooks = []WebhookConfig{{Name: "slack", URL: "ftp://example.com"}} },
+		"zero queue":        func(n *NotificationsConfig) { n.QueueSize = 0 },
+		"zero timeout":      func(n *NotificationsConfig) { n.Timeout = 0 },
+		"negative retries":  func(n *NotificationsConfig) { n.MaxRetries = -1 },
+		"zero backoff":      func(n *NotificationsConfig) { n.RetryInitialBackoff = 0 },
+		"max below initial": func(n *NotificationsConfig) { n.RetryMaxBackoff = 0.5 },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		cfg.Notifications.Webhooks = []WebhookConfig{hook}
+		mutate(&cfg.Notifications)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Notifications.Webhooks = []WebhookConfig{hook, {Name: "matrix", URL: "http://matrix.local/hook"}}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected valid webhooks to pass, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_MetricsLimits(t *testing.T) {
+	tests := map[string]func(*MetricsConfig){
+		"negative hosts":      func(m *MetricsConfig) { m.MaxHosts = -1 },
+		"negative containers": func(m *MetricsConfig) { m.MaxContainers = -1 },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		mutate(&cfg.Metrics)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Metrics = MetricsConfig{}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected unlimited labels to pass, got: %v", err)
+	}
+}
+
+func TestLoad_MetricsLimitsFromEnv(t *testing.T) {
+	resetViper()
+	defer resetViper()
+	t.Setenv("DOCKER_COREDNS_SYNC_APP_HOSTNAME", "env-host")
+	t.Setenv("DOCKER_COREDNS_SYNC_METRICS_MAX_HOSTS", "20")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	want := MetricsConfig{MaxHosts: 20, MaxContainers: 100}
+	if cfg.Metrics != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Metrics)
+	}
+}
+
+func TestConfig_Validate_Audit(t *testing.T) {
+	tests := map[string]func(*AuditConfig){
+		"negative size":    func(a *AuditConfig) { a.MaxSizeMB = -1 },
+		"negative backups": func(a *AuditConfig) { a.MaxBackups = -1 },
+		"stdout with logs": func(a *AuditConfig) { a.Stdout = true },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		mutate(&cfg.Audit)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Audit = AuditConfig{File: "/var/log/dcs/audit.log", MaxSizeMB: 0, MaxBackups: 0}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected an unrotated audit file to pass, got: %v", err)
+	}
+	if !cfg.Audit.Enabled() || (&AuditConfig{}).Enabled() {
+		t.Error("expected the audit log enabled by a file only")
+	}
+
+	cfg = validConfig()
+	cfg.Audit.Stdout = true
+	for _, output := range []string{LogOutputStderr, LogOutputFile} {
+		cfg.Logging.Output, cfg.Logging.File = output, "/var/log/dcs/dcs.log"
+		if err := cfg.validate(); err != nil {
+			t.Errorf("expected audit.stdout to pass with logs on %s, got: %v", output, err)
+		}
+	}
+}
+
+func TestConfig_Validate_Logging(t *testing.T) {
+	tests := map[string]func(*LoggingConfig){
+		"unknown format":   func(l *LoggingConfig) { l.Format = "logfmt" },
+		"unknown output":   func(l *LoggingConfig) { l.Output = "syslog" },
+		"file sans path":   func(l *LoggingConfig) { l.Output = LogOutputFile },
+		"negative size":    func(l *LoggingConfig) { l.MaxSizeMB = -1 },
+		"negative backups": func(l *LoggingConfig) { l.MaxBackups = -1 },
+		"negative every":   func(l *LoggingConfig) { l.SampleEvery = -1 },
+		"negative burst":   func(l *LoggingConfig) { l.SampleBurst = -1 },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		mutate(&cfg.Logging)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Logging.Format, cfg.Logging.Output, cfg.Logging.File = LogFormatJSON, LogOutputFile, "/var/log/dcs/dcs.log"
+	cfg.Logging.SampleEvery = 10
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected JSON logs to a file to pass, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_Tracing(t *testing.T) {
+	tests := map[string]func(*TracingConfig){
+		"non-http endpoint":  func(tc *TracingConfig) { tc.Endpoint = "grpc://collector:4317" },
+		"endpoint sans host": func(tc *TracingConfig) { tc.Endpoint = "http:///v1/traces" },
+		"negative ratio":     func(tc *TracingConfig) { tc.SampleRatio = -0.1 },
+		"ratio above one":    func(tc *TracingConfig) { tc.SampleRatio = 1.5 },
+		"zero timeout":       func(tc *TracingConfig) { tc.Timeout = 0 },
+	}
+	for name, mutate := range tests {
+		cfg := validConfig()
+		cfg.Tracing.Enabled = true
+		mutate(&cfg.Tracing)
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Tracing = TracingConfig{Enabled: true, Endpoint: "https://collector.example.com:4318/v1/traces", SampleRatio: 0.1, Timeout: 10}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected valid tracing settings to pass, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_InvalidEventsBufferSize(t *testing.T) {
+	cfg := validConfig()
+	cfg.HTTP.EventsBufferSize = 0
+
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error for non-positive http.events_buffer_size")
+	}
+}
+
 func TestConfig_Validate_InvalidEventBufferSize(t *testing.T) {
 	cfg := validConfig()
 	cfg.Docker.EventBufferSize = 0
@@ -338,6 +627,131 @@ func TestConfig_Validate_InvalidReconnectBackoff(t *testing.T) {
 	}
 }
 
+func validRedisConfig() *Config {
+	cfg := validConfig()
+	cfg.Registry.Backend = RegistryBackendRedis
+	cfg.Etcd = EtcdConfig{} // etcd settings are not validated for the redis backend
+	cfg.Redis = RedisConfig{
+		Address:           "localhost:6379",
+		KeyPrefix:         "_dns:",
+		Zones:             []string{"example.com"},
+		LockTTL:           5.0,
+		LockTimeout:       2.0,
+		LockRetryInterval: 0.1,
+	}
+	return cfg
+}
+
+func TestConfig_Validate_RedisBackendValid(t *testing.T) {
+	if err := validRedisConfig().validate(); err != nil {
+		t.Errorf("expected valid redis config to pass validation, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_UnknownRegistryBackend(t *testing.T) {
+	cfg := validConfig()
+	cfg.Registry.Backend = "consul"
+	if err := cfg.validate(); err == nil {
+		t.Error("expected error for unknown registry backend")
+	}
+}
+
+func TestConfig_Validate_RedisInvalid(t *testing.T) {
+	tests := map[string]func(c *RedisConfig){
+		"empty address":         func(c *RedisConfig) { c.Address = " " },
+		"negative db":           func(c *RedisConfig) { c.DB = -1 },
+		"no zones":              func(c *RedisConfig) { c.Zones = nil },
+		"empty zone":            func(c *RedisConfig) { c.Zones = []string{"."} },
+		"empty key prefix":      func(c *RedisConfig) { c.KeyPrefix = "" },
+		"prefix matches meta":   func(c *RedisConfig) { c.KeyPrefix = "docker-" },
+		"username w/o password": func(c *RedisConfig) { c.Username = "u" },
+		"zero lock ttl":         func(c *RedisConfig) { c.LockTTL = 0 },
+		"zero lock timeout":     func(c *RedisConfig) { c.LockTimeout = 0 },
+		"zero retry interval":   func(c *RedisConfig) { c.LockRetryInterval = 0 },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validRedisConfig()
+			mutate(&cfg.Redis)
+			if err := cfg.validate(); err == nil {
+				t.Errorf("expected error for %s", name)
+			}
+		})
+	}
+}
+
+func TestEtcdConfig_ResolvedClusters_Default(t *testing.T) {
+	cfg := validConfig()
+	clusters := cfg.Etcd.ResolvedClusters()
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d", len(clusters))
+	}
+	if clusters[0].Name != DefaultEtcdClusterName {
+		t.Errorf("expected default cluster name, got %q", clusters[0].Name)
+	}
+	if clusters[0].Endpoints[0] != "http://localhost:2379" || clusters[0].PathPrefix != "/skydns" {
+		t.Errorf("expected top-level settings, got %+v", clusters[0].EtcdConfig)
+	}
+}
+
+func TestEtcdConfig_ResolvedClusters_InheritsDefaults(t *testing.T) {
+	cfg := validConfig()
+	cfg.Etcd.Username, cfg.Etcd.Password = "top", "top-secret"
+	cfg.Etcd.Clusters = []EtcdClusterConfig{
+		{Name: "site-a", Endpoints: []string{"http://a:2379"}},
+		{Name: "site-b", Endpoints: []string{"http://b:2379"}, PathPrefix: "/dns", Username: "b", Password: "b-secret"},
+	}
+	clusters := cfg.Etcd.ResolvedClusters()
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	a, b := clusters[0], clusters[1]
+	if a.Name != "site-a" || a.Endpoints[0] != "http://a:2379" || a.PathPrefix != "/skydns" || a.Username != "top" {
+		t.Errorf("site-a did not inherit top-level settings: %+v", a)
+	}
+	if b.PathPrefix != "/dns" || b.Username != "b" || b.Password != "b-secret" {
+		t.Errorf("site-b overrides not applied: %+v", b)
+	}
+	if a.LockTTL != cfg.Etcd.LockTTL || b.LockTimeout != cfg.Etcd.LockTimeout {
+		t.Error("expected lock settings to be shared")
+	}
+	if len(a.Clusters) != 0 {
+		t.Error("resolved clusters must not nest the cluster list")
+	}
+}
+
+func TestConfig_Validate_EtcdClusters(t *testing.T) {
+	cfg := validConfig()
+	cfg.Etcd.Clusters = []EtcdClusterConfig{
+		{Name: "site-a", Endpoints: []string{"http://a:2379"}},
+		{Name: "site_b", Endpoints: []string{"http://b:2379"}},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected valid clusters to pass validation, got: %v", err)
+	}
+}
+
+func TestConfig_Validate_EtcdClustersInvalid(t *testing.T) {
+	tests := map[string][]EtcdClusterConfig{
+		"empty name":      {{Name: "", Endpoints: []string{"http://a:2379"}}},
+		"invalid name":    {{Name: "site a", Endpoints: []string{"http://a:2379"}}},
+		"duplicate name":  {{Name: "a", Endpoints: []string{"http://a:2379"}}, {Name: "a", Endpoints: []string{"http://b:2379"}}},
+		"no endpoints":    {{Name: "a"}},
+		"bad endpoint":    {{Name: "a", Endpoints: []string{"a:2379"}}},
+		"prefix overlaps": {{Name: "a", Endpoints: []string{"http://a:2379"}, PathPrefix: "/docker-coredns-sync"}},
+		"tls w/o https":   {{Name: "a", Endpoints: []string{"http://a:2379"}, TLS: EtcdTLSConfig{CAFile: "/ca.pem"}}},
+	}
+	for name, clusters := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Etcd.Clusters = clusters
+			if err := cfg.validate(); err == nil {
+				t.Errorf("expected error for %s", name)
+			}
+		})
+	}
+}
+
 func TestConfig_Validate_InvalidLockTTL(t *testing.T) {
 	tests := []float64{0, -1, -5.0}
 
@@ -551,6 +965,165 @@ func TestLoad_Success_FromEnvVars(t *testing.T) {
 	}
 }
 
+func TestLoad_HTTPAuthFromEnv(t *testing.T) {
+	resetViper()
+	defer resetViper()
+
+	t.Setenv("DOCKER_COREDNS_SYNC_APP_HOSTNAME", "test-host")
+	t.Setenv("DOCKER_COREDNS_SYNC_ETCD_ENDPOINTS", "http://localhost:2379")
+	t.Setenv("DOCKER_COREDNS_SYNC_HTTP_AUTH_TOKEN", "s3cret")
+
+	cfg, err := Load()
+
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	if cfg.HTTP.Auth.Token != "s3cret" || !cfg.HTTP.Auth.Configured() {
+		t.Errorf("expected the token from the env var, got %q", cfg.HTTP.Auth.Token)
+	}
+	want := HTTPPolicyConfig{Probes: HTTPPolicyOpen, Metrics: HTTPPolicyOpen, API: HTTPPolicyAuth, Admin: HTTPPolicyAuth}
+	if cfg.HTTP.Auth.Policy != want {
+		t.Errorf("expected the default policies %+v, got %+v", want, cfg.HTTP.Auth.Policy)
+	}
+}
+
+func TestConfig_Validate_HTTPTLSAndAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*HTTPConfig)
+	}{
+		{"cert without key", func(h *HTTPConfig) { h.TLS.CertFile = "cert.pem" }},
+		{"key without cert", func(h *HTTPConfig) { h.TLS.KeyFile = "key.pem" }},
+		{"client CA without TLS", func(h *HTTPConfig) { h.TLS.ClientCAFile = "ca.pem" }},
+		{"required client cert without CA", func(h *HTTPConfig) {
+			h.TLS.CertFile, h.TLS.KeyFile, h.TLS.RequireClientCert = "cert.pem", "key.pem", true
+		}},
+		{"token and token file", func(h *HTTPConfig) { h.Auth.Token, h.Auth.TokenFile = "a", "/run/secrets/token" }},
+		{"password and password file", func(h *HTTPConfig) {
+			h.Auth.Username, h.Auth.Password, h.Auth.PasswordFile = "ops", "a", "/run/secrets/password"
+		}},
+		{"username without password", func(h *HTTPConfig) { h.Auth.Username = "ops" }},
+		{"password without username", func(h *HTTPConfig) { h.Auth.Password = "a" }},
+		{"unknown policy", func(h *HTTPConfig) { h.Auth.Policy.Metrics = "token" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(&cfg.HTTP)
+			if err := cfg.validate(); err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+
+	cfg := validConfig()
+	cfg.HTTP.TLS = HTTPTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem", RequireClientCert: true}
+	cfg.HTTP.Auth.Username, cfg.HTTP.Auth.PasswordFile = "ops", "/run/secrets/password"
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected a complete TLS and auth config to pass, got: %v", err)
+	}
+}
+
+func TestHTTPAuthConfig_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, password, err := HTTPAuthConfig{TokenFile: tokenFile, Password: "inline"}.Secrets()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "from-file" || password != "inline" {
+		t.Errorf("expected the file's token without its newline and the inline password, got %q and %q", token, password)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []HTTPAuthConfig{
+		{TokenFile: filepath.Join(dir, "missing")},
+		{Username: "ops", PasswordFile: empty},
+	} {
+		if _, _, err := a.Secrets(); err == nil {
+			t.Errorf("expected an error for %+v", a)
+		}
+	}
+}
+
+func TestHTTPTLSConfig_ServerTLS(t *testing.T) {
+	if cfg, err := (HTTPTLSConfig{}).ServerTLS(); cfg != nil || err != nil {
+		t.Errorf("expected no TLS config when disabled, got %v, %v", cfg, err)
+	}
+
+	certFile, keyFile := writeTestKeyPair(t)
+	cfg, err := HTTPTLSConfig{CertFile: certFile, KeyFile: keyFile}.ServerTLS()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Certificates) != 1 || cfg.ClientAuth != tls.NoClientCert {
+		t.Errorf("expected a server certificate and no client auth, got %+v", cfg)
+	}
+
+	// The self-signed certificate doubles as the client CA.
+	cfg, err = HTTPTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}.ServerTLS()
+	if err != nil || cfg.ClientAuth != tls.VerifyClientCertIfGiven || cfg.ClientCAs == nil {
+		t.Errorf("expected optional client cert verification, got %+v (err %v)", cfg, err)
+	}
+	cfg, err = HTTPTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, RequireClientCert: true}.ServerTLS()
+	if err != nil || cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("expected required client certs, got %+v (err %v)", cfg, err)
+	}
+
+	if _, err := (HTTPTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}).ServerTLS(); err == nil {
+		t.Error("expected an error for a client CA file without certificates")
+	}
+	if _, err := (HTTPTLSConfig{CertFile: keyFile, KeyFile: certFile}).ServerTLS(); err == nil {
+		t.Error("expected an error for a bad keypair")
+	}
+}
+
+// writeTestKeyPair writes a self-signed certificate and its key, and returns
+// their paths.
+func writeTestKeyPair(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
 func TestLoad_Success_FromConfigFile(t *testing.T) {
 	resetViper()
 	defer resetViper()
@@ -593,6 +1166,149 @@ log:
 	}
 }
 
+func TestLoad_EtcdClustersFromConfigFile(t *testing.T) {
+	resetViper()
+	defer resetViper()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `
+app:
+  hostname: "file-host"
+etcd:
+  path_prefix: "/dns"
+  clusters:
+    - name: site-a
+      endpoints: ["http://etcd-a:2379"]
+    - name: site-b
+      endpoints: ["http://etcd-b:2379"]
+      path_prefix: "/skydns"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	viper.Set("config", configPath)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	clusters := cfg.Etcd.ResolvedClusters()
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[0].Name != "site-a" || clusters[0].PathPrefix != "/dns" {
+		t.Errorf("unexpected site-a config: %+v", clusters[0])
+	}
+	if clusters[1].Endpoints[0] != "http://etcd-b:2379" || clusters[1].PathPrefix != "/skydns" {
+		t.Errorf("unexpected site-b config: %+v", clusters[1])
+	}
+}
+
+func TestLoad_WebhooksFromConfigFile(t *testing.T) {
+	resetViper()
+	defer resetViper()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `
+app:
+  hostname: "file-host"
+notifications:
+  max_retries: 2
+  webhooks:
+    - name: slack
+      url: "https://hooks.slack.example/T000/B000"
+      events: [eviction, gc]
+      template: '{"text": {{json .Summary}}}'
+      headers:
+        Authorization: "Bearer abc"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	viper.Set("config", configPath)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	n := cfg.Notifications
+	if n.MaxRetries != 2 || n.QueueSize != 100 || n.Timeout != 5 {
+		t.Errorf("expected max_retries from the file and the other defaults, got %+v", n)
+	}
+	if len(n.Webhooks) != 1 {
+		t.Fatalf("expected 1 webhook, got %d", len(n.Webhooks))
+	}
+	w := n.Webhooks[0]
+	if w.Name != "slack" || len(w.Events) != 2 || w.Template != `{"text": {{json .Summary}}}` {
+		t.Errorf("unexpected webhook config: %+v", w)
+	}
+	// viper lowercases map keys; header names are case-insensitive.
+	if w.Headers["authorization"] != "Bearer abc" {
+		t.Errorf("expected the Authorization header, got %v", w.Headers)
+	}
+}
+
+func TestLoad_AuditFromEnv(t *testing.T) {
+	resetViper()
+	defer resetViper()
+	t.Setenv("DOCKER_COREDNS_SYNC_APP_HOSTNAME", "env-host")
+	t.Setenv("DOCKER_COREDNS_SYNC_AUDIT_FILE", "/var/log/dcs/audit.log")
+	t.Setenv("DOCKER_COREDNS_SYNC_AUDIT_STDOUT", "true")
+	t.Setenv("DOCKER_COREDNS_SYNC_LOG_OUTPUT", "stderr")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	want := AuditConfig{File: "/var/log/dcs/audit.log", Stdout: true, MaxSizeMB: 100, MaxBackups: 5}
+	if cfg.Audit != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Audit)
+	}
+}
+
+func TestLoad_LoggingFromEnv(t *testing.T) {
+	resetViper()
+	defer resetViper()
+	t.Setenv("DOCKER_COREDNS_SYNC_APP_HOSTNAME", "env-host")
+	t.Setenv("DOCKER_COREDNS_SYNC_LOG_FORMAT", "json")
+	t.Setenv("DOCKER_COREDNS_SYNC_LOG_OUTPUT", "stderr")
+	t.Setenv("DOCKER_COREDNS_SYNC_LOG_SAMPLE_EVERY", "10")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	want := LoggingConfig{
+		Level:       "INFO",
+		Format:      LogFormatJSON,
+		Output:      LogOutputStderr,
+		MaxSizeMB:   100,
+		MaxBackups:  5,
+		SampleEvery: 10,
+		SampleBurst: 100,
+	}
+	if cfg.Logging != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Logging)
+	}
+}
+
+func TestLoad_TracingFromEnv(t *testing.T) {
+	resetViper()
+	defer resetViper()
+	t.Setenv("DOCKER_COREDNS_SYNC_APP_HOSTNAME", "env-host")
+	t.Setenv("DOCKER_COREDNS_SYNC_TRACING_ENABLED", "true")
+	t.Setenv("DOCKER_COREDNS_SYNC_TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected Load to succeed, got error: %v", err)
+	}
+	tc := cfg.Tracing
+	if !tc.Enabled || tc.SampleRatio != 0.25 || tc.Endpoint != "" || tc.Timeout != 10 {
+		t.Errorf("expected tracing enabled at 0.25 with the other defaults, got %+v", tc)
+	}
+}
+
 func TestLoad_Success_NoConfigFile_UsesDefaults(t *testing.T) {
 	resetViper()
 	defer resetViper()
@@ -615,12 +1331,39 @@ func TestLoad_Success_NoConfigFile_UsesDefaults(t *testing.T) {
 	if cfg.App.PollInterval != 5 {
 		t.Errorf("expected default poll interval 5, got %d", cfg.App.PollInterval)
 	}
+	if cfg.App.ReconcileSafetyInterval != 300 {
+		t.Errorf("expected default safety-net interval 300s, got %v", cfg.App.ReconcileSafetyInterval)
+	}
+	if cfg.App.ReconcileDebounce != 0.25 || cfg.App.ReconcileMaxDelay != 2 {
+		t.Errorf("expected default debounce 0.25s and max delay 2s, got %v and %v", cfg.App.ReconcileDebounce, cfg.App.ReconcileMaxDelay)
+	}
+	if cfg.App.GCInterval != 30 {
+		t.Errorf("expected default gc_interval 30s, got %v", cfg.App.GCInterval)
+	}
+	if cfg.App.StartupGrace != 0 {
+		t.Errorf("expected default startup_grace 0, got %v", cfg.App.StartupGrace)
+	}
+	if cfg.App.DeregisterTimeout != 8 || cfg.App.StopGracePeriod != 10 {
+		t.Errorf("expected default deregister_timeout 8s and stop_grace_period 10s, got %v and %v", cfg.App.DeregisterTimeout, cfg.App.StopGracePeriod)
+	}
+	if cfg.App.DeregisterOnShutdown {
+		t.Error("expected records to be kept on shutdown by default")
+	}
 	if cfg.App.RecordTTL != 0 {
 		t.Errorf("expected default record_ttl 0, got %d", cfg.App.RecordTTL)
 	}
 	if cfg.App.HeartbeatTTL != 30 {
 		t.Errorf("expected default heartbeat_ttl 30, got %d", cfg.App.HeartbeatTTL)
 	}
+	if cfg.App.Breaker != (BreakerConfig{}) {
+		t.Errorf("expected the removal breaker to be disabled by default, got %+v", cfg.App.Breaker)
+	}
+	if cfg.Registry.Backend != RegistryBackendEtcd {
+		t.Errorf("expected default registry backend %q, got %q", RegistryBackendEtcd, cfg.Registry.Backend)
+	}
+	if cfg.HTTP.EventsBufferSize != 256 {
+		t.Errorf("expected default http.events_buffer_size 256, got %d", cfg.HTTP.EventsBufferSize)
+	}
 }
 
 func TestLoad_InitConfigError_InvalidYAML(t *testing.T) {
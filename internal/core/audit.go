@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+)
+
+// AddAuditSink registers an optional audit log of the registry writes the
+// engine makes; every sink added gets every write. Audit is called from the
+// engine's goroutines right after each write commits. Must be called before
+// Run.
+func (se *SyncEngine) AddAuditSink(s auditSink) {
+	se.audits = append(se.audits, s)
+}
+
+// auditApplied records the writes a reconcile pass made to cluster. decisions
+// are the pass's, naming the record that evicted each evicted one.
+func (se *SyncEngine) auditApplied(cluster string, applied []domain.Mutation, decisions []domain.Decision, logger zerolog.Logger) {
+	if len(se.audits) == 0 {
+		return
+	}
+	now := time.Now()
+	evictedBy := evictions(decisions)
+	for _, m := range applied {
+		e := domain.AuditEntry{Time: now, Host: se.cfg.Hostname, Cluster: cluster, Op: m.Op, Trigger: string(se.trigger), Revision: m.Revision}
+		if m.Op == domain.MutationRegister {
+			e.Reason = string(domain.RegistrationContainer)
+			e.Detail = fmt.Sprintf("container %s asks for it", m.Record.ContainerName)
+			e.After = m.Record
+		} else {
+			why := se.whyRemoved(m.Record, evictedBy)
+			e.Reason, e.Detail = string(why.reason), why.detail
+			e.Before, e.After = m.Record, why.replacement
+		}
+		se.audit(e, logger)
+	}
+}
+
+// auditDeregistered records the removals of the records this instance
+// deregistered from cluster on shutdown.
+func (se *SyncEngine) auditDeregistered(cluster string, applied []domain.Mutation, logger zerolog.Logger) {
+	if len(se.audits) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, m := range applied {
+		se.audit(domain.AuditEntry{
+			Time: now, Host: se.cfg.Hostname, Cluster: cluster, Op: m.Op,
+			Reason: string(domain.RemovalDeregistered), Detail: "this instance is shutting down",
+			Trigger: string(TriggerShutdown), Before: m.Record, Revision: m.Revision,
+		}, logger)
+	}
+}
+
+// audit hands e to the audit sinks. A sink that fails is logged: the write it
+// records has already committed.
+func (se *SyncEngine) audit(e domain.AuditEntry, logger zerolog.Logger) {
+	record := e.Before
+	if record == nil {
+		record = e.After
+	}
+	for _, s := range se.audits {
+		if err := s.Audit(e); err != nil {
+			logger.Error().Err(err).Str("op", string(e.Op)).Str("record", record.Record.Render()).Msg("could not write the audit log")
+		}
+	}
+}
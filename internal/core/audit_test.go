@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// recordingAudit records the audit entries written to it, failing with err.
+type recordingAudit struct {
+	mu      sync.Mutex
+	entries []domain.AuditEntry
+	err     error
+}
+
+func (a *recordingAudit) Audit(e domain.AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	return a.err
+}
+
+// byName returns the entries recorded so far by the name of their record.
+func (a *recordingAudit) byName() map[string]domain.AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make(map[string]domain.AuditEntry)
+	for _, e := range a.entries {
+		ri := e.Before
+		if ri == nil {
+			ri = e.After
+		}
+		out[ri.Record.Name+"/"+string(e.Op)] = e
+	}
+	return out
+}
+
+func TestSyncEngine_reconcileCluster_AuditsWrites(t *testing.T) {
+	// Same plan as TestSyncEngine_reconcileCluster_PublishesAppliedChanges.
+	desired := makeIntent("app.example.com", domain.RecordA, "10.0.0.1")
+	desired.Created = time.Now().Add(-time.Hour)
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "other.example.com")
+	cname.Hostname, cname.ContainerName = "other-host", "other"
+	stale := makeIntent("stale.example.com", domain.RecordA, "10.0.0.2")
+	orphan := makeIntent("old.example.com", domain.RecordA, "10.0.0.9")
+	orphan.Hostname, orphan.Wire = "dead-host", domain.WireInfo{Schema: domain.RecordSchema}
+	reg := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			return []*domain.RecordIntent{cname, stale, orphan}, nil
+		},
+		getLiveHostnamesFunc: func(ctx context.Context) (map[string]struct{}, error) {
+			return map[string]struct{}{"test-host": {}, "other-host": {}}, nil
+		},
+	}
+	engine := breakerEngine(reg, config.BreakerConfig{}, desired)
+	engine.trigger = TriggerManual
+	audit := &recordingAudit{}
+	engine.AddAuditSink(audit)
+
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], []*domain.RecordIntent{desired}); res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+
+	got := audit.byName()
+	if len(got) != 4 {
+		t.Fatalf("expected 4 audited writes, got %+v", got)
+	}
+	if e := got["app.example.com/register"]; e.Reason != string(domain.RegistrationContainer) || e.After != desired || e.Before != nil ||
+		e.Host != "test-host" || e.Cluster != config.DefaultEtcdClusterName || e.Trigger != string(TriggerManual) {
+		t.Errorf("unexpected registration entry %+v", e)
+	}
+	if e := got["app.example.com/remove"]; e.Reason != string(domain.RemovalEvicted) || e.Before != cname || e.After == nil || e.After.Record != desired.Record {
+		t.Errorf("expected the CNAME evicted by the A record, got %+v", e)
+	}
+	if e := got["stale.example.com/remove"]; e.Reason != string(domain.RemovalStale) || e.After != nil {
+		t.Errorf("expected the stale record removed as stale, got %+v", e)
+	}
+	if e := got["old.example.com/remove"]; e.Reason != string(domain.RemovalGC) || e.Detail != "its host dead-host has no heartbeat" {
+		t.Errorf("expected the orphan collected with its dead host named, got %+v", e)
+	}
+}
+
+func TestSyncEngine_reconcileCluster_AuditsRevisions(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(_ int, toAdd, toRemove []*domain.RecordIntent) (int, int, error) {
+		return len(toAdd), len(toRemove), nil
+	}}
+	engine := planTestEngine(reg)
+	audit := &recordingAudit{err: errors.New("disk full")}
+	engine.AddAuditSink(audit)
+
+	// A failing sink does not fail the pass: the write has committed.
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents()); res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+
+	if len(audit.entries) != 1 || audit.entries[0].Revision != 1 {
+		t.Errorf("expected the registration audited with its revision, got %+v", audit.entries)
+	}
+}
+
+func TestSyncEngine_deregister_AuditsRemovals(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	audit := &recordingAudit{}
+	engine.AddAuditSink(audit)
+
+	if _, err := engine.deregisterCluster(context.Background(), engine.clusters[0], engine.logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(audit.entries) != 2 {
+		t.Fatalf("expected both removals audited, got %+v", audit.entries)
+	}
+	for _, e := range audit.entries {
+		if e.Op != domain.MutationRemove || e.Reason != string(domain.RemovalDeregistered) || e.Trigger != string(TriggerShutdown) || e.Before == nil {
+			t.Errorf("unexpected deregistration entry %+v", e)
+		}
+	}
+}
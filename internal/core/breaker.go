@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+)
+
+// Kinds of removals the breaker limits separately. They are used as log
+// fields and metric labels.
+const (
+	// BreakerOwn covers removals of this host's own stale records.
+	BreakerOwn = "own"
+	// BreakerGC covers cross-host garbage collection of dead hosts' records.
+	BreakerGC = "gc"
+)
+
+// breakerTrip is what a cluster's removal breaker blocked in a plan: the
+// removals of each kind that went over its limit, and how many records of
+// that kind the cluster held.
+type breakerTrip struct {
+	own, gc         []*domain.RecordIntent
+	ownBase, gcBase int
+	// gcChecked is set when the pass took its turn at cross-host GC, so
+	// the GC limit was evaluated or no longer applies to this host.
+	gcChecked bool
+}
+
+func (t breakerTrip) tripped() bool {
+	return len(t.own) > 0 || len(t.gc) > 0
+}
+
+// reason describes the blocked removals for readiness reporting, or returns ""
+// when nothing is blocked.
+func (t breakerTrip) reason() string {
+	var parts []string
+	if len(t.own) > 0 {
+		parts = append(parts, fmt.Sprintf("%d of this host's %d records", len(t.own), t.ownBase))
+	}
+	if len(t.gc) > 0 {
+		parts = append(parts, fmt.Sprintf("%d of other hosts' %d records by GC", len(t.gc), t.gcBase))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "removal breaker tripped: blocked removing " + strings.Join(parts, " and ")
+}
+
+// checkBreaker returns the removals of a plan computed from actual that go
+// over the app.breaker limits. It counts the removals of this host's records
+// and, when liveHosts is set, those of dead hosts' orphaned records. A removal
+// is not counted if the plan adds a record under the same name.
+func (se *SyncEngine) checkBreaker(actual, toAdd, toRemove []*domain.RecordIntent, liveHosts map[string]struct{}) breakerTrip {
+	trip := breakerTrip{gcChecked: liveHosts != nil}
+	for _, ri := range actual {
+		if ri.Hostname == se.cfg.Hostname {
+			trip.ownBase++
+		} else {
+			trip.gcBase++
+		}
+	}
+	own, gc := se.splitRemovals(toAdd, toRemove, liveHosts)
+	b := se.cfg.Breaker
+	if overLimit(len(own), trip.ownBase, b.MaxRemovals, b.MaxRemovalPercent) {
+		trip.own = own
+	}
+	if overLimit(len(gc), trip.gcBase, b.MaxGCRemovals, b.MaxGCRemovalPercent) {
+		trip.gc = gc
+	}
+	return trip
+}
+
+// splitRemovals returns the removals in toRemove of this host's records and,
+// when liveHosts is set, of dead hosts' orphaned records. Removals replaced by
+// a record toAdd adds under the same name are left out.
+func (se *SyncEngine) splitRemovals(toAdd, toRemove []*domain.RecordIntent, liveHosts map[string]struct{}) (own, gc []*domain.RecordIntent) {
+	added := make(map[string]struct{}, len(toAdd))
+	for _, ri := range toAdd {
+		added[ri.Record.Name] = struct{}{}
+	}
+	for _, ri := range toRemove {
+		if _, replaced := added[ri.Record.Name]; replaced {
+			continue
+		}
+		if ri.Hostname == se.cfg.Hostname {
+			own = append(own, ri)
+		} else if _, alive := liveHosts[ri.Hostname]; liveHosts != nil && !alive {
+			gc = append(gc, ri)
+		}
+	}
+	return own, gc
+}
+
+// overLimit reports whether removing n of base records goes over maxCount or
+// maxPercent. A zero limit is disabled.
+func overLimit(n, base, maxCount int, maxPercent float64) bool {
+	if n == 0 {
+		return false
+	}
+	return (maxCount > 0 && n > maxCount) || (maxPercent > 0 && float64(n)*100 > maxPercent*float64(base))
+}
+
+// logBlockedPlan logs a plan the breaker stopped, in full, so an operator can
+// decide whether to override it.
+func logBlockedPlan(trip breakerTrip, toAdd, toRemove []*domain.RecordIntent, logger zerolog.Logger) {
+	var kinds []string
+	if len(trip.own) > 0 {
+		kinds = append(kinds, BreakerOwn)
+	}
+	if len(trip.gc) > 0 {
+		kinds = append(kinds, BreakerGC)
+	}
+	logger.Error().
+		Strs("breaker", kinds).
+		Strs("blocked", renderAll(append(append([]*domain.RecordIntent{}, trip.own...), trip.gc...))).
+		Strs("plan_remove", renderAll(toRemove)).
+		Strs("plan_add", renderAll(toAdd)).
+		Msg(trip.reason() + "; applying the rest of the plan. Check the configuration, then override the breaker to proceed")
+}
+
+// OverrideBreaker lets the next pass on every cluster whose removal breaker
+// is tripped apply the removals it blocked, and requests that pass. It
+// reports whether any breaker was tripped. Safe to call from any goroutine.
+func (se *SyncEngine) OverrideBreaker() bool {
+	se.breakerMu.Lock()
+	var tripped bool
+	for cluster, trip := range se.breakers {
+		if !trip.tripped() {
+			continue
+		}
+		tripped = true
+		se.breakerOverrides[cluster] = struct{}{}
+		if len(trip.gc) > 0 {
+			// Give the cluster its GC turn on the very next pass.
+			se.gcMu.Lock()
+			delete(se.lastGC, cluster)
+			se.gcMu.Unlock()
+		}
+	}
+	se.breakerMu.Unlock()
+	if tripped {
+		se.logger.Warn().Msg("removal breaker overridden; the blocked removals are applied on the next pass")
+		se.requestReconcile(TriggerManual)
+	}
+	return tripped
+}
+
+// takeBreakerOverride consumes a pending override of cluster's breaker.
+func (se *SyncEngine) takeBreakerOverride(cluster string) bool {
+	se.breakerMu.Lock()
+	defer se.breakerMu.Unlock()
+	_, ok := se.breakerOverrides[cluster]
+	delete(se.breakerOverrides, cluster)
+	return ok
+}
+
+// recordBreaker stores the state of cluster's breaker after a pass and reports
+// it. A pass that did not take its GC turn leaves the GC limit as it was, so
+// a tripped GC breaker stays reported between collections.
+func (se *SyncEngine) recordBreaker(cluster string, trip breakerTrip) {
+	se.breakerMu.Lock()
+	if prev := se.breakers[cluster]; !trip.gcChecked {
+		trip.gc, trip.gcBase = prev.gc, prev.gcBase
+	}
+	se.breakers[cluster] = trip
+	se.breakerMu.Unlock()
+
+	if r, ok := se.reporter.(breakerReporter); ok {
+		r.RecordBreaker(cluster, trip.reason())
+	}
+	if m, ok := se.metrics.(breakerMetrics); ok {
+		m.SetBreakerBlocked(cluster, BreakerOwn, len(trip.own))
+		m.SetBreakerBlocked(cluster, BreakerGC, len(trip.gc))
+	}
+}
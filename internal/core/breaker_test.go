@@ -0,0 +1,259 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+type recordingBreaker struct {
+	recordingReporter
+	reasons map[string]string
+}
+
+func (r *recordingBreaker) RecordBreaker(cluster, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reasons == nil {
+		r.reasons = map[string]string{}
+	}
+	r.reasons[cluster] = reason
+}
+
+func (r *recordingBreaker) reason() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reasons[config.DefaultEtcdClusterName]
+}
+
+type recordingBreakerMetrics struct {
+	recordingMetrics
+	mu      sync.Mutex
+	blocked map[string]int
+}
+
+func (r *recordingBreakerMetrics) SetBreakerBlocked(cluster, kind string, blocked int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blocked == nil {
+		r.blocked = map[string]int{}
+	}
+	r.blocked[cluster+"/"+kind] = blocked
+}
+
+// ownListing lists n records owned by this host.
+func ownListing(n int) func(ctx context.Context) ([]*domain.RecordIntent, error) {
+	return func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		var out []*domain.RecordIntent
+		for i := range n {
+			out = append(out, makeIntent(fmt.Sprintf("app%d.example.com", i), domain.RecordA, "192.168.1.1"))
+		}
+		return out, nil
+	}
+}
+
+func breakerEngine(reg upstreamRegistry, breaker config.BreakerConfig, desired ...*domain.RecordIntent) *SyncEngine {
+	cfg := testAppConfig()
+	cfg.Breaker = breaker
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return desired }}
+	return NewSyncEngine(engineTestLogger(), cfg, &mockGenerator{}, reg, state)
+}
+
+func TestOverLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		n, base    int
+		maxCount   int
+		maxPercent float64
+		want       bool
+	}{
+		{"disabled", 100, 100, 0, 0, false},
+		{"nothing removed", 0, 0, 1, 1, false},
+		{"at count", 5, 100, 5, 0, false},
+		{"over count", 6, 100, 5, 0, true},
+		{"at percent", 1, 2, 0, 50, false},
+		{"over percent", 3, 4, 0, 50, true},
+		{"either limit", 3, 100, 2, 50, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overLimit(tt.n, tt.base, tt.maxCount, tt.maxPercent); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSyncEngine_Breaker_BlocksOwnRemovals(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(3)}
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovals: 2}, added)
+	reporter := &recordingBreaker{}
+	m := &recordingBreakerMetrics{}
+	engine.SetReconcileReporter(reporter)
+	engine.SetMetrics(m)
+
+	engine.reconcile(context.Background())
+
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected the removals to be blocked, got %d removed", len(removed))
+	}
+	if registered := reg.GetRegisteredRecords(); len(registered) != 1 {
+		t.Errorf("expected the rest of the plan to be applied, got %d registered", len(registered))
+	}
+	if reason := reporter.reason(); !strings.Contains(reason, "3 of this host's 3 records") {
+		t.Errorf("expected the blocked removals to be reported, got %q", reason)
+	}
+	if got := m.blocked["default/own"]; got != 3 {
+		t.Errorf("expected 3 blocked own removals in metrics, got %d", got)
+	}
+	if reporter.sawError() {
+		t.Error("a tripped breaker must not fail the pass")
+	}
+}
+
+func TestSyncEngine_Breaker_OverrideAppliesBlockedRemovals(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(3)}
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovalPercent: 50})
+	reporter := &recordingBreaker{}
+	engine.SetReconcileReporter(reporter)
+
+	if engine.OverrideBreaker() {
+		t.Error("expected no override while the breaker is not tripped")
+	}
+	engine.reconcile(context.Background())
+	if !engine.OverrideBreaker() {
+		t.Fatal("expected the tripped breaker to be overridden")
+	}
+	select {
+	case reason := <-engine.triggers:
+		if reason != TriggerManual {
+			t.Errorf("expected a manual pass to be requested, got %q", reason)
+		}
+	default:
+		t.Error("expected the override to request a pass")
+	}
+
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 3 {
+		t.Errorf("expected the overridden pass to remove 3 records, got %d", len(removed))
+	}
+	if reason := reporter.reason(); reason != "" {
+		t.Errorf("expected the breaker to be reset, got %q", reason)
+	}
+}
+
+func TestSyncEngine_Breaker_OverrideIsOneShot(t *testing.T) {
+	listing := ownListing(3)
+	reg := &mockRegistry{listFunc: listing}
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovals: 1})
+
+	engine.reconcile(context.Background())
+	engine.OverrideBreaker()
+	// The overridden pass finds nothing to remove; the override is used up.
+	reg.listFunc = func(ctx context.Context) ([]*domain.RecordIntent, error) { return nil, nil }
+	engine.reconcile(context.Background())
+
+	reg.listFunc = listing
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected a later mass removal to be blocked again, got %d removed", len(removed))
+	}
+}
+
+func TestSyncEngine_Breaker_ReplacedRecordsDoNotCount(t *testing.T) {
+	old := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	renumbered := makeIntent("app.example.com", domain.RecordA, "192.168.1.2")
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{old}, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovalPercent: 10}, renumbered)
+
+	engine.reconcile(context.Background())
+
+	if removed := reg.GetRemovedRecords(); len(removed) != 1 {
+		t.Errorf("expected a record replaced under the same name to be removed, got %d removed", len(removed))
+	}
+}
+
+func TestSyncEngine_Breaker_BlocksGC(t *testing.T) {
+	reg := &mockElectorRegistry{leader: "test-host"}
+	reg.listFunc = func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		listing, _ := orphanListing(ctx)
+		second := makeIntent("old2.example.com", domain.RecordA, "10.0.0.8")
+		second.Hostname, second.Wire = "dead-host", domain.WireInfo{Schema: domain.RecordSchema}
+		return append(listing, second), nil
+	}
+	cfg := config.BreakerConfig{MaxGCRemovals: 1, MaxRemovals: 1}
+	engine := breakerEngine(reg, cfg)
+	engine.cfg.GCInterval = 60
+	reporter := &recordingBreaker{}
+	engine.SetReconcileReporter(reporter)
+
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], nil); res.removed != 0 {
+		t.Errorf("expected GC to be blocked, got %d removed", res.removed)
+	}
+	if reason := reporter.reason(); !strings.Contains(reason, "2 of other hosts' 2 records by GC") {
+		t.Errorf("expected the blocked GC to be reported, got %q", reason)
+	}
+	// The next pass has no GC turn; the breaker stays tripped.
+	engine.reconcileCluster(context.Background(), engine.clusters[0], nil)
+	if reporter.reason() == "" {
+		t.Error("expected the GC breaker to stay tripped between collections")
+	}
+
+	engine.OverrideBreaker()
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], nil); res.removed != 2 {
+		t.Errorf("expected the override to collect at once, got %d removed", res.removed)
+	}
+	if reason := reporter.reason(); reason != "" {
+		t.Errorf("expected the breaker to be reset, got %q", reason)
+	}
+}
+
+func TestSyncEngine_Breaker_DryRunLogsOnly(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovals: 1})
+	engine.cfg.DryRun = true
+	reporter := &recordingBreaker{}
+	engine.SetReconcileReporter(reporter)
+
+	engine.reconcile(context.Background())
+
+	if reg.WasRemoveCalled() {
+		t.Error("expected no writes in dry-run")
+	}
+	if reporter.reason() == "" {
+		t.Error("expected the breaker to trip in dry-run too")
+	}
+}
+
+func TestSyncEngine_Breaker_ShowsInRunLoop(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	engine := breakerEngine(reg, config.BreakerConfig{MaxRemovals: 1})
+	reporter := &recordingBreaker{}
+	engine.SetReconcileReporter(reporter)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go func() { _ = engine.Run(ctx) }()
+
+	for reporter.reason() == "" {
+		if ctx.Err() != nil {
+			t.Fatal("expected the breaker to trip")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	engine.OverrideBreaker()
+	for len(reg.GetRemovedRecords()) != 2 {
+		if ctx.Err() != nil {
+			t.Fatal("expected the override to remove the blocked records")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// conflictKey identifies a desired record losing a conflict, in the filter
+// stage (no cluster) or in one cluster's plan.
+type conflictKey struct {
+	cluster     string
+	containerId string
+	code        domain.DecisionCode
+	record      string
+}
+
+// conflictResolutions are the decisions that leave a desired record
+// unpublished because of another record, and how each resolves the conflict.
+var conflictResolutions = map[domain.DecisionCode]ConflictResolution{
+	domain.DecisionDuplicate:      ResolvedByAge,
+	domain.DecisionLostToForce:    ResolvedByForce,
+	domain.DecisionLostOnAge:      ResolvedByAge,
+	domain.DecisionCNAMEConflict:  ResolvedByValidation,
+	domain.DecisionDuplicateCNAME: ResolvedByValidation,
+	domain.DecisionDuplicateValue: ResolvedByValidation,
+	domain.DecisionCNAMECycle:     ResolvedCNAMECycle,
+}
+
+// AddChangeSink registers an optional observer of the changes the engine
+// makes or sees (see domain.Change); every sink added gets every change.
+// Publish is called from the engine's goroutines and must not block. Must be
+// called before Run.
+func (se *SyncEngine) AddChangeSink(s changeSink) {
+	se.changes = append(se.changes, s)
+}
+
+// publish hands c to the change sinks, if any.
+func (se *SyncEngine) publish(c domain.Change) {
+	if len(se.changes) == 0 {
+		return
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	for _, s := range se.changes {
+		s.Publish(c)
+	}
+}
+
+// publishContainer reports that evt changed the records its container asks
+// for to intents.
+func (se *SyncEngine) publishContainer(evt domain.ContainerEvent, intents []*domain.RecordIntent) {
+	se.publish(domain.Change{
+		Type:          domain.ChangeContainer,
+		ContainerId:   evt.Container.Id,
+		ContainerName: evt.Container.Name,
+		Event:         evt.EventType,
+		Records:       intents,
+	})
+}
+
+// publishApplied reports the records a plan wrote to and deleted from cluster,
+// and the hosts it garbage-collected. decisions are the plan's, naming the
+// record that evicted each evicted one.
+func (se *SyncEngine) publishApplied(cluster string, added, removed []*domain.RecordIntent, decisions []domain.Decision) {
+	if len(se.changes) == 0 {
+		return
+	}
+	now := time.Now()
+	evictedBy := evictions(decisions)
+	for _, ri := range removed {
+		why := se.whyRemoved(ri, evictedBy)
+		se.publish(domain.Change{
+			Type: domain.ChangeRemoved, Time: now, Cluster: cluster, ContainerId: ri.ContainerId, ContainerName: ri.ContainerName, Record: ri,
+			Reason: string(why.reason), Detail: why.detail, Against: why.replacement,
+		})
+	}
+	for _, ri := range added {
+		se.publish(domain.Change{Type: domain.ChangeRegistered, Time: now, Cluster: cluster, ContainerId: ri.ContainerId, ContainerName: ri.ContainerName, Record: ri})
+	}
+
+	hosts := make(map[string]struct{})
+	var collected int
+	for _, ri := range removed {
+		if _, evicted := evictedBy[ri.Key()]; !evicted && ri.Hostname != se.cfg.Hostname {
+			hosts[ri.Hostname] = struct{}{}
+			collected++
+		}
+	}
+	if collected > 0 {
+		se.publish(domain.Change{Type: domain.ChangeGC, Time: now, Cluster: cluster, Hosts: sortedKeys(hosts), Removed: collected})
+	}
+}
+
+// removal says why a plan removed a record: reason, explained by detail, and
+// for an eviction the record that replaced it.
+type removal struct {
+	reason      domain.RemovalReason
+	detail      string
+	replacement *domain.RecordIntent
+}
+
+// evictions indexes a plan's eviction decisions by the key of the record each
+// one evicts.
+func evictions(decisions []domain.Decision) map[string]domain.Decision {
+	evictedBy := make(map[string]domain.Decision)
+	for _, d := range decisions {
+		if d.Code == domain.DecisionEvicts && d.Against != nil {
+			evictedBy[d.Against.Key()] = d
+		}
+	}
+	return evictedBy
+}
+
+// whyRemoved classifies the removal of ri by a plan: evicted by one of its
+// additions, a stale record of this host, or a record of a host without a
+// heartbeat, which GC collected.
+func (se *SyncEngine) whyRemoved(ri *domain.RecordIntent, evictedBy map[string]domain.Decision) removal {
+	if d, ok := evictedBy[ri.Key()]; ok {
+		return removal{
+			reason:      domain.RemovalEvicted,
+			detail:      d.Reason,
+			replacement: &domain.RecordIntent{ContainerId: d.ContainerId, ContainerName: d.ContainerName, Hostname: se.cfg.Hostname, Record: d.Record},
+		}
+	}
+	if ri.Hostname == se.cfg.Hostname {
+		return removal{reason: domain.RemovalStale, detail: "no running container asks for it anymore"}
+	}
+	return removal{reason: domain.RemovalGC, detail: fmt.Sprintf("its host %s has no heartbeat", ri.Hostname)}
+}
+
+// publishRemoved reports records of this host removed from cluster for
+// reason.
+func (se *SyncEngine) publishRemoved(cluster string, removed []*domain.RecordIntent, reason domain.RemovalReason) {
+	for _, ri := range removed {
+		se.publish(domain.Change{Type: domain.ChangeRemoved, Cluster: cluster, ContainerId: ri.ContainerId, ContainerName: ri.ContainerName, Record: ri, Reason: string(reason)})
+	}
+}
+
+// publishConflicts reports, and counts in the conflict metrics, the desired
+// records that lose a conflict in decisions but did not after the previous
+// pass; a conflict that persists is reported once. The clusters in failed were not planned this pass, so their
+// conflicts are carried over as they were.
+func (se *SyncEngine) publishConflicts(decisions []domain.Decision, failed map[string]struct{}) {
+	current := make(map[conflictKey]struct{})
+	for k := range se.conflicts {
+		if _, ok := failed[k.cluster]; ok && k.cluster != "" {
+			current[k] = struct{}{}
+		}
+	}
+	now := time.Now()
+	cm, _ := se.metrics.(conflictMetrics)
+	for _, d := range decisions {
+		resolution, ok := conflictResolutions[d.Code]
+		if !ok {
+			continue
+		}
+		k := conflictKey{cluster: d.Cluster, containerId: d.ContainerId, code: d.Code, record: d.Record.Render()}
+		current[k] = struct{}{}
+		if _, seen := se.conflicts[k]; seen {
+			continue
+		}
+		if cm != nil {
+			cm.IncConflict(string(resolution))
+		}
+		se.publish(domain.Change{
+			Type:          domain.ChangeConflict,
+			Time:          now,
+			Cluster:       d.Cluster,
+			ContainerId:   d.ContainerId,
+			ContainerName: d.ContainerName,
+			Record:        &domain.RecordIntent{ContainerId: d.ContainerId, ContainerName: d.ContainerName, Hostname: se.cfg.Hostname, Record: d.Record},
+			Reason:        string(d.Code),
+			Detail:        d.Reason,
+			Against:       d.Against,
+		})
+	}
+	se.conflicts = current
+}
+
+// sortedKeys returns the keys of set, sorted.
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// recordingSink records the changes published to it.
+type recordingSink struct {
+	mu      sync.Mutex
+	changes []domain.Change
+}
+
+func (s *recordingSink) Publish(c domain.Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, c)
+}
+
+// ofType returns the changes of type typ published so far.
+func (s *recordingSink) ofType(typ domain.ChangeType) []domain.Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []domain.Change
+	for _, c := range s.changes {
+		if c.Type == typ {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func TestSyncEngine_handleEvent_PublishesContainerChanges(t *testing.T) {
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, &mockRegistry{}, &mockState{markRemovedFunc: func(string) bool { return true }})
+	sink := &recordingSink{}
+	engine.AddChangeSink(sink)
+	container := domain.Container{Id: "c1", Name: "web", Labels: map[string]string{
+		"coredns.enabled": "true",
+		"coredns.a.name":  "web.example.com",
+		"coredns.a.value": "10.0.0.1",
+	}}
+
+	engine.handleEvent(domain.ContainerEvent{Container: container, EventType: domain.EventTypeContainerStarted})
+	engine.handleEvent(domain.ContainerEvent{Container: container, EventType: domain.EventTypeContainerDied})
+	engine.handleEvent(domain.ContainerEvent{Container: domain.Container{Id: "c2", Name: "plain"}, EventType: domain.EventTypeContainerStarted})
+
+	got := sink.ofType(domain.ChangeContainer)
+	if len(got) != 2 {
+		t.Fatalf("expected a change for the start and the death of c1 only, got %+v", got)
+	}
+	if got[0].Event != domain.EventTypeContainerStarted || got[0].ContainerName != "web" || len(got[0].Records) != 1 || got[0].Time.IsZero() {
+		t.Errorf("unexpected start change %+v", got[0])
+	}
+	if got[1].Event != domain.EventTypeContainerDied || len(got[1].Records) != 0 {
+		t.Errorf("unexpected death change %+v", got[1])
+	}
+}
+
+func TestSyncEngine_reconcileCluster_PublishesAppliedChanges(t *testing.T) {
+	// A desired A record evicts another host's younger CNAME; a stale record
+	// of this host and a dead host's record are removed.
+	desired := makeIntent("app.example.com", domain.RecordA, "10.0.0.1")
+	desired.Created = time.Now().Add(-time.Hour)
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "other.example.com")
+	cname.Hostname, cname.ContainerName = "other-host", "other"
+	stale := makeIntent("stale.example.com", domain.RecordA, "10.0.0.2")
+	orphan := makeIntent("old.example.com", domain.RecordA, "10.0.0.9")
+	orphan.Hostname, orphan.Wire = "dead-host", domain.WireInfo{Schema: domain.RecordSchema}
+	reg := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			return []*domain.RecordIntent{cname, stale, orphan}, nil
+		},
+		getLiveHostnamesFunc: func(ctx context.Context) (map[string]struct{}, error) {
+			return map[string]struct{}{"test-host": {}, "other-host": {}}, nil
+		},
+	}
+	engine := breakerEngine(reg, config.BreakerConfig{}, desired)
+	sink := &recordingSink{}
+	engine.AddChangeSink(sink)
+
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], []*domain.RecordIntent{desired}); res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+
+	registered := sink.ofType(domain.ChangeRegistered)
+	if len(registered) != 1 || registered[0].Record.Key() != desired.Key() || registered[0].Cluster != config.DefaultEtcdClusterName {
+		t.Errorf("expected the desired record registered, got %+v", registered)
+	}
+	reasons := map[string]domain.Change{}
+	for _, c := range sink.ofType(domain.ChangeRemoved) {
+		reasons[c.Record.Record.Name] = c
+	}
+	if c := reasons["app.example.com"]; c.Reason != string(domain.RemovalEvicted) || c.Against == nil || c.Against.Record != desired.Record {
+		t.Errorf("expected the CNAME evicted by the A record, got %+v", c)
+	}
+	if c := reasons["stale.example.com"]; c.Reason != string(domain.RemovalStale) {
+		t.Errorf("expected the stale record removed as stale, got %+v", c)
+	}
+	if c := reasons["old.example.com"]; c.Reason != string(domain.RemovalGC) {
+		t.Errorf("expected the orphan removed by GC, got %+v", c)
+	}
+	gc := sink.ofType(domain.ChangeGC)
+	if len(gc) != 1 || gc[0].Removed != 1 || len(gc[0].Hosts) != 1 || gc[0].Hosts[0] != "dead-host" {
+		t.Errorf("expected one GC change for dead-host, got %+v", gc)
+	}
+}
+
+func TestSyncEngine_reconcile_PausedPublishesNoRecords(t *testing.T) {
+	engine := breakerEngine(&mockRegistry{}, config.BreakerConfig{}, makeIntent("app.example.com", domain.RecordA, "10.0.0.1"))
+	engine.setPaused(true)
+	sink := &recordingSink{}
+	engine.AddChangeSink(sink)
+
+	engine.reconcile(context.Background())
+
+	if got := sink.ofType(domain.ChangeRegistered); len(got) != 0 {
+		t.Errorf("expected a paused pass to report no writes, got %+v", got)
+	}
+}
+
+func TestSyncEngine_reconcile_PublishesNewConflictsOnce(t *testing.T) {
+	// A younger desired A record loses to another host's CNAME.
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "other.example.com")
+	cname.Hostname, cname.Created = "other-host", time.Now().Add(-time.Hour)
+	conflicted := true
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		if conflicted {
+			return []*domain.RecordIntent{cname}, nil
+		}
+		return nil, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{}, makeIntent("app.example.com", domain.RecordA, "10.0.0.1"))
+	engine.setPaused(true) // keep the registry as listed
+	sink := &recordingSink{}
+	engine.AddChangeSink(sink)
+
+	engine.reconcile(context.Background())
+	engine.reconcile(context.Background())
+	got := sink.ofType(domain.ChangeConflict)
+	if len(got) != 1 || got[0].Cluster != config.DefaultEtcdClusterName || got[0].Against != cname || got[0].Reason == "" {
+		t.Fatalf("expected the conflict reported once, got %+v", got)
+	}
+
+	// Once resolved, a new occurrence is reported again.
+	conflicted = false
+	engine.reconcile(context.Background())
+	conflicted = true
+	engine.reconcile(context.Background())
+	if got := sink.ofType(domain.ChangeConflict); len(got) != 2 {
+		t.Errorf("expected the recurring conflict reported again, got %d changes", len(got))
+	}
+}
+
+func TestSyncEngine_deregister_PublishesRemovals(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	sink := &recordingSink{}
+	engine.AddChangeSink(sink)
+
+	if _, err := engine.deregisterCluster(context.Background(), engine.clusters[0], engine.logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := sink.ofType(domain.ChangeRemoved)
+	if len(got) != 2 || got[0].Reason != string(domain.RemovalDeregistered) {
+		t.Errorf("expected both records reported as deregistered, got %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// controlAction is an operator request handled by the Run loop.
+type controlAction int
+
+const (
+	controlReconcile controlAction = iota
+	controlPause
+	controlResume
+)
+
+type controlRequest struct {
+	action controlAction
+	reply  chan controlReply
+}
+
+type controlReply struct {
+	// result is the outcome of the pass a controlReconcile ran.
+	result domain.PassResult
+	// changed reports whether a controlPause or controlResume changed the
+	// paused state.
+	changed bool
+}
+
+// Reconcile runs a reconciliation pass as soon as the current one, if any,
+// finishes, and returns its outcome. It fails with ctx's error if ctx ends
+// first, and with domain.ErrEngineStopped if Run is not running. Safe to call
+// from any goroutine.
+func (se *SyncEngine) Reconcile(ctx context.Context) (domain.PassResult, error) {
+	reply, err := se.control(ctx, controlReconcile)
+	return reply.result, err
+}
+
+// Pause stops the engine from writing to its registries, like a dry-run
+// enabled at runtime: container events are still tracked and every pass still
+// plans, but the plan is only logged. It takes effect between passes, and
+// reports whether the engine was running unpaused. Errors are as for
+// Reconcile.
+func (se *SyncEngine) Pause(ctx context.Context) (bool, error) {
+	reply, err := se.control(ctx, controlPause)
+	return reply.changed, err
+}
+
+// Resume undoes Pause and runs a pass to apply what changed meanwhile. It
+// reports whether the engine was paused. Errors are as for Reconcile.
+func (se *SyncEngine) Resume(ctx context.Context) (bool, error) {
+	reply, err := se.control(ctx, controlResume)
+	return reply.changed, err
+}
+
+// Paused reports whether the engine is paused (see Pause). Safe to call from
+// any goroutine.
+func (se *SyncEngine) Paused() bool {
+	return se.paused.Load()
+}
+
+// control hands action to the Run loop and waits for its reply.
+func (se *SyncEngine) control(ctx context.Context, action controlAction) (controlReply, error) {
+	req := controlRequest{action: action, reply: make(chan controlReply, 1)}
+	select {
+	case se.controls <- req:
+	case <-se.done:
+		return controlReply{}, domain.ErrEngineStopped
+	case <-ctx.Done():
+		return controlReply{}, ctx.Err()
+	}
+	select {
+	case reply := <-req.reply:
+		return reply, nil
+	case <-ctx.Done():
+		// The loop still completes the action; only its outcome is lost.
+		return controlReply{}, ctx.Err()
+	}
+}
+
+// handleControl performs action on the Run loop, using runPass to run a pass.
+func (se *SyncEngine) handleControl(action controlAction, runPass func(TriggerReason) domain.PassResult) controlReply {
+	switch action {
+	case controlReconcile:
+		return controlReply{result: runPass(TriggerManual)}
+	case controlPause:
+		if !se.setPaused(true) {
+			return controlReply{}
+		}
+		se.logger.Warn().Msg("Paused: container events are still tracked, but no records are written until resumed")
+		return controlReply{changed: true}
+	case controlResume:
+		if !se.setPaused(false) {
+			return controlReply{}
+		}
+		se.logger.Info().Msg("Resumed: applying the changes made while paused")
+		se.requestReconcile(TriggerManual)
+		return controlReply{changed: true}
+	}
+	return controlReply{}
+}
+
+// setPaused sets the paused state and reports whether it changed.
+func (se *SyncEngine) setPaused(paused bool) bool {
+	if se.paused.Swap(paused) == paused {
+		return false
+	}
+	if r, ok := se.reporter.(pauseReporter); ok {
+		r.SetPaused(paused)
+	}
+	if m, ok := se.metrics.(pauseMetrics); ok {
+		m.SetPaused(paused)
+	}
+	return true
+}
+
+// writeMode returns why the engine must not write to its registries — the
+// log prefix "dry-run" or "paused" — or "" if it may.
+func (se *SyncEngine) writeMode() string {
+	switch {
+	case se.cfg.DryRun:
+		return "dry-run"
+	case se.paused.Load():
+		return "paused"
+	}
+	return ""
+}
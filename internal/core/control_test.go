@@ -0,0 +1,157 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// pauseRecorder is a reconcile reporter that is also told of pauses.
+type pauseRecorder struct {
+	recordingReporter
+	pmu    sync.Mutex
+	paused []bool
+}
+
+func (r *pauseRecorder) SetPaused(paused bool) {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	r.paused = append(r.paused, paused)
+}
+
+// runEngine runs engine until the test ends.
+func runEngine(t *testing.T, engine *SyncEngine) {
+	t.Helper()
+	engine.cfg.ReconcileSafetyInterval = 60
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = engine.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestSyncEngine_Reconcile_ReturnsOutcome(t *testing.T) {
+	reg := &mockRegistry{}
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	engine := breakerEngine(reg, config.BreakerConfig{}, added)
+	runEngine(t, engine)
+
+	res, err := engine.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.StartedAt.IsZero() || res.Err != nil || len(res.Clusters) != 1 || res.Clusters[0].Cluster != config.DefaultEtcdClusterName {
+		t.Errorf("unexpected outcome %+v", res)
+	}
+	if len(reg.GetRegisteredRecords()) == 0 {
+		t.Error("expected the pass to register the desired record")
+	}
+}
+
+func TestSyncEngine_Reconcile_ReportsFailure(t *testing.T) {
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return nil, errors.New("etcd unavailable")
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	runEngine(t, engine)
+
+	res, err := engine.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Err == nil || res.Clusters[0].Err == nil {
+		t.Errorf("expected the pass to report the listing error, got %+v", res)
+	}
+}
+
+func TestSyncEngine_Pause_StopsWrites(t *testing.T) {
+	reg := &mockRegistry{}
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	engine := breakerEngine(reg, config.BreakerConfig{}, added)
+	reporter := &pauseRecorder{}
+	engine.SetReconcileReporter(reporter)
+	runEngine(t, engine)
+
+	if changed, err := engine.Pause(context.Background()); err != nil || !changed {
+		t.Fatalf("expected to pause, got changed=%t err=%v", changed, err)
+	}
+	if changed, _ := engine.Pause(context.Background()); changed {
+		t.Error("expected a second pause to change nothing")
+	}
+	// Let the startup pass, if it is still pending, run paused too.
+	time.Sleep(50 * time.Millisecond)
+	before := len(reg.GetRegisteredRecords())
+	res, err := engine.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Paused || res.Added != 0 || len(reg.GetRegisteredRecords()) != before {
+		t.Errorf("expected a paused pass to write nothing, got %+v", res)
+	}
+	if !engine.Paused() || !engine.Snapshot().Paused {
+		t.Error("expected the engine and its snapshot to report the pause")
+	}
+
+	if changed, err := engine.Resume(context.Background()); err != nil || !changed {
+		t.Fatalf("expected to resume, got changed=%t err=%v", changed, err)
+	}
+	if changed, _ := engine.Resume(context.Background()); changed {
+		t.Error("expected a second resume to change nothing")
+	}
+	res, err = engine.Reconcile(context.Background())
+	if err != nil || res.Paused || len(reg.GetRegisteredRecords()) == before {
+		t.Errorf("expected writes to resume, got %+v (err %v)", res, err)
+	}
+
+	reporter.pmu.Lock()
+	defer reporter.pmu.Unlock()
+	if len(reporter.paused) != 2 || !reporter.paused[0] || reporter.paused[1] {
+		t.Errorf("expected the reporter to be told of the pause and resume, got %v", reporter.paused)
+	}
+}
+
+func TestSyncEngine_Resume_RequestsPass(t *testing.T) {
+	engine := breakerEngine(&mockRegistry{}, config.BreakerConfig{})
+	engine.setPaused(true)
+
+	reply := engine.handleControl(controlResume, func(TriggerReason) domain.PassResult { return domain.PassResult{} })
+
+	if !reply.changed {
+		t.Error("expected the resume to change the state")
+	}
+	expectTrigger(t, engine, TriggerManual)
+}
+
+func TestSyncEngine_Control_NotRunning(t *testing.T) {
+	engine := breakerEngine(&mockRegistry{}, config.BreakerConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := engine.Reconcile(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to wait for Run, got %v", err)
+	}
+
+	runCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = engine.Run(runCtx)
+	}()
+	stop()
+	<-done
+	if _, err := engine.Pause(context.Background()); !errors.Is(err, domain.ErrEngineStopped) {
+		t.Errorf("expected ErrEngineStopped once Run returned, got %v", err)
+	}
+}
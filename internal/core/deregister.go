@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// deregister removes every record this host owns from each cluster, for
+// app.deregister_on_shutdown, within app.deregister_timeout. Clusters are
+// deregistered concurrently. Records left behind, e.g. because a cluster is
+// unreachable, are garbage-collected by the other hosts once this host's
+// heartbeat expires.
+func (se *SyncEngine) deregister() {
+	timeout := time.Duration(se.cfg.DeregisterTimeout * float64(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	id := logger.NewReconcileID()
+	ctx = logger.WithReconcileID(ctx, id)
+	ctx, span := se.tracer.Start(ctx, "engine.deregister", trace.WithAttributes(attribute.String("reconcile.id", id)))
+	defer span.End()
+
+	var wg sync.WaitGroup
+	for _, c := range se.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger := logger.FromContext(ctx, se.logger).With().Str("cluster", c.Name).Logger()
+			removed, err := se.deregisterCluster(ctx, c, logger)
+			if err != nil {
+				logger.Error().Err(err).Int("removed", removed).Msg("could not remove all of this host's records on shutdown; other hosts collect the rest once its heartbeat expires")
+				return
+			}
+			logger.Info().Int("removed", removed).Msg("Removed this host's records on shutdown")
+		}()
+	}
+	wg.Wait()
+}
+
+// deregisterCluster removes the records this host owns in c under the lock,
+// and returns how many it removed. In dry-run, it only logs them.
+func (se *SyncEngine) deregisterCluster(ctx context.Context, c Cluster, logger zerolog.Logger) (total int, err error) {
+	ctx, span := se.tracer.Start(ctx, "engine.deregister_cluster", trace.WithAttributes(attribute.String("cluster", c.Name)))
+	defer func() {
+		span.SetAttributes(attribute.Int("reconcile.removed", total))
+		tracing.End(span, err)
+	}()
+	reg := c.Registry
+	for attempt := 1; ; attempt++ {
+		actual, err := reg.List(ctx)
+		if err != nil {
+			return total, fmt.Errorf("error listing registry records: %w", err)
+		}
+		var owned []*domain.RecordIntent
+		for _, ri := range actual {
+			if ri.Hostname == se.cfg.Hostname {
+				owned = append(owned, ri)
+			}
+		}
+		if se.cfg.DryRun {
+			for _, rec := range owned {
+				logger.Info().Str("record", rec.Record.Render()).Str("owner_hostname", rec.Hostname).Str("container_id", rec.ContainerId).Msg("[dry-run] would remove record on shutdown")
+			}
+			return 0, nil
+		}
+		if len(owned) == 0 {
+			return total, nil
+		}
+
+		var applied []domain.Mutation
+		err = reg.LockTransaction(ctx, lockNames(nil, owned, actual), func(ctx context.Context) error {
+			var err error
+			if applier, ok := reg.(planApplier); ok {
+				applied, err = applier.ApplyPlan(ctx, nil, owned)
+			} else {
+				applied, err = se.applyEach(ctx, reg, nil, owned, logger)
+			}
+			return err
+		})
+		_, removed := domain.SplitMutations(applied)
+		total += len(removed)
+		se.auditDeregistered(c.Name, applied, logger)
+		se.publishRemoved(c.Name, removed, domain.RemovalDeregistered)
+		if err == nil {
+			return total, nil
+		}
+		if !errors.Is(err, domain.ErrPlanConflict) || attempt >= maxPlanAttempts {
+			return total, err
+		}
+		logger.Warn().Err(err).Int("attempt", attempt).Msg("registry changed since it was listed; listing again")
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// mixedListing lists n records owned by this host and one owned by a peer.
+func mixedListing(n int) func(ctx context.Context) ([]*domain.RecordIntent, error) {
+	return func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		out, _ := ownListing(n)(ctx)
+		peer := makeIntent("peer.example.com", domain.RecordA, "192.168.1.9")
+		peer.Hostname = "peer-host"
+		return append(out, peer), nil
+	}
+}
+
+func deregisterEngine(reg upstreamRegistry, desired ...*domain.RecordIntent) *SyncEngine {
+	cfg := testAppConfig()
+	cfg.ReconcileSafetyInterval = 60
+	cfg.DeregisterOnShutdown = true
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return desired }}
+	return NewSyncEngine(engineTestLogger(), cfg, &mockGenerator{}, reg, state)
+}
+
+func TestSyncEngine_Deregister_RemovesOwnRecordsOnly(t *testing.T) {
+	reg := &mockRegistry{listFunc: mixedListing(2)}
+	var locked []string
+	reg.lockTransactionFunc = func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+		locked = keys
+		return fn(ctx)
+	}
+	engine := deregisterEngine(reg)
+
+	engine.deregister()
+
+	removed := reg.GetRemovedRecords()
+	if len(removed) != 2 {
+		t.Fatalf("expected this host's 2 records to be removed, got %d", len(removed))
+	}
+	for _, ri := range removed {
+		if ri.Hostname != "test-host" {
+			t.Errorf("expected only this host's records to be removed, got one owned by %q", ri.Hostname)
+		}
+	}
+	if fmt.Sprint(locked) != "[app0.example.com app1.example.com]" {
+		t.Errorf("expected the removed names to be locked, got %v", locked)
+	}
+}
+
+func TestSyncEngine_Deregister_ReplansOnConflict(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(1)}
+	var attempts int
+	reg.lockTransactionFunc = func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+		attempts++
+		if attempts == 1 {
+			return domain.ErrPlanConflict
+		}
+		return fn(ctx)
+	}
+	engine := deregisterEngine(reg)
+
+	engine.deregister()
+
+	if attempts != 2 || len(reg.GetRemovedRecords()) != 1 {
+		t.Errorf("expected the record to be removed on the second attempt, got %d attempt(s) and %d removed", attempts, len(reg.GetRemovedRecords()))
+	}
+}
+
+func TestSyncEngine_Deregister_GivesUpAfterTimeout(t *testing.T) {
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	engine := deregisterEngine(reg)
+	engine.cfg.DeregisterTimeout = 0.05
+
+	start := time.Now()
+	engine.deregister()
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected deregistering to stop after app.deregister_timeout, took %v", elapsed)
+	}
+}
+
+func TestSyncEngine_Deregister_DryRunLogsOnly(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	engine := deregisterEngine(reg)
+	engine.cfg.DryRun = true
+
+	engine.deregister()
+
+	if reg.WasRemoveCalled() || reg.WasLockTransactionCalled() {
+		t.Error("expected no writes in dry-run")
+	}
+}
+
+func TestSyncEngine_Run_DeregistersBeforeStoppingHeartbeat(t *testing.T) {
+	reg := &mockRegistry{listFunc: mixedListing(2)}
+	stoppedFirst := false
+	reg.removeFunc = func(ctx context.Context, record *domain.RecordIntent) error {
+		if reg.WasStopHeartbeatCalled() {
+			stoppedFirst = true
+		}
+		return ctx.Err()
+	}
+	desired, _ := ownListing(2)(context.Background())
+	engine := deregisterEngine(reg, desired...)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_ = engine.Run(ctx)
+
+	if removed := reg.GetRemovedRecords(); len(removed) != 2 {
+		t.Fatalf("expected this host's 2 records to be removed on shutdown, got %d", len(removed))
+	}
+	if stoppedFirst {
+		t.Error("expected the records to be removed before the heartbeat stopped")
+	}
+	if !reg.WasStopHeartbeatCalled() {
+		t.Error("expected the heartbeat to be stopped")
+	}
+}
+
+func TestSyncEngine_Run_KeepsRecordsByDefault(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	desired, _ := ownListing(2)(context.Background())
+	engine := deregisterEngine(reg, desired...)
+	engine.cfg.DeregisterOnShutdown = false
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_ = engine.Run(ctx)
+
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected records to be kept across restarts, got %d removed", len(removed))
+	}
+}
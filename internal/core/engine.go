@@ -2,35 +2,149 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerName is the instrumentation scope of the engine's spans.
+const tracerName = "github.com/auto-dns/docker-coredns-sync/internal/core"
+
 // SyncEngine coordinates event ingestion, state updates, and registry reconciliation.
 type SyncEngine struct {
 	logger   zerolog.Logger
 	cfg      *config.AppConfig
 	gen      generator
 	state    state
-	reg      upstreamRegistry
+	clusters []Cluster
 	reporter reconcileReporter
 	metrics  reconcileMetrics
+	changes  []changeSink
+	audits   []auditSink
+	tracer   trace.Tracer
+	// triggers carries requests for a reconciliation pass outside the
+	// periodic tick. It is buffered and written without blocking: a request
+	// that finds it full is already covered by the pending ones.
+	triggers chan TriggerReason
+
+	// lastGC is when each cluster last took its turn at cross-host GC (see
+	// gcTurn). Clusters are reconciled concurrently.
+	gcMu   sync.Mutex
+	lastGC map[string]time.Time
+
+	// breakers is the removal breaker state of each cluster after its latest
+	// pass, and breakerOverrides the clusters whose next pass may apply the
+	// removals their breaker blocked (see OverrideBreaker).
+	breakerMu        sync.Mutex
+	breakers         map[string]breakerTrip
+	breakerOverrides map[string]struct{}
+
+	// startup holds back removals of this host's records until it has seen
+	// every running container (see startupGate). Only Run arms it.
+	startupMu sync.Mutex
+	startup   startupGate
+
+	// snapshot is what the latest pass saw and planned (see Snapshot).
+	snapshotMu sync.RWMutex
+	snapshot   domain.Snapshot
+
+	// labelDecisions is, per container id, what parsing its labels decided
+	// about records that yield no intent (see Trail).
+	labelMu        sync.Mutex
+	labelDecisions map[string][]domain.Decision
+
+	// controls carries operator requests (see Reconcile and Pause) to the Run
+	// loop, which handles them between passes. done is closed once Run
+	// returns, failing the requests still waiting.
+	controls chan controlRequest
+	done     chan struct{}
+	// paused stops writes to the registries while events are still tracked
+	// (see Pause). Only the Run loop changes it, between passes.
+	paused atomic.Bool
+
+	// conflicts are the desired records losing a conflict after the latest
+	// pass, so each is reported once (see publishConflicts). Only reconcile
+	// uses it.
+	conflicts map[conflictKey]struct{}
+	// trigger is what started the pass in progress, for the audit log. Only
+	// the Run loop sets it, before the pass starts.
+	trigger TriggerReason
 }
 
+// TriggerReason records why a reconciliation pass ran. It is used as a log
+// field and a metric label.
+type TriggerReason string
+
+const (
+	// TriggerEvent is a pass run, after the debounce, because a container
+	// event changed the desired state.
+	TriggerEvent TriggerReason = "event"
+	// TriggerTick is the periodic safety-net pass run every
+	// reconcile_safety_interval, or the retry of a failed pass.
+	TriggerTick TriggerReason = "tick"
+	// TriggerManual is a pass requested explicitly through TriggerReconcile.
+	TriggerManual TriggerReason = "manual"
+	// TriggerStartup is the pass run once startup completes, to remove the
+	// stale records of this host held back until then.
+	TriggerStartup TriggerReason = "startup"
+	// TriggerShutdown marks the removals of app.deregister_on_shutdown in the
+	// audit log; it never starts a pass.
+	TriggerShutdown TriggerReason = "shutdown"
+)
+
+// Cluster is a named registry the engine publishes records to. Every cluster
+// is reconciled independently, with its own lock, listing and diff, so a
+// failure on one never blocks or rolls back the others.
+type Cluster struct {
+	Name     string
+	Registry upstreamRegistry
+}
+
+// NewSyncEngine creates an engine publishing to the single registry reg, named
+// config.DefaultEtcdClusterName.
 func NewSyncEngine(logger zerolog.Logger, cfg *config.AppConfig, gen generator, reg upstreamRegistry, state state) *SyncEngine {
+	return NewMultiClusterSyncEngine(logger, cfg, gen, []Cluster{{Name: config.DefaultEtcdClusterName, Registry: reg}}, state)
+}
+
+// NewMultiClusterSyncEngine creates an engine that mirrors every record to
+// each of clusters.
+func NewMultiClusterSyncEngine(logger zerolog.Logger, cfg *config.AppConfig, gen generator, clusters []Cluster, state state) *SyncEngine {
 	return &SyncEngine{
-		logger: logger,
-		cfg:    cfg,
-		gen:    gen,
-		reg:    reg,
-		state:  state,
+		logger:   logger,
+		cfg:      cfg,
+		gen:      gen,
+		clusters: clusters,
+		state:    state,
+		tracer:   tracing.Tracer(nil, tracerName),
+		triggers: make(chan TriggerReason, 16),
+		lastGC:   make(map[string]time.Time),
+
+		breakers:         make(map[string]breakerTrip),
+		breakerOverrides: make(map[string]struct{}),
+		labelDecisions:   make(map[string][]domain.Decision),
+		controls:         make(chan controlRequest),
+		done:             make(chan struct{}),
 	}
 }
 
+// SetTracerProvider traces event handling and reconciliation passes with tp;
+// the registries' spans nest within them. Safe to leave unset. Must be called
+// before Run.
+func (se *SyncEngine) SetTracerProvider(tp trace.TracerProvider) {
+	se.tracer = tracing.Tracer(tp, tracerName)
+}
+
 // SetReconcileReporter registers an optional observer that is notified of the
 // outcome of each reconciliation pass. Safe to leave unset.
 func (se *SyncEngine) SetReconcileReporter(r reconcileReporter) {
@@ -43,35 +157,76 @@ func (se *SyncEngine) SetMetrics(m reconcileMetrics) {
 	se.metrics = m
 }
 
-func (se *SyncEngine) handleEvent(evt domain.ContainerEvent) {
+// TriggerReconcile requests a reconciliation pass as soon as the current one,
+// if any, finishes. Unlike container events it is not debounced. Safe to call
+// from any goroutine, before or during Run.
+func (se *SyncEngine) TriggerReconcile() {
+	se.requestReconcile(TriggerManual)
+}
+
+func (se *SyncEngine) requestReconcile(reason TriggerReason) {
+	select {
+	case se.triggers <- reason:
+	default:
+	}
+}
+
+// handleEvent applies evt to the state tracker and reports whether the
+// desired state may have changed.
+func (se *SyncEngine) handleEvent(evt domain.ContainerEvent) bool {
 	switch {
 	case evt.EventType == domain.EventTypeResync:
+		se.markListed()
 		running := make(map[string]struct{}, len(evt.RunningContainerIds))
 		for _, id := range evt.RunningContainerIds {
 			running[id] = struct{}{}
 		}
+		se.retainLabelDecisions(running)
 		if removed := se.state.RetainRunning(running); removed > 0 {
 			se.logger.Info().Int("removed", removed).Msg("Pruned state for containers no longer running after resync")
+			return true
 		}
 	case evt.Container.Id == "":
 		se.logger.Warn().Str("event_payload", fmt.Sprintf("%+v", evt)).Msg("handled container event with no container id")
 	case !evt.EventType.IsValid():
 		se.logger.Warn().Str("container_id", evt.Container.Id).Str("event_type", string(evt.EventType)).Msg("handled unsupported event type")
 	case evt.EventType == domain.EventTypeInitialContainerDetection, evt.EventType == domain.EventTypeContainerStarted:
-		intents := GetContainerRecordIntents(evt, se.cfg, se.logger)
+		trail := NewTrail()
+		intents := GetContainerRecordIntents(evt, se.cfg, trail, se.logger.With().Str("container_id", evt.Container.Id).Logger())
+		se.setLabelDecisions(evt.Container.Id, trail.Decisions())
+		se.countLabelErrors(evt.Container.Name, trail.Decisions())
 		if len(intents) > 0 {
 			se.state.Upsert(evt.Container.Id, evt.Container.Name, evt.Container.Created, intents, domain.StatusRunning)
-			se.logger.Info().Msgf("Upserted state for container %s", evt.Container.Id)
+			se.logger.Info().Str("container_id", evt.Container.Id).Int("records", len(intents)).Msg("Upserted state for container")
+			se.publishContainer(evt, intents)
+			return true
 		}
 	case evt.EventType == domain.EventTypeContainerStopped, evt.EventType == domain.EventTypeContainerDied:
+		se.setLabelDecisions(evt.Container.Id, nil)
 		if removed := se.state.MarkRemoved(evt.Container.Id); removed {
-			se.logger.Info().Msgf("Marked container %s as removed", evt.Container.Id)
+			se.logger.Info().Str("container_id", evt.Container.Id).Msg("Marked container as removed")
+			se.publishContainer(evt, nil)
+			return true
 		}
 	}
+	return false
+}
+
+// handleEventTraced is handleEvent within a span of its own.
+func (se *SyncEngine) handleEventTraced(ctx context.Context, evt domain.ContainerEvent) bool {
+	_, span := se.tracer.Start(ctx, "engine.handle_event", trace.WithAttributes(
+		attribute.String("container.id", evt.Container.Id),
+		attribute.String("docker.event", string(evt.EventType)),
+	))
+	defer span.End()
+	changed := se.handleEvent(evt)
+	span.SetAttributes(attribute.Bool("state.changed", changed))
+	return changed
 }
 
 func (se *SyncEngine) Run(ctx context.Context) error {
 	se.logger.Info().Msg("Starting SyncEngine")
+	defer close(se.done)
 
 	// Surface configuration that will silently drop records, prominently, once
 	// at startup rather than only as per-record warnings buried in the logs.
@@ -88,10 +243,19 @@ func (se *SyncEngine) Run(ctx context.Context) error {
 	// therefore cross-host GC participation) is skipped.
 	if se.cfg.DryRun {
 		se.logger.Info().Msg("dry-run: skipping heartbeat; this host will not publish liveness or participate in cross-host GC")
-	} else if err := se.reg.StartHeartbeat(ctx); err != nil {
-		se.logger.Error().Err(err).Msg("failed to start heartbeat; cross-host GC will be disabled this run")
+	} else {
+		for _, c := range se.clusters {
+			if err := c.Registry.StartHeartbeat(ctx); err != nil {
+				se.logger.Error().Err(err).Str("cluster", c.Name).Msg("failed to start heartbeat; cross-host GC will be disabled this run")
+			}
+		}
 	}
 
+	// Hold back removals of this host's records until the generator has
+	// listed every running container; additions are applied meanwhile.
+	stopStartup := se.armStartup()
+	defer stopStartup()
+
 	// Step 1: Subscribe to Docker events
 	eventCh, err := se.gen.Subscribe(ctx)
 	if err != nil {
@@ -108,7 +272,9 @@ func (se *SyncEngine) Run(ctx context.Context) error {
 					se.logger.Info().Msg("Event channel closed")
 					return
 				}
-				se.handleEvent(evt)
+				if se.handleEventTraced(ctx, evt) {
+					se.requestReconcile(TriggerEvent)
+				}
 			case <-ctx.Done():
 				se.logger.Info().Msg("Stopping event processing")
 				return
@@ -116,81 +282,569 @@ func (se *SyncEngine) Run(ctx context.Context) error {
 		}
 	}()
 
-	// Step 3: Launch the main reconciliation loop.
+	// Step 3: Launch the main reconciliation loop. State changes trigger a
+	// pass once events have been quiet for reconcile_debounce (but never later
+	// than reconcile_max_delay after the first of them); the ticker is a
+	// safety net that catches anything the events missed, such as records
+	// changed in the registry behind our back. A failed pass is retried every
+	// poll_interval instead.
 	se.logger.Info().Msg("Launching reconciliation loop")
-	ticker := time.NewTicker(time.Duration(se.cfg.PollInterval) * time.Second)
+	safetyInterval := time.Duration(se.cfg.ReconcileSafetyInterval * float64(time.Second))
+	retryInterval := min(time.Duration(se.cfg.PollInterval)*time.Second, safetyInterval)
+	debounce := time.Duration(se.cfg.ReconcileDebounce * float64(time.Second))
+	maxDelay := time.Duration(se.cfg.ReconcileMaxDelay * float64(time.Second))
+	ticker := time.NewTicker(safetyInterval)
 	defer ticker.Stop()
+
+	var (
+		debounceTimer *time.Timer
+		debounceC     <-chan time.Time
+		pendingSince  time.Time
+		pendingEvents int
+	)
+	clearPending := func() {
+		if debounceTimer != nil {
+			debounceTimer.Stop()
+		}
+		debounceC = nil
+		pendingEvents = 0
+	}
+	defer clearPending()
+	runPass := func(reason TriggerReason) domain.PassResult {
+		logEvt := se.logger.Debug().Str("trigger", string(reason))
+		if pendingEvents > 0 {
+			logEvt = logEvt.Int("coalesced_events", pendingEvents)
+		}
+		logEvt.Msg("Reconciliation triggered")
+		// Any pass reads the whole current state, so it covers every event
+		// that was still waiting out its debounce.
+		clearPending()
+		if m, ok := se.metrics.(reconcileTriggerMetrics); ok {
+			m.IncReconcileTrigger(string(reason))
+		}
+		se.trigger = reason
+		result := se.reconcile(ctx)
+		// The state was just reconciled; the safety net can wait a full
+		// interval from here, unless the pass has to be retried.
+		if result.Err != nil {
+			ticker.Reset(retryInterval)
+		} else {
+			ticker.Reset(safetyInterval)
+		}
+		return result
+	}
+
 	for {
 		select {
 		case <-ticker.C:
-			se.logger.Debug().Msg("Reconciliation loop tick")
-			start := time.Now()
-			var added, removed, skipped int
-			err := se.reg.LockTransaction(ctx, []string{"__global__"}, func() error {
-				actual, err := se.reg.List(ctx)
-				if err != nil {
-					return fmt.Errorf("error listing registry records: %w", err)
-				}
-				// Live host set drives cross-host GC. On error, fall back to nil
-				// (GC disabled this tick) rather than risk deleting live records.
-				liveHosts, err := se.reg.GetLiveHostnames(ctx)
-				if err != nil {
-					se.logger.Warn().Err(err).Msg("could not fetch live hostnames; skipping cross-host GC this tick")
-					liveHosts = nil
-				}
-				desired := se.state.GetAllDesiredRecordIntents()
-				// Filter out any internally inconsistent intents:
-				desiredReconciled := FilterRecordIntents(desired, se.logger)
-				skipped = len(desired) - len(desiredReconciled)
-				toAdd, toRemove := ReconcileAndValidate(desiredReconciled, actual, se.cfg, liveHosts, se.logger)
-				if se.cfg.DryRun {
-					for _, rec := range toRemove {
-						se.logger.Info().Str("record", rec.Render()).Msg("[dry-run] would remove record")
-					}
-					for _, rec := range toAdd {
-						se.logger.Info().Str("record", rec.Render()).Msg("[dry-run] would register record")
-					}
-					return nil
-				}
-				var writeErrs int
-				for _, rec := range toRemove {
-					if err := se.reg.Remove(ctx, rec); err != nil {
-						writeErrs++
-						se.logger.Error().Err(err).Msg("Error removing record")
-					} else {
-						removed++
-					}
-				}
-				for _, rec := range toAdd {
-					if err := se.reg.Register(ctx, rec); err != nil {
-						writeErrs++
-						se.logger.Error().Err(err).Msg("Error registering record")
-					} else {
-						added++
-					}
-				}
-				if writeErrs > 0 {
-					// Surface write failures so the reconcile pass is not
-					// reported as successful (e.g. to readiness).
-					return fmt.Errorf("%d record write(s) failed during reconciliation", writeErrs)
-				}
-				return nil
-			})
-			if se.reporter != nil {
-				se.reporter.RecordReconcile(err)
+			runPass(TriggerTick)
+		case reason := <-se.triggers:
+			if reason != TriggerEvent {
+				runPass(reason)
+				continue
 			}
-			if se.metrics != nil {
-				se.metrics.ObserveReconcile(time.Since(start), added, removed, skipped, err)
+			now := time.Now()
+			if pendingEvents == 0 {
+				pendingSince = now
 			}
-			if err != nil {
-				se.logger.Error().Err(err).Msg("Sync error")
+			pendingEvents++
+			wait := min(debounce, pendingSince.Add(maxDelay).Sub(now))
+			if debounceTimer != nil {
+				debounceTimer.Stop()
 			}
+			debounceTimer = time.NewTimer(max(wait, 0))
+			debounceC = debounceTimer.C
+		case <-debounceC:
+			runPass(TriggerEvent)
+		case req := <-se.controls:
+			req.reply <- se.handleControl(req.action, runPass)
 		case <-ctx.Done():
 			se.logger.Info().Msg("SyncEngine shutting down")
+			// Remove this host's records while its heartbeat still keeps
+			// other hosts from collecting them, so it is not mistaken for
+			// a crashed host.
+			if se.cfg.DeregisterOnShutdown && se.paused.Load() {
+				se.logger.Warn().Msg("paused: leaving this host's records in place on shutdown")
+			} else if se.cfg.DeregisterOnShutdown {
+				se.deregister()
+			}
 			// Stop the heartbeat promptly so peers see this host leave; the etcd
 			// client itself is closed by the App, which owns its lifecycle.
-			se.reg.StopHeartbeat()
+			for _, c := range se.clusters {
+				c.Registry.StopHeartbeat()
+			}
 			return ctx.Err()
 		}
 	}
 }
+
+// clusterResult is the outcome of reconciling a single cluster.
+type clusterResult struct {
+	added, removed int
+	// owned is how many records this host owns in the cluster after a
+	// successful pass.
+	owned int
+	// snapshot is the listing and plan of the last attempt; its ListedAt is
+	// zero if the cluster could not be listed.
+	snapshot domain.ClusterSnapshot
+	// published is the listing of the last attempt with the writes it
+	// applied.
+	published []*domain.RecordIntent
+	err       error
+}
+
+// reconcile runs one reconciliation pass against every cluster. Clusters are
+// reconciled concurrently so a slow or unreachable cluster does not delay the
+// others; their outcomes are reported per cluster and then in aggregate.
+func (se *SyncEngine) reconcile(ctx context.Context) domain.PassResult {
+	start := time.Now()
+	paused := se.paused.Load()
+	// Every line logged for the pass, by the engine or the registries,
+	// carries its id.
+	id := logger.NewReconcileID()
+	ctx = logger.WithReconcileID(ctx, id)
+	passLogger := logger.FromContext(ctx, se.logger)
+	ctx, span := se.tracer.Start(ctx, "engine.reconcile", trace.WithAttributes(
+		attribute.String("reconcile.id", id),
+		attribute.String("reconcile.trigger", string(se.trigger)),
+		attribute.Bool("reconcile.paused", paused),
+		attribute.Bool("reconcile.dry_run", se.cfg.DryRun),
+	))
+	desired := se.state.GetAllDesiredRecordIntents()
+	// Filter out any internally inconsistent intents:
+	filterTrail := NewTrail()
+	desiredReconciled := FilterRecordIntents(desired, filterTrail, passLogger)
+	skipped := len(desired) - len(desiredReconciled)
+
+	results := make([]clusterResult, len(se.clusters))
+	if len(se.clusters) == 1 {
+		results[0] = se.reconcileCluster(ctx, se.clusters[0], desiredReconciled)
+	} else {
+		var wg sync.WaitGroup
+		for i, c := range se.clusters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = se.reconcileCluster(ctx, c, desiredReconciled)
+			}()
+		}
+		wg.Wait()
+	}
+
+	var added, removed int
+	var errs []error
+	snapshots := make([]domain.ClusterSnapshot, len(se.clusters))
+	clusterResults := make([]domain.ClusterPassResult, len(se.clusters))
+	clusterReporter, _ := se.reporter.(clusterReconcileReporter)
+	clusterMetrics, _ := se.metrics.(clusterReconcileMetrics)
+	decisions := filterTrail.Decisions()
+	failed := make(map[string]struct{})
+	for i, c := range se.clusters {
+		res := results[i]
+		added += res.added
+		removed += res.removed
+		snapshots[i] = res.snapshot
+		snapshots[i].Cluster, snapshots[i].Err = c.Name, res.err
+		clusterResults[i] = domain.ClusterPassResult{Cluster: c.Name, Added: res.added, Removed: res.removed, Err: res.err}
+		decisions = append(decisions, res.snapshot.Decisions...)
+		if res.err != nil {
+			failed[c.Name] = struct{}{}
+			passLogger.Error().Err(res.err).Str("cluster", c.Name).Msg("Sync error")
+			if len(se.clusters) == 1 {
+				errs = append(errs, res.err)
+			} else {
+				errs = append(errs, fmt.Errorf("cluster %s: %w", c.Name, res.err))
+			}
+		}
+		if clusterReporter != nil {
+			clusterReporter.RecordClusterReconcile(c.Name, res.err)
+		}
+		if clusterMetrics != nil {
+			clusterMetrics.ObserveClusterReconcile(c.Name, res.added, res.removed, res.err)
+		}
+		// A paused pass applied nothing, so it does not count as a
+		// reconcile in the fleet view.
+		if res.err == nil && !paused {
+			se.publishHeartbeat(ctx, c, res.owned)
+		}
+	}
+	se.publishConflicts(decisions, failed)
+	se.observeRecords(desired, results)
+	se.storeSnapshot(start, desired, desiredReconciled, filterTrail.Decisions(), snapshots)
+	err := errors.Join(errs...)
+	if se.reporter != nil {
+		se.reporter.RecordReconcile(err)
+	}
+	if se.metrics != nil {
+		se.metrics.ObserveReconcile(time.Since(start), added, removed, skipped, err)
+	}
+	span.SetAttributes(
+		attribute.Int("reconcile.desired", len(desired)),
+		attribute.Int("reconcile.added", added),
+		attribute.Int("reconcile.removed", removed),
+		attribute.Int("reconcile.skipped", skipped),
+	)
+	tracing.End(span, err)
+	return domain.PassResult{
+		StartedAt: start,
+		Duration:  time.Since(start),
+		DryRun:    se.cfg.DryRun,
+		Paused:    paused,
+		Added:     added,
+		Removed:   removed,
+		Skipped:   skipped,
+		Clusters:  clusterResults,
+		Err:       err,
+	}
+}
+
+// maxPlanAttempts bounds how often a cluster is re-listed and re-planned
+// within one pass after its registry reported a conflicting change.
+const maxPlanAttempts = 3
+
+// reconcileCluster diffs desired against a single cluster and applies (or, in
+// dry-run, logs) the changes. Listing and diffing take no lock, so hosts do
+// them concurrently; only the names the plan touches are locked while it is
+// applied, and a pass with nothing to change takes no lock at all. Registries
+// that support it apply the plan atomically per name; if the registry changed
+// since it was listed, the plan is recomputed from a fresh listing. Other
+// registries are listed and planned again under the locks before writing.
+func (se *SyncEngine) reconcileCluster(ctx context.Context, c Cluster, desired []*domain.RecordIntent) (res clusterResult) {
+	ctx, span := se.tracer.Start(ctx, "engine.reconcile_cluster", trace.WithAttributes(attribute.String("cluster", c.Name)))
+	defer func() {
+		span.SetAttributes(attribute.Int("reconcile.added", res.added), attribute.Int("reconcile.removed", res.removed))
+		tracing.End(span, res.err)
+	}()
+	logger := logger.FromContext(ctx, se.logger).With().Str("cluster", c.Name).Logger()
+	reg := c.Registry
+	collect, gcTurn := se.gcTurn(ctx, c, logger)
+	override := se.takeBreakerOverride(c.Name)
+	desired, unserved := servedBy(reg, desired)
+	for _, ri := range unserved {
+		logger.Warn().Str("record", ri.Record.Render()).Str("container_id", ri.ContainerId).Msg("Record name is not served by this cluster's registry; not publishing it there")
+	}
+	trail := NewTrail()
+	// planCluster lists c and plans against the listing, recording the plan in
+	// res and the breaker's state.
+	planCluster := func(ctx context.Context) (toAdd, toRemove, actual []*domain.RecordIntent, err error) {
+		toAdd, toRemove, actual, trip, err := se.plan(ctx, reg, desired, collect, override, trail, logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, ri := range unserved {
+			trail.outOfZone(ri)
+		}
+		res.snapshot = domain.ClusterSnapshot{ListedAt: time.Now(), Records: actual, ToAdd: toAdd, ToRemove: toRemove, Decisions: trail.forCluster(c.Name)}
+		res.published = actual
+		// A host that lost the GC election no longer collects, so its GC
+		// limit no longer applies.
+		trip.gcChecked = trip.gcChecked || (gcTurn && !collect)
+		se.recordBreaker(c.Name, trip)
+		return toAdd, toRemove, actual, nil
+	}
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attribute.Int("reconcile.attempts", attempt))
+		toAdd, toRemove, actual, err := planCluster(ctx)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if mode := se.writeMode(); mode != "" {
+			for _, rec := range toRemove {
+				logger.Info().Str("record", rec.Record.Render()).Str("owner_hostname", rec.Hostname).Str("container_id", rec.ContainerId).Msg("[" + mode + "] would remove record")
+			}
+			for _, rec := range toAdd {
+				logger.Info().Str("record", rec.Record.Render()).Str("owner_hostname", rec.Hostname).Str("container_id", rec.ContainerId).Msg("[" + mode + "] would register record")
+			}
+			res.owned = se.ownedRecords(actual, nil, nil)
+			return res
+		}
+		if len(toAdd) == 0 && len(toRemove) == 0 {
+			res.owned = se.ownedRecords(actual, nil, nil)
+			return res
+		}
+
+		names := lockNames(toAdd, toRemove, actual)
+		logger.Debug().Strs("names", names).Msg("Locking names touched by the plan")
+		var applied []domain.Mutation
+		// The plan must be written with the context LockTransaction passes
+		// in, which fences the writes on the locks still being held.
+		err = reg.LockTransaction(ctx, names, func(ctx context.Context) error {
+			var err error
+			if applier, ok := reg.(planApplier); ok {
+				applied, err = applier.ApplyPlan(ctx, toAdd, toRemove)
+				return err
+			}
+			// Without ApplyPlan the registry cannot refuse a plan made from a
+			// stale listing, so the plan is made again from one taken under
+			// the locks. One that now touches a name not locked is planned
+			// and locked afresh.
+			if toAdd, toRemove, actual, err = planCluster(ctx); err != nil {
+				return err
+			}
+			if !covers(names, lockNames(toAdd, toRemove, actual)) {
+				return fmt.Errorf("%w: the plan now touches names that are not locked", domain.ErrPlanConflict)
+			}
+			applied, err = se.applyEach(ctx, reg, toAdd, toRemove, logger)
+			return err
+		})
+		added, removed := domain.SplitMutations(applied)
+		res.added += len(added)
+		res.removed += len(removed)
+		res.published = publishedAfter(actual, added, removed)
+		se.auditApplied(c.Name, applied, trail.Decisions(), logger)
+		se.publishApplied(c.Name, added, removed, trail.Decisions())
+		se.countApplied(c.Name, added, removed, trail.Decisions())
+		if err == nil {
+			res.owned = se.ownedRecords(actual, toAdd, toRemove)
+			return res
+		}
+		if !errors.Is(err, domain.ErrPlanConflict) || attempt >= maxPlanAttempts {
+			res.err = err
+			return res
+		}
+		logger.Warn().Err(err).Int("attempt", attempt).Msg("registry changed since it was listed; replanning")
+	}
+}
+
+// covers reports whether the sorted names locked include every name of want.
+func covers(locked, want []string) bool {
+	for _, name := range want {
+		if i := sort.SearchStrings(locked, name); i == len(locked) || locked[i] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// servedBy splits desired into the records whose names reg holds and those
+// it does not, if it only holds some names (see nameServer).
+func servedBy(reg upstreamRegistry, desired []*domain.RecordIntent) (served, unserved []*domain.RecordIntent) {
+	ns, ok := reg.(nameServer)
+	if !ok {
+		return desired, nil
+	}
+	served = make([]*domain.RecordIntent, 0, len(desired))
+	for _, ri := range desired {
+		if ns.Serves(ri.Record.Name) {
+			served = append(served, ri)
+		} else {
+			unserved = append(unserved, ri)
+		}
+	}
+	return served, unserved
+}
+
+// ownedRecords counts the records this host owns once a plan computed from
+// actual has been applied in full.
+func (se *SyncEngine) ownedRecords(actual, toAdd, toRemove []*domain.RecordIntent) int {
+	owned := len(toAdd)
+	for _, ri := range actual {
+		if ri.Hostname == se.cfg.Hostname {
+			owned++
+		}
+	}
+	for _, ri := range toRemove {
+		if ri.Hostname == se.cfg.Hostname {
+			owned--
+		}
+	}
+	return owned
+}
+
+// publishHeartbeat reports a successful pass on c to its registry's heartbeat,
+// if it carries this host's status. A failure only delays the update.
+func (se *SyncEngine) publishHeartbeat(ctx context.Context, c Cluster, owned int) {
+	p, ok := c.Registry.(heartbeatPublisher)
+	if !ok {
+		return
+	}
+	if err := p.UpdateHeartbeat(ctx, owned, time.Now()); err != nil {
+		passLogger := logger.FromContext(ctx, se.logger)
+		passLogger.Warn().Err(err).Str("cluster", c.Name).Msg("could not publish reconciliation status in the heartbeat")
+	}
+}
+
+// Fleet lists the sync instances heartbeating in each cluster.
+func (se *SyncEngine) Fleet(ctx context.Context) []domain.ClusterFleet {
+	return GetFleet(ctx, se.clusters)
+}
+
+// GetFleet lists the sync instances heartbeating in each of clusters, in
+// order. A cluster that cannot be read, or whose registry publishes no host
+// status, is reported with its error rather than failing the whole view.
+func GetFleet(ctx context.Context, clusters []Cluster) []domain.ClusterFleet {
+	fleet := make([]domain.ClusterFleet, 0, len(clusters))
+	for _, c := range clusters {
+		cf := domain.ClusterFleet{Cluster: c.Name, Hosts: []domain.HostStatus{}}
+		lister, ok := c.Registry.(fleetLister)
+		if !ok {
+			cf.Err = "registry does not publish host status"
+			fleet = append(fleet, cf)
+			continue
+		}
+		hosts, err := lister.GetFleet(ctx)
+		if err != nil {
+			cf.Err = err.Error()
+		} else {
+			cf.Hosts = hosts
+		}
+		fleet = append(fleet, cf)
+	}
+	return fleet
+}
+
+// lockNames returns, sorted, the names a plan must be applied under: every
+// name it adds or removes records for, plus the CNAME chain beyond each CNAME
+// it adds, since whether that CNAME is valid (e.g. forms no loop) depends on
+// the records there.
+func lockNames(toAdd, toRemove, actual []*domain.RecordIntent) []string {
+	set := make(map[string]struct{})
+	for _, ri := range toRemove {
+		set[ri.Record.Name] = struct{}{}
+	}
+	for _, ri := range toAdd {
+		set[ri.Record.Name] = struct{}{}
+		if ri.Record.IsCNAME() {
+			for _, name := range domain.CNAMEChain(ri.Record.Value, actual) {
+				set[name] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// plan lists a cluster and computes the records to add and remove, including
+// orphaned records of dead hosts when collect is set. The listing is returned
+// alongside. Removals of this host's records are left out while it starts up
+// (see startupGate). Unless override is set, removals over the app.breaker
+// limits are left out of the plan too and returned as trip. trail is left
+// with the decisions of the plan returned.
+func (se *SyncEngine) plan(ctx context.Context, reg upstreamRegistry, desired []*domain.RecordIntent, collect, override bool, trail *Trail, logger zerolog.Logger) (toAdd, toRemove, actual []*domain.RecordIntent, trip breakerTrip, err error) {
+	actual, err = reg.List(ctx)
+	if err != nil {
+		return nil, nil, nil, trip, fmt.Errorf("error listing registry records: %w", err)
+	}
+	var liveHosts map[string]struct{}
+	if collect {
+		// Live host set drives cross-host GC. On error, fall back to nil
+		// (GC disabled this tick) rather than risk deleting live records.
+		liveHosts, err = reg.GetLiveHostnames(ctx)
+		if err != nil {
+			logger.Warn().Err(err).Msg("could not fetch live hostnames; skipping cross-host GC this tick")
+			liveHosts = nil
+		}
+	}
+	trail.Reset()
+	toAdd, toRemove = ReconcileAndValidate(desired, actual, se.cfg, liveHosts, trail, logger)
+	if held := se.heldRemovals(toAdd, toRemove); len(held) > 0 {
+		// Keep the held records as if still desired until startup completes.
+		logger.Info().Strs("held", renderAll(held)).Msg("Starting up; keeping this host's records until every running container has been seen")
+		desired = append(desired[:len(desired):len(desired)], held...)
+		trail.Reset()
+		toAdd, toRemove = ReconcileAndValidate(desired, actual, se.cfg, liveHosts, trail, logger)
+	}
+	trip = se.checkBreaker(actual, toAdd, toRemove, liveHosts)
+	if !trip.tripped() {
+		return toAdd, toRemove, actual, trip, nil
+	}
+	if override {
+		logger.Warn().Msg(trip.reason() + "; applying the plan anyway as the breaker was overridden")
+		return toAdd, toRemove, actual, breakerTrip{gcChecked: trip.gcChecked}, nil
+	}
+	logBlockedPlan(trip, toAdd, toRemove, logger)
+	// Plan again without the blocked removals, so what is still applied is
+	// validated against the records that stay: blocked own records are kept
+	// as if still desired, and blocked GC is skipped altogether.
+	if len(trip.gc) > 0 {
+		liveHosts = nil
+	}
+	if len(trip.own) > 0 {
+		desired = append(desired[:len(desired):len(desired)], trip.own...)
+	}
+	trail.Reset()
+	toAdd, toRemove = ReconcileAndValidate(desired, actual, se.cfg, liveHosts, trail, logger)
+	return toAdd, toRemove, actual, trip, nil
+}
+
+// gcTurn reports whether this pass garbage-collects orphaned records on c,
+// and whether it used up the cluster's turn. A cluster collects at most once
+// per app.gc_interval and, if its registry holds a GC election, only on the
+// elected leader. Checking the election uses up the cluster's turn, so a host
+// that does not lead asks again only an interval later.
+func (se *SyncEngine) gcTurn(ctx context.Context, c Cluster, logger zerolog.Logger) (collect, turn bool) {
+	now := time.Now()
+	se.gcMu.Lock()
+	last, ok := se.lastGC[c.Name]
+	se.gcMu.Unlock()
+	if ok && now.Sub(last) < time.Duration(se.cfg.GCInterval*float64(time.Second)) {
+		return false, false
+	}
+	elector, ok := c.Registry.(gcElector)
+	if !ok {
+		se.markGC(c.Name, now)
+		return true, true
+	}
+	leader, isLeader, err := elector.GCLeader(ctx)
+	if err != nil {
+		logger.Warn().Err(err).Msg("could not check the GC leader; skipping cross-host GC this tick")
+		return false, false
+	}
+	se.markGC(c.Name, now)
+	if r, ok := se.reporter.(gcLeaderReporter); ok {
+		r.RecordGCLeader(c.Name, leader, isLeader)
+	}
+	if m, ok := se.metrics.(gcLeaderMetrics); ok {
+		m.SetGCLeader(c.Name, leader, isLeader)
+	}
+	if !isLeader {
+		logger.Debug().Str("gc_leader", leader).Msg("not the GC leader; leaving orphaned records to it")
+	}
+	return isLeader, true
+}
+
+func (se *SyncEngine) markGC(cluster string, at time.Time) {
+	se.gcMu.Lock()
+	se.lastGC[cluster] = at
+	se.gcMu.Unlock()
+}
+
+// applyEach applies a plan one record at a time, for registries without
+// planApplier, and returns the records it wrote and deleted. It stops early
+// once ctx is done, e.g. because a lock was lost.
+func (se *SyncEngine) applyEach(ctx context.Context, reg upstreamRegistry, toAdd, toRemove []*domain.RecordIntent, logger zerolog.Logger) (applied []domain.Mutation, err error) {
+	var writeErrs int
+	for _, rec := range toRemove {
+		if ctx.Err() != nil {
+			return applied, context.Cause(ctx)
+		}
+		if err := reg.Remove(ctx, rec); err != nil {
+			writeErrs++
+			logger.Error().Err(err).Msg("Error removing record")
+		} else {
+			applied = append(applied, domain.Mutation{Op: domain.MutationRemove, Record: rec})
+		}
+	}
+	for _, rec := range toAdd {
+		if ctx.Err() != nil {
+			return applied, context.Cause(ctx)
+		}
+		if err := reg.Register(ctx, rec); err != nil {
+			writeErrs++
+			logger.Error().Err(err).Msg("Error registering record")
+		} else {
+			applied = append(applied, domain.Mutation{Op: domain.MutationRegister, Record: rec})
+		}
+	}
+	if writeErrs > 0 {
+		// Surface write failures so the reconcile pass is not
+		// reported as successful (e.g. to readiness).
+		return applied, fmt.Errorf("%d record write(s) failed during reconciliation", writeErrs)
+	}
+	return applied, nil
+}
@@ -1,16 +1,23 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
 	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func engineTestLogger() zerolog.Logger {
@@ -19,11 +26,14 @@ func engineTestLogger() zerolog.Logger {
 
 func testAppConfig() *config.AppConfig {
 	return &config.AppConfig{
-		DockerLabelPrefix: "coredns",
-		HostIPv4:          "192.168.1.1",
-		HostIPv6:          "",
-		Hostname:          "test-host",
-		PollInterval:      1,
+		DockerLabelPrefix:       "coredns",
+		HostIPv4:                "192.168.1.1",
+		HostIPv6:                "",
+		Hostname:                "test-host",
+		PollInterval:            1,
+		ReconcileSafetyInterval: 1,
+		DeregisterTimeout:       8,
+		StopGracePeriod:         10,
 	}
 }
 
@@ -45,8 +55,11 @@ func TestNewSyncEngine(t *testing.T) {
 	if engine.state != state {
 		t.Error("expected state to be set")
 	}
-	if engine.reg != reg {
-		t.Error("expected registry to be set")
+	if len(engine.clusters) != 1 || engine.clusters[0].Registry != reg {
+		t.Error("expected registry to be set as the only cluster")
+	}
+	if engine.clusters[0].Name != config.DefaultEtcdClusterName {
+		t.Errorf("expected default cluster name, got %q", engine.clusters[0].Name)
 	}
 }
 
@@ -308,7 +321,7 @@ func TestSyncEngine_Run_ContextCancellation(t *testing.T) {
 	}
 	reg := &mockRegistry{}
 	cfg := testAppConfig()
-	cfg.PollInterval = 10 // Long enough that we cancel before it fires
+	cfg.ReconcileSafetyInterval = 10 // Long enough that we cancel before it fires
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -340,7 +353,7 @@ func TestSyncEngine_Run_ProcessesEvents(t *testing.T) {
 	}
 	reg := &mockRegistry{}
 	cfg := testAppConfig()
-	cfg.PollInterval = 10
+	cfg.ReconcileSafetyInterval = 10
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -411,7 +424,7 @@ func TestSyncEngine_Run_ReconciliationLoop(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1 // 1 second
+	cfg.ReconcileSafetyInterval = 1 // 1 second
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -469,7 +482,7 @@ func TestSyncEngine_Run_RegistersNewRecords(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -492,14 +505,7 @@ func TestSyncEngine_Run_RegistersNewRecords(t *testing.T) {
 }
 
 func TestSyncEngine_Run_RemovesStaleRecords(t *testing.T) {
-	eventCh := make(chan domain.ContainerEvent)
-	close(eventCh)
-
-	gen := &mockGenerator{
-		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
-			return eventCh, nil
-		},
-	}
+	gen := &mockGenerator{}
 
 	state := &mockState{
 		getAllDesiredFunc: func() []*domain.RecordIntent {
@@ -522,7 +528,7 @@ func TestSyncEngine_Run_RemovesStaleRecords(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 60
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -533,7 +539,9 @@ func TestSyncEngine_Run_RemovesStaleRecords(t *testing.T) {
 		engine.Run(ctx)
 	}()
 
-	time.Sleep(1200 * time.Millisecond)
+	// The pass run once the generator has listed the containers removes it
+	// without waiting for a tick.
+	time.Sleep(300 * time.Millisecond)
 	cancel()
 
 	if !reg.WasRemoveCalled() {
@@ -565,7 +573,7 @@ func TestSyncEngine_Run_ListError(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -586,14 +594,7 @@ func TestSyncEngine_Run_ListError(t *testing.T) {
 }
 
 func TestSyncEngine_Run_RemoveError(t *testing.T) {
-	eventCh := make(chan domain.ContainerEvent)
-	close(eventCh)
-
-	gen := &mockGenerator{
-		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
-			return eventCh, nil
-		},
-	}
+	gen := &mockGenerator{}
 
 	state := &mockState{
 		getAllDesiredFunc: func() []*domain.RecordIntent {
@@ -619,7 +620,7 @@ func TestSyncEngine_Run_RemoveError(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -674,7 +675,7 @@ func TestSyncEngine_Run_RegisterError(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -711,7 +712,7 @@ func TestSyncEngine_Run_StopsHeartbeatOnShutdown(t *testing.T) {
 	}
 	reg := &mockRegistry{}
 	cfg := testAppConfig()
-	cfg.PollInterval = 10 // Long enough to not trigger
+	cfg.ReconcileSafetyInterval = 10 // Long enough to not trigger
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -790,7 +791,7 @@ func TestSyncEngine_Run_WriteFailureReportedAsError(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	reporter := &recordingReporter{}
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
@@ -852,7 +853,7 @@ func TestSyncEngine_Run_DryRunSkipsWrites(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 	cfg.DryRun = true
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
@@ -905,7 +906,7 @@ func TestSyncEngine_Run_ReportsReconcileResult(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	reporter := &recordingReporter{}
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
@@ -984,7 +985,7 @@ func TestSyncEngine_Run_RecordsMetrics(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	m := &recordingMetrics{}
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
@@ -1025,7 +1026,7 @@ func TestSyncEngine_Run_EventChannelClosed(t *testing.T) {
 	}
 	reg := &mockRegistry{}
 	cfg := testAppConfig()
-	cfg.PollInterval = 10
+	cfg.ReconcileSafetyInterval = 10
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -1060,7 +1061,7 @@ func TestSyncEngine_Run_StartsHeartbeat(t *testing.T) {
 	}
 	reg := &mockRegistry{}
 	cfg := testAppConfig()
-	cfg.PollInterval = 10
+	cfg.ReconcileSafetyInterval = 10
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -1099,6 +1100,7 @@ func TestSyncEngine_Run_GCsOrphanedRecords(t *testing.T) {
 		Created:       time.Now().Add(-time.Hour),
 		Hostname:      "dead-host", // owner not in live set
 		Record:        rec,
+		Wire:          domain.WireInfo{Schema: domain.RecordSchema},
 	}
 
 	reg := &mockRegistry{
@@ -1110,7 +1112,7 @@ func TestSyncEngine_Run_GCsOrphanedRecords(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -1152,6 +1154,7 @@ func TestSyncEngine_Run_GetLiveHostnamesError(t *testing.T) {
 		Created:       time.Now().Add(-time.Hour),
 		Hostname:      "dead-host",
 		Record:        rec,
+		Wire:          domain.WireInfo{Schema: domain.RecordSchema},
 	}
 
 	reg := &mockRegistry{
@@ -1163,7 +1166,7 @@ func TestSyncEngine_Run_GetLiveHostnamesError(t *testing.T) {
 		},
 	}
 	cfg := testAppConfig()
-	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 1
 
 	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
 
@@ -1179,3 +1182,911 @@ func TestSyncEngine_Run_GetLiveHostnamesError(t *testing.T) {
 		t.Error("expected no removals when GetLiveHostnames fails (GC disabled this tick)")
 	}
 }
+
+type recordingClusterReporter struct {
+	recordingReporter
+	clusters map[string]error
+}
+
+func (r *recordingClusterReporter) RecordClusterReconcile(cluster string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clusters == nil {
+		r.clusters = map[string]error{}
+	}
+	r.clusters[cluster] = err
+}
+
+type recordingClusterMetrics struct {
+	recordingMetrics
+	clusterAdded map[string]int
+	clusterErr   map[string]error
+}
+
+func (r *recordingClusterMetrics) ObserveClusterReconcile(cluster string, added, removed int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clusterAdded == nil {
+		r.clusterAdded, r.clusterErr = map[string]int{}, map[string]error{}
+	}
+	r.clusterAdded[cluster] += added
+	r.clusterErr[cluster] = err
+}
+
+func TestSyncEngine_reconcile_TagsPassWithReconcileID(t *testing.T) {
+	stale := makeIntent("stale.example.com", domain.RecordA, "10.0.0.2")
+	var ids []string
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		ids = append(ids, logger.ReconcileID(ctx))
+		return []*domain.RecordIntent{stale}, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	var buf bytes.Buffer
+	engine.logger = zerolog.New(&buf)
+
+	engine.reconcile(context.Background())
+	engine.reconcile(context.Background())
+
+	// Without ApplyPlan, a pass lists again under the locks, with its own id.
+	if len(ids) != 4 || ids[0] == "" || ids[0] != ids[1] || ids[2] != ids[3] || ids[0] == ids[2] {
+		t.Fatalf("expected each pass to hand the registry an id of its own, got %q", ids)
+	}
+	ids = []string{ids[0], ids[2]}
+	for _, id := range ids {
+		if !strings.Contains(buf.String(), `"reconcile_id":"`+id+`","cluster":"default","record":"`+stale.Record.Render()+`"`) {
+			t.Errorf("expected the pass %s to log the stale record under its id, got %s", id, buf.String())
+		}
+	}
+}
+
+func TestSyncEngine_reconcile_PartialClusterFailure(t *testing.T) {
+	rec, _ := domain.NewA("app.example.com", "192.168.1.1")
+	desired := []*domain.RecordIntent{{
+		ContainerId:   "container-123",
+		ContainerName: "my-app",
+		Created:       time.Now(),
+		Hostname:      "test-host",
+		Record:        rec,
+	}}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return desired }}
+
+	healthy := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) { return nil, nil },
+	}
+	broken := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			return nil, errors.New("etcd unavailable")
+		},
+	}
+	engine := NewMultiClusterSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, []Cluster{
+		{Name: "site-a", Registry: healthy},
+		{Name: "site-b", Registry: broken},
+	}, state)
+	reporter := &recordingClusterReporter{}
+	m := &recordingClusterMetrics{}
+	engine.SetReconcileReporter(reporter)
+	engine.SetMetrics(m)
+
+	engine.reconcile(context.Background())
+
+	// The healthy cluster is written to despite the other failing.
+	if got := healthy.GetRegisteredRecords(); len(got) != 1 {
+		t.Fatalf("expected 1 record registered on the healthy cluster, got %d", len(got))
+	}
+	if broken.WasRegisterCalled() {
+		t.Error("expected no writes to the cluster whose listing failed")
+	}
+
+	if !reporter.sawError() {
+		t.Fatal("expected the pass to be reported as failed")
+	}
+	if err := reporter.calls[0]; !strings.Contains(err.Error(), "cluster site-b") {
+		t.Errorf("expected the aggregate error to name the failing cluster, got %v", err)
+	}
+	if reporter.clusters["site-a"] != nil || reporter.clusters["site-b"] == nil {
+		t.Errorf("unexpected per-cluster outcomes: %v", reporter.clusters)
+	}
+
+	calls, added, _, _ := m.snapshot()
+	if calls != 1 || added != 1 {
+		t.Errorf("expected one aggregate observation with 1 added, got calls=%d added=%d", calls, added)
+	}
+	if m.clusterAdded["site-a"] != 1 || m.clusterErr["site-a"] != nil || m.clusterErr["site-b"] == nil {
+		t.Errorf("unexpected per-cluster metrics: added=%v err=%v", m.clusterAdded, m.clusterErr)
+	}
+}
+
+func TestSyncEngine_reconcile_ClustersDoNotBlockEachOther(t *testing.T) {
+	release := make(chan struct{})
+	slow := &mockRegistry{
+		lockTransactionFunc: func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+			<-release
+			return fn(ctx)
+		},
+	}
+	fastListed := make(chan struct{})
+	fast := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			close(fastListed)
+			return nil, nil
+		},
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return nil }}
+	engine := NewMultiClusterSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, []Cluster{
+		{Name: "slow", Registry: slow},
+		{Name: "fast", Registry: fast},
+	}, state)
+
+	done := make(chan struct{})
+	go func() {
+		engine.reconcile(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-fastListed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the fast cluster to reconcile while the slow one is stuck")
+	}
+	close(release)
+	<-done
+}
+
+func TestSyncEngine_Run_HeartbeatsEveryCluster(t *testing.T) {
+	eventCh := make(chan domain.ContainerEvent)
+	close(eventCh)
+	gen := &mockGenerator{
+		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+			return eventCh, nil
+		},
+	}
+	a, b := &mockRegistry{}, &mockRegistry{}
+	engine := NewMultiClusterSyncEngine(engineTestLogger(), testAppConfig(), gen, []Cluster{
+		{Name: "site-a", Registry: a},
+		{Name: "site-b", Registry: b},
+	}, &mockState{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = engine.Run(ctx)
+
+	for name, reg := range map[string]*mockRegistry{"site-a": a, "site-b": b} {
+		reg.mu.Lock()
+		started := reg.startHeartbeatCalled
+		reg.mu.Unlock()
+		if !started {
+			t.Errorf("expected heartbeat to be started on %s", name)
+		}
+		if !reg.WasStopHeartbeatCalled() {
+			t.Errorf("expected heartbeat to be stopped on %s", name)
+		}
+	}
+}
+
+type recordingTriggerMetrics struct {
+	recordingMetrics
+	triggers map[string]int
+}
+
+func (r *recordingTriggerMetrics) IncReconcileTrigger(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.triggers == nil {
+		r.triggers = map[string]int{}
+	}
+	r.triggers[reason]++
+}
+
+func (r *recordingTriggerMetrics) triggerCount(reason string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.triggers[reason]
+}
+
+func startedEvent(id string) domain.ContainerEvent {
+	return domain.ContainerEvent{
+		Container: domain.Container{
+			Id:      id,
+			Name:    id,
+			Created: time.Now(),
+			Labels: map[string]string{
+				"coredns.enabled":     "true",
+				"coredns.a.web.name":  id + ".example.com",
+				"coredns.a.web.value": "192.168.1.100",
+			},
+		},
+		EventType: domain.EventTypeContainerStarted,
+	}
+}
+
+func TestSyncEngine_handleEvent_ReportsStateChange(t *testing.T) {
+	state := &mockState{
+		markRemovedFunc:   func(string) bool { return false },
+		retainRunningFunc: func(map[string]struct{}) int { return 0 },
+	}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, &mockRegistry{}, state)
+
+	if !engine.handleEvent(startedEvent("c1")) {
+		t.Error("expected a start with record labels to report a change")
+	}
+	if engine.handleEvent(domain.ContainerEvent{Container: domain.Container{Id: "c1"}, EventType: domain.EventTypeContainerDied}) {
+		t.Error("expected a stop of an untracked container to report no change")
+	}
+	if engine.handleEvent(domain.ContainerEvent{EventType: domain.EventTypeResync}) {
+		t.Error("expected a resync that prunes nothing to report no change")
+	}
+}
+
+func TestSyncEngine_Run_EventsTriggerOneDebouncedPass(t *testing.T) {
+	eventCh := make(chan domain.ContainerEvent, 10)
+	gen := &mockGenerator{
+		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+			return eventCh, nil
+		},
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return nil }}
+	cfg := testAppConfig()
+	cfg.ReconcileSafetyInterval = 60 // the safety net must not fire during the test
+	cfg.ReconcileDebounce = 0.1
+	cfg.ReconcileMaxDelay = 1
+
+	m := &recordingTriggerMetrics{}
+	engine := NewSyncEngine(engineTestLogger(), cfg, gen, &mockRegistry{}, state)
+	engine.SetMetrics(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx)
+		close(done)
+	}()
+
+	for _, id := range []string{"c1", "c2", "c3"} {
+		eventCh <- startedEvent(id)
+	}
+	time.Sleep(400 * time.Millisecond)
+	cancel()
+	<-done
+
+	if got := m.triggerCount(string(TriggerEvent)); got != 1 {
+		t.Errorf("expected a burst of events to coalesce into 1 pass, got %d", got)
+	}
+	if got := m.triggerCount(string(TriggerTick)); got != 0 {
+		t.Errorf("expected no tick passes, got %d", got)
+	}
+}
+
+func TestSyncEngine_Run_MaxDelayBoundsDebounce(t *testing.T) {
+	eventCh := make(chan domain.ContainerEvent)
+	gen := &mockGenerator{
+		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+			return eventCh, nil
+		},
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return nil }}
+	cfg := testAppConfig()
+	cfg.ReconcileSafetyInterval = 60
+	cfg.ReconcileDebounce = 0.2
+	cfg.ReconcileMaxDelay = 0.3
+
+	m := &recordingTriggerMetrics{}
+	engine := NewSyncEngine(engineTestLogger(), cfg, gen, &mockRegistry{}, state)
+	engine.SetMetrics(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx)
+		close(done)
+	}()
+
+	// Events every 100ms never leave a 200ms quiet period, so only the max
+	// delay can let a pass run while they keep coming.
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for i := 0; time.Now().Before(deadline); i++ {
+		eventCh <- startedEvent(fmt.Sprintf("c%d", i))
+		time.Sleep(100 * time.Millisecond)
+	}
+	sawPass := m.triggerCount(string(TriggerEvent)) > 0
+	cancel()
+	<-done
+
+	if !sawPass {
+		t.Error("expected reconcile_max_delay to force a pass during a steady stream of events")
+	}
+}
+
+func TestSyncEngine_TriggerReconcile(t *testing.T) {
+	gen := &mockGenerator{
+		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+			return make(chan domain.ContainerEvent), nil
+		},
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return nil }}
+	cfg := testAppConfig()
+	cfg.ReconcileSafetyInterval = 60
+
+	m := &recordingTriggerMetrics{}
+	reg := &mockRegistry{}
+	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
+	engine.SetMetrics(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx)
+		close(done)
+	}()
+
+	engine.TriggerReconcile()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	if got := m.triggerCount(string(TriggerManual)); got != 1 {
+		t.Errorf("expected 1 manual pass, got %d", got)
+	}
+	if !reg.WasListCalled() {
+		t.Error("expected the manual pass to reconcile the registry")
+	}
+}
+
+// mockPlanRegistry is a mockRegistry that also applies plans atomically.
+type mockPlanRegistry struct {
+	mockRegistry
+	applyPlanFunc func(attempt int, toAdd, toRemove []*domain.RecordIntent) (int, int, error)
+	applyCalls    int
+	listCalls     int
+}
+
+func (m *mockPlanRegistry) List(ctx context.Context) ([]*domain.RecordIntent, error) {
+	m.mu.Lock()
+	m.listCalls++
+	m.mu.Unlock()
+	return m.mockRegistry.List(ctx)
+}
+
+// ApplyPlan reports the first records of toAdd and toRemove as applied, as
+// many as applyPlanFunc counts.
+func (m *mockPlanRegistry) ApplyPlan(ctx context.Context, toAdd, toRemove []*domain.RecordIntent) ([]domain.Mutation, error) {
+	m.mu.Lock()
+	m.applyCalls++
+	attempt := m.applyCalls
+	m.mu.Unlock()
+	added, removed, err := m.applyPlanFunc(attempt, toAdd, toRemove)
+	var applied []domain.Mutation
+	for _, ri := range toRemove[:removed] {
+		applied = append(applied, domain.Mutation{Op: domain.MutationRemove, Record: ri, Revision: int64(len(applied) + 1)})
+	}
+	for _, ri := range toAdd[:added] {
+		applied = append(applied, domain.Mutation{Op: domain.MutationRegister, Record: ri, Revision: int64(len(applied) + 1)})
+	}
+	return applied, err
+}
+
+func planTestEngine(reg *mockPlanRegistry) *SyncEngine {
+	rec, _ := domain.NewA("app.example.com", "192.168.1.1")
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent {
+		return []*domain.RecordIntent{{ContainerId: "c1", ContainerName: "app", Created: time.Now(), Hostname: "test-host", Record: rec}}
+	}}
+	return NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, state)
+}
+
+func TestSyncEngine_reconcile_AppliesPlanAtomically(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(_ int, toAdd, toRemove []*domain.RecordIntent) (int, int, error) {
+		return len(toAdd), len(toRemove), nil
+	}}
+	engine := planTestEngine(reg)
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if res.err != nil || res.added != 1 {
+		t.Errorf("expected 1 record added without error, got %d and %v", res.added, res.err)
+	}
+	if reg.applyCalls != 1 {
+		t.Errorf("expected 1 ApplyPlan call, got %d", reg.applyCalls)
+	}
+	if reg.WasRegisterCalled() || reg.WasRemoveCalled() {
+		t.Error("expected no per-record writes when the registry applies plans")
+	}
+}
+
+func TestSyncEngine_reconcile_ReplansOnConflict(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(attempt int, toAdd, toRemove []*domain.RecordIntent) (int, int, error) {
+		if attempt == 1 {
+			return 0, 0, fmt.Errorf("apply: %w", domain.ErrPlanConflict)
+		}
+		return len(toAdd), len(toRemove), nil
+	}}
+	engine := planTestEngine(reg)
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if res.err != nil {
+		t.Fatalf("expected the replanned pass to succeed, got %v", res.err)
+	}
+	if reg.listCalls != 2 || reg.applyCalls != 2 {
+		t.Errorf("expected 2 listings and 2 applies, got %d and %d", reg.listCalls, reg.applyCalls)
+	}
+	if res.added != 1 {
+		t.Errorf("expected 1 record added, got %d", res.added)
+	}
+}
+
+func TestSyncEngine_reconcile_GivesUpAfterRepeatedConflicts(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(int, []*domain.RecordIntent, []*domain.RecordIntent) (int, int, error) {
+		return 0, 0, domain.ErrPlanConflict
+	}}
+	engine := planTestEngine(reg)
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if !errors.Is(res.err, domain.ErrPlanConflict) {
+		t.Errorf("expected the conflict to be reported, got %v", res.err)
+	}
+	if reg.applyCalls != maxPlanAttempts {
+		t.Errorf("expected %d attempts, got %d", maxPlanAttempts, reg.applyCalls)
+	}
+}
+
+func TestSyncEngine_reconcile_DoesNotReplanOnOtherErrors(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(int, []*domain.RecordIntent, []*domain.RecordIntent) (int, int, error) {
+		return 0, 0, errors.New("etcd unavailable")
+	}}
+	engine := planTestEngine(reg)
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if res.err == nil {
+		t.Fatal("expected the error to be reported")
+	}
+	if reg.applyCalls != 1 {
+		t.Errorf("expected no replan, got %d attempts", reg.applyCalls)
+	}
+}
+
+func TestLockNames(t *testing.T) {
+	a, _ := domain.NewA("app.example.com", "10.0.0.1")
+	stale, _ := domain.NewA("old.example.com", "10.0.0.2")
+	cname, _ := domain.NewCNAME("www.example.com", "web.example.com")
+	chain, _ := domain.NewCNAME("web.example.com", "api.example.com")
+
+	got := lockNames(
+		[]*domain.RecordIntent{{Record: cname}, {Record: a}},
+		[]*domain.RecordIntent{{Record: stale}},
+		[]*domain.RecordIntent{{Record: chain}},
+	)
+	want := []string{"api.example.com", "app.example.com", "old.example.com", "web.example.com", "www.example.com"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("lockNames = %v, want %v", got, want)
+	}
+}
+
+func TestSyncEngine_reconcile_LocksOnlyPlannedNames(t *testing.T) {
+	var locked []string
+	reg := &mockPlanRegistry{applyPlanFunc: func(_ int, toAdd, toRemove []*domain.RecordIntent) (int, int, error) {
+		return len(toAdd), len(toRemove), nil
+	}}
+	reg.lockTransactionFunc = func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+		locked = keys
+		return fn(ctx)
+	}
+	engine := planTestEngine(reg)
+
+	engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if fmt.Sprint(locked) != "[app.example.com]" {
+		t.Errorf("expected only the planned name to be locked, got %v", locked)
+	}
+}
+
+func TestSyncEngine_reconcile_NoChangesTakesNoLock(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(int, []*domain.RecordIntent, []*domain.RecordIntent) (int, int, error) {
+		t.Error("expected nothing to be applied")
+		return 0, 0, nil
+	}}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, &mockState{})
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], nil)
+
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if reg.WasLockTransactionCalled() {
+		t.Error("expected a pass with nothing to change to take no lock")
+	}
+	if reg.listCalls != 1 {
+		t.Errorf("expected the registry to still be listed, got %d listings", reg.listCalls)
+	}
+}
+
+func TestSyncEngine_reconcile_StopsWritingOnceLockIsLost(t *testing.T) {
+	a, _ := domain.NewA("app.example.com", "192.168.1.1")
+	b, _ := domain.NewA("web.example.com", "192.168.1.2")
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent {
+		return []*domain.RecordIntent{
+			{ContainerId: "c1", ContainerName: "app", Created: time.Now(), Hostname: "test-host", Record: a},
+			{ContainerId: "c2", ContainerName: "web", Created: time.Now(), Hostname: "test-host", Record: b},
+		}
+	}}
+	var lockCalls int
+	var loseLock context.CancelCauseFunc
+	reg := &mockRegistry{
+		lockTransactionFunc: func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+			lockCalls++
+			lockCtx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+			loseLock = cancel
+			return fn(lockCtx)
+		},
+	}
+	reg.registerFunc = func(ctx context.Context, record *domain.RecordIntent) error {
+		lost := &domain.LockLostError{Lock: record.Record.Name}
+		loseLock(lost)
+		return lost
+	}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, state)
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], engine.state.GetAllDesiredRecordIntents())
+
+	if !errors.As(res.err, new(*domain.LockLostError)) {
+		t.Fatalf("expected the lost lock to be reported, got %v", res.err)
+	}
+	if n := len(reg.registeredRecords); n != 1 {
+		t.Errorf("expected writing to stop after the lock was lost, got %d registrations", n)
+	}
+	if lockCalls != 1 {
+		t.Errorf("expected a lost lock not to be replanned, got %d lock attempts", lockCalls)
+	}
+}
+
+// mockElectorRegistry is a mockRegistry that holds a GC election.
+type mockElectorRegistry struct {
+	mockRegistry
+	leader      string
+	liveQueries int
+}
+
+func (m *mockElectorRegistry) GCLeader(ctx context.Context) (string, bool, error) {
+	return m.leader, m.leader == "test-host", nil
+}
+
+func (m *mockElectorRegistry) GetLiveHostnames(ctx context.Context) (map[string]struct{}, error) {
+	m.mu.Lock()
+	m.liveQueries++
+	m.mu.Unlock()
+	return map[string]struct{}{"test-host": {}}, nil
+}
+
+// orphanListing lists one record owned by a host with no heartbeat.
+func orphanListing(ctx context.Context) ([]*domain.RecordIntent, error) {
+	rec, _ := domain.NewA("old.example.com", "10.0.0.9")
+	return []*domain.RecordIntent{{ContainerId: "c9", ContainerName: "old", Created: time.Now(), Hostname: "dead-host", Record: rec, Wire: domain.WireInfo{Schema: domain.RecordSchema}}}, nil
+}
+
+type recordingGCLeader struct {
+	recordingReporter
+	leaders map[string]string
+}
+
+func (r *recordingGCLeader) RecordGCLeader(cluster, leader string, isLeader bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.leaders == nil {
+		r.leaders = map[string]string{}
+	}
+	r.leaders[cluster] = leader
+}
+
+func TestSyncEngine_reconcile_OnlyGCLeaderCollects(t *testing.T) {
+	for _, tc := range []struct {
+		leader      string
+		wantRemoved int
+	}{
+		{leader: "test-host", wantRemoved: 1},
+		{leader: "peer-host", wantRemoved: 0},
+	} {
+		t.Run(tc.leader, func(t *testing.T) {
+			reg := &mockElectorRegistry{leader: tc.leader}
+			reg.listFunc = orphanListing
+			reporter := &recordingGCLeader{}
+			engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, &mockState{})
+			engine.SetReconcileReporter(reporter)
+
+			res := engine.reconcileCluster(context.Background(), engine.clusters[0], nil)
+
+			if res.err != nil {
+				t.Fatalf("unexpected error: %v", res.err)
+			}
+			if res.removed != tc.wantRemoved {
+				t.Errorf("expected %d orphan(s) removed, got %d", tc.wantRemoved, res.removed)
+			}
+			if tc.leader != "test-host" && reg.liveQueries != 0 {
+				t.Error("expected a host that does not lead not to read peer liveness")
+			}
+			if got := reporter.leaders[config.DefaultEtcdClusterName]; got != tc.leader {
+				t.Errorf("expected leader %q to be reported, got %q", tc.leader, got)
+			}
+		})
+	}
+}
+
+func TestSyncEngine_reconcile_GCInterval(t *testing.T) {
+	reg := &mockElectorRegistry{leader: "test-host"}
+	reg.listFunc = orphanListing
+	cfg := testAppConfig()
+	cfg.GCInterval = 60
+	engine := NewSyncEngine(engineTestLogger(), cfg, &mockGenerator{}, reg, &mockState{})
+
+	first := engine.reconcileCluster(context.Background(), engine.clusters[0], nil)
+	reads := reg.liveQueries
+	second := engine.reconcileCluster(context.Background(), engine.clusters[0], nil)
+
+	if first.removed != 1 || second.removed != 0 {
+		t.Errorf("expected only the first pass to collect, got %d then %d removed", first.removed, second.removed)
+	}
+	if reads == 0 || reg.liveQueries != reads {
+		t.Errorf("expected liveness to be read by the first pass only, got %d then %d reads", reads, reg.liveQueries-reads)
+	}
+}
+
+// mockHeartbeatRegistry is a mockRegistry whose heartbeat carries host status.
+type mockHeartbeatRegistry struct {
+	mockRegistry
+	owned   []int
+	fleet   []domain.HostStatus
+	listErr error
+}
+
+func (m *mockHeartbeatRegistry) UpdateHeartbeat(ctx context.Context, recordsOwned int, reconciledAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owned = append(m.owned, recordsOwned)
+	return nil
+}
+
+func (m *mockHeartbeatRegistry) GetFleet(ctx context.Context) ([]domain.HostStatus, error) {
+	return m.fleet, m.listErr
+}
+
+func TestSyncEngine_reconcile_PublishesRecordsOwned(t *testing.T) {
+	kept := makeIntent("kept.example.com", domain.RecordA, "192.168.1.1")
+	stale := makeIntent("stale.example.com", domain.RecordA, "192.168.1.1")
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	peer := makeIntent("peer.example.com", domain.RecordA, "192.168.1.2")
+	peer.Hostname = "peer-host"
+
+	reg := &mockHeartbeatRegistry{}
+	reg.listFunc = func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{kept, stale, peer}, nil
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return []*domain.RecordIntent{kept, added} }}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, state)
+
+	engine.reconcile(context.Background())
+
+	if len(reg.owned) != 1 || reg.owned[0] != 2 {
+		t.Errorf("expected 2 owned records to be published, got %v", reg.owned)
+	}
+}
+
+func TestSyncEngine_reconcile_FailedPassIsNotPublished(t *testing.T) {
+	reg := &mockHeartbeatRegistry{}
+	reg.listFunc = func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return nil, errors.New("registry unavailable")
+	}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, &mockState{})
+
+	engine.reconcile(context.Background())
+
+	if len(reg.owned) != 0 {
+		t.Errorf("expected a failed pass not to update the heartbeat, got %v", reg.owned)
+	}
+}
+
+func TestGetFleet(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "a", Registry: &mockHeartbeatRegistry{fleet: []domain.HostStatus{{Hostname: "host-1"}}}},
+		{Name: "b", Registry: &mockHeartbeatRegistry{listErr: errors.New("etcd unavailable")}},
+		{Name: "c", Registry: &mockRegistry{}},
+	}
+
+	fleet := GetFleet(context.Background(), clusters)
+
+	if len(fleet) != 3 {
+		t.Fatalf("expected one entry per cluster, got %+v", fleet)
+	}
+	if fleet[0].Cluster != "a" || len(fleet[0].Hosts) != 1 || fleet[0].Err != "" {
+		t.Errorf("expected cluster a's hosts, got %+v", fleet[0])
+	}
+	if fleet[1].Err != "etcd unavailable" || fleet[1].Hosts == nil {
+		t.Errorf("expected cluster b's error with an empty host list, got %+v", fleet[1])
+	}
+	if fleet[2].Err == "" {
+		t.Errorf("expected a registry without host status to be reported, got %+v", fleet[2])
+	}
+}
+
+func TestSyncEngine_reconcile_Traced(t *testing.T) {
+	reg := &mockPlanRegistry{applyPlanFunc: func(_ int, toAdd, toRemove []*domain.RecordIntent) (int, int, error) {
+		return len(toAdd), len(toRemove), nil
+	}}
+	engine := planTestEngine(reg)
+	exporter := tracetest.NewInMemoryExporter()
+	engine.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	engine.trigger = TriggerManual
+
+	engine.reconcile(context.Background())
+	engine.handleEventTraced(context.Background(), domain.ContainerEvent{Container: domain.Container{Id: "c1"}, EventType: domain.EventTypeContainerDied})
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range exporter.GetSpans().Snapshots() {
+		spans[s.Name()] = s
+	}
+	pass, cluster := spans["engine.reconcile"], spans["engine.reconcile_cluster"]
+	if pass == nil || cluster == nil {
+		t.Fatalf("expected pass and cluster spans, got %v", spans)
+	}
+	if cluster.Parent().SpanID() != pass.SpanContext().SpanID() {
+		t.Error("expected the cluster span within the pass span")
+	}
+	attrs := map[string]string{}
+	for _, kv := range append(pass.Attributes(), cluster.Attributes()...) {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["reconcile.trigger"] != "manual" || attrs["cluster"] != config.DefaultEtcdClusterName || attrs["reconcile.added"] != "1" {
+		t.Errorf("unexpected span attributes %v", attrs)
+	}
+	if spans["engine.handle_event"] == nil {
+		t.Error("expected a span for the handled event")
+	}
+}
+
+// mockZonedRegistry is a mockRegistry that only serves names under zone.
+type mockZonedRegistry struct {
+	mockRegistry
+	zone string
+}
+
+func (m *mockZonedRegistry) Serves(fqdn string) bool {
+	return strings.HasSuffix(fqdn, "."+m.zone)
+}
+
+func TestSyncEngine_Reconcile_SkipsUnservedNames(t *testing.T) {
+	inZone := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	outOfZone := makeIntent("app.other.org", domain.RecordA, "192.168.1.2")
+	reg := &mockZonedRegistry{zone: "example.com"}
+	reg.registerFunc = func(ctx context.Context, ri *domain.RecordIntent) error {
+		if !reg.Serves(ri.Record.Name) {
+			return errors.New("not under any zone")
+		}
+		return nil
+	}
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return []*domain.RecordIntent{inZone, outOfZone} }}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, state)
+
+	res := engine.reconcile(context.Background())
+
+	if res.Err != nil {
+		t.Fatalf("expected the pass to succeed despite the unserved name, got %v", res.Err)
+	}
+	if len(reg.registeredRecords) != 1 || reg.registeredRecords[0] != inZone {
+		t.Errorf("expected only the in-zone record registered, got %v", reg.registeredRecords)
+	}
+	var found bool
+	for _, d := range engine.Snapshot().Clusters[0].Decisions {
+		if d.Code == domain.DecisionOutOfZone && d.Record == outOfZone.Record {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an out_of_zone decision for %s", outOfZone.Record.Render())
+	}
+}
+
+func TestSyncEngine_reconcileCluster_ReplansUnderLockWithoutApplyPlan(t *testing.T) {
+	desired := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	// Another host publishes an older CNAME for the name between the listing
+	// and the lock.
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "web.example.com")
+	cname.Hostname, cname.ContainerName, cname.Created = "other-host", "web", time.Now().Add(-time.Hour)
+	var lists int
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		lists++
+		if lists == 1 {
+			return nil, nil
+		}
+		return []*domain.RecordIntent{cname}, nil
+	}}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, &mockState{})
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], []*domain.RecordIntent{desired})
+
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(reg.registeredRecords) != 0 {
+		t.Errorf("expected the A record not to be added next to the CNAME listed under the lock, got %v", reg.registeredRecords)
+	}
+	if lists != 2 {
+		t.Errorf("expected the registry to be listed again under the lock, got %d listings", lists)
+	}
+}
+
+func TestSyncEngine_reconcileCluster_RelocksWhenReplanTouchesNewNames(t *testing.T) {
+	desired := makeIntent("alias.example.com", domain.RecordCNAME, "web.example.com")
+	// web becomes a CNAME to api after the first listing, so the plan now
+	// depends on names it did not lock.
+	web := makeIntent("web.example.com", domain.RecordCNAME, "api.example.com")
+	web.Hostname = "other-host"
+	var lists int
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		lists++
+		if lists == 1 {
+			return nil, nil
+		}
+		return []*domain.RecordIntent{web}, nil
+	}}
+	var locked [][]string
+	reg.lockTransactionFunc = func(ctx context.Context, keys []string, fn func(context.Context) error) error {
+		locked = append(locked, keys)
+		return fn(ctx)
+	}
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, &mockState{})
+
+	res := engine.reconcileCluster(context.Background(), engine.clusters[0], []*domain.RecordIntent{desired})
+
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(locked) != 2 || fmt.Sprint(locked[1]) != "[alias.example.com api.example.com web.example.com]" {
+		t.Fatalf("expected the pass to lock the CNAME's new chain before writing, got %v", locked)
+	}
+	if len(reg.registeredRecords) != 1 || reg.registeredRecords[0] != desired {
+		t.Errorf("expected the CNAME added once its chain was locked, got %v", reg.registeredRecords)
+	}
+}
+
+func TestSyncEngine_Run_RetriesFailedPassEveryPollInterval(t *testing.T) {
+	eventCh := make(chan domain.ContainerEvent)
+	close(eventCh)
+	gen := &mockGenerator{
+		subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+			return eventCh, nil
+		},
+	}
+	state := &mockState{
+		getAllDesiredFunc: func() []*domain.RecordIntent {
+			return []*domain.RecordIntent{}
+		},
+	}
+	var lists atomic.Int32
+	reg := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			lists.Add(1)
+			return nil, errors.New("etcd unavailable")
+		},
+	}
+	cfg := testAppConfig()
+	cfg.PollInterval = 1
+	cfg.ReconcileSafetyInterval = 60
+
+	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	// The first pass fails, so the next comes a poll interval later rather
+	// than a safety-net interval.
+	engine.TriggerReconcile()
+	deadline := time.Now().Add(3 * time.Second)
+	for lists.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := lists.Load(); n < 2 {
+		t.Fatalf("expected the failed pass to be retried, got %d passes", n)
+	}
+}
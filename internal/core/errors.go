@@ -1,7 +1,11 @@
 package core
 
+import "github.com/auto-dns/docker-coredns-sync/internal/domain"
+
 // RecordValidationError represents an error that occurs during DNS record validation
 type RecordValidationError struct {
+	// Code is the rule the record broke.
+	Code    domain.DecisionCode
 	Message string
 }
 
@@ -11,6 +15,6 @@ func (e *RecordValidationError) Error() string {
 }
 
 // NewRecordValidationError creates a new RecordValidationError
-func NewRecordValidationError(message string) *RecordValidationError {
-	return &RecordValidationError{Message: message}
+func NewRecordValidationError(code domain.DecisionCode, message string) *RecordValidationError {
+	return &RecordValidationError{Code: code, Message: message}
 }
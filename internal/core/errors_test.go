@@ -3,10 +3,12 @@ package core
 import (
 	"strings"
 	"testing"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 )
 
 func TestRecordValidationError_Error(t *testing.T) {
-	err := NewRecordValidationError("test error message")
+	err := NewRecordValidationError(domain.DecisionCNAMECycle, "test error message")
 
 	if err.Error() != "test error message" {
 		t.Errorf("expected 'test error message', got %q", err.Error())
@@ -14,11 +16,14 @@ func TestRecordValidationError_Error(t *testing.T) {
 }
 
 func TestRecordValidationError_Message(t *testing.T) {
-	err := NewRecordValidationError("custom message")
+	err := NewRecordValidationError(domain.DecisionDuplicateValue, "custom message")
 
 	if err.Message != "custom message" {
 		t.Errorf("expected Message 'custom message', got %q", err.Message)
 	}
+	if err.Code != domain.DecisionDuplicateValue {
+		t.Errorf("expected Code %q, got %q", domain.DecisionDuplicateValue, err.Code)
+	}
 }
 
 func TestRecordValidationError_ImplementsError(t *testing.T) {
@@ -26,7 +31,7 @@ func TestRecordValidationError_ImplementsError(t *testing.T) {
 }
 
 func TestRecordValidationError_EmptyMessage(t *testing.T) {
-	err := NewRecordValidationError("")
+	err := NewRecordValidationError(domain.DecisionCNAMEConflict, "")
 
 	if err.Error() != "" {
 		t.Errorf("expected empty error message, got %q", err.Error())
@@ -35,7 +40,7 @@ func TestRecordValidationError_EmptyMessage(t *testing.T) {
 
 func TestRecordValidationError_WithDetails(t *testing.T) {
 	msg := "cannot add A record: CNAME exists for app.example.com"
-	err := NewRecordValidationError(msg)
+	err := NewRecordValidationError(domain.DecisionCNAMEConflict, msg)
 
 	if !strings.Contains(err.Error(), "CNAME") {
 		t.Error("expected error message to contain 'CNAME'")
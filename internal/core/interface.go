@@ -18,16 +18,39 @@ type state interface {
 	GetAllDesiredRecordIntents() []*domain.RecordIntent
 }
 
+// containerLister is an optional extension of state that lists the tracked
+// containers, for the engine's snapshot (see SyncEngine.Snapshot).
+type containerLister interface {
+	Containers() []domain.TrackedContainer
+}
+
 type upstreamRegistry interface {
 	StartHeartbeat(ctx context.Context) error
 	GetLiveHostnames(ctx context.Context) (map[string]struct{}, error)
-	LockTransaction(ctx context.Context, key []string, fn func() error) error
+	LockTransaction(ctx context.Context, key []string, fn func(ctx context.Context) error) error
 	List(ctx context.Context) ([]*domain.RecordIntent, error)
 	Register(ctx context.Context, record *domain.RecordIntent) error
 	Remove(ctx context.Context, record *domain.RecordIntent) error
 	StopHeartbeat()
 }
 
+// planApplier is an optional extension of upstreamRegistry that applies a
+// whole reconciliation plan at once, guarded against changes made to the
+// registry since the preceding List. applied are the writes it committed,
+// even when it fails part-way. An error wrapping
+// domain.ErrPlanConflict means some of the plan was not applied because the
+// registry changed; the caller should list and plan again.
+type planApplier interface {
+	ApplyPlan(ctx context.Context, toAdd, toRemove []*domain.RecordIntent) (applied []domain.Mutation, err error)
+}
+
+// nameServer is an optional extension of upstreamRegistry for registries that
+// only hold some names, such as those under the zones configured for them.
+// Desired records of other names are left out of the cluster's plan.
+type nameServer interface {
+	Serves(fqdn string) bool
+}
+
 // reconcileReporter is an optional observer of reconciliation outcomes, used to
 // feed liveness/readiness reporting. A nil error indicates a successful pass.
 type reconcileReporter interface {
@@ -40,3 +63,115 @@ type reconcileReporter interface {
 type reconcileMetrics interface {
 	ObserveReconcile(duration time.Duration, added, removed, skipped int, err error)
 }
+
+// clusterReconcileReporter is an optional extension of reconcileReporter that is
+// also told the outcome of each cluster within a pass.
+type clusterReconcileReporter interface {
+	RecordClusterReconcile(cluster string, err error)
+}
+
+// clusterReconcileMetrics is an optional extension of reconcileMetrics that
+// also receives each cluster's outcome within a pass.
+type clusterReconcileMetrics interface {
+	ObserveClusterReconcile(cluster string, added, removed int, err error)
+}
+
+// reconcileTriggerMetrics is an optional extension of reconcileMetrics that
+// counts reconciliation passes by what triggered them (see TriggerReason).
+type reconcileTriggerMetrics interface {
+	IncReconcileTrigger(reason string)
+}
+
+// gcElector is an optional extension of upstreamRegistry for registries that
+// elect a single host to garbage-collect orphaned records. Every other host
+// only reconciles its own records.
+type gcElector interface {
+	GCLeader(ctx context.Context) (leader string, isLeader bool, err error)
+}
+
+// gcLeaderReporter is an optional extension of reconcileReporter that is told
+// each cluster's GC leader whenever the engine checks it.
+type gcLeaderReporter interface {
+	RecordGCLeader(cluster, leader string, isLeader bool)
+}
+
+// gcLeaderMetrics is an optional extension of reconcileMetrics that is told
+// each cluster's GC leader whenever the engine checks it.
+type gcLeaderMetrics interface {
+	SetGCLeader(cluster, leader string, isLeader bool)
+}
+
+// heartbeatPublisher is an optional extension of upstreamRegistry whose
+// heartbeat carries this host's status (see domain.HostStatus). The engine
+// reports each successful pass on the cluster to it.
+type heartbeatPublisher interface {
+	UpdateHeartbeat(ctx context.Context, recordsOwned int, reconciledAt time.Time) error
+}
+
+// fleetLister is an optional extension of upstreamRegistry that lists the
+// status every heartbeating host publishes.
+type fleetLister interface {
+	GetFleet(ctx context.Context) ([]domain.HostStatus, error)
+}
+
+// breakerReporter is an optional extension of reconcileReporter that is told
+// the state of each cluster's removal breaker after every pass. An empty
+// reason means no removals are blocked.
+type breakerReporter interface {
+	RecordBreaker(cluster, reason string)
+}
+
+// breakerMetrics is an optional extension of reconcileMetrics that is told how
+// many removals of each kind (see BreakerOwn and BreakerGC) a cluster's
+// breaker is blocking.
+type breakerMetrics interface {
+	SetBreakerBlocked(cluster, kind string, blocked int)
+}
+
+// pauseReporter is an optional extension of reconcileReporter that is told
+// whenever the engine is paused or resumed.
+type pauseReporter interface {
+	SetPaused(paused bool)
+}
+
+// changeSink is an optional observer of the changes the engine makes or sees,
+// such as a stream to operators. Publish may be called concurrently and must
+// not block.
+type changeSink interface {
+	Publish(c domain.Change)
+}
+
+// auditSink is an optional, append-only record of every registry write this
+// instance makes. Audit is called once per write, possibly concurrently, right
+// after the write commits.
+type auditSink interface {
+	Audit(e domain.AuditEntry) error
+}
+
+// pauseMetrics is an optional extension of reconcileMetrics that is told
+// whenever the engine is paused or resumed.
+type pauseMetrics interface {
+	SetPaused(paused bool)
+}
+
+// recordMetrics is an optional extension of reconcileMetrics that is told,
+// after every pass, the records this host desires and the records each
+// cluster it listed holds once the pass's writes are applied.
+type recordMetrics interface {
+	SetDesiredRecords(records []*domain.RecordIntent)
+	SetPublishedRecords(cluster string, records []*domain.RecordIntent)
+}
+
+// conflictMetrics is an optional extension of reconcileMetrics that counts
+// record conflicts by how they were resolved (see ConflictResolution), and
+// the records GC reaps from each dead host.
+type conflictMetrics interface {
+	IncConflict(resolution string)
+	AddGCReaped(cluster, host string, n int)
+}
+
+// labelErrorMetrics is an optional extension of reconcileMetrics that counts
+// the labels of each container that could not be turned into a record.
+type labelErrorMetrics interface {
+	IncLabelError(container, code string)
+}
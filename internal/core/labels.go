@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -34,10 +35,26 @@ func (lr LabeledRecord) GetValueLabel() string {
 	}
 }
 
+// record returns the record as its labels give it, before defaults apply and
+// without validation.
+func (lr LabeledRecord) record() domain.Record {
+	return domain.Record{Kind: lr.Kind, Name: strings.TrimSpace(lr.Name), Value: strings.TrimSpace(lr.Value)}
+}
+
 type ParsedLabels struct {
 	Enabled        bool
 	ContainerForce bool
 	Records        []LabeledRecord
+	// Ignored lists the record labels that could not be used, sorted by key.
+	Ignored []IgnoredLabel
+}
+
+// IgnoredLabel is a label under the prefix that ParseLabels left out, and
+// why.
+type IgnoredLabel struct {
+	Key    string
+	Code   domain.DecisionCode
+	Reason string
 }
 
 func ParseLabels(prefix string, labels map[string]string) ParsedLabels {
@@ -81,7 +98,10 @@ func ParseLabels(prefix string, labels map[string]string) ParsedLabels {
 		rawKind := parts[1]
 		kind, err := domain.ParseKind(rawKind)
 		if err != nil {
-			// unknown record kind; skip
+			// unknown record kind; skip, but report record definitions
+			if last := parts[len(parts)-1]; last == "name" || last == "value" {
+				pl.Ignored = append(pl.Ignored, IgnoredLabel{Key: k, Code: domain.DecisionUnsupportedKind, Reason: fmt.Sprintf("record type %q is not supported", rawKind)})
+			}
 			continue
 		}
 
@@ -118,6 +138,8 @@ func ParseLabels(prefix string, labels map[string]string) ParsedLabels {
 		case "ttl":
 			if ttl, ok := ttlFromLabel(v); ok {
 				a.ttl = &ttl
+			} else {
+				pl.Ignored = append(pl.Ignored, IgnoredLabel{Key: k, Code: domain.DecisionInvalidLabel, Reason: fmt.Sprintf("ttl %q is not a whole number of seconds", v)})
 			}
 		}
 	}
@@ -135,6 +157,8 @@ func ParseLabels(prefix string, labels map[string]string) ParsedLabels {
 		})
 	}
 
+	sort.Slice(pl.Ignored, func(i, j int) bool { return pl.Ignored[i].Key < pl.Ignored[j].Key })
+
 	return pl
 }
 
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
@@ -613,3 +614,25 @@ func TestParseLabels_OnlyInvalidFieldsNoRecord(t *testing.T) {
 		t.Errorf("expected 0 records for invalid fields only, got %d", len(result.Records))
 	}
 }
+
+func TestParseLabels_ReportsIgnoredLabels(t *testing.T) {
+	labels := map[string]string{
+		"coredns.enabled":  "true",
+		"coredns.MX.name":  "mail.example.com",
+		"coredns.TXT.text": "v=spf1 ~all",
+		"coredns.A.name":   "app.example.com",
+		"coredns.A.ttl":    "soon",
+	}
+
+	result := ParseLabels("coredns", labels)
+
+	if len(result.Ignored) != 2 {
+		t.Fatalf("expected 2 ignored labels, got %+v", result.Ignored)
+	}
+	if ig := result.Ignored[0]; ig.Key != "coredns.A.ttl" || ig.Code != domain.DecisionInvalidLabel {
+		t.Errorf("unexpected ignored label %+v", ig)
+	}
+	if ig := result.Ignored[1]; ig.Key != "coredns.MX.name" || ig.Code != domain.DecisionUnsupportedKind || !strings.Contains(ig.Reason, `"MX"`) {
+		t.Errorf("unexpected ignored label %+v", ig)
+	}
+}
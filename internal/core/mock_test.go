@@ -22,9 +22,16 @@ func (m *mockGenerator) Subscribe(ctx context.Context) (<-chan domain.ContainerE
 	if m.subscribeFunc != nil {
 		return m.subscribeFunc(ctx)
 	}
-	ch := make(chan domain.ContainerEvent)
+	return listedEvents(), nil
+}
+
+// listedEvents returns a closed event channel carrying just the resync event
+// a generator sends once it has listed the (here, no) running containers.
+func listedEvents() <-chan domain.ContainerEvent {
+	ch := make(chan domain.ContainerEvent, 1)
+	ch <- domain.ContainerEvent{EventType: domain.EventTypeResync}
 	close(ch)
-	return ch, nil
+	return ch
 }
 
 type mockState struct {
@@ -110,7 +117,7 @@ type mockRegistry struct {
 	mu                   sync.Mutex
 	startHeartbeatFunc   func(ctx context.Context) error
 	getLiveHostnamesFunc func(ctx context.Context) (map[string]struct{}, error)
-	lockTransactionFunc  func(ctx context.Context, keys []string, fn func() error) error
+	lockTransactionFunc  func(ctx context.Context, keys []string, fn func(context.Context) error) error
 	listFunc             func(ctx context.Context) ([]*domain.RecordIntent, error)
 	registerFunc         func(ctx context.Context, record *domain.RecordIntent) error
 	removeFunc           func(ctx context.Context, record *domain.RecordIntent) error
@@ -149,7 +156,7 @@ func (m *mockRegistry) GetLiveHostnames(ctx context.Context) (map[string]struct{
 	return nil, nil
 }
 
-func (m *mockRegistry) LockTransaction(ctx context.Context, keys []string, fn func() error) error {
+func (m *mockRegistry) LockTransaction(ctx context.Context, keys []string, fn func(context.Context) error) error {
 	m.mu.Lock()
 	m.lockTransactionCalled = true
 	m.mu.Unlock()
@@ -157,7 +164,7 @@ func (m *mockRegistry) LockTransaction(ctx context.Context, keys []string, fn fu
 	if m.lockTransactionFunc != nil {
 		return m.lockTransactionFunc(ctx, keys, fn)
 	}
-	return fn()
+	return fn(ctx)
 }
 
 func (m *mockRegistry) List(ctx context.Context) ([]*domain.RecordIntent, error) {
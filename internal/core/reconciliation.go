@@ -1,6 +1,8 @@
 package core
 
 import (
+	"sort"
+
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 
@@ -96,8 +98,9 @@ func shouldReplaceAllExisting(new *domain.RecordIntent, existing []*domain.Recor
 }
 
 // FilterRecordIntents receives a slice of RecordIntent (desired) and filters out conflicting ones.
-// It returns a reconciled slice of RecordIntent.
-func FilterRecordIntents(recordIntents []*domain.RecordIntent, logger zerolog.Logger) []*domain.RecordIntent {
+// It returns a reconciled slice of RecordIntent. Why each dropped intent lost
+// is recorded in trail, which may be nil.
+func FilterRecordIntents(recordIntents []*domain.RecordIntent, trail *Trail, logger zerolog.Logger) []*domain.RecordIntent {
 	logger.Debug().Msg("Reconciling desired records against each other")
 
 	desiredByNameKind := newNestedRecordMap()
@@ -105,13 +108,16 @@ func FilterRecordIntents(recordIntents []*domain.RecordIntent, logger zerolog.Lo
 	// 1. Deduplicate per name+kind using shouldReplaceExisting
 	for _, ri := range recordIntents {
 		switch {
-		case ri.Record.IsA():
-			if existing, dup := desiredByNameKind.PeekNameKindRecord(ri.Record.Name, domain.RecordA, ri.Record.Value); !dup || shouldReplaceExisting(ri, existing, logger) {
-				desiredByNameKind.Get(ri.Record.Name).Get(domain.RecordA).Set(ri.Record.Value, ri)
-			}
-		case ri.Record.IsAAAA():
-			if existing, dup := desiredByNameKind.PeekNameKindRecord(ri.Record.Name, domain.RecordAAAA, ri.Record.Value); !dup || shouldReplaceExisting(ri, existing, logger) {
-				desiredByNameKind.Get(ri.Record.Name).Get(domain.RecordAAAA).Set(ri.Record.Value, ri)
+		case ri.Record.IsAddress():
+			existing, dup := desiredByNameKind.PeekNameKindRecord(ri.Record.Name, ri.Record.Kind, ri.Record.Value)
+			switch {
+			case !dup:
+				desiredByNameKind.Get(ri.Record.Name).Get(ri.Record.Kind).Set(ri.Record.Value, ri)
+			case shouldReplaceExisting(ri, existing, logger):
+				desiredByNameKind.Get(ri.Record.Name).Get(ri.Record.Kind).Set(ri.Record.Value, ri)
+				trail.lost(existing, ri)
+			default:
+				trail.lost(ri, existing)
 			}
 		case ri.Record.IsCNAME():
 			if cnames, exists := desiredByNameKind.PeekNameKindRecords(ri.Record.Name, domain.RecordCNAME); exists {
@@ -120,6 +126,9 @@ func FilterRecordIntents(recordIntents []*domain.RecordIntent, logger zerolog.Lo
 				if shouldReplaceExisting(ri, existing, logger) {
 					desiredByNameKind.Get(ri.Record.Name).Get(domain.RecordCNAME).Delete(existing.Record.Value)
 					desiredByNameKind.Get(ri.Record.Name).Get(domain.RecordCNAME).Set(ri.Record.Value, ri)
+					trail.lost(existing, ri)
+				} else {
+					trail.lost(ri, existing)
 				}
 			} else {
 				// No conflict - just add it
@@ -155,7 +164,11 @@ func FilterRecordIntents(recordIntents []*domain.RecordIntent, logger zerolog.Lo
 
 			if shouldReplaceAllExisting(cnameRecord, allAddr, logger) {
 				desiredByNameKindDeduplicated.Get(name).Get(domain.RecordCNAME).Set(cnameRecord.Record.Value, cnameRecord)
+				for _, ri := range allAddr {
+					trail.lost(ri, cnameRecord)
+				}
 			} else {
+				trail.lostToAll(cnameRecord, allAddr)
 				for _, ri := range aRecs {
 					desiredByNameKindDeduplicated.Get(name).Get(domain.RecordA).Set(ri.Record.Value, ri)
 				}
@@ -180,7 +193,17 @@ func FilterRecordIntents(recordIntents []*domain.RecordIntent, logger zerolog.Lo
 // (and not owned by this host) are garbage-collected as orphans. When it is
 // nil, cross-host GC is disabled and only this host's own stale records are
 // removed — the original, conservative behavior.
-func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.AppConfig, liveHostnames map[string]struct{}, logger zerolog.Logger) ([]*domain.RecordIntent, []*domain.RecordIntent) {
+//
+// A record in a wire format this release does not recognize (see
+// domain.WireInfo.Recognized) is never garbage-collected: its owner predates
+// heartbeats or runs a newer release, so its missing heartbeat proves nothing.
+//
+// A record without an owner was written by another tool. It is never removed,
+// not even to make way for a record with the force label.
+//
+// Whether each desired record is published, and if not why, is recorded in
+// trail, which may be nil.
+func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.AppConfig, liveHostnames map[string]struct{}, trail *Trail, logger zerolog.Logger) ([]*domain.RecordIntent, []*domain.RecordIntent) {
 	toAddMap := map[string]*domain.RecordIntent{}
 	toRemoveMap := map[string]*domain.RecordIntent{}
 
@@ -191,26 +214,43 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 	}
 
 	// Step 1: Remove stale records and build lookup structure
+	unrecognizedOwners := map[string]struct{}{}
 	for _, ri := range actual {
 		if _, exists := desiredSet[ri.Key()]; !exists {
-			if ri.Hostname == cfg.Hostname {
-				logger.Info().Msgf("Removing stale record: %s (owned by %s/%s)", ri.Record.Render(), ri.Hostname, ri.ContainerName)
+			if ri.Hostname == "" {
+				logger.Debug().Str("record", ri.Record.Render()).Msg("Skipping removal of record no instance owns")
+			} else if ri.Hostname == cfg.Hostname {
+				logger.Info().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Str("container_name", ri.ContainerName).Msg("Removing stale record")
 				toRemoveMap[ri.Key()] = ri
 				continue // Don't add stale records to lookup - they're already being removed
 			} else if liveHostnames != nil {
-				if _, alive := liveHostnames[ri.Hostname]; !alive {
-					logger.Info().Msgf("GC: removing orphaned record owned by dead host: %s (owned by %s/%s)", ri.Record.Render(), ri.Hostname, ri.ContainerName)
+				_, alive := liveHostnames[ri.Hostname]
+				switch {
+				case !alive && ri.Wire.Recognized():
+					logger.Info().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Str("container_name", ri.ContainerName).Msg("GC: removing orphaned record owned by dead host")
 					toRemoveMap[ri.Key()] = ri
 					continue // Don't add orphaned records to lookup - they're already being removed
+				case !alive:
+					logger.Debug().Int("schema", ri.Wire.Schema).Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Msg("GC: keeping record of a host without a heartbeat: wire schema not recognized")
+					unrecognizedOwners[ri.Hostname] = struct{}{}
+				default:
+					logger.Debug().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Msg("Skipping removal of record owned by another live host")
 				}
-				logger.Debug().Msgf("Skipping removal of record %s owned by live host %s (not this host %s)", ri.Record.Render(), ri.Hostname, cfg.Hostname)
 			} else {
-				logger.Debug().Msgf("Skipping removal of record %s not owned by this host (%s != %s)", ri.Record.Render(), ri.Hostname, cfg.Hostname)
+				logger.Debug().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Msg("Skipping removal of record not owned by this host")
 			}
 		}
 		// Add all non-stale records to lookup for conflict detection in Step 2
 		actualByNameKind.Get(ri.Record.Name).Get(ri.Record.Kind).Set(ri.Record.Value, ri)
 	}
+	if len(unrecognizedOwners) > 0 {
+		owners := make([]string, 0, len(unrecognizedOwners))
+		for h := range unrecognizedOwners {
+			owners = append(owners, h)
+		}
+		sort.Strings(owners)
+		logger.Warn().Strs("owners", owners).Msg("GC: keeping records of hosts without a heartbeat whose wire schema is not recognized; upgrade those hosts, or remove their records by hand if they are gone")
+	}
 
 	// Step 2: Reconcile each desired record
 	for _, d := range desired {
@@ -221,22 +261,31 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 			// A vs CNAME
 			if cnames, ok := actualByNameKind.PeekNameKindRecords(d.Record.Name, domain.RecordCNAME); ok {
 				existing := cnames[0]
-				if d.Force || d.Created.Before(existing.Created) {
+				if u := unowned(cnames); u != nil {
+					trail.lostToUnowned(d, u)
+					continue
+				} else if d.Force || d.Created.Before(existing.Created) {
 					for _, r := range cnames {
 						evictions[r.Key()] = r
 					}
 					logger.Warn().Strs("actual", renderAll(cnames)).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", d.Created.Before(existing.Created)).Msg("A vs CNAME - evicting CNAME")
 				} else {
+					trail.lostToRegistry(d, existing)
 					continue
 				}
 			} else if r, ok := actualByNameKind.PeekNameKindRecord(d.Record.Name, domain.RecordA, d.Record.Value); ok {
 				// Same A exists - replace only if d wins
 				if r.Equal(*d) {
+					trail.intent(domain.StageReconcile, d, domain.DecisionPublished, "already in the registry", nil)
+					continue
+				} else if r.Hostname == "" {
+					trail.lostToUnowned(d, r)
 					continue
 				} else if d.Force || d.Created.Before(r.Created) {
 					logger.Warn().Str("actual_record_intent", r.Render()).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", d.Created.Before(r.Created)).Msg("A vs A - evicting A")
 					evictions[r.Key()] = r
 				} else {
+					trail.lostToRegistry(d, r)
 					continue
 				}
 			}
@@ -244,22 +293,31 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 		case d.Record.IsAAAA():
 			if cnames, ok := actualByNameKind.PeekNameKindRecords(d.Record.Name, domain.RecordCNAME); ok {
 				existing := cnames[0]
-				if d.Force || d.Created.Before(existing.Created) {
+				if u := unowned(cnames); u != nil {
+					trail.lostToUnowned(d, u)
+					continue
+				} else if d.Force || d.Created.Before(existing.Created) {
 					for _, r := range cnames {
 						evictions[r.Key()] = r
 					}
 					logger.Warn().Strs("actual", renderAll(cnames)).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", d.Created.Before(existing.Created)).Msg("AAAA vs CNAME - evicting CNAME")
 				} else {
+					trail.lostToRegistry(d, existing)
 					continue
 				}
 			} else if r, ok := actualByNameKind.PeekNameKindRecord(d.Record.Name, domain.RecordAAAA, d.Record.Value); ok {
 				// Same AAAA exists — replace only if d wins
 				if r.Equal(*d) {
+					trail.intent(domain.StageReconcile, d, domain.DecisionPublished, "already in the registry", nil)
+					continue
+				} else if r.Hostname == "" {
+					trail.lostToUnowned(d, r)
 					continue
 				} else if d.Force || d.Created.Before(r.Created) {
 					logger.Warn().Str("actual_record_intent", r.Render()).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", d.Created.Before(r.Created)).Msg("AAAA vs AAAA - evicting AAAA")
 					evictions[r.Key()] = r
 				} else {
+					trail.lostToRegistry(d, r)
 					continue
 				}
 			}
@@ -267,25 +325,35 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 		case d.Record.IsCNAME():
 			// CNAME vs A/AAAA
 			if allAddr, hasAddr := addrRecords(actualByNameKind, d.Record.Name); hasAddr {
-				olderThanAll := true
+				var notYounger *domain.RecordIntent
 				for _, r := range allAddr {
 					if !d.Created.Before(r.Created) {
-						olderThanAll = false
+						notYounger = r
 						break
 					}
 				}
+				olderThanAll := notYounger == nil
 
-				if d.Force || olderThanAll {
+				if u := unowned(allAddr); u != nil {
+					trail.lostToUnowned(d, u)
+					continue
+				} else if d.Force || olderThanAll {
 					for _, r := range allAddr {
 						evictions[r.Key()] = r
 					}
 					logger.Warn().Strs("actual", renderAll(allAddr)).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", olderThanAll).Msg("CNAME vs A/AAAA — evicting address records")
 				} else {
+					trail.lostToRegistry(d, notYounger)
 					continue
 				}
 			} else if cnames, ok := actualByNameKind.PeekNameKindRecords(d.Record.Name, domain.RecordCNAME); ok {
 				existing := cnames[0]
 				if existing.Equal(*d) {
+					trail.intent(domain.StageReconcile, d, domain.DecisionPublished, "already in the registry", nil)
+					continue
+				}
+				if u := unowned(cnames); u != nil {
+					trail.lostToUnowned(d, u)
 					continue
 				}
 				if d.Force || d.Created.Before(existing.Created) {
@@ -294,6 +362,7 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 					}
 					logger.Warn().Strs("actual", renderAll(cnames)).Str("desired", d.Render()).Bool("force_eviction", d.Force).Bool("age_eviction", d.Created.Before(existing.Created)).Msg("Local vs remote - evicting remote")
 				} else {
+					trail.lostToRegistry(d, existing)
 					continue
 				}
 			}
@@ -319,13 +388,15 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 		}
 
 		if err := ValidateRecord(d, simulated, logger); err == nil {
-			logger.Info().Str("record", d.Render()).Msg("Adding new record")
+			logger.Info().Str("record", d.Record.Render()).Str("owner_hostname", d.Hostname).Str("container_id", d.ContainerId).Msg("Adding new record")
 			toAddMap[d.Record.Key()] = d
 			for k, v := range evictions {
 				toRemoveMap[k] = v
 			}
+			trail.added(d, evictions)
 		} else {
 			logger.Warn().Err(err).Str("record", d.Record.Render()).Msg("Skipping invalid record")
+			trail.invalid(d, err)
 		}
 	}
 
@@ -341,6 +412,16 @@ func ReconcileAndValidate(desired, actual []*domain.RecordIntent, cfg *config.Ap
 	return toAdd, toRemove
 }
 
+// unowned returns the first of rs that no instance owns, or nil.
+func unowned(rs []*domain.RecordIntent) *domain.RecordIntent {
+	for _, r := range rs {
+		if r.Hostname == "" {
+			return r
+		}
+	}
+	return nil
+}
+
 func addrRecords(m *nestedRecordMap, name string) ([]*domain.RecordIntent, bool) {
 	a, hasA := m.PeekNameKindRecords(name, domain.RecordA)
 	aaaa, hasAAAA := m.PeekNameKindRecords(name, domain.RecordAAAA)
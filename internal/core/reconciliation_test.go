@@ -1,6 +1,7 @@
 package core
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -214,7 +215,7 @@ func TestFilterRecordIntents_NoDuplicates(t *testing.T) {
 		simpleIntent("alias.example.com", domain.RecordCNAME, "target.example.com", "c3", 1, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 3 {
 		t.Errorf("expected 3 records, got %d", len(result))
@@ -227,7 +228,7 @@ func TestFilterRecordIntents_DuplicateADeduped(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "older", 5, false), // older should win
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record after dedup, got %d", len(result))
@@ -244,7 +245,7 @@ func TestFilterRecordIntents_DuplicateCNAMEDeduped(t *testing.T) {
 		simpleIntent("alias.example.com", domain.RecordCNAME, "target2.example.com", "older", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 CNAME after dedup, got %d", len(result))
@@ -261,7 +262,7 @@ func TestFilterRecordIntents_CNAMEVsA_CNAMEWins(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "older", 5, false), // older CNAME wins
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record, got %d", len(result))
@@ -278,7 +279,7 @@ func TestFilterRecordIntents_CNAMEVsA_AWins(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "newer", 1, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record, got %d", len(result))
@@ -296,7 +297,7 @@ func TestFilterRecordIntents_MultipleADifferentValues(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordA, "192.168.1.3", "c3", 3, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 3 {
 		t.Errorf("expected 3 A records with different values, got %d", len(result))
@@ -314,7 +315,7 @@ func TestReconcileAndValidate_AddNewRecord(t *testing.T) {
 	}
 	actual := []*domain.RecordIntent{}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 1 {
 		t.Errorf("expected 1 record to add, got %d", len(toAdd))
@@ -331,7 +332,7 @@ func TestReconcileAndValidate_RemoveStaleOwned(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c1", time.Now(), false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -348,7 +349,7 @@ func TestReconcileAndValidate_KeepStaleNotOwned(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c1", time.Now(), false, "other-host"), // different host
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -364,7 +365,7 @@ func TestReconcileAndValidate_IdenticalNoOp(t *testing.T) {
 	desired := []*domain.RecordIntent{intent}
 	actual := []*domain.RecordIntent{intent}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -384,7 +385,7 @@ func TestReconcileAndValidate_EvictCNAMEForA(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 1 {
 		t.Errorf("expected 1 record to add, got %d", len(toAdd))
@@ -404,7 +405,7 @@ func TestReconcileAndValidate_ForceEviction(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now.Add(-5*time.Hour), false, "test-host"),
 	}
 
-	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Force should cause eviction of different record with same name+kind+value
 	if len(toAdd) != 1 {
@@ -421,7 +422,7 @@ func TestReconcileAndValidate_ValidationFailureSkipped(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", time.Now().Add(-10*time.Hour), false, "other-host"), // other host, won't be evicted
 	}
 
-	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME conflicts with A record that can't be evicted (different host)
 	if len(toAdd) != 0 {
@@ -445,7 +446,7 @@ func TestReconcileAndValidate_ComplexScenario(t *testing.T) {
 		makeRecordIntent("other.example.com", domain.RecordA, "192.168.1.100", "c5", now, false, "other-host"), // not owned
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Should add: app1, alias
 	// Should remove: stale (owned, not in desired)
@@ -555,7 +556,7 @@ func TestReconcileAndValidate_AAAAVsCNAME_AAAAWins(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 1 {
 		t.Errorf("expected 1 AAAA record to add, got %d", len(toAdd))
@@ -576,7 +577,7 @@ func TestReconcileAndValidate_AAAAVsCNAME_CNAMEWins(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, _ := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME is older and owned by another host, AAAA should not be added
 	if len(toAdd) != 0 {
@@ -594,7 +595,7 @@ func TestReconcileAndValidate_AAAAVsAAAA_SameValue(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c1", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Same record - no changes
 	if len(toAdd) != 0 {
@@ -615,7 +616,7 @@ func TestReconcileAndValidate_AAAAVsAAAA_DifferentOwner(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c2", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Older desired wins
 	if len(toAdd) != 1 {
@@ -637,7 +638,7 @@ func TestReconcileAndValidate_CNAMEVsAAndAAAA(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c3", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME with force should evict both A and AAAA
 	if len(toAdd) != 1 {
@@ -658,7 +659,7 @@ func TestReconcileAndValidate_CNAMEVsCNAME_Eviction(t *testing.T) {
 		makeRecordIntent("alias.example.com", domain.RecordCNAME, "old-target.example.com", "c2", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Force CNAME should replace existing CNAME
 	if len(toAdd) != 1 {
@@ -676,7 +677,7 @@ func TestReconcileAndValidate_CNAMEVsCNAME_IdenticalNoOp(t *testing.T) {
 	desired := []*domain.RecordIntent{intent}
 	actual := []*domain.RecordIntent{intent}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -696,7 +697,7 @@ func TestReconcileAndValidate_AVsA_ForceEviction(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.2", "c2", now.Add(-5*time.Hour), false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 1 {
 		t.Errorf("expected 1 record to add, got %d", len(toAdd))
@@ -718,7 +719,7 @@ func TestReconcileAndValidate_MultipleDesiredWithEvictions(t *testing.T) {
 		makeRecordIntent("app2.example.com", domain.RecordCNAME, "old2.example.com", "c4", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Both A records should win over CNAMEs (older)
 	if len(toAdd) != 2 {
@@ -739,7 +740,7 @@ func TestFilterRecordIntents_AAAADeduplication(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "older", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record after dedup, got %d", len(result))
@@ -756,7 +757,7 @@ func TestFilterRecordIntents_CNAMEVsAAAA(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "older", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record, got %d", len(result))
@@ -774,7 +775,7 @@ func TestFilterRecordIntents_AAndAAAATogether(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c2", 1, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	// Both should be kept - A and AAAA can coexist
 	if len(result) != 2 {
@@ -788,7 +789,7 @@ func TestFilterRecordIntents_ForceWinsDeduplication(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "nonforce-older", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record after dedup, got %d", len(result))
@@ -880,7 +881,7 @@ func TestReconcileAndValidate_AVsA_NewerALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.2", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Existing A is older but owned by other host - desired newer should NOT win
 	if len(toAdd) != 0 {
@@ -902,7 +903,7 @@ func TestReconcileAndValidate_AAAAVsAAAA_NewerAAAALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Existing AAAA is older but owned by other host - desired newer should NOT win
 	if len(toAdd) != 0 {
@@ -924,7 +925,7 @@ func TestReconcileAndValidate_AVsCNAME_ALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Existing CNAME is older (owned by other host) - A should not be added
 	if len(toAdd) != 0 {
@@ -946,7 +947,7 @@ func TestReconcileAndValidate_CNAMEVsCNAME_NewerCNAMELoses(t *testing.T) {
 		makeRecordIntent("alias.example.com", domain.RecordCNAME, "old-target.example.com", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Existing CNAME is older (owned by other host) - new CNAME should not be added
 	if len(toAdd) != 0 {
@@ -969,7 +970,7 @@ func TestReconcileAndValidate_CNAMEVsAAndAAAA_CNAMELoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c3", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Existing address records are older (owned by other host) - CNAME should not be added
 	if len(toAdd) != 0 {
@@ -993,7 +994,7 @@ func TestReconcileAndValidate_ValidationFailure(t *testing.T) {
 		makeRecordIntent("loop.example.com", domain.RecordCNAME, "app.example.com", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Should skip the CNAME because it creates a cycle
 	if len(toAdd) != 0 {
@@ -1014,7 +1015,7 @@ func TestReconcileAndValidate_StaleRecordOtherHost(t *testing.T) {
 		makeRecordIntent("stale.example.com", domain.RecordA, "192.168.1.99", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Should not remove record owned by other host
 	if len(toRemove) != 0 {
@@ -1038,7 +1039,7 @@ func TestReconcileAndValidate_AWithDifferentValue(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now.Add(-5*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Should add new A - different values can coexist
 	if len(toAdd) != 1 {
@@ -1060,7 +1061,7 @@ func TestReconcileAndValidate_CNAMEOlderThanAllAddress(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c3", now, false, "test-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME is older than all address records - should evict them
 	if len(toAdd) != 1 {
@@ -1083,7 +1084,7 @@ func TestReconcileAndValidate_CNAMEVsAddressNotOlderThanAll(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c3", now.Add(-10*time.Hour), false, "other-host"), // Older than CNAME
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME is NOT older than all address records - should not evict
 	if len(toAdd) != 0 {
@@ -1103,7 +1104,7 @@ func TestFilterRecordIntents_NoRecordKind(t *testing.T) {
 	// This should hit the default case in the switch
 	intents := []*domain.RecordIntent{}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 0 {
 		t.Errorf("expected 0 records, got %d", len(result))
@@ -1116,7 +1117,7 @@ func TestFilterRecordIntents_CNAMEDeduplication(t *testing.T) {
 		simpleIntent("alias.example.com", domain.RecordCNAME, "target2.example.com", "older", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 CNAME after dedup, got %d", len(result))
@@ -1135,7 +1136,7 @@ func TestFilterRecordIntents_CNAMEVsAAndAAAA_CNAMEWins(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "oldest", 10, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	if len(result) != 1 {
 		t.Fatalf("expected 1 record (CNAME wins), got %d", len(result))
@@ -1153,7 +1154,7 @@ func TestFilterRecordIntents_CNAMEVsAAndAAAA_AddressWins(t *testing.T) {
 		simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "newer", 1, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	// A and AAAA are older - they should win
 	if len(result) != 2 {
@@ -1185,7 +1186,7 @@ func TestFilterRecordIntents_UnsupportedKindSkipped(t *testing.T) {
 		Record:        domain.Record{Kind: "UNKNOWN", Name: "test.example.com", Value: "x"},
 	}
 
-	result := FilterRecordIntents([]*domain.RecordIntent{unsupportedIntent}, reconcileLogger())
+	result := FilterRecordIntents([]*domain.RecordIntent{unsupportedIntent}, nil, reconcileLogger())
 
 	// The unsupported record should be skipped entirely
 	if len(result) != 0 {
@@ -1206,7 +1207,7 @@ func TestFilterRecordIntents_UnsupportedKindWithValidRecords(t *testing.T) {
 		simpleIntent("app2.example.com", domain.RecordCNAME, "target.example.com", "c3", 5, false),
 	}
 
-	result := FilterRecordIntents(intents, reconcileLogger())
+	result := FilterRecordIntents(intents, nil, reconcileLogger())
 
 	// Should have 2 records (the valid A and CNAME), unsupported skipped
 	if len(result) != 2 {
@@ -1229,7 +1230,7 @@ func TestReconcileAndValidate_CrossHostAVsCNAME_AEvictsCNAME(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// A is older than CNAME and should evict it
 	if len(toAdd) != 1 {
@@ -1251,7 +1252,7 @@ func TestReconcileAndValidate_CrossHostAVsCNAME_ALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// A is newer than CNAME - A loses, no changes
 	if len(toAdd) != 0 {
@@ -1273,7 +1274,7 @@ func TestReconcileAndValidate_CrossHostAAAAVsCNAME_AAAAEvictsCNAME(t *testing.T)
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// AAAA is older than CNAME and should evict it
 	if len(toAdd) != 1 {
@@ -1295,7 +1296,7 @@ func TestReconcileAndValidate_CrossHostAAAAVsCNAME_AAAALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// AAAA is newer than CNAME - AAAA loses
 	if len(toAdd) != 0 {
@@ -1317,7 +1318,7 @@ func TestReconcileAndValidate_CrossHostAVsA_AEvictsA(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired A is older, should evict the actual A
 	if len(toAdd) != 1 {
@@ -1339,7 +1340,7 @@ func TestReconcileAndValidate_CrossHostAVsA_ALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired A is newer - it loses to the older actual A
 	if len(toAdd) != 0 {
@@ -1361,7 +1362,7 @@ func TestReconcileAndValidate_CrossHostAAAAVsAAAA_AAAAEvictsAAAA(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired AAAA is older, should evict the actual AAAA
 	if len(toAdd) != 1 {
@@ -1383,7 +1384,7 @@ func TestReconcileAndValidate_CrossHostAAAAVsAAAA_AAAALoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired AAAA is newer - it loses to the older actual AAAA
 	if len(toAdd) != 0 {
@@ -1406,7 +1407,7 @@ func TestReconcileAndValidate_CrossHostCNAMEVsAAndAAAA_CNAMEEvicts(t *testing.T)
 		makeRecordIntent("app.example.com", domain.RecordAAAA, "2001:db8::1", "c3", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// CNAME is older than all address records, should evict both
 	if len(toAdd) != 1 {
@@ -1428,7 +1429,7 @@ func TestReconcileAndValidate_CrossHostCNAMEVsCNAME_CNAMEEvicts(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target2.example.com", "c2", now, false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired CNAME is older, should evict the actual CNAME
 	if len(toAdd) != 1 {
@@ -1450,7 +1451,7 @@ func TestReconcileAndValidate_CrossHostCNAMEVsCNAME_CNAMELoses(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target2.example.com", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Desired CNAME is newer - it loses to the older actual CNAME
 	if len(toAdd) != 0 {
@@ -1472,7 +1473,7 @@ func TestReconcileAndValidate_ForceEvictsCrossHost(t *testing.T) {
 		makeRecordIntent("app.example.com", domain.RecordCNAME, "target.example.com", "c2", now.Add(-10*time.Hour), false, "other-host"),
 	}
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	// Force should evict even though the actual record is older
 	if len(toAdd) != 1 {
@@ -1493,11 +1494,11 @@ func TestReconcileAndValidate_GCRemovesOrphanFromDeadHost(t *testing.T) {
 	desired := []*domain.RecordIntent{}
 	// A record owned by a host that is NOT in the live set.
 	actual := []*domain.RecordIntent{
-		makeRecordIntent("ghost.example.com", domain.RecordA, "192.168.1.9", "c1", now.Add(-10*time.Hour), false, "dead-host"),
+		versioned(makeRecordIntent("ghost.example.com", domain.RecordA, "192.168.1.9", "c1", now.Add(-10*time.Hour), false, "dead-host")),
 	}
 	liveHosts := map[string]struct{}{"test-host": {}} // dead-host absent
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -1519,7 +1520,7 @@ func TestReconcileAndValidate_GCKeepsRecordsFromLiveHost(t *testing.T) {
 	}
 	liveHosts := map[string]struct{}{"test-host": {}, "other-host": {}} // other-host alive
 
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -1538,7 +1539,7 @@ func TestReconcileAndValidate_GCDisabledKeepsForeignRecords(t *testing.T) {
 	}
 
 	// nil liveHosts => cross-host GC disabled; original conservative behavior.
-	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, reconcileLogger())
+	toAdd, toRemove := ReconcileAndValidate(desired, actual, cfg, nil, nil, reconcileLogger())
 
 	if len(toAdd) != 0 {
 		t.Errorf("expected 0 records to add, got %d", len(toAdd))
@@ -1558,7 +1559,7 @@ func TestReconcileAndValidate_GCStillRemovesOwnStaleRecords(t *testing.T) {
 	}
 	liveHosts := map[string]struct{}{"test-host": {}}
 
-	_, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, reconcileLogger())
+	_, toRemove := ReconcileAndValidate(desired, actual, cfg, liveHosts, nil, reconcileLogger())
 
 	if len(toRemove) != 1 {
 		t.Fatalf("expected 1 own stale record to remove, got %d", len(toRemove))
@@ -1567,3 +1568,187 @@ func TestReconcileAndValidate_GCStillRemovesOwnStaleRecords(t *testing.T) {
 		t.Errorf("expected removed record to be our own, got %q", toRemove[0].Hostname)
 	}
 }
+
+// versioned marks ri as read in this release's wire format.
+func versioned(ri *domain.RecordIntent) *domain.RecordIntent {
+	ri.Wire.Schema = domain.RecordSchema
+	return ri
+}
+
+func TestReconcileAndValidate_GCKeepsUnrecognizedSchema(t *testing.T) {
+	cfg := reconcileConfig()
+	now := time.Now()
+	legacy := makeRecordIntent("legacy.example.com", domain.RecordA, "192.168.1.8", "c1", now.Add(-10*time.Hour), false, "old-host")
+	newer := makeRecordIntent("newer.example.com", domain.RecordA, "192.168.1.9", "c2", now.Add(-10*time.Hour), false, "new-host")
+	newer.Wire.Schema = domain.RecordSchema + 1
+	liveHosts := map[string]struct{}{"test-host": {}} // neither owner heartbeats
+
+	_, toRemove := ReconcileAndValidate(nil, []*domain.RecordIntent{legacy, newer}, cfg, liveHosts, nil, reconcileLogger())
+
+	if len(toRemove) != 0 {
+		t.Errorf("expected records in an unrecognized wire schema never to be collected, got %d removals", len(toRemove))
+	}
+}
+
+func TestReconcileAndValidate_GCKeptRecordsStillConflict(t *testing.T) {
+	cfg := reconcileConfig()
+	now := time.Now()
+	// A legacy CNAME that is older than the desired A record keeps its name.
+	legacy := makeRecordIntent("app.example.com", domain.RecordCNAME, "other.example.com", "c1", now.Add(-10*time.Hour), false, "old-host")
+	desired := []*domain.RecordIntent{
+		makeRecordIntent("app.example.com", domain.RecordA, "10.0.0.1", "c2", now, false, "test-host"),
+	}
+
+	toAdd, toRemove := ReconcileAndValidate(desired, []*domain.RecordIntent{legacy}, cfg, map[string]struct{}{"test-host": {}}, nil, reconcileLogger())
+
+	if len(toAdd) != 0 || len(toRemove) != 0 {
+		t.Errorf("expected the kept record to still win its name, got %d adds and %d removals", len(toAdd), len(toRemove))
+	}
+}
+
+func TestReconcileAndValidate_UnownedRecordsNeverRemoved(t *testing.T) {
+	now := time.Now()
+	// Written by another tool: no owner, container or creation time.
+	static := makeRecordIntent("static.example.com", domain.RecordA, "10.9.9.9", "", time.Time{}, false, "")
+	cname := makeRecordIntent("app.example.com", domain.RecordCNAME, "elsewhere.example.com", "", time.Time{}, false, "")
+	addr := makeRecordIntent("web.example.com", domain.RecordA, "10.9.9.8", "", time.Time{}, false, "")
+	desired := []*domain.RecordIntent{
+		makeRecordIntent("app.example.com", domain.RecordA, "10.0.0.1", "c1", now.Add(-10*time.Hour), true, "test-host"),
+		makeRecordIntent("web.example.com", domain.RecordCNAME, "app.example.com", "c2", now.Add(-10*time.Hour), true, "test-host"),
+	}
+
+	// With cross-host GC disabled and enabled.
+	for _, live := range []map[string]struct{}{nil, {"test-host": {}}} {
+		trail := NewTrail()
+		toAdd, toRemove := ReconcileAndValidate(desired, []*domain.RecordIntent{static, cname, addr}, reconcileConfig(), live, trail, reconcileLogger())
+		if len(toAdd) != 0 || len(toRemove) != 0 {
+			t.Errorf("expected unowned records to be kept and to block forced records, got %d adds and %d removals", len(toAdd), len(toRemove))
+		}
+		for _, c := range []string{"c1", "c2"} {
+			got := decisionsFor(trail, c)
+			if len(got) != 1 || got[0].Code != domain.DecisionUnowned || got[0].Published() {
+				t.Errorf("expected an unowned decision for %s, got %+v", c, got)
+			}
+		}
+	}
+}
+
+func TestReconcileAndValidate_OwnStaleRecordRemovedInAnySchema(t *testing.T) {
+	cfg := reconcileConfig()
+	// Written by this host before it was upgraded.
+	mine := makeRecordIntent("mine.example.com", domain.RecordA, "10.0.0.1", "c1", time.Now(), false, "test-host")
+
+	_, toRemove := ReconcileAndValidate(nil, []*domain.RecordIntent{mine}, cfg, map[string]struct{}{"test-host": {}}, nil, reconcileLogger())
+
+	if len(toRemove) != 1 {
+		t.Errorf("expected this host's own stale record to be removed, got %d removals", len(toRemove))
+	}
+}
+
+// ============================================================================
+// Decision trail tests
+// ============================================================================
+
+// decisionsFor returns the decisions of trail about the container containerId.
+func decisionsFor(trail *Trail, containerId string) []domain.Decision {
+	var out []domain.Decision
+	for _, d := range trail.Decisions() {
+		if d.ContainerId == containerId {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func TestFilterRecordIntents_TrailDuplicate(t *testing.T) {
+	older := simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "older", 5, false)
+	newer := simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "newer", 1, false)
+	trail := NewTrail()
+
+	FilterRecordIntents([]*domain.RecordIntent{newer, older}, trail, reconcileLogger())
+
+	got := decisionsFor(trail, "container-newer")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 decision about the newer container, got %+v", trail.Decisions())
+	}
+	d := got[0]
+	if d.Stage != domain.StageFilter || d.Code != domain.DecisionDuplicate || d.Against != older || !strings.Contains(d.Reason, "older") {
+		t.Errorf("unexpected decision %+v", d)
+	}
+	if len(decisionsFor(trail, "container-older")) != 0 {
+		t.Error("expected no decision about the winner at the filter stage")
+	}
+}
+
+func TestFilterRecordIntents_TrailLostToForce(t *testing.T) {
+	address := simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "addr", 5, false)
+	cname := simpleIntent("app.example.com", domain.RecordCNAME, "target.example.com", "cname", 1, true)
+	trail := NewTrail()
+
+	FilterRecordIntents([]*domain.RecordIntent{address, cname}, trail, reconcileLogger())
+
+	got := decisionsFor(trail, "container-addr")
+	if len(got) != 1 || got[0].Code != domain.DecisionLostToForce || got[0].Against != cname {
+		t.Errorf("expected the address to lose to the forced CNAME, got %+v", trail.Decisions())
+	}
+}
+
+func TestReconcileAndValidate_TrailAddedAndPublished(t *testing.T) {
+	published := simpleIntent("app.example.com", domain.RecordA, "192.168.1.1", "c1", 1, false)
+	added := simpleIntent("new.example.com", domain.RecordA, "192.168.1.2", "c2", 1, false)
+	trail := NewTrail()
+
+	ReconcileAndValidate([]*domain.RecordIntent{published, added}, []*domain.RecordIntent{published}, reconcileConfig(), nil, trail, reconcileLogger())
+
+	if got := decisionsFor(trail, "container-c1"); len(got) != 1 || got[0].Code != domain.DecisionPublished || !got[0].Published() {
+		t.Errorf("expected the existing record to be published, got %+v", got)
+	}
+	if got := decisionsFor(trail, "container-c2"); len(got) != 1 || got[0].Code != domain.DecisionAdded || got[0].Stage != domain.StageReconcile {
+		t.Errorf("expected the new record to be added, got %+v", got)
+	}
+}
+
+func TestReconcileAndValidate_TrailLostToRegistry(t *testing.T) {
+	now := time.Now()
+	existing := makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c1", now.Add(-10*time.Hour), false, "other-host")
+	desired := makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now, false, "test-host")
+	trail := NewTrail()
+
+	ReconcileAndValidate([]*domain.RecordIntent{desired}, []*domain.RecordIntent{existing}, reconcileConfig(), nil, trail, reconcileLogger())
+
+	got := decisionsFor(trail, "c2")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 decision, got %+v", trail.Decisions())
+	}
+	if d := got[0]; d.Code != domain.DecisionLostOnAge || d.Published() || d.Against != existing || !strings.Contains(d.Reason, "other-host") || !strings.Contains(d.Reason, "force label") {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestReconcileAndValidate_TrailEvicts(t *testing.T) {
+	now := time.Now()
+	cname := makeRecordIntent("app.example.com", domain.RecordCNAME, "other.example.com", "c1", now, false, "other-host")
+	desired := makeRecordIntent("app.example.com", domain.RecordA, "192.168.1.1", "c2", now.Add(-10*time.Hour), false, "test-host")
+	trail := NewTrail()
+
+	ReconcileAndValidate([]*domain.RecordIntent{desired}, []*domain.RecordIntent{cname}, reconcileConfig(), nil, trail, reconcileLogger())
+
+	got := decisionsFor(trail, "c2")
+	if len(got) != 1 || got[0].Code != domain.DecisionEvicts || got[0].Against != cname || !got[0].Published() {
+		t.Errorf("expected the record to evict the CNAME, got %+v", trail.Decisions())
+	}
+}
+
+func TestReconcileAndValidate_TrailValidationCode(t *testing.T) {
+	now := time.Now()
+	desired := makeRecordIntent("app.example.com", domain.RecordCNAME, "loop.example.com", "c1", now.Add(-10*time.Hour), false, "test-host")
+	actual := makeRecordIntent("loop.example.com", domain.RecordCNAME, "app.example.com", "c2", now, false, "other-host")
+	trail := NewTrail()
+
+	ReconcileAndValidate([]*domain.RecordIntent{desired}, []*domain.RecordIntent{actual}, reconcileConfig(), nil, trail, reconcileLogger())
+
+	got := decisionsFor(trail, "c1")
+	if len(got) != 1 || got[0].Code != domain.DecisionCNAMECycle || !strings.Contains(got[0].Reason, "cycle") {
+		t.Errorf("expected a cname_cycle decision, got %+v", trail.Decisions())
+	}
+}
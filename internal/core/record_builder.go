@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
@@ -9,7 +10,8 @@ import (
 )
 
 // GetContainerRecordIntents parses the container event's labels and returns record intents.
-func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfig, logger zerolog.Logger) []*domain.RecordIntent {
+// Labeled records that yield no intent are recorded in trail, which may be nil.
+func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfig, trail *Trail, logger zerolog.Logger) []*domain.RecordIntent {
 	var intents []*domain.RecordIntent
 
 	prefix := cfg.DockerLabelPrefix
@@ -17,14 +19,22 @@ func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfi
 
 	if !parsedLabels.Enabled {
 		logger.Debug().Msg("Record generation not enabled for container")
+		for _, labeledRecord := range parsedLabels.Records {
+			trail.label(event.Container, labeledRecord.record(), domain.DecisionNotEnabled, fmt.Sprintf("the container does not have the label %s.enabled=true", prefix))
+		}
 		return intents
 	}
 
+	for _, ignored := range parsedLabels.Ignored {
+		trail.label(event.Container, domain.Record{}, ignored.Code, fmt.Sprintf("label %s ignored: %s", ignored.Key, ignored.Reason))
+	}
+
 	for _, labeledRecord := range parsedLabels.Records {
 		// Handle empty name
 		// -- Skip
 		if strings.TrimSpace(labeledRecord.Name) == "" {
 			logger.Warn().Str("kind", string(labeledRecord.Kind)).Msg("skipping record with no name")
+			trail.label(event.Container, labeledRecord.record(), domain.DecisionMissingName, fmt.Sprintf("%s is set but %s is not", labeledRecord.GetValueLabel(), labeledRecord.GetNameLabel()))
 			continue
 		}
 
@@ -39,6 +49,7 @@ func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfi
 				value = cfg.HostIPv4
 				if value == "" {
 					logger.Warn().Str("name", labeledRecord.Name).Msgf("%s label found with no matching %s. No default value configured. Skipping.", nameLabel, valueLabel)
+					trail.label(event.Container, labeledRecord.record(), domain.DecisionMissingValue, fmt.Sprintf("%s is not set and no host IPv4 address is configured", valueLabel))
 					continue
 				} else {
 					logger.Debug().Str("name", labeledRecord.Name).Msgf("%s label found with no matching %s. Using host IP %s", nameLabel, valueLabel, value)
@@ -47,12 +58,14 @@ func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfi
 				value = cfg.HostIPv6
 				if value == "" {
 					logger.Warn().Str("name", labeledRecord.Name).Msgf("%s label found with no matching %s. No default value configured. Skipping.", nameLabel, valueLabel)
+					trail.label(event.Container, labeledRecord.record(), domain.DecisionMissingValue, fmt.Sprintf("%s is not set and no host IPv6 address is configured", valueLabel))
 					continue
 				} else {
 					logger.Debug().Str("name", labeledRecord.Name).Msgf("%s label found with no matching %s. Using host IP %s", nameLabel, valueLabel, value)
 				}
 			case domain.RecordCNAME:
 				logger.Warn().Str("name", labeledRecord.Name).Msgf("%s label found with no matching %s. Skipping.", nameLabel, valueLabel)
+				trail.label(event.Container, labeledRecord.record(), domain.DecisionMissingValue, fmt.Sprintf("%s is not set", valueLabel))
 				continue
 			default:
 				logger.Warn().Str("kind", string(labeledRecord.Kind)).Msg("unsupported record kind")
@@ -62,6 +75,7 @@ func GetContainerRecordIntents(event domain.ContainerEvent, cfg *config.AppConfi
 		rec, err := domain.NewFromKind(labeledRecord.Kind, labeledRecord.Name, value)
 		if err != nil {
 			logger.Warn().Err(err).Str("kind", string(labeledRecord.Kind)).Str("name", labeledRecord.Name).Str("value", value).Msg("invalid record")
+			trail.label(event.Container, domain.Record{Kind: labeledRecord.Kind, Name: labeledRecord.Name, Value: value}, domain.DecisionInvalidRecord, err.Error())
 			continue
 		}
 
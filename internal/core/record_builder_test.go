@@ -52,7 +52,7 @@ func TestGetContainerRecordIntents_NotEnabled(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents when not enabled, got %d", len(intents))
@@ -67,7 +67,7 @@ func TestGetContainerRecordIntents_AWithValue(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -94,7 +94,7 @@ func TestGetContainerRecordIntents_TTLDefaultFromConfig(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -114,7 +114,7 @@ func TestGetContainerRecordIntents_TTLLabelOverridesConfig(t *testing.T) {
 		"coredns.A.ttl":   "30",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -132,7 +132,7 @@ func TestGetContainerRecordIntents_TTLUnsetIsZero(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -149,7 +149,7 @@ func TestGetContainerRecordIntents_AWithDefaultIPv4(t *testing.T) {
 		"coredns.A.name":  "app.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -168,7 +168,7 @@ func TestGetContainerRecordIntents_ANoDefaultSkipped(t *testing.T) {
 		"coredns.A.name":  "app.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents when no default IP, got %d", len(intents))
@@ -183,7 +183,7 @@ func TestGetContainerRecordIntents_AAAAWithValue(t *testing.T) {
 		"coredns.AAAA.value": "2001:db8::1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -205,7 +205,7 @@ func TestGetContainerRecordIntents_AAAAWithDefaultIPv6(t *testing.T) {
 		"coredns.AAAA.name": "app.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -224,7 +224,7 @@ func TestGetContainerRecordIntents_AAAANoDefaultSkipped(t *testing.T) {
 		"coredns.AAAA.name": "app.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents when no default IPv6, got %d", len(intents))
@@ -238,7 +238,7 @@ func TestGetContainerRecordIntents_CNAMERequiresValue(t *testing.T) {
 		"coredns.CNAME.name": "alias.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents for CNAME without value, got %d", len(intents))
@@ -253,7 +253,7 @@ func TestGetContainerRecordIntents_CNAMEWithValue(t *testing.T) {
 		"coredns.CNAME.value": "target.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -273,7 +273,7 @@ func TestGetContainerRecordIntents_SkipsEmptyName(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents for empty name, got %d", len(intents))
@@ -288,7 +288,7 @@ func TestGetContainerRecordIntents_SkipsWhitespaceOnlyName(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents for whitespace-only name, got %d", len(intents))
@@ -303,7 +303,7 @@ func TestGetContainerRecordIntents_InvalidRecordSkipped(t *testing.T) {
 		"coredns.A.value": "not-an-ip", // Invalid IP
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 0 {
 		t.Errorf("expected 0 intents for invalid record, got %d", len(intents))
@@ -319,7 +319,7 @@ func TestGetContainerRecordIntents_ForceInheritedFromContainer(t *testing.T) {
 		"coredns.A.value": "192.168.1.1",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -342,7 +342,7 @@ func TestGetContainerRecordIntents_ForceOverriddenPerRecord(t *testing.T) {
 		"coredns.A.api.value": "192.168.1.2",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 2 {
 		t.Fatalf("expected 2 intents, got %d", len(intents))
@@ -379,7 +379,7 @@ func TestGetContainerRecordIntents_SetsContainerMetadata(t *testing.T) {
 		EventType: domain.EventTypeContainerStarted,
 	}
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 1 {
 		t.Fatalf("expected 1 intent, got %d", len(intents))
@@ -412,7 +412,7 @@ func TestGetContainerRecordIntents_MultipleRecords(t *testing.T) {
 		"coredns.CNAME.value": "app.example.com",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 3 {
 		t.Fatalf("expected 3 intents, got %d", len(intents))
@@ -431,7 +431,7 @@ func TestGetContainerRecordIntents_MultipleAliases(t *testing.T) {
 		"coredns.A.db.value":  "192.168.1.3",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 3 {
 		t.Fatalf("expected 3 intents, got %d", len(intents))
@@ -462,9 +462,72 @@ func TestGetContainerRecordIntents_ValidAndInvalidMixed(t *testing.T) {
 		"coredns.A.good.value":  "192.168.1.2",
 	})
 
-	intents := GetContainerRecordIntents(event, cfg, nopLogger())
+	intents := GetContainerRecordIntents(event, cfg, nil, nopLogger())
 
 	if len(intents) != 2 {
 		t.Fatalf("expected 2 valid intents, got %d", len(intents))
 	}
 }
+
+func TestGetContainerRecordIntents_TrailNotEnabled(t *testing.T) {
+	event := makeContainerEvent(map[string]string{
+		"coredns.A.name":  "app.example.com",
+		"coredns.A.value": "192.168.1.1",
+	})
+	trail := NewTrail()
+
+	GetContainerRecordIntents(event, makeTestConfig(), trail, nopLogger())
+
+	decisions := trail.Decisions()
+	if len(decisions) != 1 {
+		t.Fatalf("expected 1 decision, got %+v", decisions)
+	}
+	d := decisions[0]
+	if d.Stage != domain.StageLabels || d.Code != domain.DecisionNotEnabled || d.ContainerName != "test-container" || d.Record.Name != "app.example.com" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestGetContainerRecordIntents_TrailSkippedRecords(t *testing.T) {
+	event := makeContainerEvent(map[string]string{
+		"coredns.enabled":         "true",
+		"coredns.A.name":          "app.example.com",
+		"coredns.A.bad.name":      "bad.example.com",
+		"coredns.A.bad.value":     "not-an-ip",
+		"coredns.CNAME.name":      "alias.example.com",
+		"coredns.A.noname.value":  "192.168.1.2",
+		"coredns.MX.name":         "mail.example.com",
+		"coredns.A.ok.name":       "ok.example.com",
+		"coredns.A.ok.value":      "192.168.1.3",
+		"coredns.AAAA.v6.name":    "v6.example.com",
+		"coredns.AAAA.v6.ttl":     "never",
+		"coredns.CNAME.web.name":  "web.example.com",
+		"coredns.CNAME.web.value": "app.example.com",
+	})
+	trail := NewTrail()
+
+	intents := GetContainerRecordIntents(event, makeTestConfigNoDefaults(), trail, nopLogger())
+
+	if len(intents) != 2 {
+		t.Errorf("expected 2 intents, got %d", len(intents))
+	}
+	codes := map[domain.DecisionCode]int{}
+	for _, d := range trail.Decisions() {
+		if d.Stage != domain.StageLabels || d.Published() {
+			t.Errorf("unexpected decision %+v", d)
+		}
+		codes[d.Code]++
+	}
+	want := map[domain.DecisionCode]int{
+		domain.DecisionUnsupportedKind: 1,
+		domain.DecisionInvalidLabel:    1,
+		domain.DecisionMissingValue:    3,
+		domain.DecisionMissingName:     1,
+		domain.DecisionInvalidRecord:   1,
+	}
+	for code, n := range want {
+		if codes[code] != n {
+			t.Errorf("expected %d %s decisions, got %d (%v)", n, code, codes[code], codes)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// ConflictResolution says how a conflict between records was resolved, as
+// counted by the conflict metrics.
+type ConflictResolution string
+
+const (
+	// ResolvedByForce: the record with the force label won.
+	ResolvedByForce ConflictResolution = "force"
+	// ResolvedByAge: the record of the older container, or of the one seen
+	// first, won.
+	ResolvedByAge ConflictResolution = "age"
+	// ResolvedByValidation: the record was rejected as the name cannot hold
+	// it next to the others, e.g. a CNAME beside address records.
+	ResolvedByValidation ConflictResolution = "validation_rejected"
+	// ResolvedCNAMECycle: the CNAME was rejected as it would close a
+	// resolution loop.
+	ResolvedCNAMECycle ConflictResolution = "cname_cycle"
+)
+
+// labelErrorCodes are the label decisions that count as label errors. A
+// container without the enabled label is not one.
+var labelErrorCodes = map[domain.DecisionCode]bool{
+	domain.DecisionInvalidLabel:    true,
+	domain.DecisionUnsupportedKind: true,
+	domain.DecisionMissingName:     true,
+	domain.DecisionMissingValue:    true,
+	domain.DecisionInvalidRecord:   true,
+}
+
+// countLabelErrors counts the label errors among the label decisions made for
+// the container named container.
+func (se *SyncEngine) countLabelErrors(container string, decisions []domain.Decision) {
+	m, ok := se.metrics.(labelErrorMetrics)
+	if !ok {
+		return
+	}
+	for _, d := range decisions {
+		if labelErrorCodes[d.Code] {
+			m.IncLabelError(container, string(d.Code))
+		}
+	}
+}
+
+// countApplied counts, for the writes a plan applied to cluster, the conflicts
+// its additions won by evicting a record, and the records it garbage-collected
+// from each dead host. decisions are the plan's.
+func (se *SyncEngine) countApplied(cluster string, added, removed []*domain.RecordIntent, decisions []domain.Decision) {
+	m, ok := se.metrics.(conflictMetrics)
+	if !ok || len(removed) == 0 {
+		return
+	}
+	forced := make(map[domain.Record]map[string]bool)
+	for _, ri := range added {
+		if forced[ri.Record] == nil {
+			forced[ri.Record] = make(map[string]bool)
+		}
+		forced[ri.Record][ri.ContainerId] = ri.Force
+	}
+	evictedBy := evictions(decisions)
+	reaped := make(map[string]int)
+	for _, ri := range removed {
+		if d, ok := evictedBy[ri.Key()]; ok {
+			if forced[d.Record][d.ContainerId] {
+				m.IncConflict(string(ResolvedByForce))
+			} else {
+				m.IncConflict(string(ResolvedByAge))
+			}
+			continue
+		}
+		if ri.Hostname != se.cfg.Hostname {
+			reaped[ri.Hostname]++
+		}
+	}
+	for host, n := range reaped {
+		m.AddGCReaped(cluster, host, n)
+	}
+}
+
+// observeRecords reports the records desired on this host and, for each
+// cluster listed this pass, the records it holds after the pass.
+func (se *SyncEngine) observeRecords(desired []*domain.RecordIntent, results []clusterResult) {
+	m, ok := se.metrics.(recordMetrics)
+	if !ok {
+		return
+	}
+	m.SetDesiredRecords(desired)
+	for i, c := range se.clusters {
+		if !results[i].snapshot.ListedAt.IsZero() {
+			m.SetPublishedRecords(c.Name, results[i].published)
+		}
+	}
+}
+
+// publishedAfter returns the records of the listing actual once the records
+// removed are deleted and the records added written.
+func publishedAfter(actual, added, removed []*domain.RecordIntent) []*domain.RecordIntent {
+	if len(added) == 0 && len(removed) == 0 {
+		return actual
+	}
+	gone := make(map[string]struct{}, len(removed))
+	for _, ri := range removed {
+		gone[ri.Key()] = struct{}{}
+	}
+	published := make([]*domain.RecordIntent, 0, len(actual)+len(added))
+	for _, ri := range actual {
+		if _, ok := gone[ri.Key()]; !ok {
+			published = append(published, ri)
+		}
+	}
+	return append(published, added...)
+}
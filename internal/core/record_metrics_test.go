@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// recordingRecordMetrics records the per-record, conflict and label error
+// metrics reported to it.
+type recordingRecordMetrics struct {
+	recordingMetrics
+	desired     []*domain.RecordIntent
+	published   map[string][]*domain.RecordIntent
+	conflicts   map[string]int
+	reaped      map[string]int
+	labelErrors map[string]int
+}
+
+func newRecordingRecordMetrics() *recordingRecordMetrics {
+	return &recordingRecordMetrics{
+		published:   map[string][]*domain.RecordIntent{},
+		conflicts:   map[string]int{},
+		reaped:      map[string]int{},
+		labelErrors: map[string]int{},
+	}
+}
+
+func (r *recordingRecordMetrics) SetDesiredRecords(records []*domain.RecordIntent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.desired = records
+}
+
+func (r *recordingRecordMetrics) SetPublishedRecords(cluster string, records []*domain.RecordIntent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.published[cluster] = records
+}
+
+func (r *recordingRecordMetrics) IncConflict(resolution string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conflicts[resolution]++
+}
+
+func (r *recordingRecordMetrics) AddGCReaped(cluster, host string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reaped[cluster+"/"+host] += n
+}
+
+func (r *recordingRecordMetrics) IncLabelError(container, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.labelErrors[container+"/"+code]++
+}
+
+func TestSyncEngine_reconcile_ObservesRecords(t *testing.T) {
+	// The older desired A record evicts another host's CNAME, a stale record
+	// of this host is removed and a dead host's record is reaped.
+	desired := makeIntent("app.example.com", domain.RecordA, "10.0.0.1")
+	desired.Created = time.Now().Add(-time.Hour)
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "other.example.com")
+	cname.Hostname, cname.ContainerName = "other-host", "other"
+	stale := makeIntent("stale.example.com", domain.RecordA, "10.0.0.2")
+	orphan := makeIntent("old.example.com", domain.RecordA, "10.0.0.9")
+	orphan.Hostname, orphan.Wire = "dead-host", domain.WireInfo{Schema: domain.RecordSchema}
+	kept := makeIntent("kept.example.com", domain.RecordA, "10.0.0.3")
+	kept.Hostname = "other-host"
+	reg := &mockRegistry{
+		listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+			return []*domain.RecordIntent{cname, stale, orphan, kept}, nil
+		},
+		getLiveHostnamesFunc: func(ctx context.Context) (map[string]struct{}, error) {
+			return map[string]struct{}{"test-host": {}, "other-host": {}}, nil
+		},
+	}
+	engine := breakerEngine(reg, config.BreakerConfig{}, desired)
+	m := newRecordingRecordMetrics()
+	engine.SetMetrics(m)
+
+	if res := engine.reconcile(context.Background()); res.Err != nil {
+		t.Fatalf("unexpected error: %v", res.Err)
+	}
+
+	if len(m.desired) != 1 || m.desired[0] != desired {
+		t.Errorf("expected the desired record reported, got %v", m.desired)
+	}
+	published := m.published[config.DefaultEtcdClusterName]
+	if len(published) != 2 || published[0] != kept || published[1] != desired {
+		t.Errorf("expected the registry as the pass left it, got %v", renderAll(published))
+	}
+	if m.conflicts[string(ResolvedByAge)] != 1 || len(m.conflicts) != 1 {
+		t.Errorf("expected the eviction counted as won on age, got %v", m.conflicts)
+	}
+	if m.reaped[config.DefaultEtcdClusterName+"/dead-host"] != 1 || len(m.reaped) != 1 {
+		t.Errorf("expected one record reaped from dead-host, got %v", m.reaped)
+	}
+}
+
+func TestSyncEngine_reconcile_CountsNewConflictsOnce(t *testing.T) {
+	// A younger desired A record loses to another host's CNAME, and a desired
+	// CNAME to a desired A record with the force label.
+	cname := makeIntent("app.example.com", domain.RecordCNAME, "other.example.com")
+	cname.Hostname, cname.Created = "other-host", time.Now().Add(-time.Hour)
+	forced := makeIntent("forced.example.com", domain.RecordA, "10.0.0.1")
+	forced.ContainerId, forced.Force = "forced", true
+	loser := makeIntent("forced.example.com", domain.RecordCNAME, "other.example.com")
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{cname}, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{}, makeIntent("app.example.com", domain.RecordA, "10.0.0.1"), forced, loser)
+	engine.setPaused(true) // keep the registry as listed
+	m := newRecordingRecordMetrics()
+	engine.SetMetrics(m)
+
+	engine.reconcile(context.Background())
+	engine.reconcile(context.Background())
+
+	if m.conflicts[string(ResolvedByAge)] != 1 || m.conflicts[string(ResolvedByForce)] != 1 || len(m.conflicts) != 2 {
+		t.Errorf("expected each conflict counted once by its resolution, got %v", m.conflicts)
+	}
+	if len(m.published[config.DefaultEtcdClusterName]) != 1 {
+		t.Errorf("expected a paused pass to report the registry as listed, got %v", m.published)
+	}
+}
+
+func TestSyncEngine_handleEvent_CountsLabelErrors(t *testing.T) {
+	engine := breakerEngine(&mockRegistry{}, config.BreakerConfig{})
+	m := newRecordingRecordMetrics()
+	engine.SetMetrics(m)
+
+	engine.handleEvent(makeContainerEvent(map[string]string{
+		"coredns.enabled":        "true",
+		"coredns.A.name":         "app.example.com",
+		"coredns.MX.name":        "mail.example.com",
+		"coredns.A.noname.value": "192.168.1.2",
+	}))
+	engine.handleEvent(makeContainerEvent(map[string]string{"coredns.A.name": "off.example.com"}))
+
+	want := map[string]int{
+		"test-container/" + string(domain.DecisionUnsupportedKind): 1,
+		"test-container/" + string(domain.DecisionMissingName):     1,
+	}
+	if len(m.labelErrors) != len(want) {
+		t.Errorf("expected %v, got %v", want, m.labelErrors)
+	}
+	for k, n := range want {
+		if m.labelErrors[k] != n {
+			t.Errorf("expected %d %s, got %v", n, k, m.labelErrors)
+		}
+	}
+}
+
+func TestPublishedAfter(t *testing.T) {
+	a := makeIntent("a.example.com", domain.RecordA, "10.0.0.1")
+	b := makeIntent("b.example.com", domain.RecordA, "10.0.0.2")
+	c := makeIntent("c.example.com", domain.RecordA, "10.0.0.3")
+	actual := []*domain.RecordIntent{a, b}
+
+	if got := publishedAfter(actual, nil, nil); len(got) != 2 {
+		t.Errorf("expected the listing unchanged, got %v", renderAll(got))
+	}
+	got := publishedAfter(actual, []*domain.RecordIntent{c}, []*domain.RecordIntent{a})
+	if len(got) != 2 || got[0] != b || got[1] != c {
+		t.Errorf("expected [b c], got %v", renderAll(got))
+	}
+	if len(actual) != 2 || actual[0] != a {
+		t.Error("expected the listing left untouched")
+	}
+}
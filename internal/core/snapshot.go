@@ -0,0 +1,123 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// Snapshot returns the desired and actual state as of the latest
+// reconciliation pass. Serving it costs no registry reads. Safe to call from
+// any goroutine.
+func (se *SyncEngine) Snapshot() domain.Snapshot {
+	se.snapshotMu.RLock()
+	defer se.snapshotMu.RUnlock()
+	return se.snapshot
+}
+
+// storeSnapshot records what a pass taken at takenAt saw, with the decisions
+// of its filter. A cluster that could not be listed keeps the records of its
+// previous listing.
+func (se *SyncEngine) storeSnapshot(takenAt time.Time, desired, kept []*domain.RecordIntent, filter []domain.Decision, clusters []domain.ClusterSnapshot) {
+	snap := domain.Snapshot{
+		TakenAt:   takenAt,
+		DryRun:    se.cfg.DryRun,
+		Paused:    se.paused.Load(),
+		Dropped:   droppedIntents(desired, kept, filter),
+		Decisions: append(se.labelDecisionList(), filter...),
+		Clusters:  clusters,
+	}
+	if lister, ok := se.state.(containerLister); ok {
+		snap.Containers = lister.Containers()
+	}
+
+	se.snapshotMu.Lock()
+	defer se.snapshotMu.Unlock()
+	for i, cs := range clusters {
+		if !cs.ListedAt.IsZero() {
+			continue
+		}
+		for _, prev := range se.snapshot.Clusters {
+			if prev.Cluster == cs.Cluster {
+				clusters[i].ListedAt, clusters[i].Records = prev.ListedAt, prev.Records
+			}
+		}
+	}
+	se.snapshot = snap
+}
+
+// droppedIntents returns the intents of desired that FilterRecordIntents left
+// out of kept, each with the reason the filter decisions give for it.
+func droppedIntents(desired, kept []*domain.RecordIntent, filter []domain.Decision) []domain.DroppedIntent {
+	keptSet := make(map[*domain.RecordIntent]struct{}, len(kept))
+	for _, ri := range kept {
+		keptSet[ri] = struct{}{}
+	}
+	type key struct {
+		containerId string
+		record      domain.Record
+	}
+	reasons := make(map[key]string, len(filter))
+	for _, d := range filter {
+		k := key{d.ContainerId, d.Record}
+		if _, ok := reasons[k]; !ok {
+			reasons[k] = d.Reason
+		}
+	}
+	var dropped []domain.DroppedIntent
+	for _, ri := range desired {
+		if _, ok := keptSet[ri]; ok {
+			continue
+		}
+		reason, ok := reasons[key{ri.ContainerId, ri.Record}]
+		if !ok {
+			reason = "no record was kept for this name"
+		}
+		dropped = append(dropped, domain.DroppedIntent{Intent: ri, Reason: reason})
+	}
+	return dropped
+}
+
+// setLabelDecisions replaces what parsing the labels of the container id
+// decided. nil forgets the container.
+func (se *SyncEngine) setLabelDecisions(id string, decisions []domain.Decision) {
+	se.labelMu.Lock()
+	defer se.labelMu.Unlock()
+	if len(decisions) == 0 {
+		delete(se.labelDecisions, id)
+		return
+	}
+	se.labelDecisions[id] = decisions
+}
+
+// retainLabelDecisions forgets the label decisions of containers not in
+// running.
+func (se *SyncEngine) retainLabelDecisions(running map[string]struct{}) {
+	se.labelMu.Lock()
+	defer se.labelMu.Unlock()
+	for id := range se.labelDecisions {
+		if _, ok := running[id]; !ok {
+			delete(se.labelDecisions, id)
+		}
+	}
+}
+
+// labelDecisionList returns the label decisions of every container, ordered
+// by container name and id.
+func (se *SyncEngine) labelDecisionList() []domain.Decision {
+	se.labelMu.Lock()
+	defer se.labelMu.Unlock()
+	var decisions []domain.Decision
+	for _, ds := range se.labelDecisions {
+		decisions = append(decisions, ds...)
+	}
+	sort.SliceStable(decisions, func(i, j int) bool {
+		a, b := decisions[i], decisions[j]
+		if a.ContainerName != b.ContainerName {
+			return a.ContainerName < b.ContainerName
+		}
+		return a.ContainerId < b.ContainerId
+	})
+	return decisions
+}
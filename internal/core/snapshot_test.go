@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// listingState is a mockState that also lists its containers.
+type listingState struct {
+	mockState
+	containers []domain.TrackedContainer
+}
+
+func (s *listingState) Containers() []domain.TrackedContainer {
+	return s.containers
+}
+
+func TestDroppedIntents_Reasons(t *testing.T) {
+	now := time.Now()
+	older := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	older.ContainerName, older.Created = "old", now.Add(-time.Hour)
+	duplicate := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	duplicate.ContainerName, duplicate.Created = "new", now
+	forced := makeIntent("web.example.com", domain.RecordCNAME, "app.example.com")
+	forced.ContainerName, forced.Force, forced.Created = "forced", true, now
+	address := makeIntent("web.example.com", domain.RecordA, "192.168.1.2")
+	address.ContainerName, address.Created = "web", now.Add(-time.Hour)
+
+	desired := []*domain.RecordIntent{older, duplicate, forced, address}
+	trail := NewTrail()
+	kept := FilterRecordIntents(desired, trail, engineTestLogger())
+	dropped := droppedIntents(desired, kept, trail.Decisions())
+
+	reasons := map[*domain.RecordIntent]string{}
+	for _, d := range dropped {
+		reasons[d.Intent] = d.Reason
+	}
+	if len(dropped) != 2 {
+		t.Fatalf("expected 2 dropped intents, got %d: %+v", len(dropped), dropped)
+	}
+	if r := reasons[duplicate]; !strings.Contains(r, "duplicate of "+older.Record.Render()+" of container old") || !strings.Contains(r, "older") {
+		t.Errorf("unexpected reason for the duplicate: %q", r)
+	}
+	if r := reasons[address]; !strings.Contains(r, "conflicts with "+forced.Record.Render()+" of container forced") || !strings.Contains(r, "force label") {
+		t.Errorf("unexpected reason for the conflicting address: %q", r)
+	}
+}
+
+func TestSyncEngine_Snapshot_CapturesPass(t *testing.T) {
+	stale := makeIntent("stale.example.com", domain.RecordA, "192.168.1.9")
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{stale}, nil
+	}}
+	state := &listingState{containers: []domain.TrackedContainer{{Id: "c1", Name: "app", Intents: []*domain.RecordIntent{added}}}}
+	state.getAllDesiredFunc = func() []*domain.RecordIntent { return []*domain.RecordIntent{added} }
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, reg, state)
+
+	if !engine.Snapshot().TakenAt.IsZero() {
+		t.Error("expected no snapshot before the first pass")
+	}
+	engine.reconcile(context.Background())
+
+	snap := engine.Snapshot()
+	if snap.TakenAt.IsZero() || len(snap.Containers) != 1 || snap.Containers[0].Id != "c1" {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+	if len(snap.Clusters) != 1 {
+		t.Fatalf("expected one cluster, got %d", len(snap.Clusters))
+	}
+	cs := snap.Clusters[0]
+	if cs.Cluster != config.DefaultEtcdClusterName || cs.ListedAt.IsZero() || cs.Err != nil {
+		t.Errorf("unexpected cluster snapshot %+v", cs)
+	}
+	if len(cs.Records) != 1 || cs.Records[0] != stale {
+		t.Errorf("expected the listing in the snapshot, got %v", cs.Records)
+	}
+	if len(cs.ToAdd) != 1 || cs.ToAdd[0] != added || len(cs.ToRemove) != 1 || cs.ToRemove[0] != stale {
+		t.Errorf("expected the plan in the snapshot, got add %v remove %v", cs.ToAdd, cs.ToRemove)
+	}
+}
+
+func TestSyncEngine_Snapshot_KeepsLastListingOnError(t *testing.T) {
+	listed := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{listed}, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{}, listed)
+	engine.reconcile(context.Background())
+	first := engine.Snapshot().Clusters[0]
+
+	reg.listFunc = func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return nil, errors.New("etcd unavailable")
+	}
+	engine.reconcile(context.Background())
+
+	cs := engine.Snapshot().Clusters[0]
+	if cs.Err == nil || !strings.Contains(cs.Err.Error(), "etcd unavailable") {
+		t.Errorf("expected the listing error in the snapshot, got %v", cs.Err)
+	}
+	if !cs.ListedAt.Equal(first.ListedAt) || len(cs.Records) != 1 || cs.Records[0] != listed {
+		t.Errorf("expected the previous listing to be kept, got %+v", cs)
+	}
+	if len(cs.ToAdd) != 0 || len(cs.ToRemove) != 0 {
+		t.Errorf("expected no plan for a cluster that could not be listed, got %+v", cs)
+	}
+}
+
+func TestSyncEngine_Snapshot_Decisions(t *testing.T) {
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	state := &listingState{}
+	state.getAllDesiredFunc = func() []*domain.RecordIntent { return []*domain.RecordIntent{added} }
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, &mockRegistry{}, state)
+	disabled := domain.ContainerEvent{
+		EventType: domain.EventTypeContainerStarted,
+		Container: domain.Container{Id: "c2", Name: "off", Labels: map[string]string{"coredns.A.name": "off.example.com"}},
+	}
+	engine.handleEvent(disabled)
+
+	engine.reconcile(context.Background())
+
+	snap := engine.Snapshot()
+	if len(snap.Decisions) != 1 || snap.Decisions[0].Code != domain.DecisionNotEnabled || snap.Decisions[0].ContainerName != "off" {
+		t.Errorf("expected the label decision in the snapshot, got %+v", snap.Decisions)
+	}
+	cs := snap.Clusters[0]
+	if len(cs.Decisions) != 1 || cs.Decisions[0].Code != domain.DecisionAdded || cs.Decisions[0].Cluster != config.DefaultEtcdClusterName {
+		t.Errorf("expected the cluster's decision in the snapshot, got %+v", cs.Decisions)
+	}
+
+	disabled.EventType = domain.EventTypeContainerStopped
+	engine.handleEvent(disabled)
+	engine.reconcile(context.Background())
+	if got := engine.Snapshot().Decisions; len(got) != 0 {
+		t.Errorf("expected the label decisions of a stopped container to be forgotten, got %+v", got)
+	}
+}
+
+func TestSyncEngine_LabelDecisions_PrunedOnResync(t *testing.T) {
+	engine := NewSyncEngine(engineTestLogger(), testAppConfig(), &mockGenerator{}, &mockRegistry{}, &mockState{})
+	engine.setLabelDecisions("gone", []domain.Decision{{ContainerId: "gone"}})
+	engine.setLabelDecisions("running", []domain.Decision{{ContainerId: "running"}})
+
+	engine.handleEvent(domain.ContainerEvent{EventType: domain.EventTypeResync, RunningContainerIds: []string{"running"}})
+
+	got := engine.labelDecisionList()
+	if len(got) != 1 || got[0].ContainerId != "running" {
+		t.Errorf("expected only the running container's decisions, got %+v", got)
+	}
+}
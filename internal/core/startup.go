@@ -0,0 +1,69 @@
+package core
+
+import (
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// startupGate holds back removals of this host's own records while it starts
+// up. Until the generator has listed every running container, records of
+// containers not yet seen would look stale and be removed, only to be added
+// again a moment later. The gate opens once the first resync event arrives
+// and app.startup_grace has passed, whichever is later.
+type startupGate struct {
+	held      bool
+	listed    bool
+	graceOver bool
+}
+
+// armStartup closes the startup gate. It returns a function that stops the
+// grace timer, if any.
+func (se *SyncEngine) armStartup() (stop func()) {
+	grace := time.Duration(se.cfg.StartupGrace * float64(time.Second))
+	se.startupMu.Lock()
+	se.startup = startupGate{held: true, graceOver: grace <= 0}
+	se.startupMu.Unlock()
+	if grace <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(grace, func() {
+		se.updateStartup(func(g *startupGate) { g.graceOver = true })
+	})
+	return func() { timer.Stop() }
+}
+
+// markListed records that the generator has listed every running container.
+func (se *SyncEngine) markListed() {
+	se.updateStartup(func(g *startupGate) { g.listed = true })
+}
+
+// updateStartup applies update to the startup gate and, if that opens it,
+// requests a pass to apply the removals it held back.
+func (se *SyncEngine) updateStartup(update func(g *startupGate)) {
+	se.startupMu.Lock()
+	update(&se.startup)
+	opened := se.startup.held && se.startup.listed && se.startup.graceOver
+	if opened {
+		se.startup.held = false
+	}
+	se.startupMu.Unlock()
+	if opened {
+		se.logger.Info().Msg("Startup complete; stale records of this host are removed from now on")
+		se.requestReconcile(TriggerStartup)
+	}
+}
+
+// heldRemovals returns the removals of this host's records in toRemove that
+// the startup gate holds back, or nil once it is open. As with the breaker, a
+// removal is not held if the plan adds a record under the same name.
+func (se *SyncEngine) heldRemovals(toAdd, toRemove []*domain.RecordIntent) []*domain.RecordIntent {
+	se.startupMu.Lock()
+	held := se.startup.held
+	se.startupMu.Unlock()
+	if !held {
+		return nil
+	}
+	own, _ := se.splitRemovals(toAdd, toRemove, nil)
+	return own
+}
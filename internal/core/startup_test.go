@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func expectTrigger(t *testing.T, engine *SyncEngine, want TriggerReason) {
+	t.Helper()
+	select {
+	case reason := <-engine.triggers:
+		if reason != want {
+			t.Errorf("expected a %q pass to be requested, got %q", want, reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a %q pass to be requested", want)
+	}
+}
+
+func TestSyncEngine_Startup_HoldsRemovalsUntilListed(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(2)}
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	engine := breakerEngine(reg, config.BreakerConfig{}, added)
+	defer engine.armStartup()()
+
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected removals to be held during startup, got %d removed", len(removed))
+	}
+	if registered := reg.GetRegisteredRecords(); len(registered) != 1 {
+		t.Errorf("expected additions to be applied during startup, got %d registered", len(registered))
+	}
+
+	engine.handleEvent(domain.ContainerEvent{EventType: domain.EventTypeResync})
+	expectTrigger(t, engine, TriggerStartup)
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 2 {
+		t.Errorf("expected the held removals once startup completed, got %d removed", len(removed))
+	}
+}
+
+func TestSyncEngine_Startup_WaitsForGrace(t *testing.T) {
+	reg := &mockRegistry{listFunc: ownListing(1)}
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	engine.cfg.StartupGrace = 0.05
+	defer engine.armStartup()()
+
+	engine.markListed()
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected removals to be held during the grace period, got %d removed", len(removed))
+	}
+
+	expectTrigger(t, engine, TriggerStartup)
+	engine.reconcile(context.Background())
+	if removed := reg.GetRemovedRecords(); len(removed) != 1 {
+		t.Errorf("expected the held removal once the grace period ended, got %d removed", len(removed))
+	}
+}
+
+func TestSyncEngine_Startup_ReplacedRecordsNotHeld(t *testing.T) {
+	old := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	renumbered := makeIntent("app.example.com", domain.RecordA, "192.168.1.2")
+	reg := &mockRegistry{listFunc: func(ctx context.Context) ([]*domain.RecordIntent, error) {
+		return []*domain.RecordIntent{old}, nil
+	}}
+	engine := breakerEngine(reg, config.BreakerConfig{}, renumbered)
+	defer engine.armStartup()()
+
+	engine.reconcile(context.Background())
+
+	if removed := reg.GetRemovedRecords(); len(removed) != 1 {
+		t.Errorf("expected a record replaced under the same name to be removed, got %d removed", len(removed))
+	}
+}
+
+func TestSyncEngine_Startup_OtherHostsNotHeld(t *testing.T) {
+	reg := &mockElectorRegistry{leader: "test-host"}
+	reg.listFunc = orphanListing
+	engine := breakerEngine(reg, config.BreakerConfig{})
+	defer engine.armStartup()()
+
+	if res := engine.reconcileCluster(context.Background(), engine.clusters[0], nil); res.removed != 1 {
+		t.Errorf("expected GC of a dead host's records during startup, got %d removed", res.removed)
+	}
+}
+
+func TestSyncEngine_Startup_RunWaitsForResync(t *testing.T) {
+	events := make(chan domain.ContainerEvent)
+	gen := &mockGenerator{subscribeFunc: func(ctx context.Context) (<-chan domain.ContainerEvent, error) {
+		return events, nil
+	}}
+	reg := &mockRegistry{listFunc: ownListing(1)}
+	added := makeIntent("new.example.com", domain.RecordA, "192.168.1.1")
+	state := &mockState{getAllDesiredFunc: func() []*domain.RecordIntent { return []*domain.RecordIntent{added} }}
+	cfg := testAppConfig()
+	cfg.ReconcileSafetyInterval = 60
+	engine := NewSyncEngine(engineTestLogger(), cfg, gen, reg, state)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go func() { _ = engine.Run(ctx) }()
+
+	engine.TriggerReconcile()
+	for len(reg.GetRegisteredRecords()) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("expected additions to be applied before the resync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if removed := reg.GetRemovedRecords(); len(removed) != 0 {
+		t.Errorf("expected no removals before the resync, got %d removed", len(removed))
+	}
+
+	events <- domain.ContainerEvent{EventType: domain.EventTypeResync}
+	for len(reg.GetRemovedRecords()) != 1 {
+		if ctx.Err() != nil {
+			t.Fatal("expected the stale record to be removed after the resync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
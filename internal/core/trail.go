@@ -0,0 +1,180 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// Trail collects the decisions made about records on their way through
+// GetContainerRecordIntents, FilterRecordIntents and ReconcileAndValidate, to
+// explain why a record was or was not published. A nil *Trail records
+// nothing. A Trail is not safe for concurrent use.
+type Trail struct {
+	decisions []domain.Decision
+}
+
+// NewTrail returns an empty trail.
+func NewTrail() *Trail {
+	return &Trail{}
+}
+
+// Decisions returns the decisions recorded so far, in order.
+func (t *Trail) Decisions() []domain.Decision {
+	if t == nil {
+		return nil
+	}
+	return t.decisions
+}
+
+// Reset discards the decisions recorded so far.
+func (t *Trail) Reset() {
+	if t != nil {
+		t.decisions = nil
+	}
+}
+
+// forCluster returns a copy of the decisions recorded so far, attributed to
+// the cluster named cluster.
+func (t *Trail) forCluster(cluster string) []domain.Decision {
+	decisions := make([]domain.Decision, len(t.Decisions()))
+	for i, d := range t.Decisions() {
+		d.Cluster = cluster
+		decisions[i] = d
+	}
+	return decisions
+}
+
+func (t *Trail) add(d domain.Decision) {
+	if t != nil {
+		t.decisions = append(t.decisions, d)
+	}
+}
+
+// intent records a decision about ri, made against the record against, if any.
+func (t *Trail) intent(stage domain.DecisionStage, ri *domain.RecordIntent, code domain.DecisionCode, reason string, against *domain.RecordIntent) {
+	t.add(domain.Decision{
+		Stage:         stage,
+		ContainerId:   ri.ContainerId,
+		ContainerName: ri.ContainerName,
+		Record:        ri.Record,
+		Code:          code,
+		Reason:        reason,
+		Against:       against,
+	})
+}
+
+// lost records that the desired record loser was dropped in favor of the
+// desired record winner, and which of the conflict rules decided it.
+func (t *Trail) lost(loser, winner *domain.RecordIntent) {
+	if t == nil {
+		return
+	}
+	what, code, why := "conflicts with", domain.DecisionLostOnAge, "its container is older"
+	switch {
+	case winner.Force && !loser.Force:
+		code, why = domain.DecisionLostToForce, "its container has the force label"
+	case !winner.Created.Before(loser.Created):
+		why = "it was seen first"
+	}
+	if winner.Record == loser.Record {
+		what, code = "duplicate of", domain.DecisionDuplicate
+	}
+	t.intent(domain.StageFilter, loser, code, fmt.Sprintf("%s %s of container %s, which won because %s", what, winner.Record.Render(), winner.ContainerName, why), winner)
+}
+
+// lostToAll records that the desired CNAME loser was dropped in favor of the
+// desired address records winners, and which of the conflict rules decided
+// it.
+func (t *Trail) lostToAll(loser *domain.RecordIntent, winners []*domain.RecordIntent) {
+	if t == nil || len(winners) == 0 {
+		return
+	}
+	for _, w := range winners {
+		if w.Force && !loser.Force {
+			t.intent(domain.StageFilter, loser, domain.DecisionLostToForce, fmt.Sprintf("conflicts with %s of container %s, which has the force label", w.Record.Render(), w.ContainerName), w)
+			return
+		}
+	}
+	for _, w := range winners {
+		if !loser.Created.Before(w.Created) {
+			t.intent(domain.StageFilter, loser, domain.DecisionLostOnAge, fmt.Sprintf("conflicts with %s of container %s, which is older", w.Record.Render(), w.ContainerName), w)
+			return
+		}
+	}
+	t.intent(domain.StageFilter, loser, domain.DecisionLostOnAge, fmt.Sprintf("conflicts with %s of container %s", winners[0].Record.Render(), winners[0].ContainerName), winners[0])
+}
+
+// lostToRegistry records that the desired record d was not published because
+// the registry holds the conflicting record existing, which a desired record
+// only evicts if it has the force label or its container is older.
+func (t *Trail) lostToRegistry(d, existing *domain.RecordIntent) {
+	if t == nil {
+		return
+	}
+	t.intent(domain.StageReconcile, d, domain.DecisionLostOnAge, fmt.Sprintf("conflicts with %s of container %s on host %s in the registry, which is not younger; the force label would evict it", existing.Record.Render(), existing.ContainerName, existing.Hostname), existing)
+}
+
+// lostToUnowned records that the desired record d conflicts with existing,
+// which no instance owns.
+func (t *Trail) lostToUnowned(d, existing *domain.RecordIntent) {
+	if t == nil {
+		return
+	}
+	t.intent(domain.StageReconcile, d, domain.DecisionUnowned, fmt.Sprintf("conflicts with %s in the registry, which no instance owns and is never evicted", existing.Record.Render()), existing)
+}
+
+// added records that the desired record d is added to the registry, evicting
+// the records of evictions.
+func (t *Trail) added(d *domain.RecordIntent, evictions map[string]*domain.RecordIntent) {
+	if t == nil {
+		return
+	}
+	if len(evictions) == 0 {
+		t.intent(domain.StageReconcile, d, domain.DecisionAdded, "added to the registry", nil)
+		return
+	}
+	keys := make([]string, 0, len(evictions))
+	for k := range evictions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r := evictions[k]
+		t.intent(domain.StageReconcile, d, domain.DecisionEvicts, fmt.Sprintf("added to the registry, evicting %s of container %s on host %s", r.Record.Render(), r.ContainerName, r.Hostname), r)
+	}
+}
+
+// outOfZone records that the desired record d was left out of a cluster whose
+// registry does not serve its name.
+func (t *Trail) outOfZone(d *domain.RecordIntent) {
+	t.intent(domain.StageReconcile, d, domain.DecisionOutOfZone, "not under any zone the registry serves", nil)
+}
+
+// invalid records that the desired record d was not published because
+// ValidateRecord rejected it with err.
+func (t *Trail) invalid(d *domain.RecordIntent, err error) {
+	if t == nil {
+		return
+	}
+	code := domain.DecisionInvalidRecord
+	var verr *RecordValidationError
+	if errors.As(err, &verr) {
+		code = verr.Code
+	}
+	t.intent(domain.StageReconcile, d, code, err.Error(), nil)
+}
+
+// label records a decision made while parsing the labels of a container.
+func (t *Trail) label(c domain.Container, rec domain.Record, code domain.DecisionCode, reason string) {
+	t.add(domain.Decision{
+		Stage:         domain.StageLabels,
+		ContainerId:   c.Id,
+		ContainerName: c.Name,
+		Record:        rec,
+		Code:          code,
+		Reason:        reason,
+	})
+}
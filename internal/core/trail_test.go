@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func TestTrail_NilRecordsNothing(t *testing.T) {
+	var trail *Trail
+	ri := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+
+	trail.intent(domain.StageReconcile, ri, domain.DecisionAdded, "added", nil)
+	trail.lost(ri, ri)
+	trail.lostToAll(ri, []*domain.RecordIntent{ri})
+	trail.lostToRegistry(ri, ri)
+	trail.added(ri, nil)
+	trail.invalid(ri, errors.New("bad"))
+	trail.label(domain.Container{}, ri.Record, domain.DecisionNotEnabled, "off")
+	trail.Reset()
+
+	if trail.Decisions() != nil {
+		t.Error("expected a nil trail to record nothing")
+	}
+}
+
+func TestTrail_ResetAndForCluster(t *testing.T) {
+	trail := NewTrail()
+	ri := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	trail.added(ri, nil)
+	trail.Reset()
+	trail.added(ri, nil)
+
+	got := trail.forCluster("dr")
+	if len(got) != 1 || got[0].Cluster != "dr" {
+		t.Fatalf("expected one decision attributed to the cluster, got %+v", got)
+	}
+	if trail.Decisions()[0].Cluster != "" {
+		t.Error("expected forCluster to leave the trail's decisions untouched")
+	}
+}
+
+func TestTrail_AddedRecordsEachEviction(t *testing.T) {
+	trail := NewTrail()
+	ri := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+	a := makeIntent("app.example.com", domain.RecordA, "192.168.1.2")
+	b := makeIntent("app.example.com", domain.RecordA, "192.168.1.3")
+
+	trail.added(ri, map[string]*domain.RecordIntent{b.Record.Key(): b, a.Record.Key(): a})
+
+	got := trail.Decisions()
+	if len(got) != 2 || got[0].Against != a || got[1].Against != b || got[0].Code != domain.DecisionEvicts {
+		t.Errorf("expected one evicts decision per eviction in key order, got %+v", got)
+	}
+}
+
+func TestTrail_InvalidUsesValidationCode(t *testing.T) {
+	trail := NewTrail()
+	ri := makeIntent("app.example.com", domain.RecordA, "192.168.1.1")
+
+	trail.invalid(ri, NewRecordValidationError(domain.DecisionDuplicateValue, "duplicate"))
+	trail.invalid(ri, errors.New("other"))
+
+	got := trail.Decisions()
+	if got[0].Code != domain.DecisionDuplicateValue || got[1].Code != domain.DecisionInvalidRecord {
+		t.Errorf("unexpected codes %s and %s", got[0].Code, got[1].Code)
+	}
+}
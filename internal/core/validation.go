@@ -52,23 +52,23 @@ func ValidateRecord(newRI *domain.RecordIntent, existing []*domain.RecordIntent,
 
 	// Rule 1: CNAME cannot coexist any address records (A or AAAA)
 	if newR.IsCNAME() && sameNameAnyAddress {
-		return NewRecordValidationError(fmt.Sprintf("%s -> %s - cannot add a CNAME when A/AAAA records exist with the same name", newR.Name, newR.Value))
+		return NewRecordValidationError(domain.DecisionCNAMEConflict, fmt.Sprintf("%s -> %s - cannot add a CNAME when A/AAAA records exist with the same name", newR.Name, newR.Value))
 	}
 	if (newR.IsAddress()) && sameNameCNAME {
-		return NewRecordValidationError(fmt.Sprintf("%s -> %s - cannot add A/AAAA when a CNAME exists with the same name", newR.Name, newR.Value))
+		return NewRecordValidationError(domain.DecisionCNAMEConflict, fmt.Sprintf("%s -> %s - cannot add A/AAAA when a CNAME exists with the same name", newR.Name, newR.Value))
 	}
 
 	// Rule 2: Only one CNAME per name
 	if newR.IsCNAME() && sameNameCNAME {
-		return NewRecordValidationError(fmt.Sprintf("%s -> %s - multiple CNAME records with the same name are not allowed", newR.Name, newR.Value))
+		return NewRecordValidationError(domain.DecisionDuplicateCNAME, fmt.Sprintf("%s -> %s - multiple CNAME records with the same name are not allowed", newR.Name, newR.Value))
 	}
 
 	// Rule 3: no duplicate address values per family
 	if newR.IsA() && dupAValue {
-		return NewRecordValidationError(fmt.Sprintf("%s -> %s - duplicate A record value not allowed", newR.Name, newR.Value))
+		return NewRecordValidationError(domain.DecisionDuplicateValue, fmt.Sprintf("%s -> %s - duplicate A record value not allowed", newR.Name, newR.Value))
 	}
 	if newR.IsAAAA() && dupAAAAValue {
-		return NewRecordValidationError(fmt.Sprintf("%s -> %s - duplicate AAAA record value not allowed", newR.Name, newR.Value))
+		return NewRecordValidationError(domain.DecisionDuplicateValue, fmt.Sprintf("%s -> %s - duplicate AAAA record value not allowed", newR.Name, newR.Value))
 	}
 
 	// Rule 4: CNAME cycle detection
@@ -93,7 +93,7 @@ func ValidateRecord(newRI *domain.RecordIntent, existing []*domain.RecordIntent,
 				break
 			}
 			if _, s := seen[cur]; s {
-				return NewRecordValidationError(fmt.Sprintf("CNAME cycle detected starting at: %s", newR.Name))
+				return NewRecordValidationError(domain.DecisionCNAMECycle, fmt.Sprintf("CNAME cycle detected starting at: %s", newR.Name))
 			}
 			seen[cur] = struct{}{}
 			cur = v
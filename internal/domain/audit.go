@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// RegistrationReason says why a record was registered.
+type RegistrationReason string
+
+// RegistrationContainer: a running container asks for the record.
+const RegistrationContainer RegistrationReason = "container"
+
+// AuditEntry records one registry write this instance made.
+type AuditEntry struct {
+	Time time.Time
+	// Host is the instance that made the write.
+	Host    string
+	Cluster string
+	Op      MutationOp
+	// Reason is a RegistrationReason or a RemovalReason, and Detail explains
+	// it, e.g. naming the dead host whose record was collected.
+	Reason string
+	Detail string
+	// Trigger is what started the pass that made the write (see
+	// core.TriggerReason), if known.
+	Trigger string
+	// Before is the record as it was in the registry (nil for a
+	// registration), and After what is there now: the registered record, or
+	// for an eviction the record that replaced the evicted one.
+	Before *RecordIntent
+	After  *RecordIntent
+	// Revision is the registry revision of the write; zero if the registry
+	// has none.
+	Revision int64
+}
@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// ChangeType is the kind of a Change.
+type ChangeType string
+
+const (
+	// ChangeContainer: a container event changed the records the container
+	// asks for.
+	ChangeContainer ChangeType = "container"
+	// ChangeRegistered: a record was written to a cluster.
+	ChangeRegistered ChangeType = "record_registered"
+	// ChangeRemoved: a record was deleted from a cluster.
+	ChangeRemoved ChangeType = "record_removed"
+	// ChangeConflict: a desired record started losing a conflict, so it is
+	// not published.
+	ChangeConflict ChangeType = "conflict"
+	// ChangeGC: a pass collected the records of hosts without a heartbeat.
+	ChangeGC ChangeType = "gc"
+)
+
+// RemovalReason says why a record was removed from a cluster.
+type RemovalReason string
+
+const (
+	// RemovalStale: a record of this host that no container asks for
+	// anymore.
+	RemovalStale RemovalReason = "stale"
+	// RemovalEvicted: a record that conflicts with the one added in its
+	// place.
+	RemovalEvicted RemovalReason = "evicted"
+	// RemovalGC: a record of a host without a heartbeat.
+	RemovalGC RemovalReason = "gc"
+	// RemovalDeregistered: a record of this host removed as it shut down.
+	RemovalDeregistered RemovalReason = "deregistered"
+)
+
+// Change is something the engine did or saw that changes, or explains, what
+// is in DNS.
+type Change struct {
+	Type ChangeType
+	Time time.Time
+	// Cluster is set for the changes made to, or decided for, one cluster.
+	Cluster       string
+	ContainerId   string
+	ContainerName string
+	// Event is the container event of a ChangeContainer, and Records the
+	// records the container asks for since.
+	Event   EventType
+	Records []*RecordIntent
+	// Record is the record registered, removed or losing a conflict.
+	Record *RecordIntent
+	// Reason is a RemovalReason for ChangeRemoved, and a DecisionCode for
+	// ChangeConflict. Detail explains it.
+	Reason string
+	Detail string
+	// Against is the record that evicted Record, or that Record lost to.
+	Against *RecordIntent
+	// Hosts are the hosts whose records a ChangeGC collected, and Removed
+	// how many records it removed.
+	Hosts   []string
+	Removed int
+}
@@ -0,0 +1,29 @@
+package domain
+
+// CNAMEChain returns the names reached by resolving name through the CNAME
+// records among records: name itself, then each CNAME target in turn. It stops
+// at a name with no CNAME, or before revisiting a name when the chain loops.
+func CNAMEChain(name string, records []*RecordIntent) []string {
+	targets := make(map[string]string)
+	for _, ri := range records {
+		if ri.Record.IsCNAME() {
+			if _, dup := targets[ri.Record.Name]; !dup {
+				targets[ri.Record.Name] = ri.Record.Value
+			}
+		}
+	}
+	chain := []string{name}
+	seen := map[string]struct{}{name: {}}
+	for {
+		next, ok := targets[name]
+		if !ok {
+			return chain
+		}
+		if _, loop := seen[next]; loop {
+			return chain
+		}
+		seen[next] = struct{}{}
+		chain = append(chain, next)
+		name = next
+	}
+}
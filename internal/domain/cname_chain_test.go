@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func cnameIntent(t *testing.T, name, target string) *RecordIntent {
+	t.Helper()
+	rec, err := NewCNAME(name, target)
+	if err != nil {
+		t.Fatalf("NewCNAME: %v", err)
+	}
+	return &RecordIntent{Record: rec}
+}
+
+func TestCNAMEChain(t *testing.T) {
+	a, _ := NewA("c.example.com", "10.0.0.1")
+	records := []*RecordIntent{
+		cnameIntent(t, "a.example.com", "b.example.com"),
+		cnameIntent(t, "b.example.com", "c.example.com"),
+		{Record: a},
+	}
+
+	got := CNAMEChain("a.example.com", records)
+	want := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CNAMEChain = %v, want %v", got, want)
+	}
+}
+
+func TestCNAMEChain_NoCNAME(t *testing.T) {
+	got := CNAMEChain("plain.example.com", nil)
+	if !reflect.DeepEqual(got, []string{"plain.example.com"}) {
+		t.Errorf("expected only the starting name, got %v", got)
+	}
+}
+
+func TestCNAMEChain_StopsAtLoop(t *testing.T) {
+	records := []*RecordIntent{
+		cnameIntent(t, "a.example.com", "b.example.com"),
+		cnameIntent(t, "b.example.com", "a.example.com"),
+	}
+
+	got := CNAMEChain("a.example.com", records)
+	want := []string{"a.example.com", "b.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CNAMEChain = %v, want %v", got, want)
+	}
+}
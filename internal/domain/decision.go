@@ -0,0 +1,93 @@
+package domain
+
+// DecisionStage is the step of the pipeline that made a Decision.
+type DecisionStage string
+
+const (
+	// StageLabels is the parsing of a container's labels into records.
+	StageLabels DecisionStage = "labels"
+	// StageFilter is the resolution of conflicts between desired records.
+	StageFilter DecisionStage = "filter"
+	// StageReconcile is the diff of the desired records against a cluster.
+	StageReconcile DecisionStage = "reconcile"
+)
+
+// DecisionCode says, in a machine-readable way, what was decided about a
+// record.
+type DecisionCode string
+
+const (
+	// DecisionNotEnabled: the container has labels under the prefix but
+	// not <prefix>.enabled=true.
+	DecisionNotEnabled DecisionCode = "not_enabled"
+	// DecisionInvalidLabel: a label's value cannot be used, and the label
+	// is ignored.
+	DecisionInvalidLabel DecisionCode = "invalid_label"
+	// DecisionUnsupportedKind: a label names a record type that is not
+	// supported.
+	DecisionUnsupportedKind DecisionCode = "unsupported_kind"
+	// DecisionMissingName: a record has a value label but no name label.
+	DecisionMissingName DecisionCode = "missing_name"
+	// DecisionMissingValue: a record has no value label and no default
+	// applies.
+	DecisionMissingValue DecisionCode = "missing_value"
+	// DecisionInvalidRecord: the name or value is not valid for the type.
+	DecisionInvalidRecord DecisionCode = "invalid_record"
+
+	// DecisionDuplicate: another container wants the same record and won.
+	DecisionDuplicate DecisionCode = "duplicate"
+	// DecisionLostToForce: the record conflicts with one whose container has
+	// the force label.
+	DecisionLostToForce DecisionCode = "lost_to_force"
+	// DecisionLostOnAge: the record conflicts with one whose container is
+	// older.
+	DecisionLostOnAge DecisionCode = "lost_on_age"
+
+	// DecisionAdded: the record is added to the cluster.
+	DecisionAdded DecisionCode = "added"
+	// DecisionPublished: the record is already in the cluster.
+	DecisionPublished DecisionCode = "published"
+	// DecisionEvicts: the record is added and evicts a conflicting record of
+	// the cluster, named by Against.
+	DecisionEvicts DecisionCode = "evicts"
+	// DecisionCNAMEConflict: a CNAME and address records for the same name.
+	DecisionCNAMEConflict DecisionCode = "cname_conflict"
+	// DecisionDuplicateCNAME: a second CNAME for the same name.
+	DecisionDuplicateCNAME DecisionCode = "duplicate_cname"
+	// DecisionDuplicateValue: an address record the name already has.
+	DecisionDuplicateValue DecisionCode = "duplicate_value"
+	// DecisionCNAMECycle: the CNAME would close a resolution loop.
+	DecisionCNAMECycle DecisionCode = "cname_cycle"
+	// DecisionUnowned: the record conflicts with one of the cluster that no
+	// instance owns, written by another tool, which is never evicted.
+	DecisionUnowned DecisionCode = "unowned"
+	// DecisionOutOfZone: the cluster's registry does not serve the name,
+	// e.g. it is not under any zone configured for it.
+	DecisionOutOfZone DecisionCode = "out_of_zone"
+)
+
+// Decision is one step of the trail explaining what became of a record a
+// container asks for, as of the latest reconciliation pass.
+type Decision struct {
+	Stage DecisionStage
+	// Cluster is set for StageReconcile decisions.
+	Cluster       string
+	ContainerId   string
+	ContainerName string
+	// Record is the record decided on. At StageLabels, only the fields its
+	// labels provided are set.
+	Record Record
+	Code   DecisionCode
+	Reason string
+	// Against is the record the decision was made against, if any.
+	Against *RecordIntent
+}
+
+// Published reports whether the decision leaves the record in DNS.
+func (d Decision) Published() bool {
+	switch d.Code {
+	case DecisionAdded, DecisionPublished, DecisionEvicts:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "testing"
+
+func TestDecision_Published(t *testing.T) {
+	tests := map[DecisionCode]bool{
+		DecisionAdded:       true,
+		DecisionPublished:   true,
+		DecisionEvicts:      true,
+		DecisionNotEnabled:  false,
+		DecisionDuplicate:   false,
+		DecisionLostOnAge:   false,
+		DecisionCNAMECycle:  false,
+		DecisionMissingName: false,
+	}
+	for code, want := range tests {
+		if got := (Decision{Code: code}).Published(); got != want {
+			t.Errorf("Published() for %s = %v, want %v", code, got, want)
+		}
+	}
+}
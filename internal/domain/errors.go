@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPlanConflict reports that a registry changed after a reconciliation plan
+// was computed from it, so the plan was not applied and must be recomputed.
+var ErrPlanConflict = errors.New("registry changed since the plan was computed")
+
+// LockLostError reports that a lock stopped being held before the critical
+// section it guarded finished, because its lease expired or its key was taken
+// over. Writes attempted after that point were refused, so some of the
+// section's work may not have been applied.
+type LockLostError struct {
+	// Lock is the name that was locked.
+	Lock string
+}
+
+func (e *LockLostError) Error() string {
+	return fmt.Sprintf("lock on %s was lost during the transaction", e.Lock)
+}
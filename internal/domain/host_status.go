@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// HostStatus describes one sync instance. Each instance publishes its own as
+// the value of its heartbeat key, so every instance can list the whole fleet.
+// It is also the shape of the fleet view served over HTTP and the CLI.
+type HostStatus struct {
+	// Schema is the version of the payload format, HeartbeatSchema when
+	// written by this release. Zero for heartbeats holding just a hostname.
+	Schema    int       `json:"schema"`
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version,omitempty"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	HostIPv4  string    `json:"host_ipv4,omitempty"`
+	HostIPv6  string    `json:"host_ipv6,omitempty"`
+	// RecordsOwned is how many records this instance owns in the registry, as
+	// of its latest successful reconciliation.
+	RecordsOwned int `json:"records_owned"`
+	// LastReconcile is when this instance last reconciled the registry
+	// successfully. Zero until it first has.
+	LastReconcile time.Time `json:"last_successful_reconcile,omitzero"`
+}
+
+// ClusterFleet is the set of sync instances heartbeating in one registry
+// cluster, sorted by hostname. Err is set when the cluster could not be read.
+type ClusterFleet struct {
+	Cluster string       `json:"cluster"`
+	Hosts   []HostStatus `json:"hosts"`
+	Err     string       `json:"error,omitempty"`
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Peers running different versions read each other's heartbeats, so the JSON
+// field names must stay stable.
+func TestHostStatus_JSON(t *testing.T) {
+	s := HostStatus{
+		Schema:        HeartbeatSchema,
+		Hostname:      "host-1",
+		Version:       "v1.2.3",
+		StartedAt:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		HostIPv4:      "10.0.0.1",
+		HostIPv6:      "fd00::1",
+		RecordsOwned:  7,
+		LastReconcile: time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC),
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"schema":1,"hostname":"host-1","version":"v1.2.3","started_at":"2026-01-02T03:04:05Z","host_ipv4":"10.0.0.1","host_ipv6":"fd00::1","records_owned":7,"last_successful_reconcile":"2026-01-02T03:05:00Z"}`
+	if string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+}
+
+func TestHostStatus_JSON_OmitsUnset(t *testing.T) {
+	b, err := json.Marshal(HostStatus{Hostname: "host-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"schema":0,"hostname":"host-1","records_owned":0}`
+	if string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+}
@@ -0,0 +1,31 @@
+package domain
+
+// MutationOp is the kind of a Mutation.
+type MutationOp string
+
+const (
+	MutationRegister MutationOp = "register"
+	MutationRemove   MutationOp = "remove"
+)
+
+// Mutation is a write a registry committed: Record was registered or
+// removed. Revision is the registry's revision once the write committed, or
+// zero for a registry without revisions.
+type Mutation struct {
+	Op       MutationOp
+	Record   *RecordIntent
+	Revision int64
+}
+
+// SplitMutations returns the records registered and removed by mutations, in
+// order.
+func SplitMutations(mutations []Mutation) (registered, removed []*RecordIntent) {
+	for _, m := range mutations {
+		if m.Op == MutationRegister {
+			registered = append(registered, m.Record)
+		} else {
+			removed = append(removed, m.Record)
+		}
+	}
+	return registered, removed
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrEngineStopped reports that the sync engine is not running, so it cannot
+// act on a request.
+var ErrEngineStopped = errors.New("sync engine is not running")
+
+// PassResult is the outcome of one reconciliation pass.
+type PassResult struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	// DryRun and Paused report why a pass applied nothing: in either mode the
+	// plan is only logged.
+	DryRun bool
+	Paused bool
+	// Added and Removed are the records applied across all clusters, and
+	// Skipped the desired records dropped as conflicting.
+	Added    int
+	Removed  int
+	Skipped  int
+	Clusters []ClusterPassResult
+	// Err joins the errors of the clusters that failed.
+	Err error
+}
+
+// ClusterPassResult is the outcome of a reconciliation pass on one cluster.
+type ClusterPassResult struct {
+	Cluster string
+	Added   int
+	Removed int
+	Err     error
+}
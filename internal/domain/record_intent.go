@@ -15,6 +15,11 @@ type RecordIntent struct {
 	// omitted from the etcd value and CoreDNS applies its own default.
 	TTL    uint32
 	Record Record
+	// Wire is what the registry stored alongside the record, carried so a
+	// record read from the registry is written back with it intact. It is not
+	// part of the record's identity. Zero for records not read from a
+	// registry.
+	Wire WireInfo
 }
 
 func (ri RecordIntent) Render() string {
@@ -0,0 +1,56 @@
+package domain
+
+import "time"
+
+// TrackedContainer is a container the state tracker holds, with the record
+// intents built from its labels.
+type TrackedContainer struct {
+	Id          string
+	Name        string
+	Created     time.Time
+	LastUpdated time.Time
+	Status      ContainerStatus
+	Intents     []*RecordIntent
+}
+
+// DroppedIntent is a desired record intent left out of a reconciliation pass
+// because it conflicts with another desired intent, and why.
+type DroppedIntent struct {
+	Intent *RecordIntent
+	Reason string
+}
+
+// ClusterSnapshot is what a reconciliation pass saw and planned in one
+// registry cluster.
+type ClusterSnapshot struct {
+	Cluster string
+	// ListedAt is when Records were listed. If the latest listing failed,
+	// Records are those of the last listing that succeeded, and Err is set.
+	ListedAt time.Time
+	Records  []*RecordIntent
+	// ToAdd and ToRemove are the plan the pass applied, or in dry-run would
+	// have applied, after the startup gate and the removal breaker.
+	ToAdd    []*RecordIntent
+	ToRemove []*RecordIntent
+	// Decisions explain, for every desired record, what the plan does with
+	// it and why.
+	Decisions []Decision
+	Err       error
+}
+
+// Snapshot is the engine's view of the desired and actual state as of its
+// latest reconciliation pass. Zero until the first pass.
+type Snapshot struct {
+	TakenAt time.Time
+	DryRun  bool
+	// Paused is set when the engine was paused (see SyncEngine.Pause), so
+	// the plan was only logged.
+	Paused     bool
+	Containers []TrackedContainer
+	Dropped    []DroppedIntent
+	// Decisions are those made before any cluster is consulted: about the
+	// labels of the tracked containers, and about conflicts between their
+	// records. Each cluster's own are in its ClusterSnapshot.
+	Decisions []Decision
+	Clusters  []ClusterSnapshot
+}
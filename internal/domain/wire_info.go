@@ -0,0 +1,31 @@
+package domain
+
+import "encoding/json"
+
+// RecordSchema is the version of the record wire format this release writes.
+// Records stored without a version were written by a release that predates
+// versioning.
+const RecordSchema = 1
+
+// HeartbeatSchema is the version of the heartbeat payload (see HostStatus)
+// this release writes. Heartbeats holding just a hostname predate it.
+const HeartbeatSchema = 1
+
+// WireInfo is what a registry stored alongside a record that is not part of
+// the record itself.
+type WireInfo struct {
+	// Schema is the wire format version the record was written with, or zero
+	// if it predates versioning.
+	Schema int
+	// Unknown holds the fields, by name, that a newer release wrote and this
+	// one does not interpret. They are written back unchanged.
+	Unknown map[string]json.RawMessage
+}
+
+// Recognized reports whether the record was written in a wire format this
+// release understands: its own or an earlier versioned one. Records in any
+// other format come from a release that predates versioning or from a newer
+// one, whose owners this release cannot vouch for.
+func (w WireInfo) Recognized() bool {
+	return w.Schema >= 1 && w.Schema <= RecordSchema
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "testing"
+
+func TestWireInfo_Recognized(t *testing.T) {
+	tests := []struct {
+		schema int
+		want   bool
+	}{
+		{0, false},
+		{RecordSchema, true},
+		{RecordSchema + 1, false},
+	}
+	for _, tt := range tests {
+		if got := (WireInfo{Schema: tt.schema}).Recognized(); got != tt.want {
+			t.Errorf("schema %d: expected recognized=%t, got %t", tt.schema, tt.want, got)
+		}
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Defaults used when no option overrides them. These mirror the viper defaults
@@ -22,11 +25,15 @@ const (
 	defaultReconnectMaxBackoff = 30 * time.Second
 )
 
+// tracerName is the instrumentation scope of the generator's spans.
+const tracerName = "github.com/auto-dns/docker-coredns-sync/internal/event"
+
 type DockerGenerator struct {
 	logger             zerolog.Logger
 	cli                dockerClient
 	onConnectionChange func(connected bool)
 	onDisconnect       func()
+	tracer             trace.Tracer
 	bufferSize         int
 	reconnectInitial   time.Duration
 	reconnectMax       time.Duration
@@ -81,10 +88,18 @@ func WithDisconnectObserver(fn func()) Option {
 	}
 }
 
+// WithTracerProvider traces the generator's Docker API calls with tp.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(dw *DockerGenerator) {
+		dw.tracer = tracing.Tracer(tp, tracerName)
+	}
+}
+
 func NewDockerGenerator(cli dockerClient, logger zerolog.Logger, opts ...Option) *DockerGenerator {
 	dw := &DockerGenerator{
 		logger:           logger,
 		cli:              cli,
+		tracer:           tracing.Tracer(nil, tracerName),
 		bufferSize:       defaultEventBufferSize,
 		reconnectInitial: defaultReconnectInitial,
 		reconnectMax:     defaultReconnectMaxBackoff,
@@ -173,9 +188,9 @@ func (dw *DockerGenerator) Subscribe(ctx context.Context) (<-chan domain.Contain
 // ctx is cancelled (caller detects this via ctx.Err()).
 func (dw *DockerGenerator) runOnce(ctx context.Context, out chan<- domain.ContainerEvent, since *time.Time) (time.Time, error) {
 	var notConnected time.Time
-	containers, err := dw.cli.ContainerList(ctx, container.ListOptions{All: false})
+	containers, err := dw.listContainers(ctx)
 	if err != nil {
-		return notConnected, fmt.Errorf("listing containers: %w", err)
+		return notConnected, err
 	}
 	runningIds := make([]string, 0, len(containers))
 	for _, c := range containers {
@@ -255,6 +270,18 @@ func (dw *DockerGenerator) runOnce(ctx context.Context, out chan<- domain.Contai
 	}
 }
 
+// listContainers lists the running containers.
+func (dw *DockerGenerator) listContainers(ctx context.Context) (containers []container.Summary, err error) {
+	ctx, span := dw.tracer.Start(ctx, "docker.list_containers")
+	defer func() { tracing.End(span, err) }()
+	containers, err = dw.cli.ContainerList(ctx, container.ListOptions{All: false})
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	span.SetAttributes(attribute.Int("docker.containers", len(containers)))
+	return containers, nil
+}
+
 // stableConnection reports whether a connection established at connectedAt was
 // up long enough (>= minUptime) to be considered healthy. A zero connectedAt
 // means the connection was never established.
@@ -14,6 +14,10 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func testLogger() zerolog.Logger {
@@ -937,3 +941,36 @@ func TestJitter(t *testing.T) {
 		t.Error("expected jitter(0) == 0")
 	}
 }
+
+func TestDockerGenerator_listContainers_Traced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	mock := newMockDockerClient()
+	mock.containerListFunc = func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			t.Error("expected the list call to run within its span")
+		}
+		return []container.Summary{{ID: "c1"}, {ID: "c2"}}, nil
+	}
+	gen := NewDockerGenerator(mock, testLogger(), WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+
+	if _, err := gen.listContainers(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mock.containerListFunc = func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+		return nil, errors.New("docker daemon unavailable")
+	}
+	if _, err := gen.listContainers(context.Background()); err == nil {
+		t.Fatal("expected the list error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "docker.list_containers" {
+		t.Fatalf("expected 2 list spans, got %v", spans)
+	}
+	if got := spans[0].Attributes; len(got) != 1 || got[0].Value.AsInt64() != 2 {
+		t.Errorf("expected the container count recorded, got %v", got)
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("expected the failed list marked as an error, got %v", spans[1].Status)
+	}
+}
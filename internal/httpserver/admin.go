@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// Admin is the sync engine, as driven by the /admin routes. Each call waits
+// until the engine's loop has handled it.
+type Admin interface {
+	Reconcile(ctx context.Context) (domain.PassResult, error)
+	Pause(ctx context.Context) (bool, error)
+	Resume(ctx context.Context) (bool, error)
+}
+
+// adminTimeout bounds how long an /admin request waits for the engine, which
+// handles it once its current pass, if any, finishes.
+const adminTimeout = 60 * time.Second
+
+type clusterPassJSON struct {
+	Cluster string `json:"cluster"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Err     string `json:"error,omitempty"`
+}
+
+type passJSON struct {
+	StartedAt time.Time         `json:"started_at"`
+	Duration  float64           `json:"duration_seconds"`
+	DryRun    bool              `json:"dry_run"`
+	Paused    bool              `json:"paused"`
+	Added     int               `json:"added"`
+	Removed   int               `json:"removed"`
+	Skipped   int               `json:"skipped"`
+	Clusters  []clusterPassJSON `json:"clusters"`
+	Err       string            `json:"error,omitempty"`
+}
+
+func toPassJSON(res domain.PassResult) passJSON {
+	clusters := make([]clusterPassJSON, 0, len(res.Clusters))
+	for _, cr := range res.Clusters {
+		clusters = append(clusters, clusterPassJSON{Cluster: cr.Cluster, Added: cr.Added, Removed: cr.Removed, Err: errString(cr.Err)})
+	}
+	return passJSON{
+		StartedAt: res.StartedAt,
+		Duration:  res.Duration.Seconds(),
+		DryRun:    res.DryRun,
+		Paused:    res.Paused,
+		Added:     res.Added,
+		Removed:   res.Removed,
+		Skipped:   res.Skipped,
+		Clusters:  clusters,
+		Err:       errString(res.Err),
+	}
+}
+
+// writeAdminError reports that the engine did not handle a request.
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrEngineStopped):
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	_, _ = w.Write([]byte(err.Error()))
+}
+
+// registerAdmin adds the /admin routes to mux. /admin/override-breaker is only
+// added when overrideBreaker is set.
+func registerAdmin(mux *http.ServeMux, admin Admin, overrideBreaker http.HandlerFunc) {
+	// withEngine runs fn with a context bounded by adminTimeout, and lets the
+	// response outlive the server's write timeout by as much.
+	withEngine := func(fn func(ctx context.Context, w http.ResponseWriter)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(adminTimeout + 5*time.Second))
+			ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+			defer cancel()
+			fn(ctx, w)
+		}
+	}
+	mux.HandleFunc("POST /admin/reconcile", withEngine(func(ctx context.Context, w http.ResponseWriter) {
+		res, err := admin.Reconcile(ctx)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if res.Err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_ = json.NewEncoder(w).Encode(toPassJSON(res))
+	}))
+	mux.HandleFunc("POST /admin/pause", withEngine(func(ctx context.Context, w http.ResponseWriter) {
+		changed, err := admin.Pause(ctx)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		if !changed {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte("already paused"))
+			return
+		}
+		_, _ = w.Write([]byte("paused; container events are still tracked, but no records are written until resumed"))
+	}))
+	mux.HandleFunc("POST /admin/resume", withEngine(func(ctx context.Context, w http.ResponseWriter) {
+		changed, err := admin.Resume(ctx)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		if !changed {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte("not paused"))
+			return
+		}
+		_, _ = w.Write([]byte("resumed; the changes made while paused are applied on the next pass"))
+	}))
+	if overrideBreaker != nil {
+		mux.HandleFunc("POST /admin/override-breaker", overrideBreaker)
+	}
+}
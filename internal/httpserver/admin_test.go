@@ -0,0 +1,186 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+type mockAdmin struct {
+	result  domain.PassResult
+	changed bool
+	err     error
+	calls   []string
+}
+
+func (m *mockAdmin) Reconcile(ctx context.Context) (domain.PassResult, error) {
+	m.calls = append(m.calls, "reconcile")
+	return m.result, m.err
+}
+
+func (m *mockAdmin) Pause(ctx context.Context) (bool, error) {
+	m.calls = append(m.calls, "pause")
+	return m.changed, m.err
+}
+
+func (m *mockAdmin) Resume(ctx context.Context) (bool, error) {
+	m.calls = append(m.calls, "resume")
+	return m.changed, m.err
+}
+
+// adminAuth protects the admin routes with the token "s3cret".
+var adminAuth = WithAuth(Auth{Token: "s3cret", Policies: map[RouteGroup]Policy{RouteProbes: PolicyOpen}})
+
+// adminPost posts to path with token as the bearer token, if set.
+func adminPost(t *testing.T, url, token string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestHandler_Admin_RequiresToken(t *testing.T) {
+	admin := &mockAdmin{changed: true}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(admin), adminAuth, WithBreakerOverride(func() bool { return true })))
+	defer srv.Close()
+
+	for _, path := range []string{"/admin/reconcile", "/admin/pause", "/admin/resume", "/admin/override-breaker"} {
+		for _, token := range []string{"", "wrong"} {
+			if code, _ := adminPost(t, srv.URL+path, token); code != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: expected 401, got %d", path, token, code)
+			}
+		}
+	}
+	if len(admin.calls) != 0 {
+		t.Errorf("expected no call to reach the engine, got %v", admin.calls)
+	}
+}
+
+func TestHandler_Admin_Reconcile(t *testing.T) {
+	admin := &mockAdmin{result: domain.PassResult{
+		StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Added:     2,
+		Clusters:  []domain.ClusterPassResult{{Cluster: "default", Added: 2}},
+	}}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(admin), adminAuth))
+	defer srv.Close()
+
+	code, body := adminPost(t, srv.URL+"/admin/reconcile", "s3cret")
+
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", code, body)
+	}
+	var got passJSON
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Added != 2 || got.Duration != 1.5 || len(got.Clusters) != 1 || got.Clusters[0].Cluster != "default" || got.Err != "" {
+		t.Errorf("unexpected pass %+v", got)
+	}
+}
+
+func TestHandler_Admin_ReconcileFailed(t *testing.T) {
+	admin := &mockAdmin{result: domain.PassResult{
+		Err:      errors.New("etcd unavailable"),
+		Clusters: []domain.ClusterPassResult{{Cluster: "default", Err: errors.New("etcd unavailable")}},
+	}}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(admin), adminAuth))
+	defer srv.Close()
+
+	code, body := adminPost(t, srv.URL+"/admin/reconcile", "s3cret")
+
+	var got passJSON
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if code != http.StatusInternalServerError || got.Err != "etcd unavailable" || got.Clusters[0].Err != "etcd unavailable" {
+		t.Errorf("expected 500 with the error, got %d: %s", code, body)
+	}
+}
+
+func TestHandler_Admin_PauseResume(t *testing.T) {
+	admin := &mockAdmin{}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(admin), adminAuth))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path    string
+		changed bool
+		want    int
+	}{
+		{"/admin/pause", true, http.StatusOK},
+		{"/admin/pause", false, http.StatusConflict},
+		{"/admin/resume", true, http.StatusOK},
+		{"/admin/resume", false, http.StatusConflict},
+	} {
+		admin.changed = tc.changed
+		if code, body := adminPost(t, srv.URL+tc.path, "s3cret"); code != tc.want {
+			t.Errorf("%s (changed=%t): expected %d, got %d: %s", tc.path, tc.changed, tc.want, code, body)
+		}
+	}
+}
+
+func TestHandler_Admin_EngineErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{domain.ErrEngineStopped, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	} {
+		admin := &mockAdmin{err: tc.err}
+		srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(admin), adminAuth))
+		for _, path := range []string{"/admin/reconcile", "/admin/pause", "/admin/resume"} {
+			if code, _ := adminPost(t, srv.URL+path, "s3cret"); code != tc.want {
+				t.Errorf("%s with %v: expected %d, got %d", path, tc.err, tc.want, code)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestHandler_Admin_OverrideBreaker(t *testing.T) {
+	var calls int
+	override := func() bool {
+		calls++
+		return true
+	}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAdmin(&mockAdmin{}), adminAuth, WithBreakerOverride(override)))
+	defer srv.Close()
+
+	if code, _ := adminPost(t, srv.URL+"/admin/override-breaker", "s3cret"); code != http.StatusAccepted || calls != 1 {
+		t.Errorf("expected the override to be applied, got %d after %d calls", code, calls)
+	}
+	// The original route is kept, and protected like the admin routes.
+	if code, _ := adminPost(t, srv.URL+"/override-breaker", ""); code != http.StatusUnauthorized || calls != 1 {
+		t.Errorf("expected /override-breaker to require the token, got %d after %d calls", code, calls)
+	}
+	if code, _ := adminPost(t, srv.URL+"/override-breaker", "s3cret"); code != http.StatusAccepted || calls != 2 {
+		t.Errorf("expected /override-breaker to keep working, got %d after %d calls", code, calls)
+	}
+}
+
+func TestHandler_Admin_NotServedByDefault(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil))
+	defer srv.Close()
+
+	if code, _ := adminPost(t, srv.URL+"/admin/reconcile", "s3cret"); code != http.StatusNotFound {
+		t.Errorf("expected 404 without WithAdmin, got %d", code)
+	}
+}
@@ -0,0 +1,248 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// recordJSON is the API shape of a record intent.
+type recordJSON struct {
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Value         string    `json:"value"`
+	TTL           uint32    `json:"ttl,omitempty"`
+	Hostname      string    `json:"hostname"`
+	ContainerId   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	Created       time.Time `json:"created,omitzero"`
+	Force         bool      `json:"force"`
+	// Schema is the wire schema the registry stored the record in; zero for
+	// desired records.
+	Schema int `json:"schema,omitempty"`
+}
+
+type containerJSON struct {
+	Id          string       `json:"id"`
+	Name        string       `json:"name"`
+	Created     time.Time    `json:"created,omitzero"`
+	LastUpdated time.Time    `json:"last_updated,omitzero"`
+	Status      string       `json:"status"`
+	Records     []recordJSON `json:"records"`
+}
+
+type droppedJSON struct {
+	Record recordJSON `json:"record"`
+	Reason string     `json:"reason"`
+}
+
+type clusterRecordsJSON struct {
+	Cluster  string       `json:"cluster"`
+	ListedAt time.Time    `json:"listed_at,omitzero"`
+	Records  []recordJSON `json:"records"`
+	Err      string       `json:"error,omitempty"`
+}
+
+type clusterPlanJSON struct {
+	Cluster  string       `json:"cluster"`
+	ToAdd    []recordJSON `json:"to_add"`
+	ToRemove []recordJSON `json:"to_remove"`
+	Err      string       `json:"error,omitempty"`
+}
+
+// decisionJSON is the API shape of a decision about a record.
+type decisionJSON struct {
+	Stage         string      `json:"stage"`
+	Cluster       string      `json:"cluster,omitempty"`
+	ContainerId   string      `json:"container_id"`
+	ContainerName string      `json:"container_name"`
+	Name          string      `json:"name,omitempty"`
+	Type          string      `json:"type,omitempty"`
+	Value         string      `json:"value,omitempty"`
+	Code          string      `json:"code"`
+	Reason        string      `json:"reason"`
+	Published     bool        `json:"published"`
+	Against       *recordJSON `json:"against,omitempty"`
+}
+
+func toDecisionJSON(d domain.Decision) decisionJSON {
+	out := decisionJSON{
+		Stage:         string(d.Stage),
+		Cluster:       d.Cluster,
+		ContainerId:   d.ContainerId,
+		ContainerName: d.ContainerName,
+		Name:          d.Record.Name,
+		Type:          string(d.Record.Kind),
+		Value:         d.Record.Value,
+		Code:          string(d.Code),
+		Reason:        d.Reason,
+		Published:     d.Published(),
+	}
+	if d.Against != nil {
+		against := toRecordJSON(d.Against)
+		out.Against = &against
+	}
+	return out
+}
+
+// explain returns the decisions of snap about the records of query: a record
+// name, a container name, or a prefix of a container id. Decisions made
+// before any cluster was consulted come first, then those of each cluster.
+func explain(snap domain.Snapshot, query string) []decisionJSON {
+	name := strings.TrimSuffix(strings.ToLower(query), ".")
+	matches := func(d domain.Decision) bool {
+		return strings.TrimSuffix(strings.ToLower(d.Record.Name), ".") == name ||
+			d.ContainerName == query ||
+			(d.ContainerId != "" && strings.HasPrefix(d.ContainerId, query))
+	}
+	out := []decisionJSON{}
+	for _, d := range snap.Decisions {
+		if matches(d) {
+			out = append(out, toDecisionJSON(d))
+		}
+	}
+	for _, cs := range snap.Clusters {
+		for _, d := range cs.Decisions {
+			if matches(d) {
+				out = append(out, toDecisionJSON(d))
+			}
+		}
+	}
+	return out
+}
+
+func toRecordJSON(ri *domain.RecordIntent) recordJSON {
+	return recordJSON{
+		Name:          ri.Record.Name,
+		Type:          string(ri.Record.Kind),
+		Value:         ri.Record.Value,
+		TTL:           ri.TTL,
+		Hostname:      ri.Hostname,
+		ContainerId:   ri.ContainerId,
+		ContainerName: ri.ContainerName,
+		Created:       ri.Created,
+		Force:         ri.Force,
+		Schema:        ri.Wire.Schema,
+	}
+}
+
+// toRecordsJSON renders intents sorted by name, type and value, so responses
+// are stable across passes.
+func toRecordsJSON(intents []*domain.RecordIntent) []recordJSON {
+	out := make([]recordJSON, 0, len(intents))
+	for _, ri := range intents {
+		out = append(out, toRecordJSON(ri))
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+	return out
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// registerAPI adds the read-only /api/v1 routes to mux. They are served from
+// the engine's latest snapshot and answer 503 until the first pass has run.
+func registerAPI(mux *http.ServeMux, snapshot func() domain.Snapshot) {
+	serveRequest := func(render func(domain.Snapshot, *http.Request) any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			snap := snapshot()
+			if snap.TakenAt.IsZero() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("no reconciliation pass has run yet"))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(render(snap, r))
+		}
+	}
+	serve := func(render func(domain.Snapshot) any) http.HandlerFunc {
+		return serveRequest(func(snap domain.Snapshot, _ *http.Request) any { return render(snap) })
+	}
+	mux.HandleFunc("GET /api/v1/containers", serve(func(snap domain.Snapshot) any {
+		containers := make([]containerJSON, 0, len(snap.Containers))
+		for _, c := range snap.Containers {
+			containers = append(containers, containerJSON{
+				Id:          c.Id,
+				Name:        c.Name,
+				Created:     c.Created,
+				LastUpdated: c.LastUpdated,
+				Status:      string(c.Status),
+				Records:     toRecordsJSON(c.Intents),
+			})
+		}
+		return struct {
+			TakenAt    time.Time       `json:"taken_at"`
+			Containers []containerJSON `json:"containers"`
+		}{snap.TakenAt, containers}
+	}))
+	mux.HandleFunc("GET /api/v1/records", serve(func(snap domain.Snapshot) any {
+		clusters := make([]clusterRecordsJSON, 0, len(snap.Clusters))
+		for _, cs := range snap.Clusters {
+			clusters = append(clusters, clusterRecordsJSON{
+				Cluster:  cs.Cluster,
+				ListedAt: cs.ListedAt,
+				Records:  toRecordsJSON(cs.Records),
+				Err:      errString(cs.Err),
+			})
+		}
+		return struct {
+			TakenAt  time.Time            `json:"taken_at"`
+			Clusters []clusterRecordsJSON `json:"clusters"`
+		}{snap.TakenAt, clusters}
+	}))
+	mux.HandleFunc("GET /api/v1/plan", serve(func(snap domain.Snapshot) any {
+		dropped := make([]droppedJSON, 0, len(snap.Dropped))
+		for _, d := range snap.Dropped {
+			dropped = append(dropped, droppedJSON{Record: toRecordJSON(d.Intent), Reason: d.Reason})
+		}
+		clusters := make([]clusterPlanJSON, 0, len(snap.Clusters))
+		for _, cs := range snap.Clusters {
+			clusters = append(clusters, clusterPlanJSON{
+				Cluster:  cs.Cluster,
+				ToAdd:    toRecordsJSON(cs.ToAdd),
+				ToRemove: toRecordsJSON(cs.ToRemove),
+				Err:      errString(cs.Err),
+			})
+		}
+		return struct {
+			TakenAt  time.Time         `json:"taken_at"`
+			DryRun   bool              `json:"dry_run"`
+			Paused   bool              `json:"paused"`
+			Dropped  []droppedJSON     `json:"dropped"`
+			Clusters []clusterPlanJSON `json:"clusters"`
+		}{snap.TakenAt, snap.DryRun, snap.Paused, dropped, clusters}
+	}))
+	explainHandler := serveRequest(func(snap domain.Snapshot, r *http.Request) any {
+		query := r.URL.Query().Get("q")
+		return struct {
+			TakenAt   time.Time      `json:"taken_at"`
+			Query     string         `json:"query"`
+			Decisions []decisionJSON `json:"decisions"`
+		}{snap.TakenAt, query, explain(snap, query)}
+	})
+	mux.HandleFunc("GET /api/v1/explain", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("missing query parameter q: a record name, container name or container id"))
+			return
+		}
+		explainHandler(w, r)
+	})
+}
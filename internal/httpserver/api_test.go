@@ -0,0 +1,232 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func apiIntent(name, value, container string) *domain.RecordIntent {
+	rec, _ := domain.NewA(name, value)
+	return &domain.RecordIntent{ContainerId: container + "-id", ContainerName: container, Hostname: "host-1", Record: rec}
+}
+
+func testSnapshot() domain.Snapshot {
+	kept := apiIntent("web.example.com", "10.0.0.1", "web")
+	stale := apiIntent("old.example.com", "10.0.0.9", "old")
+	stale.Wire = domain.WireInfo{Schema: domain.RecordSchema}
+	return domain.Snapshot{
+		TakenAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		DryRun:  true,
+		Containers: []domain.TrackedContainer{
+			{Id: "web-id", Name: "web", Status: domain.StatusRunning, Intents: []*domain.RecordIntent{kept}},
+		},
+		Dropped: []domain.DroppedIntent{{Intent: apiIntent("web.example.com", "10.0.0.1", "late"), Reason: "duplicate"}},
+		Decisions: []domain.Decision{
+			{Stage: domain.StageLabels, ContainerId: "off-id", ContainerName: "off", Record: domain.Record{Kind: domain.RecordA, Name: "off.example.com"}, Code: domain.DecisionNotEnabled, Reason: "not enabled"},
+			{Stage: domain.StageFilter, ContainerId: "late-id", ContainerName: "late", Record: kept.Record, Code: domain.DecisionDuplicate, Reason: "duplicate", Against: kept},
+		},
+		Clusters: []domain.ClusterSnapshot{
+			{Cluster: "default", ListedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Records: []*domain.RecordIntent{stale}, ToAdd: []*domain.RecordIntent{kept}, ToRemove: []*domain.RecordIntent{stale}, Decisions: []domain.Decision{
+				{Stage: domain.StageReconcile, Cluster: "default", ContainerId: "web-id", ContainerName: "web", Record: kept.Record, Code: domain.DecisionAdded, Reason: "added to the registry"},
+			}},
+			{Cluster: "dr", Err: errors.New("etcd unavailable")},
+		},
+	}
+}
+
+func getJSON(t *testing.T, url string, into any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from %s, got %d", url, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response, got %q", ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+}
+
+func TestHandler_API_Containers(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	var got struct {
+		TakenAt    time.Time `json:"taken_at"`
+		Containers []struct {
+			Id      string       `json:"id"`
+			Status  string       `json:"status"`
+			Records []recordJSON `json:"records"`
+		} `json:"containers"`
+	}
+	getJSON(t, srv.URL+"/api/v1/containers", &got)
+
+	if got.TakenAt.IsZero() || len(got.Containers) != 1 {
+		t.Fatalf("unexpected response %+v", got)
+	}
+	c := got.Containers[0]
+	if c.Id != "web-id" || c.Status != "running" || len(c.Records) != 1 || c.Records[0].Name != "web.example.com" || c.Records[0].Type != "A" {
+		t.Errorf("unexpected container %+v", c)
+	}
+}
+
+func TestHandler_API_Records(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	var got struct {
+		Clusters []clusterRecordsJSON `json:"clusters"`
+	}
+	getJSON(t, srv.URL+"/api/v1/records", &got)
+
+	if len(got.Clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", got)
+	}
+	if cs := got.Clusters[0]; len(cs.Records) != 1 || cs.Records[0].Schema != domain.RecordSchema || cs.ListedAt.IsZero() {
+		t.Errorf("unexpected records %+v", cs)
+	}
+	if cs := got.Clusters[1]; cs.Err != "etcd unavailable" || cs.Records == nil {
+		t.Errorf("expected the error and an empty list for an unlisted cluster, got %+v", cs)
+	}
+}
+
+func TestHandler_API_Plan(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	var got struct {
+		DryRun   bool              `json:"dry_run"`
+		Dropped  []droppedJSON     `json:"dropped"`
+		Clusters []clusterPlanJSON `json:"clusters"`
+	}
+	getJSON(t, srv.URL+"/api/v1/plan", &got)
+
+	if !got.DryRun || len(got.Dropped) != 1 || got.Dropped[0].Reason != "duplicate" || got.Dropped[0].Record.ContainerName != "late" {
+		t.Errorf("unexpected plan %+v", got)
+	}
+	if len(got.Clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(got.Clusters))
+	}
+	if cs := got.Clusters[0]; len(cs.ToAdd) != 1 || cs.ToAdd[0].Name != "web.example.com" || len(cs.ToRemove) != 1 || cs.ToRemove[0].Name != "old.example.com" {
+		t.Errorf("unexpected cluster plan %+v", cs)
+	}
+}
+
+func TestHandler_API_BeforeFirstPass(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(func() domain.Snapshot { return domain.Snapshot{} })))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/plan")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before the first pass, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_API_ReadOnly(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/v1/plan", "application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_API_Explain(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Web.Example.com.", []string{"duplicate", "added"}},
+		{"late", []string{"duplicate"}},
+		{"off-", []string{"not_enabled"}},
+		{"nothing.example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got struct {
+				Query     string         `json:"query"`
+				Decisions []decisionJSON `json:"decisions"`
+			}
+			getJSON(t, srv.URL+"/api/v1/explain?q="+url.QueryEscape(tt.query), &got)
+
+			if got.Query != tt.query || got.Decisions == nil || len(got.Decisions) != len(tt.want) {
+				t.Fatalf("unexpected response %+v", got)
+			}
+			for i, code := range tt.want {
+				if got.Decisions[i].Code != code {
+					t.Errorf("decision %d: expected %s, got %+v", i, code, got.Decisions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_API_ExplainFields(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	var got struct {
+		Decisions []decisionJSON `json:"decisions"`
+	}
+	getJSON(t, srv.URL+"/api/v1/explain?q=web.example.com", &got)
+
+	lost, added := got.Decisions[0], got.Decisions[1]
+	if lost.Stage != "filter" || lost.Published || lost.Against == nil || lost.Against.ContainerName != "web" {
+		t.Errorf("unexpected filter decision %+v", lost)
+	}
+	if added.Stage != "reconcile" || added.Cluster != "default" || !added.Published || added.Type != "A" || added.Value != "10.0.0.1" {
+		t.Errorf("unexpected reconcile decision %+v", added)
+	}
+}
+
+func TestHandler_API_ExplainNeedsQuery(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithSnapshot(testSnapshot)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/explain")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without a query, got %d", resp.StatusCode)
+	}
+}
+
+func TestToRecordsJSON_Sorted(t *testing.T) {
+	got := toRecordsJSON([]*domain.RecordIntent{
+		apiIntent("b.example.com", "10.0.0.1", "b"),
+		apiIntent("a.example.com", "10.0.0.2", "a"),
+		apiIntent("a.example.com", "10.0.0.1", "a"),
+	})
+	if got[0].Name != "a.example.com" || got[0].Value != "10.0.0.1" || got[1].Value != "10.0.0.2" || got[2].Name != "b.example.com" {
+		t.Errorf("expected records sorted by name and value, got %+v", got)
+	}
+	if empty := toRecordsJSON(nil); empty == nil {
+		t.Error("expected an empty list, not null")
+	}
+}
@@ -0,0 +1,105 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RouteGroup is a set of routes sharing an authentication policy.
+type RouteGroup string
+
+const (
+	// RouteProbes covers /healthz and /readyz.
+	RouteProbes RouteGroup = "probes"
+	// RouteMetrics covers /metrics.
+	RouteMetrics RouteGroup = "metrics"
+	// RouteAPI covers /fleet, the /api/v1 routes and any unknown path.
+	RouteAPI RouteGroup = "api"
+	// RouteAdmin covers the /admin routes and /override-breaker.
+	RouteAdmin RouteGroup = "admin"
+)
+
+// Policy says whether the routes of a group require authentication.
+type Policy string
+
+const (
+	PolicyOpen Policy = "open"
+	PolicyAuth Policy = "auth"
+)
+
+// Auth holds the credentials the server accepts and which routes require
+// them. A request is authenticated by any one of: a bearer token equal to
+// Token, basic auth matching Username and Password, or — with ClientCerts — a
+// TLS client certificate the server verified against its client CAs.
+type Auth struct {
+	Token    string
+	Username string
+	Password string
+	// ClientCerts accepts a verified client certificate as authentication.
+	ClientCerts bool
+	// Policies maps each route group to its policy. A group without one
+	// requires authentication.
+	Policies map[RouteGroup]Policy
+}
+
+// Enabled reports whether any credential is configured. Without one, Handler
+// does not enforce the policies.
+func (a Auth) Enabled() bool {
+	return a.Token != "" || a.Username != "" || a.ClientCerts
+}
+
+// routeGroup returns the group of the route serving path.
+func routeGroup(path string) RouteGroup {
+	switch {
+	case path == "/healthz" || path == "/readyz":
+		return RouteProbes
+	case path == "/metrics":
+		return RouteMetrics
+	case path == "/override-breaker" || path == "/admin" || strings.HasPrefix(path, "/admin/"):
+		return RouteAdmin
+	}
+	return RouteAPI
+}
+
+// authenticated reports whether r carries one of the accepted credentials.
+func (a Auth) authenticated(r *http.Request) bool {
+	if a.ClientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if a.Token != "" && equal(r.Header.Get("Authorization"), "Bearer "+a.Token) {
+		return true
+	}
+	if a.Username != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			// Evaluate both so the timing does not reveal which one differs.
+			userOK, passOK := equal(user, a.Username), equal(pass, a.Password)
+			return userOK && passOK
+		}
+	}
+	return false
+}
+
+// equal compares two secrets in constant time.
+func equal(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// protect serves next to requests that satisfy the policy of their route's
+// group, and answers 401 to the others.
+func (a Auth) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Policies[routeGroup(r.URL.Path)] == PolicyOpen || a.authenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.Token != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="docker-coredns-sync"`)
+		}
+		if a.Username != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="docker-coredns-sync"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("missing or invalid credentials"))
+	})
+}
@@ -0,0 +1,189 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1, usable by
+// servers and clients, and a pool trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// get requests url with client, applying auth to the request if set.
+func get(t *testing.T, client *http.Client, url string, auth func(*http.Request)) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if auth != nil {
+		auth(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func bearer(token string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func basic(user, pass string) func(*http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth(user, pass) }
+}
+
+func TestRouteGroup(t *testing.T) {
+	tests := map[string]RouteGroup{
+		"/healthz":           RouteProbes,
+		"/readyz":            RouteProbes,
+		"/metrics":           RouteMetrics,
+		"/fleet":             RouteAPI,
+		"/api/v1/records":    RouteAPI,
+		"/admin/pause":       RouteAdmin,
+		"/override-breaker":  RouteAdmin,
+		"/healthz/../admin":  RouteAPI,
+		"/administrator":     RouteAPI,
+		"/unknown":           RouteAPI,
+		"/readyz/extra-path": RouteAPI,
+	}
+	for path, want := range tests {
+		if got := routeGroup(path); got != want {
+			t.Errorf("routeGroup(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestHandler_Auth_Policies(t *testing.T) {
+	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	auth := Auth{
+		Token:    "s3cret",
+		Username: "ops",
+		Password: "hunter2",
+		Policies: map[RouteGroup]Policy{RouteProbes: PolicyOpen, RouteMetrics: PolicyOpen, RouteAPI: PolicyAuth},
+	}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), metricsHandler, WithAuth(auth)))
+	defer srv.Close()
+	client := srv.Client()
+
+	for _, path := range []string{"/healthz", "/metrics"} {
+		if code := get(t, client, srv.URL+path, nil); code == http.StatusUnauthorized {
+			t.Errorf("expected %s to stay open, got %d", path, code)
+		}
+	}
+	for name, tc := range map[string]struct {
+		auth func(*http.Request)
+		want int
+	}{
+		"no credentials": {nil, http.StatusUnauthorized},
+		"wrong token":    {bearer("wrong"), http.StatusUnauthorized},
+		"wrong password": {basic("ops", "wrong"), http.StatusUnauthorized},
+		"wrong user":     {basic("root", "hunter2"), http.StatusUnauthorized},
+		"token":          {bearer("s3cret"), http.StatusNotFound},
+		"basic":          {basic("ops", "hunter2"), http.StatusNotFound},
+	} {
+		// /api/v1 is not served, so an authenticated request gets 404.
+		if code := get(t, client, srv.URL+"/api/v1/records", tc.auth); code != tc.want {
+			t.Errorf("%s: expected %d, got %d", name, tc.want, code)
+		}
+	}
+	// A group without a policy requires authentication.
+	if code := get(t, client, srv.URL+"/admin/pause", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected the admin group to default to auth, got %d", code)
+	}
+}
+
+func TestHandler_Auth_Challenge(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAuth(Auth{Token: "s3cret", Username: "ops", Password: "hunter2"})))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got := resp.Header.Values("WWW-Authenticate"); resp.StatusCode != http.StatusUnauthorized || len(got) != 2 {
+		t.Errorf("expected 401 with a bearer and a basic challenge, got %d %v", resp.StatusCode, got)
+	}
+}
+
+func TestHandler_Auth_DisabledWithoutCredentials(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithAuth(Auth{Policies: map[RouteGroup]Policy{RouteProbes: PolicyAuth}})))
+	defer srv.Close()
+
+	if code := get(t, srv.Client(), srv.URL+"/healthz", nil); code != http.StatusOK {
+		t.Errorf("expected policies not to apply without credentials, got %d", code)
+	}
+}
+
+func TestNewServer_TLSClientCerts(t *testing.T) {
+	cert, pool := testCertificate(t)
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	auth := Auth{Token: "s3cret", ClientCerts: true, Policies: map[RouteGroup]Policy{RouteProbes: PolicyOpen}}
+	srv, err := NewServer(freeAddr(t), NewStatus(time.Minute), nil, zerolog.Nop(), WithTLS(tlsCfg), WithAuth(auth))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.Close()
+	srv.Start(t.Context())
+	base := "https://" + srv.listener.Addr().String()
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}}}
+
+	if code := get(t, anonymous, base+"/healthz", nil); code != http.StatusOK {
+		t.Errorf("expected the open probe over TLS without a client cert, got %d", code)
+	}
+	if code := get(t, anonymous, base+"/api/v1/records", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a client cert, got %d", code)
+	}
+	if code := get(t, anonymous, base+"/api/v1/records", bearer("s3cret")); code != http.StatusNotFound {
+		t.Errorf("expected the token to authenticate over TLS, got %d", code)
+	}
+	if code := get(t, withCert, base+"/api/v1/records", nil); code != http.StatusNotFound {
+		t.Errorf("expected the verified client cert to authenticate, got %d", code)
+	}
+}
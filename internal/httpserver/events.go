@@ -0,0 +1,299 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// keepAliveInterval is how often an idle event stream sends a comment, so
+// proxies do not close it.
+const keepAliveInterval = 15 * time.Second
+
+// changeTypes are the event names a client may filter on with ?types=.
+var changeTypes = map[domain.ChangeType]bool{
+	domain.ChangeContainer:  true,
+	domain.ChangeRegistered: true,
+	domain.ChangeRemoved:    true,
+	domain.ChangeConflict:   true,
+	domain.ChangeGC:         true,
+}
+
+type changeJSON struct {
+	Type          string       `json:"type"`
+	Time          time.Time    `json:"time"`
+	Cluster       string       `json:"cluster,omitempty"`
+	ContainerId   string       `json:"container_id,omitempty"`
+	ContainerName string       `json:"container_name,omitempty"`
+	Event         string       `json:"event,omitempty"`
+	Records       []recordJSON `json:"records,omitzero"`
+	Record        *recordJSON  `json:"record,omitempty"`
+	Reason        string       `json:"reason,omitempty"`
+	Detail        string       `json:"detail,omitempty"`
+	Against       *recordJSON  `json:"against,omitempty"`
+	Hosts         []string     `json:"hosts,omitempty"`
+	Removed       int          `json:"removed,omitempty"`
+}
+
+func toChangeJSON(c domain.Change) changeJSON {
+	out := changeJSON{
+		Type:          string(c.Type),
+		Time:          c.Time,
+		Cluster:       c.Cluster,
+		ContainerId:   c.ContainerId,
+		ContainerName: c.ContainerName,
+		Event:         string(c.Event),
+		Reason:        c.Reason,
+		Detail:        c.Detail,
+		Hosts:         c.Hosts,
+		Removed:       c.Removed,
+	}
+	// A container event always lists its records, even none, so a client can
+	// tell a container that asks for nothing from another kind of change.
+	if c.Type == domain.ChangeContainer {
+		out.Records = toRecordsJSON(c.Records)
+	}
+	if c.Record != nil {
+		r := toRecordJSON(c.Record)
+		out.Record = &r
+	}
+	if c.Against != nil {
+		r := toRecordJSON(c.Against)
+		out.Against = &r
+	}
+	return out
+}
+
+// streamEvent is one change, rendered once for every client, or the notice
+// of events dropped for one client.
+type streamEvent struct {
+	id   uint64
+	typ  domain.ChangeType
+	data []byte
+	// drops is set on a drop notice instead of the change.
+	drops *dropNotice
+}
+
+// dropNotice stands in a client's queue for the events dropped there, so the
+// client is told of them between the events it got before and after them.
+// n is guarded by EventStream.mu.
+type dropNotice struct {
+	n uint64
+}
+
+// eventClient is one connection to GET /api/v1/events.
+type eventClient struct {
+	// events holds one more event than the client buffer, which only a drop
+	// notice may take.
+	events chan streamEvent
+	// types are the change types the client asked for; nil for all.
+	types map[domain.ChangeType]bool
+	// notice is the drop notice last queued while no event has been queued
+	// behind it, and counts further drops. Guarded by EventStream.mu.
+	notice *dropNotice
+}
+
+// EventStreamOption configures an EventStream.
+type EventStreamOption func(*EventStream)
+
+// WithClientBuffer sets how many events each client may fall behind by before
+// further events are dropped for it. Values below 1 are ignored.
+func WithClientBuffer(n int) EventStreamOption {
+	return func(s *EventStream) {
+		if n > 0 {
+			s.buffer = n
+		}
+	}
+}
+
+// WithDropObserver registers fn, called once for every event dropped for a
+// slow client, e.g. to count drops in metrics. It must not block.
+func WithDropObserver(fn func()) EventStreamOption {
+	return func(s *EventStream) { s.onDrop = fn }
+}
+
+// EventStream fans the changes the engine publishes out to the clients of
+// GET /api/v1/events, as Server-Sent Events. Each client has its own bounded
+// buffer: when a slow client's buffer is full, events are dropped for that
+// client alone and a "dropped" event takes the place of the first of them,
+// telling the client how many it missed, so Publish never blocks the engine.
+type EventStream struct {
+	buffer int
+	onDrop func()
+
+	mu      sync.Mutex
+	clients map[*eventClient]struct{}
+	nextID  uint64
+	done    chan struct{}
+	closed  bool
+}
+
+// NewEventStream returns an EventStream with a client buffer of 256 events
+// unless opts say otherwise.
+func NewEventStream(opts ...EventStreamOption) *EventStream {
+	s := &EventStream{
+		buffer:  256,
+		clients: make(map[*eventClient]struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Publish sends c to every client that asked for its type. It never blocks.
+func (s *EventStream) Publish(c domain.Change) {
+	data, err := json.Marshal(toChangeJSON(c))
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.nextID++
+	evt := streamEvent{id: s.nextID, typ: c.Type, data: data}
+	for client := range s.clients {
+		if client.types != nil && !client.types[c.Type] {
+			continue
+		}
+		// Only Publish sends, under s.mu, so the length can only shrink.
+		if len(client.events) < s.buffer {
+			client.events <- evt
+			client.notice = nil
+			continue
+		}
+		if client.notice == nil {
+			// The slot kept for it is free: the queue holds a notice beyond
+			// the buffer only while it is the last in the queue.
+			client.notice = &dropNotice{}
+			client.events <- streamEvent{drops: client.notice}
+		}
+		client.notice.n++
+		if s.onDrop != nil {
+			s.onDrop()
+		}
+	}
+}
+
+// closeNotice returns how many events notice stands for, as it is sent to
+// client. Events dropped from then on get a notice of their own.
+func (s *EventStream) closeNotice(client *eventClient, notice *dropNotice) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client.notice == notice {
+		client.notice = nil
+	}
+	return notice.n
+}
+
+// Close ends every stream and turns away new clients. It is safe to call more
+// than once.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// Clients returns the number of connected clients.
+func (s *EventStream) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+func (s *EventStream) subscribe(types map[domain.ChangeType]bool) (*eventClient, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	client := &eventClient{events: make(chan streamEvent, s.buffer+1), types: types}
+	s.clients[client] = struct{}{}
+	return client, true
+}
+
+func (s *EventStream) unsubscribe(client *eventClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, client)
+}
+
+// parseChangeTypes parses the comma-separated ?types= filter; an empty one
+// selects every type.
+func parseChangeTypes(raw string) (map[domain.ChangeType]bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	types := make(map[domain.ChangeType]bool)
+	for _, t := range strings.Split(raw, ",") {
+		typ := domain.ChangeType(strings.TrimSpace(t))
+		if !changeTypes[typ] {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+		types[typ] = true
+	}
+	return types, nil
+}
+
+// ServeHTTP streams events to the client until it disconnects or the stream
+// is closed.
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	types, err := parseChangeTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	client, ok := s.subscribe(types)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("shutting down"))
+		return
+	}
+	defer s.unsubscribe(client)
+
+	// The stream outlives the server's write timeout by design.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case evt := <-client.events:
+			if evt.drops != nil {
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", s.closeNotice(client, evt.drops))
+			} else {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.id, evt.typ, evt.data)
+			}
+		}
+		if err != nil || rc.Flush() != nil {
+			return
+		}
+	}
+}
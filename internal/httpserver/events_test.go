@@ -0,0 +1,234 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+)
+
+// sseEvent is one event read from a stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// connect opens url as an event stream and waits until the stream has
+// registered the client.
+func connect(t *testing.T, s *EventStream, url string) (*bufio.Reader, func()) {
+	t.Helper()
+	want := s.Clients() + 1
+	req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+	if line, _ := r.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("expected the connected comment, got %q", line)
+	}
+	for s.Clients() < want {
+		time.Sleep(time.Millisecond)
+	}
+	return r, func() { _ = resp.Body.Close() }
+}
+
+// next reads the next event from r, skipping comments.
+func next(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var evt sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && evt.event != "":
+			return evt
+		case strings.HasPrefix(line, "id: "):
+			evt.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			evt.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			evt.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func registered(name string) domain.Change {
+	return domain.Change{
+		Type:    domain.ChangeRegistered,
+		Time:    time.Now(),
+		Cluster: "default",
+		Record:  &domain.RecordIntent{Record: domain.Record{Name: name, Kind: domain.RecordA, Value: "10.0.0.1"}, Hostname: "host-a"},
+	}
+}
+
+func TestEventStream_StreamsChanges(t *testing.T) {
+	stream := NewEventStream()
+	srv := httptest.NewServer(Handler(nil, nil, WithEvents(stream)))
+	defer srv.Close()
+	all, closeAll := connect(t, stream, srv.URL+"/api/v1/events")
+	defer closeAll()
+	gcOnly, closeGC := connect(t, stream, srv.URL+"/api/v1/events?types=gc")
+	defer closeGC()
+
+	stream.Publish(registered("app.example.com"))
+	stream.Publish(domain.Change{Type: domain.ChangeGC, Cluster: "default", Hosts: []string{"dead-host"}, Removed: 2})
+	stream.Publish(domain.Change{Type: domain.ChangeContainer, ContainerId: "c1", Event: domain.EventTypeContainerDied})
+
+	evt := next(t, all)
+	var got changeJSON
+	if err := json.Unmarshal([]byte(evt.data), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt.id != "1" || evt.event != "record_registered" || got.Record == nil || got.Record.Name != "app.example.com" || got.Cluster != "default" {
+		t.Errorf("unexpected first event %+v", evt)
+	}
+	if evt := next(t, all); evt.id != "2" || evt.event != "gc" || !strings.Contains(evt.data, `"hosts":["dead-host"]`) {
+		t.Errorf("unexpected second event %+v", evt)
+	}
+	if evt := next(t, all); evt.event != "container" || !strings.Contains(evt.data, `"records":[]`) {
+		t.Errorf("expected a container event listing no records, got %+v", evt)
+	}
+	if evt := next(t, gcOnly); evt.id != "2" || evt.event != "gc" {
+		t.Errorf("expected the filtered client to get only the gc event, got %+v", evt)
+	}
+}
+
+func TestEventStream_UnknownType(t *testing.T) {
+	srv := httptest.NewServer(Handler(nil, nil, WithEvents(NewEventStream())))
+	defer srv.Close()
+
+	if code := get(t, srv.Client(), srv.URL+"/api/v1/events?types=gc,bogus", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown type, got %d", code)
+	}
+}
+
+func TestEventStream_PublishDropsForSlowClient(t *testing.T) {
+	var drops int
+	stream := NewEventStream(WithClientBuffer(1), WithDropObserver(func() { drops++ }))
+	slow, _ := stream.subscribe(nil)
+	filtered, _ := stream.subscribe(map[domain.ChangeType]bool{domain.ChangeGC: true})
+
+	// Publish must return although nobody reads.
+	for i := 0; i < 3; i++ {
+		stream.Publish(registered("app.example.com"))
+	}
+
+	if len(slow.events) != 2 || slow.notice == nil || slow.notice.n != 2 || drops != 2 {
+		t.Errorf("expected an event and a notice of 2 drops queued, and 2 drops observed, got %d queued and %d observed", len(slow.events), drops)
+	}
+	if filtered.notice != nil || len(filtered.events) != 0 {
+		t.Errorf("expected nothing queued or dropped for a client filtering the type out, got %d queued", len(filtered.events))
+	}
+}
+
+func TestEventStream_QueuesDropNoticeWhereEventsWereLost(t *testing.T) {
+	stream := NewEventStream(WithClientBuffer(2))
+	client, _ := stream.subscribe(nil)
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			stream.Publish(registered("app.example.com"))
+		}
+	}
+	// receive takes the next queued event as the writer does, and returns
+	// its id, or the number of drops for a notice.
+	receive := func() string {
+		evt := <-client.events
+		if evt.drops != nil {
+			return fmt.Sprintf("dropped %d", stream.closeNotice(client, evt.drops))
+		}
+		return fmt.Sprintf("%d", evt.id)
+	}
+
+	publish(4) // 1 and 2 are queued, 3 and 4 dropped
+	for _, want := range []string{"1", "2"} {
+		if got := receive(); got != want {
+			t.Fatalf("expected event %s, got %s", want, got)
+		}
+	}
+	publish(2) // 5 is queued behind the notice, 6 dropped behind 5
+	var got []string
+	for len(client.events) > 0 {
+		got = append(got, receive())
+	}
+	want := []string{"dropped 2", "5", "dropped 1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestEventStream_ReportsDroppedEvents(t *testing.T) {
+	stream := NewEventStream()
+	srv := httptest.NewServer(Handler(nil, nil, WithEvents(stream)))
+	defer srv.Close()
+	r, closeStream := connect(t, stream, srv.URL+"/api/v1/events")
+	defer closeStream()
+
+	stream.mu.Lock()
+	for client := range stream.clients {
+		client.notice = &dropNotice{n: 5}
+		client.events <- streamEvent{drops: client.notice}
+	}
+	stream.mu.Unlock()
+
+	// The notice is sent without waiting for a later event.
+	if evt := next(t, r); evt.event != "dropped" || evt.data != `{"dropped":5}` {
+		t.Errorf("expected the drops reported, got %+v", evt)
+	}
+	stream.Publish(registered("app.example.com"))
+	if evt := next(t, r); evt.event != "record_registered" {
+		t.Errorf("expected the delivered event next, got %+v", evt)
+	}
+}
+
+func TestEventStream_Close(t *testing.T) {
+	stream := NewEventStream()
+	srv := httptest.NewServer(Handler(nil, nil, WithEvents(stream)))
+	defer srv.Close()
+	r, closeStream := connect(t, stream, srv.URL+"/api/v1/events")
+	defer closeStream()
+
+	stream.Close()
+	stream.Close()
+
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("expected the stream to end cleanly, got %v", err)
+	}
+	if code := get(t, srv.Client(), srv.URL+"/api/v1/events", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once closed, got %d", code)
+	}
+}
+
+func TestNewServer_ShutdownEndsEventStreams(t *testing.T) {
+	stream := NewEventStream()
+	srv, err := NewServer(freeAddr(t), nil, nil, zerolog.Nop(), WithEvents(stream))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(t.Context())
+	srv.Start(ctx)
+	r, closeStream := connect(t, stream, "http://"+srv.listener.Addr().String()+"/api/v1/events")
+	defer closeStream()
+
+	start := time.Now()
+	cancel()
+	_, _ = io.ReadAll(r)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected shutdown to end the stream promptly, took %v", elapsed)
+	}
+}
@@ -2,25 +2,117 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/rs/zerolog"
 )
 
+// HandlerOption enables an optional route or behaviour of Handler and
+// NewServer.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	fleet           func(ctx context.Context) []domain.ClusterFleet
+	overrideBreaker func() bool
+	snapshot        func() domain.Snapshot
+	admin           Admin
+	events          *EventStream
+	auth            Auth
+	tls             *tls.Config
+}
+
+// WithFleet serves GET /fleet from fleet, which lists the sync instances
+// heartbeating in each registry cluster.
+func WithFleet(fleet func(ctx context.Context) []domain.ClusterFleet) HandlerOption {
+	return func(o *handlerOptions) { o.fleet = fleet }
+}
+
+// WithBreakerOverride serves POST /override-breaker from override, which lets
+// the removals blocked by a tripped removal breaker proceed and reports
+// whether any breaker was tripped.
+func WithBreakerOverride(override func() bool) HandlerOption {
+	return func(o *handlerOptions) { o.overrideBreaker = override }
+}
+
+// WithSnapshot serves the read-only /api/v1 routes from snapshot, which
+// returns the engine's view of the desired and actual state as of its latest
+// reconciliation pass.
+func WithSnapshot(snapshot func() domain.Snapshot) HandlerOption {
+	return func(o *handlerOptions) { o.snapshot = snapshot }
+}
+
+// WithAdmin serves the /admin routes from admin. They are only protected
+// together with WithAuth.
+func WithAdmin(admin Admin) HandlerOption {
+	return func(o *handlerOptions) { o.admin = admin }
+}
+
+// WithEvents serves GET /api/v1/events from events, a Server-Sent Events
+// stream of the engine's changes. NewServer closes it when shutting down.
+func WithEvents(events *EventStream) HandlerOption {
+	return func(o *handlerOptions) { o.events = events }
+}
+
+// WithAuth requires the routes of each group whose policy is not open to be
+// authenticated as auth describes. It has no effect unless auth.Enabled().
+func WithAuth(auth Auth) HandlerOption {
+	return func(o *handlerOptions) { o.auth = auth }
+}
+
+// WithTLS makes NewServer serve over TLS with cfg, which also sets whether
+// client certificates are requested and how they are verified. Handler
+// ignores it.
+func WithTLS(cfg *tls.Config) HandlerOption {
+	return func(o *handlerOptions) { o.tls = cfg }
+}
+
 // Handler returns the HTTP handler for the auxiliary server. The registered
 // routes depend on which features are enabled:
 //   - When status is non-nil:
 //   - GET /healthz — liveness; always 200 while the process is running.
 //   - GET /readyz  — readiness; 200 when Status.Ready(), else 503 with reason.
+//     With more than one registry cluster, one line per cluster follows. The
+//     GC leader of each cluster is shown once known.
 //   - When metricsHandler is non-nil:
 //   - GET /metrics — Prometheus exposition.
+//   - With WithFleet:
+//   - GET /fleet   — JSON list of every heartbeating sync instance, per cluster.
+//   - With WithBreakerOverride:
+//   - POST /override-breaker — let blocked removals proceed on the next pass;
+//     409 when no removal breaker is tripped.
+//   - With WithSnapshot (JSON, as of the latest pass; 503 before the first):
+//   - GET /api/v1/containers — tracked containers and their record intents.
+//   - GET /api/v1/records    — each cluster's records, as last listed.
+//   - GET /api/v1/plan       — each cluster's planned additions and removals,
+//     and the desired intents dropped as conflicting, with the reason.
+//   - GET /api/v1/explain?q= — the decisions about a record name or container.
+//   - With WithEvents:
+//   - GET /api/v1/events — Server-Sent Events stream of container events,
+//     record registrations and removals, conflicts and GC actions;
+//     ?types= filters by comma-separated event type.
+//   - With WithAdmin:
+//   - POST /admin/reconcile — run a pass now; JSON outcome, 500 if it failed.
+//   - POST /admin/pause, POST /admin/resume — stop or restart writing
+//     records; 409 when already in that state.
+//   - POST /admin/override-breaker — as /override-breaker, with
+//     WithBreakerOverride too.
+//
+// With WithAuth, a request to a route whose group is not open gets 401 unless
+// it is authenticated.
 //
 // Either argument may be nil; at least one is expected to be set by the caller.
-func Handler(status *Status, metricsHandler http.Handler) http.Handler {
+func Handler(status *Status, metricsHandler http.Handler, opts ...HandlerOption) http.Handler {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	mux := http.NewServeMux()
 	if status != nil {
 		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -31,19 +123,90 @@ func Handler(status *Status, metricsHandler http.Handler) http.Handler {
 			ready, reason := status.Ready()
 			if !ready {
 				w.WriteHeader(http.StatusServiceUnavailable)
-				_, _ = w.Write([]byte(reason))
-				return
+			} else {
+				w.WriteHeader(http.StatusOK)
+				reason = "ok"
+			}
+			_, _ = w.Write([]byte(reason))
+			// With several clusters, append each one's health so a partial
+			// failure is visible at a glance.
+			clusters := status.Clusters()
+			if len(clusters) > 1 {
+				for _, cs := range clusters {
+					_, _ = w.Write([]byte("\n" + formatClusterStatus(cs)))
+				}
+			} else if len(clusters) == 1 && clusters[0].GCLeader != "" {
+				_, _ = w.Write([]byte("\n" + formatGCLeader(clusters[0])))
 			}
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("ok"))
 		})
 	}
 	if metricsHandler != nil {
 		mux.Handle("/metrics", metricsHandler)
 	}
+	if o.fleet != nil {
+		mux.HandleFunc("/fleet", func(w http.ResponseWriter, r *http.Request) {
+			// A cluster that cannot be read is reported in its entry, so the
+			// rest of the fleet is still shown.
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(o.fleet(r.Context()))
+		})
+	}
+	if o.snapshot != nil {
+		registerAPI(mux, o.snapshot)
+	}
+	if o.events != nil {
+		mux.Handle("GET /api/v1/events", o.events)
+	}
+	var overrideBreaker http.HandlerFunc
+	if o.overrideBreaker != nil {
+		overrideBreaker = func(w http.ResponseWriter, r *http.Request) {
+			if !o.overrideBreaker() {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte("no removal breaker is tripped"))
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("breaker overridden; blocked removals are applied on the next pass"))
+		}
+		mux.HandleFunc("POST /override-breaker", overrideBreaker)
+	}
+	if o.admin != nil {
+		registerAdmin(mux, o.admin, overrideBreaker)
+	}
+	if o.auth.Enabled() {
+		return o.auth.protect(mux)
+	}
 	return mux
 }
 
+// formatClusterStatus renders one cluster's health as a single readyz line.
+func formatClusterStatus(cs ClusterStatus) string {
+	var line string
+	switch {
+	case cs.LastErr != nil:
+		line = fmt.Sprintf("cluster %s: last reconciliation failed: %v", cs.Name, cs.LastErr)
+	case cs.LastSuccess.IsZero():
+		line = fmt.Sprintf("cluster %s: no successful reconciliation yet", cs.Name)
+	default:
+		line = fmt.Sprintf("cluster %s: ok", cs.Name)
+	}
+	if cs.GCLeader != "" {
+		line += "; " + formatGCLeader(cs)
+	}
+	if cs.Breaker != "" {
+		line += "; " + cs.Breaker
+	}
+	return line
+}
+
+// formatGCLeader renders a cluster's GC leader.
+func formatGCLeader(cs ClusterStatus) string {
+	if cs.IsGCLeader {
+		return fmt.Sprintf("gc leader: %s (this host)", cs.GCLeader)
+	}
+	return "gc leader: " + cs.GCLeader
+}
+
 // Server is the auxiliary HTTP server exposing the health and metrics endpoints.
 type Server struct {
 	srv      *http.Server
@@ -53,23 +216,35 @@ type Server struct {
 
 // NewServer binds the auxiliary HTTP server to addr. Binding happens
 // synchronously so a bad or in-use address fails fast at startup rather than
-// silently leaving the endpoints unavailable. status and metricsHandler are
-// passed through to Handler; either may be nil.
-func NewServer(addr string, status *Status, metricsHandler http.Handler, logger zerolog.Logger) (*Server, error) {
+// silently leaving the endpoints unavailable. status, metricsHandler and opts
+// are passed through to Handler; either of the first two may be nil. With
+// WithTLS, connections are served over TLS. The write timeout does not apply
+// to the event stream.
+func NewServer(addr string, status *Status, metricsHandler http.Handler, logger zerolog.Logger, opts ...HandlerOption) (*Server, error) {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("bind HTTP server on %q: %w", addr, err)
 	}
-	return &Server{
-		srv: &http.Server{
-			Handler:           Handler(status, metricsHandler),
-			ReadHeaderTimeout: 5 * time.Second,
-			WriteTimeout:      10 * time.Second,
-			IdleTimeout:       60 * time.Second,
-		},
-		listener: ln,
-		logger:   logger,
-	}, nil
+	if o.tls != nil {
+		ln = tls.NewListener(ln, o.tls)
+	}
+	srv := &http.Server{
+		Handler:           Handler(status, metricsHandler, opts...),
+		TLSConfig:         o.tls,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	// Shutdown waits for active requests, which an open event stream never
+	// finishes on its own.
+	if o.events != nil {
+		srv.RegisterOnShutdown(o.events.Close)
+	}
+	return &Server{srv: srv, listener: ln, logger: logger}, nil
 }
 
 // Start serves requests in the background and shuts down gracefully when ctx is
@@ -84,7 +259,7 @@ func (s *Server) Start(ctx context.Context) {
 		}
 	}()
 	go func() {
-		s.logger.Info().Str("addr", s.listener.Addr().String()).Msg("Starting auxiliary HTTP server")
+		s.logger.Info().Str("addr", s.listener.Addr().String()).Bool("tls", s.srv.TLSConfig != nil).Msg("Starting auxiliary HTTP server")
 		if err := s.srv.Serve(s.listener); err != nil &&
 			!errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 			s.logger.Error().Err(err).Msg("HTTP server error")
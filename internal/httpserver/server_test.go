@@ -2,12 +2,17 @@ package httpserver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/rs/zerolog"
 )
 
@@ -189,3 +194,154 @@ func TestHandler_Readyz_200WhenReady(t *testing.T) {
 		t.Errorf("expected 200 from /readyz when ready, got %d", resp.StatusCode)
 	}
 }
+
+func TestHandler_Readyz_ListsClusters(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordClusterReconcile("site-b", errors.New("etcd unavailable"))
+	s.RecordClusterReconcile("site-a", nil)
+	s.RecordReconcile(errors.New("cluster site-b: etcd unavailable"))
+
+	srv := httptest.NewServer(Handler(s, nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 from /readyz on a partial cluster failure, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{"cluster site-a: ok", "cluster site-b: last reconciliation failed: etcd unavailable"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected /readyz body to contain %q, got %q", want, body)
+		}
+	}
+}
+
+func TestHandler_Readyz_ShowsGCLeader(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordClusterReconcile("default", nil)
+	s.RecordGCLeader("default", "host-a", true)
+	s.RecordReconcile(nil)
+
+	srv := httptest.NewServer(Handler(s, nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if want := "ok\ngc leader: host-a (this host)"; string(body) != want {
+		t.Errorf("expected /readyz body %q, got %q", want, body)
+	}
+}
+
+func TestHandler_Fleet(t *testing.T) {
+	fleet := func(ctx context.Context) []domain.ClusterFleet {
+		return []domain.ClusterFleet{
+			{Cluster: "default", Hosts: []domain.HostStatus{{Hostname: "host-1", Version: "v1.0.0", RecordsOwned: 3}}},
+			{Cluster: "dr", Hosts: []domain.HostStatus{}, Err: "etcd unavailable"},
+		}
+	}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithFleet(fleet)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/fleet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 from /fleet, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response, got %q", ct)
+	}
+	var got []domain.ClusterFleet
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got) != 2 || got[0].Hosts[0].Hostname != "host-1" || got[0].Hosts[0].RecordsOwned != 3 || got[1].Err != "etcd unavailable" {
+		t.Errorf("unexpected fleet %+v", got)
+	}
+}
+
+func TestHandler_Fleet_NotServedByDefault(t *testing.T) {
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/fleet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 from /fleet without WithFleet, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_OverrideBreaker(t *testing.T) {
+	tripped := true
+	var calls int
+	override := func() bool {
+		calls++
+		return tripped
+	}
+	srv := httptest.NewServer(Handler(NewStatus(time.Minute), nil, WithBreakerOverride(override)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/override-breaker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || calls != 0 {
+		t.Errorf("expected GET to be refused, got %d after %d calls", resp.StatusCode, calls)
+	}
+
+	for _, tc := range []struct {
+		tripped bool
+		want    int
+	}{{true, http.StatusAccepted}, {false, http.StatusConflict}} {
+		tripped = tc.tripped
+		resp, err := http.Post(srv.URL+"/override-breaker", "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("tripped=%t: expected %d, got %d", tc.tripped, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_Readyz_ListsBreakerPerCluster(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordClusterReconcile("site-a", nil)
+	s.RecordClusterReconcile("site-b", nil)
+	s.RecordBreaker("site-b", "removal breaker tripped: blocked removing 4 of other hosts' 5 records by GC")
+	s.RecordReconcile(nil)
+
+	srv := httptest.NewServer(Handler(s, nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while a breaker is tripped, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := "cluster site-b: ok; removal breaker tripped"; !strings.Contains(string(body), want) {
+		t.Errorf("expected /readyz body to contain %q, got %q", want, body)
+	}
+}
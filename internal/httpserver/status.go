@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -16,6 +17,8 @@ type Status struct {
 	lastReconcileErr     error
 	readyThreshold       time.Duration
 	dryRun               bool
+	paused               bool
+	clusters             map[string]*ClusterStatus
 
 	// now is overridable in tests.
 	now func() time.Time
@@ -45,6 +48,14 @@ func (s *Status) SetDryRun(dryRun bool) {
 	s.mu.Unlock()
 }
 
+// SetPaused records whether the sync engine is paused, in which it applies no
+// records and therefore does not report ready.
+func (s *Status) SetPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	s.mu.Unlock()
+}
+
 // RecordReconcile records the outcome of a reconciliation pass. A nil error
 // marks the pass as successful and refreshes the readiness timestamp.
 func (s *Status) RecordReconcile(err error) {
@@ -56,10 +67,83 @@ func (s *Status) RecordReconcile(err error) {
 	}
 }
 
+// ClusterStatus is the reconciliation health of one registry cluster.
+type ClusterStatus struct {
+	Name        string
+	LastSuccess time.Time
+	LastErr     error
+	// GCLeader is the host elected to garbage-collect orphaned records, as of
+	// the latest check, and IsGCLeader whether that is this host. Empty when
+	// the registry holds no election or none was checked yet.
+	GCLeader   string
+	IsGCLeader bool
+	// Breaker describes the removals the cluster's removal breaker is
+	// blocking, or is empty when it is not tripped.
+	Breaker string
+}
+
+// RecordClusterReconcile records the outcome of one cluster within a
+// reconciliation pass. The aggregate outcome is still reported through
+// RecordReconcile; this only feeds the per-cluster breakdown.
+func (s *Status) RecordClusterReconcile(cluster string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs := s.clusterLocked(cluster)
+	cs.LastErr = err
+	if err == nil {
+		cs.LastSuccess = s.now()
+	}
+}
+
+// RecordGCLeader records the GC leader of cluster.
+func (s *Status) RecordGCLeader(cluster, leader string, isLeader bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs := s.clusterLocked(cluster)
+	cs.GCLeader = leader
+	cs.IsGCLeader = isLeader
+}
+
+// RecordBreaker records the state of cluster's removal breaker. A non-empty
+// reason keeps the daemon not ready until the breaker is overridden or the
+// removals are no longer planned.
+func (s *Status) RecordBreaker(cluster, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusterLocked(cluster).Breaker = reason
+}
+
+// clusterLocked returns the status of cluster, creating it. s.mu must be held.
+func (s *Status) clusterLocked(cluster string) *ClusterStatus {
+	if s.clusters == nil {
+		s.clusters = make(map[string]*ClusterStatus)
+	}
+	cs, ok := s.clusters[cluster]
+	if !ok {
+		cs = &ClusterStatus{Name: cluster}
+		s.clusters[cluster] = cs
+	}
+	return cs
+}
+
+// Clusters returns a snapshot of the per-cluster health, sorted by name.
+func (s *Status) Clusters() []ClusterStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ClusterStatus, 0, len(s.clusters))
+	for _, cs := range s.clusters {
+		out = append(out, *cs)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
 // Ready reports whether the daemon is ready to serve, with a human-readable
-// reason when it is not. Readiness requires the Docker stream to be connected,
+// reason when it is not. Readiness requires the engine not to be paused, the
+// Docker stream to be connected,
 // the most recent reconciliation pass to have not failed, and a reconciliation
-// to have succeeded within the readiness threshold.
+// to have succeeded within the readiness threshold, and no removal breaker to
+// be tripped.
 func (s *Status) Ready() (bool, string) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -67,9 +151,15 @@ func (s *Status) Ready() (bool, string) {
 	if s.dryRun {
 		return false, "dry-run mode: records are not applied"
 	}
+	if s.paused {
+		return false, "paused: records are not applied until resumed"
+	}
 	if !s.dockerConnected {
 		return false, "docker event stream not connected"
 	}
+	if reason := s.breakerLocked(); reason != "" {
+		return false, reason
+	}
 	if s.lastReconcileErr != nil {
 		return false, "last reconciliation failed: " + s.lastReconcileErr.Error()
 	}
@@ -81,3 +171,23 @@ func (s *Status) Ready() (bool, string) {
 	}
 	return true, "ok"
 }
+
+// breakerLocked returns the reason of the first tripped removal breaker, by
+// cluster name, naming the cluster when there are several. s.mu must be held.
+func (s *Status) breakerLocked() string {
+	names := make([]string, 0, len(s.clusters))
+	for name, cs := range s.clusters {
+		if cs.Breaker != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	reason := s.clusters[names[0]].Breaker
+	if len(s.clusters) > 1 {
+		reason = "cluster " + names[0] + ": " + reason
+	}
+	return reason
+}
@@ -2,6 +2,7 @@ package httpserver
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 )
@@ -56,6 +57,21 @@ func TestStatus_Ready_DryRunNeverReady(t *testing.T) {
 	}
 }
 
+func TestStatus_Ready_PausedNotReady(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordReconcile(nil)
+	s.SetPaused(true)
+
+	if ready, reason := s.Ready(); ready || !strings.Contains(reason, "paused") {
+		t.Errorf("expected paused to be not ready, got ready=%v (reason=%q)", ready, reason)
+	}
+	s.SetPaused(false)
+	if ready, reason := s.Ready(); !ready {
+		t.Errorf("expected ready once resumed, got %q", reason)
+	}
+}
+
 func TestStatus_RecordReconcile_ErrorDoesNotRefresh(t *testing.T) {
 	s := NewStatus(time.Minute)
 	s.SetDockerConnected(true)
@@ -77,3 +93,69 @@ func TestStatus_Ready_FailedReconcileAfterSuccessIsNotReady(t *testing.T) {
 		t.Error("expected not ready immediately after a reconcile failure, even within the staleness window")
 	}
 }
+
+func TestStatus_Clusters_SortedSnapshot(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.RecordClusterReconcile("site-b", nil)
+	s.RecordClusterReconcile("site-a", errors.New("boom"))
+	s.RecordClusterReconcile("site-b", errors.New("later failure"))
+
+	clusters := s.Clusters()
+	if len(clusters) != 2 || clusters[0].Name != "site-a" || clusters[1].Name != "site-b" {
+		t.Fatalf("expected clusters sorted by name, got %+v", clusters)
+	}
+	if clusters[0].LastErr == nil || !clusters[0].LastSuccess.IsZero() {
+		t.Errorf("unexpected site-a status: %+v", clusters[0])
+	}
+	// A failure after a success keeps the success timestamp but records the error.
+	if clusters[1].LastErr == nil || clusters[1].LastSuccess.IsZero() {
+		t.Errorf("unexpected site-b status: %+v", clusters[1])
+	}
+}
+
+func TestStatus_RecordGCLeader(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.RecordClusterReconcile("site-a", nil)
+	s.RecordGCLeader("site-a", "host-a", true)
+	s.RecordGCLeader("site-b", "host-b", false)
+
+	clusters := s.Clusters()
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", clusters)
+	}
+	if clusters[0].GCLeader != "host-a" || !clusters[0].IsGCLeader || clusters[0].LastSuccess.IsZero() {
+		t.Errorf("unexpected site-a status: %+v", clusters[0])
+	}
+	if clusters[1].GCLeader != "host-b" || clusters[1].IsGCLeader {
+		t.Errorf("unexpected site-b status: %+v", clusters[1])
+	}
+}
+
+func TestStatus_Ready_BreakerTripped(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordReconcile(nil)
+	s.RecordBreaker("default", "removal breaker tripped: blocked removing 3 of this host's 3 records")
+
+	ready, reason := s.Ready()
+	if ready || reason != "removal breaker tripped: blocked removing 3 of this host's 3 records" {
+		t.Errorf("expected not ready with the breaker reason, got %t (%q)", ready, reason)
+	}
+
+	s.RecordBreaker("default", "")
+	if ready, reason := s.Ready(); !ready {
+		t.Errorf("expected ready once the breaker is reset, got %q", reason)
+	}
+}
+
+func TestStatus_Ready_BreakerNamesCluster(t *testing.T) {
+	s := NewStatus(time.Minute)
+	s.SetDockerConnected(true)
+	s.RecordReconcile(nil)
+	s.RecordClusterReconcile("site-a", nil)
+	s.RecordBreaker("site-b", "removal breaker tripped")
+
+	if _, reason := s.Ready(); reason != "cluster site-b: removal breaker tripped" {
+		t.Errorf("expected the cluster to be named, got %q", reason)
+	}
+}
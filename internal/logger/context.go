@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+)
+
+type reconcileIDKey struct{}
+
+// NewReconcileID returns a random id for a reconcile pass.
+func NewReconcileID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithReconcileID returns a copy of ctx carrying the reconcile pass id.
+func WithReconcileID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, reconcileIDKey{}, id)
+}
+
+// ReconcileID returns the reconcile pass id ctx carries, or "" if none.
+func ReconcileID(ctx context.Context) string {
+	id, _ := ctx.Value(reconcileIDKey{}).(string)
+	return id
+}
+
+// FromContext returns l with the reconcile pass id ctx carries, if any, as
+// its reconcile_id field, so work done on behalf of a pass logs under its id.
+func FromContext(ctx context.Context, l zerolog.Logger) zerolog.Logger {
+	if id := ReconcileID(ctx); id != "" {
+		return l.With().Str("reconcile_id", id).Logger()
+	}
+	return l
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNewReconcileID_Unique(t *testing.T) {
+	a, b := NewReconcileID(), NewReconcileID()
+	if len(a) != 16 || a == b {
+		t.Errorf("expected two distinct 16-character ids, got %q and %q", a, b)
+	}
+}
+
+func TestReconcileID_RoundTrip(t *testing.T) {
+	if id := ReconcileID(context.Background()); id != "" {
+		t.Errorf("expected no id in a bare context, got %q", id)
+	}
+	ctx := WithReconcileID(context.Background(), "abc")
+	if id := ReconcileID(ctx); id != "abc" {
+		t.Errorf("expected abc, got %q", id)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	base := zerolog.New(&buf)
+
+	l := FromContext(context.Background(), base)
+	l.Info().Msg("no pass")
+	l = FromContext(WithReconcileID(context.Background(), "abc"), base)
+	l.Info().Msg("pass")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || strings.Contains(lines[0], "reconcile_id") || !strings.Contains(lines[1], `"reconcile_id":"abc"`) {
+		t.Errorf("expected reconcile_id on the pass line only, got %q", buf.String())
+	}
+}
@@ -1,24 +1,39 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/rotate"
 	"github.com/rs/zerolog"
 )
 
 var (
 	getHostname           = os.Hostname
 	stdout      io.Writer = os.Stdout
+	stderr      io.Writer = os.Stderr
 )
 
-func SetupLogger(cfg *config.LoggingConfig) zerolog.Logger {
-	consoleWriter := zerolog.ConsoleWriter{
-		Out:        stdout,
-		TimeFormat: "2006-01-02 15:04:05",
+// SetupLogger returns the service logger cfg describes and sets the global
+// log level. An empty format or output means console lines on stdout. It
+// fails only if the log file cannot be opened.
+func SetupLogger(cfg *config.LoggingConfig) (zerolog.Logger, error) {
+	out, err := output(cfg)
+	if err != nil {
+		return zerolog.Nop(), err
+	}
+
+	var w io.Writer = out
+	if cfg.Format != config.LogFormatJSON {
+		w = zerolog.ConsoleWriter{
+			Out:        out,
+			NoColor:    cfg.Output == config.LogOutputFile,
+			TimeFormat: "2006-01-02 15:04:05",
+		}
 	}
 
 	levelStr := strings.ToLower(cfg.Level)
@@ -36,7 +51,7 @@ func SetupLogger(cfg *config.LoggingConfig) zerolog.Logger {
 		hostname = "unknown-host"
 	}
 
-	logger := zerolog.New(consoleWriter).
+	logger := zerolog.New(w).
 		With().
 		Timestamp().
 		Caller().
@@ -44,5 +59,40 @@ func SetupLogger(cfg *config.LoggingConfig) zerolog.Logger {
 		Str("host", hostname).
 		Logger()
 
-	return logger
+	if cfg.SampleEvery > 1 {
+		// Each level gets its own sampler, so a flood of trace messages does
+		// not use up the burst of debug ones.
+		logger = logger.Sample(zerolog.LevelSampler{
+			TraceSampler: sampler(cfg),
+			DebugSampler: sampler(cfg),
+		})
+	}
+
+	return logger, nil
+}
+
+// output returns the writer log lines go to.
+func output(cfg *config.LoggingConfig) (io.Writer, error) {
+	switch cfg.Output {
+	case config.LogOutputStderr:
+		return stderr, nil
+	case config.LogOutputFile:
+		f, err := rotate.Open(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("logger: open the log file: %w", err)
+		}
+		return f, nil
+	default:
+		return stdout, nil
+	}
+}
+
+// sampler lets the first SampleBurst messages of each second through, then
+// one in SampleEvery.
+func sampler(cfg *config.LoggingConfig) zerolog.Sampler {
+	return &zerolog.BurstSampler{
+		Burst:       uint32(cfg.SampleBurst),
+		Period:      time.Second,
+		NextSampler: &zerolog.BasicSampler{N: uint32(cfg.SampleEvery)},
+	}
 }
@@ -2,7 +2,10 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -34,7 +37,9 @@ func TestSetupLogger_ValidLevels(t *testing.T) {
 			defer func() { stdout = oldStdout }()
 
 			cfg := &config.LoggingConfig{Level: tc.input}
-			_ = SetupLogger(cfg)
+			if _, err := SetupLogger(cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 
 			if zerolog.GlobalLevel() != tc.expected {
 				t.Errorf("expected level %v, got %v", tc.expected, zerolog.GlobalLevel())
@@ -50,7 +55,9 @@ func TestSetupLogger_InvalidLevel_FallbackToInfo(t *testing.T) {
 	defer func() { stdout = oldStdout }()
 
 	cfg := &config.LoggingConfig{Level: "invalid-level"}
-	_ = SetupLogger(cfg)
+	if _, err := SetupLogger(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	if zerolog.GlobalLevel() != zerolog.InfoLevel {
 		t.Errorf("expected fallback to InfoLevel, got %v", zerolog.GlobalLevel())
@@ -64,7 +71,9 @@ func TestSetupLogger_EmptyLevel_UsesNoLevel(t *testing.T) {
 	defer func() { stdout = oldStdout }()
 
 	cfg := &config.LoggingConfig{Level: ""}
-	_ = SetupLogger(cfg)
+	if _, err := SetupLogger(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// zerolog.ParseLevel("") returns NoLevel without error
 	// so SetGlobalLevel is called with NoLevel (which allows all levels)
@@ -86,7 +95,10 @@ func TestSetupLogger_HostnameIncluded(t *testing.T) {
 	defer func() { getHostname = oldGetHostname }()
 
 	cfg := &config.LoggingConfig{Level: "info"}
-	logger := SetupLogger(cfg)
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	logger.Info().Msg("test message")
 
@@ -109,7 +121,10 @@ func TestSetupLogger_HostnameFallback(t *testing.T) {
 	defer func() { getHostname = oldGetHostname }()
 
 	cfg := &config.LoggingConfig{Level: "info"}
-	logger := SetupLogger(cfg)
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	logger.Info().Msg("test message")
 
@@ -132,7 +147,10 @@ func TestSetupLogger_OutputStructure(t *testing.T) {
 	defer func() { getHostname = oldGetHostname }()
 
 	cfg := &config.LoggingConfig{Level: "info"}
-	logger := SetupLogger(cfg)
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	logger.Info().Msg("structured output test")
 
@@ -156,7 +174,10 @@ func TestSetupLogger_WritesToConfiguredOutput(t *testing.T) {
 	defer func() { stdout = oldStdout }()
 
 	cfg := &config.LoggingConfig{Level: "info"}
-	logger := SetupLogger(cfg)
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	logger.Info().Msg("output test")
 
@@ -164,3 +185,101 @@ func TestSetupLogger_WritesToConfiguredOutput(t *testing.T) {
 		t.Error("expected logger to write to configured output buffer")
 	}
 }
+
+func TestSetupLogger_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &config.LoggingConfig{Level: "info", Format: config.LogFormatJSON}
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger.Info().Str("container_id", "abc123").Msg("json test")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected a JSON line, got: %s", buf.String())
+	}
+	if got["message"] != "json test" || got["container_id"] != "abc123" || got["level"] != "info" || got["service"] != "docker_coredns_sync" {
+		t.Errorf("unexpected JSON line: %s", buf.String())
+	}
+}
+
+func TestSetupLogger_StderrOutput(t *testing.T) {
+	var out, errOut bytes.Buffer
+	oldStdout, oldStderr := stdout, stderr
+	stdout, stderr = &out, &errOut
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+
+	cfg := &config.LoggingConfig{Level: "info", Output: config.LogOutputStderr}
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger.Info().Msg("stderr test")
+
+	if out.Len() != 0 || !strings.Contains(errOut.String(), "stderr test") {
+		t.Errorf("expected the line on stderr only, got stdout %q, stderr %q", out.String(), errOut.String())
+	}
+}
+
+func TestSetupLogger_FileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "dcs.log")
+	cfg := &config.LoggingConfig{Level: "info", Output: config.LogOutputFile, File: path, MaxSizeMB: 1, MaxBackups: 1}
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger.Info().Msg("file test")
+
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), "file test") {
+		t.Fatalf("expected the line in the file, got %q, %v", b, err)
+	}
+	if strings.Contains(string(b), "\x1b[") {
+		t.Errorf("expected no colors in the file, got %q", b)
+	}
+}
+
+func TestSetupLogger_FileOutputError(t *testing.T) {
+	cfg := &config.LoggingConfig{Level: "info", Output: config.LogOutputFile, File: t.TempDir()}
+	if _, err := SetupLogger(cfg); err == nil {
+		t.Error("expected an error opening a directory as the log file")
+	}
+}
+
+func TestSetupLogger_SamplesDebugMessages(t *testing.T) {
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &config.LoggingConfig{Level: "debug", Format: config.LogFormatJSON, SampleEvery: 10, SampleBurst: 5}
+	logger, err := SetupLogger(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range 100 {
+		logger.Debug().Msg("sampled")
+	}
+	for range 3 {
+		logger.Info().Msg("kept")
+	}
+
+	debug, info := strings.Count(buf.String(), `"sampled"`), strings.Count(buf.String(), `"kept"`)
+	// The burst of 5, then one in 10 of the remaining 95. The test is not
+	// expected to cross a second boundary; allow for it if it does.
+	if debug < 14 || debug > 24 {
+		t.Errorf("expected about 14 debug lines, got %d", debug)
+	}
+	if info != 3 {
+		t.Errorf("expected every info line kept, got %d", info)
+	}
+}
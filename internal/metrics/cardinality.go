@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// OtherLabelValue stands in for the values of a host or container label past
+// its limit (see SetLabelLimits), so a large fleet or a churn of containers
+// cannot grow the number of series without bound.
+const OtherLabelValue = "_other"
+
+// Defaults used by New until SetLabelLimits overrides them. These mirror the
+// viper defaults in internal/config (metrics.max_hosts,
+// metrics.max_containers); keep them in sync.
+const (
+	defaultMaxHosts      = 100
+	defaultMaxContainers = 100
+)
+
+// labelCap bounds the distinct values a label of a counter takes: the first
+// max values are kept and any later one is reported as OtherLabelValue. As a
+// counter's series must not vanish, a value once kept stays kept. max 0 keeps
+// every value.
+type labelCap struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func newLabelCap(max int) *labelCap {
+	return &labelCap{max: max, seen: make(map[string]struct{})}
+}
+
+// value returns v, or OtherLabelValue if v is past the limit.
+func (c *labelCap) value(v string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.seen[v]; ok || c.max <= 0 {
+		return v
+	}
+	if len(c.seen) >= c.max {
+		return OtherLabelValue
+	}
+	c.seen[v] = struct{}{}
+	return v
+}
+
+// top returns the keys of the max largest values, ties broken by key, for a
+// gauge whose series are replaced on every update. max 0 keeps every key.
+func top(values map[string]float64, max int) map[string]bool {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if values[keys[i]] != values[keys[j]] {
+			return values[keys[i]] > values[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if max > 0 && len(keys) > max {
+		keys = keys[:max]
+	}
+	kept := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		kept[k] = true
+	}
+	return kept
+}
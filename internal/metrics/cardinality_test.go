@@ -0,0 +1,30 @@
+package metrics
+
+import "testing"
+
+func TestLabelCap(t *testing.T) {
+	c := newLabelCap(2)
+	for _, v := range []string{"a", "b", "c", "a"} {
+		c.value(v)
+	}
+
+	if got := c.value("b"); got != "b" {
+		t.Errorf("expected a value within the limit kept, got %q", got)
+	}
+	if got := c.value("c"); got != OtherLabelValue {
+		t.Errorf("expected a value past the limit folded, got %q", got)
+	}
+	if got := newLabelCap(0).value("z"); got != "z" {
+		t.Errorf("expected no limit at 0, got %q", got)
+	}
+}
+
+func TestTop(t *testing.T) {
+	kept := top(map[string]float64{"a": 1, "b": 3, "c": 3, "d": 2}, 2)
+	if len(kept) != 2 || !kept["b"] || !kept["c"] {
+		t.Errorf("expected the two largest kept, got %v", kept)
+	}
+	if kept := top(map[string]float64{"a": 1, "b": 2}, 0); len(kept) != 2 {
+		t.Errorf("expected every key kept at 0, got %v", kept)
+	}
+}
@@ -5,32 +5,68 @@ package metrics
 
 import (
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Metrics holds the daemon's Prometheus collectors and the registry they are
-// registered on. It is fed by the sync engine (reconcile outcomes), the etcd
-// registry (operation/lock errors), and the Docker generator (disconnects).
+// registered on. It is fed by the sync engine (reconcile outcomes), the etcd or
+// redis registry (operation/lock errors, heartbeat ages), and the Docker generator
+// (disconnects).
 type Metrics struct {
 	registry *prometheus.Registry
 
 	reconcileDuration    prometheus.Histogram
 	reconcileTotal       *prometheus.CounterVec
+	reconcileTriggers    *prometheus.CounterVec
 	lastReconcileSuccess prometheus.Gauge
 	recordsAdded         prometheus.Counter
 	recordsRemoved       prometheus.Counter
 	recordsSkipped       prometheus.Gauge
 	etcdErrors           prometheus.Counter
 	etcdLockFailures     prometheus.Counter
+	redisErrors          prometheus.Counter
 	dockerDisconnects    prometheus.Counter
+	eventsDropped        prometheus.Counter
+	webhookDeliveries    *prometheus.CounterVec
+
+	clusterReconcileTotal *prometheus.CounterVec
+	clusterLastSuccess    *prometheus.GaugeVec
+	clusterUp             *prometheus.GaugeVec
+	clusterRecordsAdded   *prometheus.CounterVec
+	clusterRecordsRemoved *prometheus.CounterVec
+	cacheStaleness        *prometheus.GaugeVec
+	cacheResyncs          *prometheus.CounterVec
+	gcLeader              *prometheus.GaugeVec
+	gcIsLeader            *prometheus.GaugeVec
+	breakerBlocked        *prometheus.GaugeVec
+	paused                prometheus.Gauge
+
+	recordsDesired   *prometheus.GaugeVec
+	recordsPublished *prometheus.GaugeVec
+	conflicts        *prometheus.CounterVec
+	gcReaped         *prometheus.CounterVec
+	labelErrors      *prometheus.CounterVec
+	heartbeatAge     *prometheus.GaugeVec
+
+	// maxHosts and maxContainers bound the host and container labels (see
+	// SetLabelLimits); reapedHosts and errorContainers apply them to the
+	// counters.
+	maxHosts        int
+	reapedHosts     *labelCap
+	errorContainers *labelCap
 
 	// dryRun is set once at startup. In dry-run the daemon applies nothing, so a
 	// pass is not counted as a success and the last-success gauge is not
 	// refreshed (mirroring readiness, which also reports not-ready).
 	dryRun bool
+	// isPaused mirrors the paused gauge for ObserveReconcile: like a dry-run
+	// pass, a paused pass applies nothing.
+	isPaused atomic.Bool
 }
 
 // New constructs a Metrics set with all collectors registered on a fresh
@@ -48,6 +84,10 @@ func New() *Metrics {
 			Name: "dcs_reconcile_total",
 			Help: "Total number of reconciliation passes by result.",
 		}, []string{"result"}),
+		reconcileTriggers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_reconcile_triggers_total",
+			Help: "Total number of reconciliation passes by what triggered them (event, tick, manual, startup).",
+		}, []string{"reason"}),
 		lastReconcileSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "dcs_reconcile_last_success_timestamp_seconds",
 			Help: "Unix timestamp of the last successful reconciliation.",
@@ -72,21 +112,125 @@ func New() *Metrics {
 			Name: "dcs_etcd_lock_failures_total",
 			Help: "Total number of etcd distributed-lock acquisition failures.",
 		}),
+		redisErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dcs_redis_errors_total",
+			Help: "Total number of Redis operation errors (redis registry backend).",
+		}),
 		dockerDisconnects: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "dcs_docker_disconnects_total",
 			Help: "Total number of Docker event-stream disconnects.",
 		}),
+		eventsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dcs_events_dropped_total",
+			Help: "Total number of events dropped for event-stream clients that fell behind.",
+		}),
+		webhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_webhook_deliveries_total",
+			Help: "Total number of webhook notifications by webhook and result (success, failure, dropped).",
+		}, []string{"webhook", "result"}),
+		clusterReconcileTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_cluster_reconcile_total",
+			Help: "Total number of per-cluster reconciliations by cluster and result.",
+		}, []string{"cluster", "result"}),
+		clusterLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_cluster_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful reconciliation of each cluster.",
+		}, []string{"cluster"}),
+		clusterUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_cluster_up",
+			Help: "Whether the most recent reconciliation of each cluster succeeded (1) or failed (0).",
+		}, []string{"cluster"}),
+		clusterRecordsAdded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_cluster_records_added_total",
+			Help: "Total number of DNS records added, by cluster.",
+		}, []string{"cluster"}),
+		clusterRecordsRemoved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_cluster_records_removed_total",
+			Help: "Total number of DNS records removed, by cluster.",
+		}, []string{"cluster"}),
+		cacheStaleness: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_registry_cache_staleness_seconds",
+			Help: "Seconds since the etcd watch last confirmed the registry cache was current, as of the latest listing.",
+		}, []string{"cluster"}),
+		cacheResyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_registry_cache_resyncs_total",
+			Help: "Total number of full registry cache reloads by cluster and reason (initial, compacted, watch_error).",
+		}, []string{"cluster", "reason"}),
+		gcLeader: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_gc_leader_info",
+			Help: "The host elected to garbage-collect orphaned records on each cluster, as of the latest check; always 1.",
+		}, []string{"cluster", "leader"}),
+		gcIsLeader: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_gc_is_leader",
+			Help: "Whether this host leads garbage collection of orphaned records on each cluster (1) or not (0).",
+		}, []string{"cluster"}),
+		breakerBlocked: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_removal_breaker_blocked",
+			Help: "Number of removals the removal breaker is blocking, by cluster and kind (own, gc). Non-zero means the breaker is tripped and waits for an override.",
+		}, []string{"cluster", "kind"}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dcs_paused",
+			Help: "1 while the sync engine is paused through the admin API and writes no records, else 0.",
+		}),
+		recordsDesired: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_records_desired",
+			Help: "Number of records this host's containers ask for, by kind and owner host, as of the latest reconciliation.",
+		}, []string{"kind", "owner"}),
+		recordsPublished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_records_published",
+			Help: "Number of records in each cluster, by kind and owner host, as of the latest reconciliation of the cluster.",
+		}, []string{"cluster", "kind", "owner"}),
+		conflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_conflicts_total",
+			Help: "Total number of record conflicts by how they were resolved (force, age, validation_rejected, cname_cycle).",
+		}, []string{"resolution"}),
+		gcReaped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_gc_reaped_total",
+			Help: "Total number of records garbage-collected by this host, by cluster and the dead host that owned them.",
+		}, []string{"cluster", "host"}),
+		labelErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dcs_label_errors_total",
+			Help: "Total number of container labels that could not be turned into a record, by container name and error code.",
+		}, []string{"container", "code"}),
+		heartbeatAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "dcs_host_heartbeat_age_seconds",
+			Help: "Seconds since each live host last renewed its heartbeat, as of this host's latest garbage-collection check.",
+		}, []string{"cluster", "host"}),
+		maxHosts:        defaultMaxHosts,
+		reapedHosts:     newLabelCap(defaultMaxHosts),
+		errorContainers: newLabelCap(defaultMaxContainers),
 	}
 	reg.MustRegister(
 		m.reconcileDuration,
 		m.reconcileTotal,
+		m.reconcileTriggers,
 		m.lastReconcileSuccess,
 		m.recordsAdded,
 		m.recordsRemoved,
 		m.recordsSkipped,
 		m.etcdErrors,
 		m.etcdLockFailures,
+		m.redisErrors,
 		m.dockerDisconnects,
+		m.eventsDropped,
+		m.webhookDeliveries,
+		m.clusterReconcileTotal,
+		m.clusterLastSuccess,
+		m.clusterUp,
+		m.clusterRecordsAdded,
+		m.clusterRecordsRemoved,
+		m.cacheStaleness,
+		m.cacheResyncs,
+		m.gcLeader,
+		m.gcIsLeader,
+		m.breakerBlocked,
+		m.paused,
+		m.recordsDesired,
+		m.recordsPublished,
+		m.conflicts,
+		m.gcReaped,
+		m.labelErrors,
+		m.heartbeatAge,
 	)
 	return m
 }
@@ -95,6 +239,26 @@ func New() *Metrics {
 // the reconciliation loop starts. See the dryRun field for the effect.
 func (m *Metrics) SetDryRun(dryRun bool) { m.dryRun = dryRun }
 
+// SetLabelLimits bounds the distinct hosts and containers the per-host and
+// per-container metrics report; the others are folded into OtherLabelValue.
+// 0 means no limit. Must be called before the reconciliation loop starts.
+func (m *Metrics) SetLabelLimits(maxHosts, maxContainers int) {
+	m.maxHosts = maxHosts
+	m.reapedHosts = newLabelCap(maxHosts)
+	m.errorContainers = newLabelCap(maxContainers)
+}
+
+// SetPaused records whether the sync engine is paused. Passes run while paused
+// are counted with result "paused" and do not refresh the last-success gauge.
+func (m *Metrics) SetPaused(paused bool) {
+	m.isPaused.Store(paused)
+	if paused {
+		m.paused.Set(1)
+	} else {
+		m.paused.Set(0)
+	}
+}
+
 // Handler returns the HTTP handler that exposes this metrics set in the
 // Prometheus text exposition format.
 func (m *Metrics) Handler() http.Handler {
@@ -117,17 +281,191 @@ func (m *Metrics) ObserveReconcile(duration time.Duration, added, removed, skipp
 		// A dry-run pass applies nothing, so it is neither a success nor an
 		// error and must not refresh the last-success gauge.
 		m.reconcileTotal.WithLabelValues("dry_run").Inc()
+	case m.isPaused.Load():
+		m.reconcileTotal.WithLabelValues("paused").Inc()
 	default:
 		m.reconcileTotal.WithLabelValues("success").Inc()
 		m.lastReconcileSuccess.Set(float64(time.Now().Unix()))
 	}
 }
 
+// IncReconcileTrigger counts a reconciliation pass by what triggered it.
+func (m *Metrics) IncReconcileTrigger(reason string) {
+	m.reconcileTriggers.WithLabelValues(reason).Inc()
+}
+
+// ObserveClusterReconcile records the outcome of one cluster within a
+// reconciliation pass. The aggregate pass is still recorded by
+// ObserveReconcile. As there, dry-run passes never count as a success.
+func (m *Metrics) ObserveClusterReconcile(cluster string, added, removed int, err error) {
+	m.clusterRecordsAdded.WithLabelValues(cluster).Add(float64(added))
+	m.clusterRecordsRemoved.WithLabelValues(cluster).Add(float64(removed))
+	switch {
+	case err != nil:
+		m.clusterReconcileTotal.WithLabelValues(cluster, "error").Inc()
+		m.clusterUp.WithLabelValues(cluster).Set(0)
+	case m.dryRun:
+		m.clusterReconcileTotal.WithLabelValues(cluster, "dry_run").Inc()
+	case m.isPaused.Load():
+		m.clusterReconcileTotal.WithLabelValues(cluster, "paused").Inc()
+	default:
+		m.clusterReconcileTotal.WithLabelValues(cluster, "success").Inc()
+		m.clusterUp.WithLabelValues(cluster).Set(1)
+		m.clusterLastSuccess.WithLabelValues(cluster).Set(float64(time.Now().Unix()))
+	}
+}
+
+// SetGCLeader records the GC leader of cluster, replacing the previous one.
+func (m *Metrics) SetGCLeader(cluster, leader string, isLeader bool) {
+	m.gcLeader.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+	if leader != "" {
+		m.gcLeader.WithLabelValues(cluster, leader).Set(1)
+	}
+	if isLeader {
+		m.gcIsLeader.WithLabelValues(cluster).Set(1)
+	} else {
+		m.gcIsLeader.WithLabelValues(cluster).Set(0)
+	}
+}
+
+// SetBreakerBlocked records how many removals of kind the removal breaker of
+// cluster is blocking.
+func (m *Metrics) SetBreakerBlocked(cluster, kind string, blocked int) {
+	m.breakerBlocked.WithLabelValues(cluster, kind).Set(float64(blocked))
+}
+
+// SetDesiredRecords records the records this host's containers ask for, by
+// kind and owner host, replacing the previous set.
+func (m *Metrics) SetDesiredRecords(records []*domain.RecordIntent) {
+	m.recordsDesired.Reset()
+	for kind, owners := range m.countRecords(records) {
+		for owner, n := range owners {
+			m.recordsDesired.WithLabelValues(kind, owner).Set(n)
+		}
+	}
+}
+
+// SetPublishedRecords records the records cluster holds, by kind and owner
+// host, replacing the previous set of the cluster.
+func (m *Metrics) SetPublishedRecords(cluster string, records []*domain.RecordIntent) {
+	m.recordsPublished.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+	for kind, owners := range m.countRecords(records) {
+		for owner, n := range owners {
+			m.recordsPublished.WithLabelValues(cluster, kind, owner).Set(n)
+		}
+	}
+}
+
+// countRecords counts records by kind and owner host. Past the host limit,
+// the hosts owning the fewest records are counted as OtherLabelValue.
+func (m *Metrics) countRecords(records []*domain.RecordIntent) map[string]map[string]float64 {
+	perHost := make(map[string]float64)
+	for _, ri := range records {
+		perHost[ri.Hostname]++
+	}
+	kept := top(perHost, m.maxHosts)
+	counts := make(map[string]map[string]float64)
+	for _, ri := range records {
+		kind, owner := string(ri.Record.Kind), ri.Hostname
+		if !kept[owner] {
+			owner = OtherLabelValue
+		}
+		if counts[kind] == nil {
+			counts[kind] = make(map[string]float64)
+		}
+		counts[kind][owner]++
+	}
+	return counts
+}
+
+// IncConflict counts a record conflict by how it was resolved.
+func (m *Metrics) IncConflict(resolution string) {
+	m.conflicts.WithLabelValues(resolution).Inc()
+}
+
+// AddGCReaped counts n records of the dead host garbage-collected from
+// cluster.
+func (m *Metrics) AddGCReaped(cluster, host string, n int) {
+	m.gcReaped.WithLabelValues(cluster, m.reapedHosts.value(host)).Add(float64(n))
+}
+
+// IncLabelError counts a label of container that could not be turned into a
+// record, by the error's code.
+func (m *Metrics) IncLabelError(container, code string) {
+	m.labelErrors.WithLabelValues(m.errorContainers.value(container), code).Inc()
+}
+
+// HeartbeatMetrics is the heartbeat metrics sink of a single registry
+// cluster.
+type HeartbeatMetrics struct {
+	m       *Metrics
+	cluster string
+}
+
+// ClusterHeartbeats returns the heartbeat metrics sink for cluster.
+func (m *Metrics) ClusterHeartbeats(cluster string) *HeartbeatMetrics {
+	return &HeartbeatMetrics{m: m, cluster: cluster}
+}
+
+// SetHeartbeatAges records how long ago each live host renewed its heartbeat,
+// replacing the previous set. Past the host limit, the hosts renewed most
+// recently are reported as OtherLabelValue, with the oldest age among them.
+func (h *HeartbeatMetrics) SetHeartbeatAges(ages map[string]time.Duration) {
+	values := make(map[string]float64, len(ages))
+	for host, age := range ages {
+		values[host] = age.Seconds()
+	}
+	kept := top(values, h.m.maxHosts)
+	h.m.heartbeatAge.DeletePartialMatch(prometheus.Labels{"cluster": h.cluster})
+	other, folded := 0.0, false
+	for host, age := range values {
+		if kept[host] {
+			h.m.heartbeatAge.WithLabelValues(h.cluster, host).Set(age)
+			continue
+		}
+		other, folded = max(other, age), true
+	}
+	if folded {
+		h.m.heartbeatAge.WithLabelValues(h.cluster, OtherLabelValue).Set(other)
+	}
+}
+
+// CacheMetrics is the watch-cache metrics sink of a single registry cluster.
+type CacheMetrics struct {
+	staleness prometheus.Gauge
+	resyncs   *prometheus.CounterVec
+}
+
+// ClusterCache returns the watch-cache metrics sink for cluster.
+func (m *Metrics) ClusterCache(cluster string) *CacheMetrics {
+	return &CacheMetrics{
+		staleness: m.cacheStaleness.WithLabelValues(cluster),
+		resyncs:   m.cacheResyncs.MustCurryWith(prometheus.Labels{"cluster": cluster}),
+	}
+}
+
+// SetCacheStaleness records how long ago the watch last confirmed the cache.
+func (c *CacheMetrics) SetCacheStaleness(d time.Duration) { c.staleness.Set(d.Seconds()) }
+
+// IncCacheResync counts a full cache reload.
+func (c *CacheMetrics) IncCacheResync(reason string) { c.resyncs.WithLabelValues(reason).Inc() }
+
 // IncEtcdError increments the etcd operation-error counter.
 func (m *Metrics) IncEtcdError() { m.etcdErrors.Inc() }
 
 // IncLockFailure increments the etcd lock-acquisition-failure counter.
 func (m *Metrics) IncLockFailure() { m.etcdLockFailures.Inc() }
 
+// IncRedisError increments the Redis operation-error counter.
+func (m *Metrics) IncRedisError() { m.redisErrors.Inc() }
+
 // IncDockerDisconnect increments the Docker event-stream disconnect counter.
 func (m *Metrics) IncDockerDisconnect() { m.dockerDisconnects.Inc() }
+
+// ObserveWebhookDelivery counts a webhook notification by its result.
+func (m *Metrics) ObserveWebhookDelivery(webhook, result string) {
+	m.webhookDeliveries.WithLabelValues(webhook, result).Inc()
+}
+
+// IncEventDropped counts an event dropped for a slow event-stream client.
+func (m *Metrics) IncEventDropped() { m.eventsDropped.Inc() }
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -71,12 +72,195 @@ func TestObserveReconcile_Error(t *testing.T) {
 	}
 }
 
+func TestObserveClusterReconcile(t *testing.T) {
+	m := New()
+	m.ObserveClusterReconcile("site-a", 2, 1, nil)
+	m.ObserveClusterReconcile("site-b", 0, 0, errors.New("boom"))
+
+	if got := testutil.ToFloat64(m.clusterUp.WithLabelValues("site-a")); got != 1 {
+		t.Errorf("site-a up = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.clusterUp.WithLabelValues("site-b")); got != 0 {
+		t.Errorf("site-b up = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.clusterReconcileTotal.WithLabelValues("site-b", "error")); got != 1 {
+		t.Errorf("site-b error total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.clusterRecordsAdded.WithLabelValues("site-a")); got != 2 {
+		t.Errorf("site-a records added = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.clusterLastSuccess.WithLabelValues("site-b")); got != 0 {
+		t.Errorf("site-b last success = %v, want 0", got)
+	}
+}
+
+func TestObserveClusterReconcile_DryRunNotSuccess(t *testing.T) {
+	m := New()
+	m.SetDryRun(true)
+	m.ObserveClusterReconcile("site-a", 0, 0, nil)
+	if got := testutil.ToFloat64(m.clusterReconcileTotal.WithLabelValues("site-a", "dry_run")); got != 1 {
+		t.Errorf("dry_run total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.clusterLastSuccess.WithLabelValues("site-a")); got != 0 {
+		t.Errorf("last success = %v, want 0 in dry-run", got)
+	}
+}
+
+func TestClusterCache(t *testing.T) {
+	m := New()
+	c := m.ClusterCache("site-a")
+	c.SetCacheStaleness(1500 * time.Millisecond)
+	c.IncCacheResync("initial")
+	c.IncCacheResync("compacted")
+	c.IncCacheResync("compacted")
+
+	if got := testutil.ToFloat64(m.cacheStaleness.WithLabelValues("site-a")); got != 1.5 {
+		t.Errorf("staleness = %v, want 1.5", got)
+	}
+	if got := testutil.ToFloat64(m.cacheResyncs.WithLabelValues("site-a", "compacted")); got != 2 {
+		t.Errorf("compacted resyncs = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.cacheResyncs.WithLabelValues("site-b", "initial")); got != 0 {
+		t.Errorf("site-b resyncs = %v, want 0", got)
+	}
+}
+
+func TestSetGCLeader(t *testing.T) {
+	m := New()
+	m.SetGCLeader("site-a", "host-a", true)
+	m.SetGCLeader("site-a", "host-b", false)
+
+	if n := testutil.CollectAndCount(m.gcLeader); n != 1 {
+		t.Errorf("expected only the current leader to be exported, got %d series", n)
+	}
+	if got := testutil.ToFloat64(m.gcLeader.WithLabelValues("site-a", "host-b")); got != 1 {
+		t.Errorf("host-b leader = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.gcIsLeader.WithLabelValues("site-a")); got != 0 {
+		t.Errorf("is leader = %v, want 0", got)
+	}
+}
+
+func TestSetBreakerBlocked(t *testing.T) {
+	m := New()
+	m.SetBreakerBlocked("site-a", "own", 12)
+	m.SetBreakerBlocked("site-a", "gc", 0)
+	m.SetBreakerBlocked("site-a", "own", 0)
+
+	if got := testutil.ToFloat64(m.breakerBlocked.WithLabelValues("site-a", "own")); got != 0 {
+		t.Errorf("own blocked = %v, want 0 once the breaker is reset", got)
+	}
+	m.SetBreakerBlocked("site-a", "gc", 4)
+	if got := testutil.ToFloat64(m.breakerBlocked.WithLabelValues("site-a", "gc")); got != 4 {
+		t.Errorf("gc blocked = %v, want 4", got)
+	}
+}
+
+func intent(kind domain.RecordKind, host string) *domain.RecordIntent {
+	return &domain.RecordIntent{Record: domain.Record{Kind: kind}, Hostname: host}
+}
+
+func TestSetDesiredAndPublishedRecords(t *testing.T) {
+	m := New()
+	m.SetDesiredRecords([]*domain.RecordIntent{intent(domain.RecordA, "host-a"), intent(domain.RecordA, "host-a"), intent(domain.RecordCNAME, "host-a")})
+	m.SetPublishedRecords("site-a", []*domain.RecordIntent{intent(domain.RecordA, "host-a"), intent(domain.RecordA, "host-b")})
+	m.SetPublishedRecords("site-b", []*domain.RecordIntent{intent(domain.RecordA, "host-a")})
+
+	if got := testutil.ToFloat64(m.recordsDesired.WithLabelValues("A", "host-a")); got != 2 {
+		t.Errorf("desired A = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.recordsPublished.WithLabelValues("site-a", "A", "host-b")); got != 1 {
+		t.Errorf("published A of host-b = %v, want 1", got)
+	}
+
+	m.SetPublishedRecords("site-a", []*domain.RecordIntent{intent(domain.RecordA, "host-a")})
+	if n := testutil.CollectAndCount(m.recordsPublished); n != 2 {
+		t.Errorf("expected host-b's series dropped from site-a only, got %d series", n)
+	}
+	m.SetDesiredRecords(nil)
+	if n := testutil.CollectAndCount(m.recordsDesired); n != 0 {
+		t.Errorf("expected no desired series, got %d", n)
+	}
+}
+
+func TestSetPublishedRecords_FoldsHostsPastLimit(t *testing.T) {
+	m := New()
+	m.SetLabelLimits(1, 1)
+	m.SetPublishedRecords("site-a", []*domain.RecordIntent{
+		intent(domain.RecordA, "host-a"), intent(domain.RecordA, "host-a"),
+		intent(domain.RecordA, "host-b"), intent(domain.RecordA, "host-c"),
+	})
+
+	if got := testutil.ToFloat64(m.recordsPublished.WithLabelValues("site-a", "A", "host-a")); got != 2 {
+		t.Errorf("host-a = %v, want 2 (the host with the most records is kept)", got)
+	}
+	if got := testutil.ToFloat64(m.recordsPublished.WithLabelValues("site-a", "A", OtherLabelValue)); got != 2 {
+		t.Errorf("%s = %v, want 2", OtherLabelValue, got)
+	}
+}
+
+func TestConflictAndGCCounters(t *testing.T) {
+	m := New()
+	m.SetLabelLimits(1, 1)
+	m.IncConflict("force")
+	m.IncConflict("force")
+	m.AddGCReaped("site-a", "host-b", 3)
+	m.AddGCReaped("site-a", "host-c", 1)
+	m.AddGCReaped("site-b", "host-b", 2)
+
+	if got := testutil.ToFloat64(m.conflicts.WithLabelValues("force")); got != 2 {
+		t.Errorf("force conflicts = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.gcReaped.WithLabelValues("site-b", "host-b")); got != 2 {
+		t.Errorf("reaped from host-b on site-b = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.gcReaped.WithLabelValues("site-a", OtherLabelValue)); got != 1 {
+		t.Errorf("reaped from hosts past the limit = %v, want 1", got)
+	}
+}
+
+func TestIncLabelError(t *testing.T) {
+	m := New()
+	m.SetLabelLimits(0, 1)
+	m.IncLabelError("web", "invalid_label")
+	m.IncLabelError("web", "invalid_label")
+	m.IncLabelError("db", "missing_name")
+
+	if got := testutil.ToFloat64(m.labelErrors.WithLabelValues("web", "invalid_label")); got != 2 {
+		t.Errorf("web errors = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.labelErrors.WithLabelValues(OtherLabelValue, "missing_name")); got != 1 {
+		t.Errorf("errors past the container limit = %v, want 1", got)
+	}
+}
+
+func TestClusterHeartbeats(t *testing.T) {
+	m := New()
+	m.SetLabelLimits(2, 0)
+	h := m.ClusterHeartbeats("site-a")
+	h.SetHeartbeatAges(map[string]time.Duration{"host-a": time.Second, "host-b": 5 * time.Second, "host-c": 3 * time.Second, "host-d": 2 * time.Second})
+
+	if got := testutil.ToFloat64(m.heartbeatAge.WithLabelValues("site-a", "host-b")); got != 5 {
+		t.Errorf("host-b age = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(m.heartbeatAge.WithLabelValues("site-a", OtherLabelValue)); got != 2 {
+		t.Errorf("%s age = %v, want 2 (the oldest of the folded hosts)", OtherLabelValue, got)
+	}
+
+	h.SetHeartbeatAges(map[string]time.Duration{"host-a": time.Second})
+	if n := testutil.CollectAndCount(m.heartbeatAge); n != 1 {
+		t.Errorf("expected hosts no longer live dropped, got %d series", n)
+	}
+}
+
 func TestIncCounters(t *testing.T) {
 	m := New()
 	m.IncEtcdError()
 	m.IncEtcdError()
 	m.IncLockFailure()
+	m.IncRedisError()
 	m.IncDockerDisconnect()
+	m.IncEventDropped()
 
 	if got := testutil.ToFloat64(m.etcdErrors); got != 2 {
 		t.Errorf("etcd errors = %v, want 2", got)
@@ -84,9 +268,29 @@ func TestIncCounters(t *testing.T) {
 	if got := testutil.ToFloat64(m.etcdLockFailures); got != 1 {
 		t.Errorf("etcd lock failures = %v, want 1", got)
 	}
+	if got := testutil.ToFloat64(m.redisErrors); got != 1 {
+		t.Errorf("redis errors = %v, want 1", got)
+	}
 	if got := testutil.ToFloat64(m.dockerDisconnects); got != 1 {
 		t.Errorf("docker disconnects = %v, want 1", got)
 	}
+	if got := testutil.ToFloat64(m.eventsDropped); got != 1 {
+		t.Errorf("events dropped = %v, want 1", got)
+	}
+}
+
+func TestObserveWebhookDelivery(t *testing.T) {
+	m := New()
+	m.ObserveWebhookDelivery("slack", "success")
+	m.ObserveWebhookDelivery("slack", "success")
+	m.ObserveWebhookDelivery("slack", "failure")
+
+	if got := testutil.ToFloat64(m.webhookDeliveries.WithLabelValues("slack", "success")); got != 2 {
+		t.Errorf("successful deliveries = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.webhookDeliveries.WithLabelValues("slack", "failure")); got != 1 {
+		t.Errorf("failed deliveries = %v, want 1", got)
+	}
 }
 
 func TestHandler_ExposesMetrics(t *testing.T) {
@@ -123,3 +327,46 @@ func TestHandler_ExposesMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestIncReconcileTrigger(t *testing.T) {
+	m := New()
+	m.IncReconcileTrigger("event")
+	m.IncReconcileTrigger("event")
+	m.IncReconcileTrigger("tick")
+
+	if got := testutil.ToFloat64(m.reconcileTriggers.WithLabelValues("event")); got != 2 {
+		t.Errorf("event triggers = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.reconcileTriggers.WithLabelValues("tick")); got != 1 {
+		t.Errorf("tick triggers = %v, want 1", got)
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	m := New()
+	m.SetPaused(true)
+	m.ObserveReconcile(time.Millisecond, 0, 0, 0, nil)
+	m.ObserveClusterReconcile("site-a", 0, 0, nil)
+
+	if got := testutil.ToFloat64(m.paused); got != 1 {
+		t.Errorf("paused = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.reconcileTotal.WithLabelValues("paused")); got != 1 {
+		t.Errorf("paused total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.clusterReconcileTotal.WithLabelValues("site-a", "paused")); got != 1 {
+		t.Errorf("cluster paused total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.lastReconcileSuccess); got != 0 {
+		t.Errorf("last success timestamp = %v, want 0 while paused", got)
+	}
+
+	m.SetPaused(false)
+	m.ObserveReconcile(time.Millisecond, 0, 0, 0, nil)
+	if got := testutil.ToFloat64(m.paused); got != 0 {
+		t.Errorf("paused = %v, want 0 after resuming", got)
+	}
+	if got := testutil.ToFloat64(m.reconcileTotal.WithLabelValues("success")); got != 1 {
+		t.Errorf("success total = %v, want 1 after resuming", got)
+	}
+}
@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// Events a webhook can select.
+const (
+	EventContainer  = "container"
+	EventRegistered = "record_registered"
+	EventRemoved    = "record_removed"
+	EventEviction   = "eviction"
+	EventConflict   = "conflict"
+	EventGC         = "gc"
+)
+
+// DefaultEvents are sent to a webhook that selects none: the changes a human
+// may have to act on.
+var DefaultEvents = []string{EventConflict, EventEviction, EventGC}
+
+var knownEvents = map[string]bool{
+	EventContainer:  true,
+	EventRegistered: true,
+	EventRemoved:    true,
+	EventEviction:   true,
+	EventConflict:   true,
+	EventGC:         true,
+}
+
+// eventOf returns the event a change is sent as. An evicted record's removal
+// is an eviction.
+func eventOf(c domain.Change) string {
+	if c.Type == domain.ChangeRemoved && c.Reason == string(domain.RemovalEvicted) {
+		return EventEviction
+	}
+	return string(c.Type)
+}
+
+// Message is what a webhook is told about a change. Without a template it is
+// sent as JSON; a template renders it with text/template.
+type Message struct {
+	Event string `json:"event"`
+	// Summary is a one-line, human-readable account of the change.
+	Summary string    `json:"summary"`
+	Host    string    `json:"host"`
+	Time    time.Time `json:"time"`
+	Cluster string    `json:"cluster,omitempty"`
+	// Container is the container's name.
+	Container   string `json:"container,omitempty"`
+	ContainerId string `json:"container_id,omitempty"`
+	// Record is the record registered, removed or losing a conflict, rendered
+	// as "[A] name -> value", and Owner the host that owned it.
+	Record string `json:"record,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	// Against is the record that evicted Record, or that it lost to.
+	Against string   `json:"against,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Removed int      `json:"removed,omitempty"`
+	// ContainerEvent is the Docker event of a container notification, and
+	// Records the records the container asks for since.
+	ContainerEvent string   `json:"container_event,omitempty"`
+	Records        []string `json:"records,omitempty"`
+}
+
+// newMessage describes c as seen by host.
+func newMessage(host string, c domain.Change) Message {
+	m := Message{
+		Event:       eventOf(c),
+		Host:        host,
+		Time:        c.Time,
+		Cluster:     c.Cluster,
+		Container:   c.ContainerName,
+		ContainerId: c.ContainerId,
+		Reason:      c.Reason,
+		Detail:      c.Detail,
+		Hosts:       c.Hosts,
+		Removed:     c.Removed,
+
+		ContainerEvent: string(c.Event),
+	}
+	if c.Record != nil {
+		m.Record, m.Owner = c.Record.Record.Render(), c.Record.Hostname
+	}
+	if c.Against != nil {
+		m.Against = c.Against.Record.Render()
+	}
+	for _, ri := range c.Records {
+		m.Records = append(m.Records, ri.Record.Render())
+	}
+	m.Summary = summary(m)
+	return m
+}
+
+// summary renders m as one line, in the words of the daemon's logs.
+func summary(m Message) string {
+	in := ""
+	if m.Cluster != "" {
+		in = " in cluster " + m.Cluster
+	}
+	switch m.Event {
+	case EventContainer:
+		return fmt.Sprintf("%s: container %s %s, and asks for %d record(s)", m.Host, m.Container, m.ContainerEvent, len(m.Records))
+	case EventRegistered:
+		return fmt.Sprintf("%s: registered %s of container %s%s", m.Host, m.Record, m.Container, in)
+	case EventEviction:
+		return fmt.Sprintf("%s: evicted %s of container %s on %s%s, replaced by %s: %s", m.Host, m.Record, m.Container, m.Owner, in, m.Against, m.Detail)
+	case EventRemoved:
+		return fmt.Sprintf("%s: removed %s of container %s on %s%s (%s)", m.Host, m.Record, m.Container, m.Owner, in, m.Reason)
+	case EventConflict:
+		return fmt.Sprintf("%s: %s of container %s is not published%s: %s", m.Host, m.Record, m.Container, in, m.Detail)
+	case EventGC:
+		return fmt.Sprintf("%s: garbage-collected %d record(s) of %s, which have no heartbeat%s", m.Host, m.Removed, strings.Join(m.Hosts, ", "), in)
+	}
+	return fmt.Sprintf("%s: %s", m.Host, m.Event)
+}
+
+// templateFuncs are available to webhook templates: json encodes a value as
+// JSON, so {{json .Summary}} is a quoted, escaped string; join joins a list.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+}
+
+// parseTemplate parses a webhook's body template; an empty one sends the
+// message as JSON.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// render returns the body sent for m: tmpl applied to m, or m as JSON.
+func render(tmpl *template.Template, m Message) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(m)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func intent(name, value, host, container string) *domain.RecordIntent {
+	return &domain.RecordIntent{
+		Record:        domain.Record{Name: name, Kind: domain.RecordA, Value: value},
+		Hostname:      host,
+		ContainerName: container,
+	}
+}
+
+func TestEventOf(t *testing.T) {
+	tests := []struct {
+		change domain.Change
+		want   string
+	}{
+		{domain.Change{Type: domain.ChangeRemoved, Reason: string(domain.RemovalEvicted)}, EventEviction},
+		{domain.Change{Type: domain.ChangeRemoved, Reason: string(domain.RemovalStale)}, EventRemoved},
+		{domain.Change{Type: domain.ChangeGC}, EventGC},
+		{domain.Change{Type: domain.ChangeConflict}, EventConflict},
+	}
+	for _, tc := range tests {
+		if got := eventOf(tc.change); got != tc.want {
+			t.Errorf("eventOf(%s/%s) = %q, want %q", tc.change.Type, tc.change.Reason, got, tc.want)
+		}
+	}
+}
+
+func TestNewMessage_Summaries(t *testing.T) {
+	tests := map[string]struct {
+		change domain.Change
+		want   string
+	}{
+		"eviction": {
+			domain.Change{
+				Type: domain.ChangeRemoved, Cluster: "default", ContainerName: "old",
+				Record:  intent("app.example.com", "10.0.0.2", "host-b", "old"),
+				Against: intent("app.example.com", "10.0.0.1", "host-a", "new"),
+				Reason:  string(domain.RemovalEvicted), Detail: "forced",
+			},
+			"host-a: evicted [A] app.example.com -> 10.0.0.2 of container old on host-b in cluster default, replaced by [A] app.example.com -> 10.0.0.1: forced",
+		},
+		"gc": {
+			domain.Change{Type: domain.ChangeGC, Cluster: "default", Hosts: []string{"host-c", "host-d"}, Removed: 3},
+			"host-a: garbage-collected 3 record(s) of host-c, host-d, which have no heartbeat in cluster default",
+		},
+		"filter conflict": {
+			domain.Change{Type: domain.ChangeConflict, ContainerName: "new", Record: intent("app.example.com", "10.0.0.1", "host-a", "new"), Detail: "lost on age"},
+			"host-a: [A] app.example.com -> 10.0.0.1 of container new is not published: lost on age",
+		},
+		"container": {
+			domain.Change{Type: domain.ChangeContainer, ContainerName: "web", Event: domain.EventTypeContainerDied},
+			"host-a: container web die, and asks for 0 record(s)",
+		},
+	}
+	for name, tc := range tests {
+		if got := newMessage("host-a", tc.change).Summary; got != tc.want {
+			t.Errorf("%s:\n got %q\nwant %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := newMessage("host-a", domain.Change{Type: domain.ChangeGC, Time: time.Unix(0, 0).UTC(), Cluster: "default", Hosts: []string{"host-c"}, Removed: 1})
+
+	body, err := render(nil, m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("expected JSON without a template, got %s", body)
+	}
+	if got["event"] != "gc" || got["host"] != "host-a" || got["removed"] != float64(1) {
+		t.Errorf("unexpected default body %s", body)
+	}
+
+	tmpl, err := parseTemplate("slack", `{"text": {{json .Summary}}, "hosts": "{{join .Hosts ","}}"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err = render(tmpl, m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !json.Valid(body) || !strings.Contains(string(body), `"hosts": "host-c"`) {
+		t.Errorf("unexpected templated body %s", body)
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	if tmpl, err := parseTemplate("empty", ""); tmpl != nil || err != nil {
+		t.Errorf("expected no template for an empty one, got %v, %v", tmpl, err)
+	}
+	if _, err := parseTemplate("bad", "{{.Summary"); err == nil {
+		t.Error("expected an error for an unterminated action")
+	}
+	tmpl, err := parseTemplate("unknown", "{{.Nope}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := render(tmpl, Message{}); err == nil {
+		t.Error("expected an error rendering an unknown field")
+	}
+}
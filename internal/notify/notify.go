@@ -0,0 +1,290 @@
+// Package notify sends the changes the sync engine makes or sees to outbound
+// webhooks, e.g. to post to a chat room when a record is evicted or a dead
+// host's records are garbage-collected. Delivery is asynchronous: each webhook
+// has a bounded in-memory queue drained by its own goroutine, which retries
+// failed deliveries with exponential backoff.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/buildinfo"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+)
+
+// Defaults used when no option overrides them. These mirror the viper
+// defaults in internal/config (notifications.*); keep them in sync.
+const (
+	defaultQueueSize      = 100
+	defaultTimeout        = 5 * time.Second
+	defaultMaxRetries     = 5
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 60 * time.Second
+)
+
+// Delivery results reported to the delivery observer.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDropped = "dropped"
+)
+
+// Webhook is one destination. Events selects what is sent to it
+// (DefaultEvents when empty); Template renders the request body (the Message
+// as JSON when empty). Headers are added to every request.
+type Webhook struct {
+	Name     string
+	URL      string
+	Events   []string
+	Template string
+	Headers  map[string]string
+}
+
+// Option configures a Notifier at construction time.
+type Option func(*Notifier)
+
+// WithQueueSize sets how many notifications each webhook may have waiting.
+// Once full, new ones are dropped.
+func WithQueueSize(size int) Option {
+	return func(n *Notifier) {
+		if size > 0 {
+			n.queueSize = size
+		}
+	}
+}
+
+// WithTimeout sets the timeout of each delivery attempt.
+func WithTimeout(d time.Duration) Option {
+	return func(n *Notifier) {
+		if d > 0 {
+			n.client.Timeout = d
+		}
+	}
+}
+
+// WithRetries sets how many times a failed delivery is retried, and the
+// backoff bounds between attempts. max is clamped up to initial.
+func WithRetries(retries int, initial, max time.Duration) Option {
+	return func(n *Notifier) {
+		if retries >= 0 {
+			n.maxRetries = retries
+		}
+		if initial > 0 {
+			n.initialBackoff = initial
+		}
+		if max > 0 {
+			n.maxBackoff = max
+		}
+		if n.maxBackoff < n.initialBackoff {
+			n.maxBackoff = n.initialBackoff
+		}
+	}
+}
+
+// WithDeliveryObserver registers a callback invoked once per notification
+// with the webhook's name and the result: ResultSuccess, ResultFailure once
+// the retries are exhausted, or ResultDropped when the queue was full. It
+// must be non-blocking.
+func WithDeliveryObserver(fn func(webhook, result string)) Option {
+	return func(n *Notifier) { n.onDelivery = fn }
+}
+
+// Notifier fans changes out to its webhooks. It implements the engine's
+// change sink: Publish never blocks.
+type Notifier struct {
+	host           string
+	hooks          []*hook
+	client         *http.Client
+	logger         zerolog.Logger
+	onDelivery     func(webhook, result string)
+	queueSize      int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// hook is a webhook with its parsed template and queue.
+type hook struct {
+	Webhook
+	events map[string]bool
+	tmpl   *template.Template
+	queue  chan Message
+}
+
+// New returns a Notifier sending the changes seen by host to webhooks. It
+// fails on an unknown event or a template that does not parse. Nothing is
+// sent until Start.
+func New(host string, webhooks []Webhook, logger zerolog.Logger, opts ...Option) (*Notifier, error) {
+	n := &Notifier{
+		host:           host,
+		client:         &http.Client{Timeout: defaultTimeout},
+		logger:         logger,
+		queueSize:      defaultQueueSize,
+		maxRetries:     defaultMaxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	for _, w := range webhooks {
+		events := w.Events
+		if len(events) == 0 {
+			events = DefaultEvents
+		}
+		h := &hook{Webhook: w, events: make(map[string]bool, len(events)), queue: make(chan Message, n.queueSize)}
+		for _, e := range events {
+			if !knownEvents[e] {
+				return nil, fmt.Errorf("notifications.webhooks[%s]: unknown event %q", w.Name, e)
+			}
+			h.events[e] = true
+		}
+		tmpl, err := parseTemplate(w.Name, w.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.webhooks[%s].template: %w", w.Name, err)
+		}
+		h.tmpl = tmpl
+		n.hooks = append(n.hooks, h)
+	}
+	return n, nil
+}
+
+// wants reports whether a change sent as event goes to h. A webhook that
+// selects record_removed also gets evictions, which are removals.
+func (h *hook) wants(event string) bool {
+	return h.events[event] || (event == EventEviction && h.events[EventRemoved])
+}
+
+// Publish queues c for every webhook that selects it. A webhook whose queue
+// is full drops it.
+func (n *Notifier) Publish(c domain.Change) {
+	event := eventOf(c)
+	var m *Message
+	for _, h := range n.hooks {
+		if !h.wants(event) {
+			continue
+		}
+		if m == nil {
+			msg := newMessage(n.host, c)
+			m = &msg
+		}
+		select {
+		case h.queue <- *m:
+		default:
+			n.logger.Warn().Str("webhook", h.Name).Str("event", event).Msg("webhook queue is full; dropping the notification")
+			n.observe(h.Name, ResultDropped)
+		}
+	}
+}
+
+// Start delivers the queued notifications in the background until ctx is
+// cancelled. Notifications still queued then are not sent.
+func (n *Notifier) Start(ctx context.Context) {
+	for _, h := range n.hooks {
+		go n.run(ctx, h)
+	}
+}
+
+func (n *Notifier) run(ctx context.Context, h *hook) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-h.queue:
+			n.deliver(ctx, h, m)
+		}
+	}
+}
+
+// deliver sends m to h, retrying with backoff until it is accepted, fails
+// permanently, the retries run out or ctx is cancelled.
+func (n *Notifier) deliver(ctx context.Context, h *hook, m Message) {
+	logger := n.logger.With().Str("webhook", h.Name).Str("event", m.Event).Logger()
+	body, err := render(h.tmpl, m)
+	if err != nil {
+		logger.Error().Err(err).Msg("could not render the webhook template; dropping the notification")
+		n.observe(h.Name, ResultFailure)
+		return
+	}
+	backoff := n.initialBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, h, body)
+		if err == nil {
+			logger.Debug().Int("attempt", attempt+1).Msg("webhook notified")
+			n.observe(h.Name, ResultSuccess)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !retry || attempt >= n.maxRetries {
+			logger.Error().Err(err).Int("attempts", attempt+1).Msg("webhook delivery failed; dropping the notification")
+			n.observe(h.Name, ResultFailure)
+			return
+		}
+		logger.Warn().Err(err).Dur("backoff", backoff).Msg("webhook delivery failed; retrying after backoff")
+		if !sleepCtx(ctx, jitter(backoff)) {
+			return
+		}
+		backoff = min(backoff*2, n.maxBackoff)
+	}
+}
+
+// post sends body to h once. A failure is worth retrying unless the webhook
+// rejected the request itself (a 4xx other than 408 or 429).
+func (n *Notifier) post(ctx context.Context, h *hook, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "docker-coredns-sync/"+buildinfo.Version())
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || slices.Contains([]int{http.StatusRequestTimeout, http.StatusTooManyRequests}, resp.StatusCode)
+	return retryable, fmt.Errorf("webhook answered %s", resp.Status)
+}
+
+func (n *Notifier) observe(webhook, result string) {
+	if n.onDelivery != nil {
+		n.onDelivery(webhook, result)
+	}
+}
+
+// jitter returns d with up to +25% random jitter, so hosts notified of the
+// same outage do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/4+1))
+}
+
+// sleepCtx sleeps for d, returning false if ctx is cancelled first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,205 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+)
+
+// deliveries records what the delivery observer was told.
+type deliveries struct {
+	mu      sync.Mutex
+	results []string
+	done    chan struct{}
+}
+
+func newDeliveries() *deliveries { return &deliveries{done: make(chan struct{}, 100)} }
+
+func (d *deliveries) observe(webhook, result string) {
+	d.mu.Lock()
+	d.results = append(d.results, webhook+":"+result)
+	d.mu.Unlock()
+	d.done <- struct{}{}
+}
+
+// wait waits for n results and returns all of them.
+func (d *deliveries) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-d.done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for delivery %d", i+1)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.results...)
+}
+
+var gcChange = domain.Change{Type: domain.ChangeGC, Cluster: "default", Hosts: []string{"dead-host"}, Removed: 2}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New("host-a", []Webhook{{Name: "x", URL: "http://x", Events: []string{"bogus"}}}, zerolog.Nop()); err == nil {
+		t.Error("expected an error for an unknown event")
+	}
+	if _, err := New("host-a", []Webhook{{Name: "x", URL: "http://x", Template: "{{"}}, zerolog.Nop()); err == nil {
+		t.Error("expected an error for a bad template")
+	}
+}
+
+func TestNotifier_DeliversSelectedEvents(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Header, body}
+	}))
+	defer srv.Close()
+	d := newDeliveries()
+	n, err := New("host-a", []Webhook{
+		{Name: "default", URL: srv.URL, Headers: map[string]string{"authorization": "Bearer abc"}},
+		{Name: "removals", URL: srv.URL, Events: []string{EventRemoved}, Template: `{"text": {{json .Summary}}}`},
+	}, zerolog.Nop(), WithDeliveryObserver(d.observe))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n.Start(t.Context())
+
+	n.Publish(domain.Change{Type: domain.ChangeRegistered}) // selected by neither
+	n.Publish(gcChange)                                     // default only
+	n.Publish(domain.Change{                                // both: an eviction is a removal
+		Type:   domain.ChangeRemoved,
+		Reason: string(domain.RemovalEvicted),
+		Record: &domain.RecordIntent{Record: domain.Record{Name: "app.example.com", Kind: domain.RecordA, Value: "10.0.0.2"}},
+	})
+
+	if got := d.wait(t, 3); len(got) != 3 {
+		t.Fatalf("expected 3 deliveries, got %v", got)
+	}
+	var events []string
+	for range 3 {
+		req := <-received
+		var body map[string]any
+		if err := json.Unmarshal(req.body, &body); err != nil {
+			t.Fatalf("expected a JSON body, got %s", req.body)
+		}
+		if text, ok := body["text"]; ok {
+			events = append(events, "templated")
+			if text == "" {
+				t.Error("expected the templated summary")
+			}
+			continue
+		}
+		events = append(events, body["event"].(string))
+		if req.header.Get("Authorization") != "Bearer abc" || req.header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected headers %v", req.header)
+		}
+	}
+	slices.Sort(events)
+	if want := []string{"eviction", "gc", "templated"}; !slices.Equal(events, want) {
+		t.Errorf("expected bodies %v, got %v", want, events)
+	}
+	select {
+	case req := <-received:
+		t.Errorf("unexpected extra delivery %s", req.body)
+	default:
+	}
+}
+
+func TestNotifier_RetriesThenSucceeds(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	d := newDeliveries()
+	n, _ := New("host-a", []Webhook{{Name: "slack", URL: srv.URL}}, zerolog.Nop(),
+		WithRetries(5, time.Millisecond, 2*time.Millisecond), WithDeliveryObserver(d.observe))
+	n.Start(t.Context())
+
+	n.Publish(gcChange)
+
+	if got := d.wait(t, 1); got[0] != "slack:success" {
+		t.Errorf("expected success after retrying, got %v", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestNotifier_FailureResults(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		want   int // attempts
+	}{
+		"retries exhausted":    {http.StatusBadGateway, 3},
+		"rejected permanently": {http.StatusBadRequest, 1},
+		"rate limited":         {http.StatusTooManyRequests, 3},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calls++
+				mu.Unlock()
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+			d := newDeliveries()
+			n, _ := New("host-a", []Webhook{{Name: "slack", URL: srv.URL}}, zerolog.Nop(),
+				WithRetries(2, time.Millisecond, time.Millisecond), WithDeliveryObserver(d.observe))
+			n.Start(t.Context())
+
+			n.Publish(gcChange)
+
+			if got := d.wait(t, 1); got[0] != "slack:failure" {
+				t.Errorf("expected a failure, got %v", got)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != tc.want {
+				t.Errorf("expected %d attempts, got %d", tc.want, calls)
+			}
+		})
+	}
+}
+
+func TestNotifier_DropsWhenQueueFull(t *testing.T) {
+	d := newDeliveries()
+	n, _ := New("host-a", []Webhook{{Name: "slack", URL: "http://127.0.0.1:0"}}, zerolog.Nop(),
+		WithQueueSize(2), WithDeliveryObserver(d.observe))
+
+	// Not started, so nothing drains the queue; Publish must not block.
+	for range 5 {
+		n.Publish(gcChange)
+	}
+
+	got := d.wait(t, 3)
+	for _, r := range got {
+		if r != "slack:dropped" {
+			t.Errorf("expected only drops, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/rs/zerolog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// cacheMetrics is an optional sink for watch-cache metrics. Implementations
+// must be safe for concurrent use.
+type cacheMetrics interface {
+	SetCacheStaleness(d time.Duration)
+	IncCacheResync(reason string)
+}
+
+// Reasons a watch cache reloads its contents, used as metric labels.
+const (
+	cacheResyncInitial   = "initial"
+	cacheResyncCompacted = "compacted"
+	cacheResyncError     = "watch_error"
+)
+
+const (
+	cacheRetryInitialBackoff = 1 * time.Second
+	cacheRetryMaxBackoff     = 30 * time.Second
+	// cacheCatchUpTimeout bounds how long List waits for the watch to deliver
+	// this host's own writes before falling back to a direct read.
+	cacheCatchUpTimeout = 2 * time.Second
+)
+
+// etcdCache mirrors every record under the path prefix in memory. It loads the
+// prefix with a single Get and then follows a Watch from the revision that Get
+// returned. A compacted or failed watch triggers a full reload.
+type etcdCache struct {
+	client  etcdClient
+	prefix  string
+	logger  zerolog.Logger
+	metrics cacheMetrics
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	records map[string]listedRecord
+	rev     int64
+	synced  bool
+	// confirmed is when the watch last showed the cache to be current: the
+	// load, or any watch response (events or a progress notification).
+	confirmed time.Time
+}
+
+func newEtcdCache(client etcdClient, prefix string, logger zerolog.Logger) *etcdCache {
+	c := &etcdCache{
+		client:  client,
+		prefix:  prefix,
+		logger:  logger.With().Str("component", "etcd_cache").Logger(),
+		records: make(map[string]listedRecord),
+	}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// run keeps the cache in sync until ctx is cancelled.
+func (c *etcdCache) run(ctx context.Context) {
+	reason := cacheResyncInitial
+	backoff := cacheRetryInitialBackoff
+	for ctx.Err() == nil {
+		rev, err := c.load(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Warn().Err(err).Dur("retry_in", backoff).Msg("watch cache load failed; List reads etcd directly until it succeeds")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > cacheRetryMaxBackoff {
+				backoff = cacheRetryMaxBackoff
+			}
+			continue
+		}
+		backoff = cacheRetryInitialBackoff
+		if c.metrics != nil {
+			c.metrics.IncCacheResync(reason)
+		}
+		c.logger.Info().Int64("revision", rev).Str("reason", reason).Msg("watch cache loaded")
+		reason = c.follow(ctx, rev)
+		c.setSynced(false)
+	}
+}
+
+// load replaces the cache contents with a linearizable read of the prefix and
+// returns the revision it was read at.
+func (c *etcdCache) load(ctx context.Context) (int64, error) {
+	resp, err := c.client.Get(ctx, c.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("load prefix %q: %w", c.prefix, err)
+	}
+	records := make(map[string]listedRecord, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if ri := c.parse(string(kv.Key), kv.Value); ri != nil {
+			records[string(kv.Key)] = listedRecord{key: string(kv.Key), modRev: kv.ModRevision, intent: ri}
+		}
+	}
+	var rev int64
+	if resp.Header != nil {
+		rev = resp.Header.Revision
+	}
+	c.mu.Lock()
+	c.records = records
+	c.rev = rev
+	c.synced = true
+	c.confirmed = time.Now()
+	c.changed.Broadcast()
+	c.mu.Unlock()
+	return rev, nil
+}
+
+// follow applies watch events from rev+1 until the watch ends, and returns the
+// reason the cache must be reloaded.
+func (c *etcdCache) follow(ctx context.Context, rev int64) string {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := c.client.Watch(wctx, c.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1), clientv3.WithProgressNotify())
+	for wresp := range wch {
+		if wresp.CompactRevision != 0 {
+			c.logger.Warn().Int64("compact_revision", wresp.CompactRevision).Msg("watch cache fell behind a compaction; reloading")
+			return cacheResyncCompacted
+		}
+		if err := wresp.Err(); err != nil {
+			c.logger.Warn().Err(err).Msg("watch cache watch failed; reloading")
+			return cacheResyncError
+		}
+		c.apply(wresp)
+	}
+	if ctx.Err() == nil {
+		c.logger.Warn().Msg("watch cache watch closed; reloading")
+	}
+	return cacheResyncError
+}
+
+func (c *etcdCache) apply(wresp clientv3.WatchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ev := range wresp.Events {
+		key := string(ev.Kv.Key)
+		switch ev.Type {
+		case clientv3.EventTypePut:
+			if ri := c.parse(key, ev.Kv.Value); ri != nil {
+				c.records[key] = listedRecord{key: key, modRev: ev.Kv.ModRevision, intent: ri}
+			} else {
+				delete(c.records, key)
+			}
+		case clientv3.EventTypeDelete:
+			delete(c.records, key)
+		}
+	}
+	if wresp.Header.Revision > c.rev {
+		c.rev = wresp.Header.Revision
+	}
+	c.confirmed = time.Now()
+	c.changed.Broadcast()
+}
+
+func (c *etcdCache) parse(key string, value []byte) *domain.RecordIntent {
+	ri, err := unmarshalEtcdValue(key, string(value), c.prefix)
+	if err != nil {
+		c.logger.Warn().Err(err).Str("key", key).Msg("watch cache: failed to parse record")
+		return nil
+	}
+	return ri
+}
+
+func (c *etcdCache) setSynced(synced bool) {
+	c.mu.Lock()
+	c.synced = synced
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+// list returns the cached records, ordered by key like a prefix Get, and the
+// revision they reflect, once the cache has caught up to minRev. ok is false
+// when the cache is not synced or does not catch up within
+// cacheCatchUpTimeout; the caller then reads etcd directly.
+func (c *etcdCache) list(ctx context.Context, minRev int64) ([]listedRecord, int64, bool) {
+	// Ask etcd to confirm the watch is current, so staleness reflects the
+	// watch's health rather than how recently a record changed.
+	_ = c.client.RequestProgress(ctx)
+
+	deadline := time.Now().Add(cacheCatchUpTimeout)
+	timer := time.AfterFunc(cacheCatchUpTimeout, func() {
+		c.mu.Lock()
+		c.changed.Broadcast()
+		c.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.synced && c.rev < minRev && time.Now().Before(deadline) && ctx.Err() == nil {
+		c.changed.Wait()
+	}
+	if c.metrics != nil && !c.confirmed.IsZero() {
+		c.metrics.SetCacheStaleness(time.Since(c.confirmed))
+	}
+	if !c.synced || c.rev < minRev {
+		return nil, 0, false
+	}
+	keys := make([]string, 0, len(c.records))
+	for k := range c.records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]listedRecord, 0, len(keys))
+	for _, k := range keys {
+		rec := c.records[k]
+		ri := *rec.intent
+		rec.intent = &ri
+		out = append(out, rec)
+	}
+	return out, c.rev, true
+}
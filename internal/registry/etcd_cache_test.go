@@ -0,0 +1,250 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type recordingCacheMetrics struct {
+	mu        sync.Mutex
+	resyncs   map[string]int
+	staleness time.Duration
+}
+
+func (r *recordingCacheMetrics) SetCacheStaleness(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.staleness = d
+}
+
+func (r *recordingCacheMetrics) IncCacheResync(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resyncs == nil {
+		r.resyncs = map[string]int{}
+	}
+	r.resyncs[reason]++
+}
+
+func (r *recordingCacheMetrics) resyncCount(reason string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resyncs[reason]
+}
+
+// cacheHarness wires a registry with etcd.watch_cache on to a mock whose
+// prefix Get serves kvs at revision rev and whose watches are handed to the
+// test through watches.
+type cacheHarness struct {
+	mock    *mockEtcdClient
+	reg     *EtcdRegistry
+	metrics *recordingCacheMetrics
+	watches chan chan clientv3.WatchResponse
+	revs    chan int64
+	gets    atomic.Int32
+
+	mu  sync.Mutex
+	kvs []*mvccpb.KeyValue
+	rev int64
+}
+
+func newCacheHarness(t *testing.T) *cacheHarness {
+	t.Helper()
+	h := &cacheHarness{
+		mock:    newMockEtcdClient(),
+		metrics: &recordingCacheMetrics{},
+		watches: make(chan chan clientv3.WatchResponse, 4),
+		revs:    make(chan int64, 4),
+	}
+	h.mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		h.gets.Add(1)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return &clientv3.GetResponse{
+			Header: &etcdserverpb.ResponseHeader{Revision: h.rev},
+			Kvs:    h.kvs,
+		}, nil
+	}
+	h.mock.watchFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+		ch := make(chan clientv3.WatchResponse)
+		h.revs <- clientv3.OpGet(key, opts...).Rev()
+		h.watches <- ch
+		return ch
+	}
+	cfg := testConfig()
+	cfg.WatchCache = true
+	h.reg = NewEtcdRegistry(h.mock, cfg, "docker-host", 30, testLogger())
+	h.reg.SetCacheMetrics(h.metrics)
+	return h
+}
+
+func (h *cacheHarness) setStore(rev int64, kvs ...*mvccpb.KeyValue) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rev, h.kvs = rev, kvs
+}
+
+// nextWatch waits for the cache to open a watch and returns it with the
+// revision it starts from.
+func (h *cacheHarness) nextWatch(t *testing.T) (chan clientv3.WatchResponse, int64) {
+	t.Helper()
+	select {
+	case ch := <-h.watches:
+		return ch, <-h.revs
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the cache to open a watch")
+		return nil, 0
+	}
+}
+
+func recordKV(t *testing.T, key, name, value string) *mvccpb.KeyValue {
+	t.Helper()
+	v, err := marshalEtcdValue(makeIntent(name, value, domain.RecordA))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v)}
+}
+
+func putEvent(rev int64, kv *mvccpb.KeyValue) clientv3.WatchResponse {
+	return clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: rev},
+		Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: kv}},
+	}
+}
+
+func TestEtcdCache_ListServedFromCacheAfterLoad(t *testing.T) {
+	h := newCacheHarness(t)
+	h.setStore(10, recordKV(t, "/skydns/com/example/app/x1", "app.example.com", "10.0.0.1"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.reg.StartWatchCache(ctx)
+	_, startRev := h.nextWatch(t)
+	if startRev != 11 {
+		t.Errorf("expected the watch to start right after the loaded revision (11), got %d", startRev)
+	}
+
+	got, err := h.reg.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Record.Name != "app.example.com" {
+		t.Fatalf("expected the loaded record, got %v", got)
+	}
+	if n := h.gets.Load(); n != 1 {
+		t.Errorf("expected only the initial Get, got %d", n)
+	}
+	if h.metrics.resyncCount(cacheResyncInitial) != 1 {
+		t.Error("expected the initial load to be counted as a resync")
+	}
+}
+
+func TestEtcdCache_AppliesWatchEvents(t *testing.T) {
+	h := newCacheHarness(t)
+	h.setStore(10, recordKV(t, "/skydns/com/example/app/x1", "app.example.com", "10.0.0.1"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.reg.StartWatchCache(ctx)
+	wch, _ := h.nextWatch(t)
+
+	wch <- putEvent(11, recordKV(t, "/skydns/com/example/web/x1", "web.example.com", "10.0.0.2"))
+	wch <- clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: 12},
+		Events: []*clientv3.Event{{Type: clientv3.EventTypeDelete, Kv: &mvccpb.KeyValue{Key: []byte("/skydns/com/example/app/x1")}}},
+	}
+	// An unbuffered send returns once the cache has received the response; a
+	// progress notification after it guarantees both were applied.
+	wch <- clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 12}}
+
+	got, err := h.reg.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Record.Name != "web.example.com" {
+		t.Fatalf("expected only web.example.com after put+delete, got %v", got)
+	}
+}
+
+func TestEtcdCache_ReloadsAfterCompaction(t *testing.T) {
+	h := newCacheHarness(t)
+	h.setStore(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.reg.StartWatchCache(ctx)
+	wch, _ := h.nextWatch(t)
+
+	h.setStore(50, recordKV(t, "/skydns/com/example/app/x1", "app.example.com", "10.0.0.1"))
+	wch <- clientv3.WatchResponse{CompactRevision: 40}
+
+	_, startRev := h.nextWatch(t)
+	if startRev != 51 {
+		t.Errorf("expected the new watch to start after the reloaded revision (51), got %d", startRev)
+	}
+	if h.metrics.resyncCount(cacheResyncCompacted) != 1 {
+		t.Error("expected the compaction reload to be counted")
+	}
+	got, _ := h.reg.List(ctx)
+	if len(got) != 1 {
+		t.Errorf("expected the reloaded record, got %v", got)
+	}
+}
+
+func TestEtcdCache_ListReadsDirectlyUntilSynced(t *testing.T) {
+	h := newCacheHarness(t)
+	h.setStore(10, recordKV(t, "/skydns/com/example/app/x1", "app.example.com", "10.0.0.1"))
+
+	// Never started: every List falls back to a prefix Get.
+	got, err := h.reg.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || h.gets.Load() != 1 {
+		t.Errorf("expected a direct read, got %d records after %d gets", len(got), h.gets.Load())
+	}
+}
+
+func TestEtcdCache_ListWaitsForOwnWrites(t *testing.T) {
+	h := newCacheHarness(t)
+	h.setStore(10)
+	h.mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		return &mockTxn{commitFunc: func() (*clientv3.TxnResponse, error) {
+			return &clientv3.TxnResponse{Succeeded: true, Header: &etcdserverpb.ResponseHeader{Revision: 20}}, nil
+		}}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.reg.StartWatchCache(ctx)
+	wch, _ := h.nextWatch(t)
+
+	if err := h.reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		wch <- putEvent(20, recordKV(t, "/skydns/com/example/app/x1", "app.example.com", "10.0.0.1"))
+	}()
+
+	gets := h.gets.Load()
+	got, err := h.reg.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected List to wait for the cache to see this host's write, got %v", got)
+	}
+	if h.gets.Load() != gets {
+		t.Error("expected the caught-up cache to serve List without a direct read")
+	}
+}
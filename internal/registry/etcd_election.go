@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// gcLeaderPrefix is the prefix of the cross-host GC election. Its layout is
+// that of etcd's concurrency.Election: each candidate puts a key named after
+// its lease, and the candidate whose key was created first leads. Candidates
+// campaign with their heartbeat lease, so a host that stops heartbeating also
+// stops leading, and the next candidate in creation order takes over.
+const gcLeaderPrefix = config.GCLeaderKeyPrefix
+
+func gcCandidateKey(lease clientv3.LeaseID) string {
+	return fmt.Sprintf("%s/%x", gcLeaderPrefix, int64(lease))
+}
+
+// campaign enters this host into the GC election under its heartbeat lease.
+// Failures are only logged: GCLeader retries before reporting leadership.
+func (er *EtcdRegistry) campaign(ctx context.Context, lease clientv3.LeaseID) {
+	key := gcCandidateKey(lease)
+	if _, err := er.client.Put(ctx, key, er.hostname, clientv3.WithLease(lease)); err != nil {
+		er.incEtcdError()
+		er.logger.Warn().Err(err).Str("key", key).Msg("failed to join the GC leader election; retrying on the next GC")
+		return
+	}
+	er.hbMu.Lock()
+	if er.hbLease == lease {
+		er.gcCandidate = key
+	}
+	er.hbMu.Unlock()
+}
+
+// GCLeader reports which host currently leads the cross-host GC election and
+// whether it is this one. A host that is not heartbeating never leads. The
+// read may be served by any member: a briefly stale answer can at worst let
+// two hosts collect at once, which is safe because collection itself is
+// authorized by the linearizable GetLiveHostnames.
+func (er *EtcdRegistry) GCLeader(ctx context.Context) (leader string, isLeader bool, err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.gc_leader")
+	defer func() { tracing.End(span, err) }()
+	er.hbMu.Lock()
+	active, lease, candidate := er.hbActive, er.hbLease, er.gcCandidate
+	er.hbMu.Unlock()
+	if active && candidate == "" {
+		er.campaign(ctx, lease)
+		er.hbMu.Lock()
+		candidate = er.gcCandidate
+		er.hbMu.Unlock()
+	}
+
+	resp, err := er.client.Get(ctx, gcLeaderPrefix+"/", append(clientv3.WithFirstCreate(), clientv3.WithSerializable())...)
+	if err != nil {
+		er.incEtcdError()
+		return "", false, fmt.Errorf("read GC leader under %q: %w", gcLeaderPrefix, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	kv := resp.Kvs[0]
+	return string(kv.Value), active && candidate != "" && string(kv.Key) == candidate, nil
+}
+
+// resign withdraws this host's GC candidacy, so a peer takes over at once
+// rather than after the heartbeat lease expires.
+func (er *EtcdRegistry) resign() {
+	er.hbMu.Lock()
+	key := er.gcCandidate
+	er.gcCandidate = ""
+	er.hbMu.Unlock()
+	if key == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := er.client.Delete(ctx, key); err != nil {
+		er.logger.Warn().Err(err).Msg("withdraw from the GC leader election on shutdown")
+	}
+}
@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// electionAt makes the GC election read return first as its leading key.
+func electionAt(mock *mockEtcdClient, first *mvccpb.KeyValue) {
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		if key != "/docker-coredns-sync/gc-leader/" {
+			return &clientv3.GetResponse{}, nil
+		}
+		op := clientv3.OpGet(key, opts...)
+		if !op.IsSerializable() {
+			return nil, errors.New("expected a serializable read")
+		}
+		if first == nil {
+			return &clientv3.GetResponse{}, nil
+		}
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{first}}, nil
+	}
+}
+
+func heartbeatingRegistry(t *testing.T, mock *mockEtcdClient) *EtcdRegistry {
+	t.Helper()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("start heartbeat: %v", err)
+	}
+	return reg
+}
+
+func TestEtcdRegistry_GCLeader_ThisHostLeads(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := heartbeatingRegistry(t, mock)
+	electionAt(mock, &mvccpb.KeyValue{Key: []byte("/docker-coredns-sync/gc-leader/1"), Value: []byte("docker-host")})
+
+	leader, isLeader, err := reg.GCLeader(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if leader != "docker-host" || !isLeader {
+		t.Errorf("expected this host to lead, got leader %q (is leader: %t)", leader, isLeader)
+	}
+}
+
+func TestEtcdRegistry_GCLeader_PeerLeads(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := heartbeatingRegistry(t, mock)
+	electionAt(mock, &mvccpb.KeyValue{Key: []byte("/docker-coredns-sync/gc-leader/2a"), Value: []byte("peer-host")})
+
+	leader, isLeader, err := reg.GCLeader(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if leader != "peer-host" || isLeader {
+		t.Errorf("expected peer-host to lead, got leader %q (is leader: %t)", leader, isLeader)
+	}
+}
+
+func TestEtcdRegistry_GCLeader_NeverLeadsWithoutHeartbeat(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	// A stale key left with this host's name must not make it the leader.
+	electionAt(mock, &mvccpb.KeyValue{Key: []byte("/docker-coredns-sync/gc-leader/1"), Value: []byte("docker-host")})
+
+	if _, isLeader, err := reg.GCLeader(context.Background()); err != nil || isLeader {
+		t.Errorf("expected no leadership without a heartbeat, got %t (err %v)", isLeader, err)
+	}
+	if mock.putCalled {
+		t.Error("expected no campaign without a heartbeat lease")
+	}
+}
+
+func TestEtcdRegistry_GCLeader_RetriesFailedCampaign(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.putFunc = func(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+		if key == "/docker-coredns-sync/gc-leader/1" {
+			return nil, errors.New("etcd unavailable")
+		}
+		return &clientv3.PutResponse{}, nil
+	}
+	reg := heartbeatingRegistry(t, mock)
+	if reg.gcCandidate != "" {
+		t.Fatal("expected the failed campaign to leave no candidacy")
+	}
+	mock.putFunc = nil
+	electionAt(mock, &mvccpb.KeyValue{Key: []byte("/docker-coredns-sync/gc-leader/1"), Value: []byte("docker-host")})
+
+	if _, isLeader, err := reg.GCLeader(context.Background()); err != nil || !isLeader {
+		t.Errorf("expected the campaign to be retried and win, got %t (err %v)", isLeader, err)
+	}
+}
+
+func TestEtcdRegistry_StopHeartbeat_Resigns(t *testing.T) {
+	mock := newMockEtcdClient()
+	var deleted []string
+	mock.deleteFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+		deleted = append(deleted, key)
+		return &clientv3.DeleteResponse{}, nil
+	}
+	reg := heartbeatingRegistry(t, mock)
+
+	reg.StopHeartbeat()
+
+	found := false
+	for _, key := range deleted {
+		found = found || key == "/docker-coredns-sync/gc-leader/1"
+	}
+	if !found {
+		t.Errorf("expected the GC candidate key to be deleted, got %v", deleted)
+	}
+}
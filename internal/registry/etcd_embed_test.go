@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// localURL returns an http URL on a free local port.
+func localURL(t *testing.T) url.URL {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return url.URL{Scheme: "http", Host: addr}
+}
+
+// embeddedEtcd starts a single-member etcd with its default limits, such as
+// --max-txn-ops 128, and returns a client connected to it.
+func embeddedEtcd(t *testing.T) *clientv3.Client {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("starts an embedded etcd")
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	client, peer := localURL(t), localURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{client}, []url.URL{client}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peer}, []url.URL{peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("start embedded etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("embedded etcd did not become ready")
+	}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{client.String()}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("connect to embedded etcd: %v", err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	return cli
+}
+
+func TestEtcdRegistry_ApplyPlan_OversizedPlanAgainstEtcd(t *testing.T) {
+	cli := embeddedEtcd(t)
+	ctx := context.Background()
+	reg := NewEtcdRegistry(cli, testConfig(), "docker-host", 0, testLogger())
+
+	// One name holds more records than a transaction may remove...
+	const n = maxTxnOps + 10
+	var stale []*domain.RecordIntent
+	for i := range n {
+		ri := makeIntent("busy.example.com", fmt.Sprintf("10.1.%d.%d", i/250, i%250+1), domain.RecordA)
+		value, err := marshalEtcdValue(ri)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if _, err := cli.Put(ctx, fmt.Sprintf("/skydns/com/example/busy/x%d", i+1), value); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		stale = append(stale, ri)
+	}
+	// ...and the plan touches more names, and so holds more locks, than a
+	// transaction may compare.
+	names := []string{"busy.example.com"}
+	var toAdd []*domain.RecordIntent
+	for i := range n {
+		name := fmt.Sprintf("app%d.example.com", i)
+		names = append(names, name)
+		toAdd = append(toAdd, makeIntent(name, "10.0.0.1", domain.RecordA))
+	}
+	toAdd = append(toAdd, makeIntent("alias.example.com", "app0.example.com", domain.RecordCNAME))
+	names = append(names, "alias.example.com")
+
+	if _, err := reg.List(ctx); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var applied []domain.Mutation
+	err := reg.LockTransaction(ctx, names, func(ctx context.Context) error {
+		var err error
+		applied, err = reg.ApplyPlan(ctx, toAdd, stale)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("expected etcd to accept every transaction, got %v", err)
+	}
+	added, removed := domain.SplitMutations(applied)
+	if len(added) != len(toAdd) || len(removed) != n {
+		t.Errorf("expected %d added and %d removed, got %d and %d", len(toAdd), n, len(added), len(removed))
+	}
+	listed, err := reg.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed) != len(toAdd) {
+		t.Errorf("expected only the added records left, got %d records", len(listed))
+	}
+}
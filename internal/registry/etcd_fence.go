@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdFence is the set of locks a LockTransaction holds. Their creation
+// revisions act as fencing tokens: a write inside the critical section only
+// commits while every lock key still exists at the revision it was created
+// with. Once a lock's lease expires its key is deleted, and a key re-created by
+// another holder has a newer revision, so a holder that lost its lock can never
+// write over the new holder's changes.
+type etcdFence struct {
+	locks []heldLease
+	// cancel ends the critical section's context once a lock is known to be
+	// lost, so the section's remaining writes are abandoned.
+	cancel context.CancelCauseFunc
+}
+
+type etcdFenceKey struct{}
+
+// withEtcdFence returns ctx carrying f, for the registry's writes to condition
+// themselves on.
+func withEtcdFence(ctx context.Context, f *etcdFence) context.Context {
+	return context.WithValue(ctx, etcdFenceKey{}, f)
+}
+
+// etcdFenceFrom returns the fence carried by ctx, or nil outside a
+// LockTransaction.
+func etcdFenceFrom(ctx context.Context) *etcdFence {
+	f, _ := ctx.Value(etcdFenceKey{}).(*etcdFence)
+	return f
+}
+
+// covering returns the fence of the locks on names, which are the only ones a
+// write to those names depends on. Fencing a write on every lock held would
+// put one compare per locked name in each transaction, soon more than etcd
+// allows. If no lock covers names, the whole fence is kept. Nil-safe.
+func (f *etcdFence) covering(names ...string) *etcdFence {
+	if f == nil {
+		return nil
+	}
+	want := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		want[name] = struct{}{}
+	}
+	var locks []heldLease
+	for _, l := range f.locks {
+		if _, ok := want[l.name]; ok {
+			locks = append(locks, l)
+		}
+	}
+	if len(locks) == 0 {
+		return f
+	}
+	return &etcdFence{locks: locks, cancel: f.cancel}
+}
+
+// cmps returns the compares a fenced transaction must include. Nil-safe.
+func (f *etcdFence) cmps() []clientv3.Cmp {
+	if f == nil {
+		return nil
+	}
+	cmps := make([]clientv3.Cmp, 0, len(f.locks))
+	for _, l := range f.locks {
+		cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(l.lockKey), "=", l.rev))
+	}
+	return cmps
+}
+
+// checks returns the reads a fenced transaction appends to its Else branch, so
+// that lost can tell a lost lock from the transaction's own compares failing.
+// Nil-safe.
+func (f *etcdFence) checks() []clientv3.Op {
+	if f == nil {
+		return nil
+	}
+	ops := make([]clientv3.Op, 0, len(f.locks))
+	for _, l := range f.locks {
+		ops = append(ops, clientv3.OpGet(l.lockKey, clientv3.WithKeysOnly()))
+	}
+	return ops
+}
+
+// lost inspects the Else responses of a failed fenced transaction, whose last
+// entries are the results of checks, and reports the first lock no longer
+// held, ending the critical section. It returns nil if every lock is still
+// held. Nil-safe.
+func (f *etcdFence) lost(resps []*etcdserverpb.ResponseOp) error {
+	if f == nil || len(resps) < len(f.locks) {
+		return nil
+	}
+	resps = resps[len(resps)-len(f.locks):]
+	for i, l := range f.locks {
+		rr := resps[i].GetResponseRange()
+		if rr == nil || len(rr.Kvs) == 0 || rr.Kvs[0].CreateRevision != l.rev {
+			err := &domain.LockLostError{Lock: l.name}
+			f.cancel(err)
+			return err
+		}
+	}
+	return nil
+}
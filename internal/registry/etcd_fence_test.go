@@ -0,0 +1,236 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// isLockAcquire reports whether txn is a lock acquisition.
+func isLockAcquire(txn *mockTxn) bool {
+	return len(txn.thenOps) == 1 && txn.thenOps[0].IsPut() && string(txn.thenOps[0].KeyBytes()) == "/locks/app.example.com"
+}
+
+// fencedTxns makes lock acquisitions succeed at revision lockRev and every
+// other transaction commit with commit. Every transaction is recorded.
+func fencedTxns(mock *mockEtcdClient, lockRev int64, commit func(txn *mockTxn) *clientv3.TxnResponse) {
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		txn := &mockTxn{ctx: ctx}
+		txn.commitFunc = func() (*clientv3.TxnResponse, error) {
+			if isLockAcquire(txn) {
+				return &clientv3.TxnResponse{Succeeded: true, Header: &etcdserverpb.ResponseHeader{Revision: lockRev}}, nil
+			}
+			return commit(txn), nil
+		}
+		mock.mu.Lock()
+		mock.txns = append(mock.txns, txn)
+		mock.mu.Unlock()
+		return txn
+	}
+}
+
+// lockTakenOver is the Else response of a fenced transaction showing the lock
+// key re-created at revision rev by another holder.
+func lockTakenOver(rev int64) *etcdserverpb.ResponseOp {
+	return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: &etcdserverpb.RangeResponse{
+		Kvs: []*mvccpb.KeyValue{{Key: []byte("/locks/app.example.com"), CreateRevision: rev}},
+	}}}
+}
+
+func emptyRange() *etcdserverpb.ResponseOp {
+	return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: &etcdserverpb.RangeResponse{}}}
+}
+
+func TestEtcdRegistry_LockTransaction_FencesWrites(t *testing.T) {
+	mock := newMockEtcdClient()
+	fencedTxns(mock, 7, func(*mockTxn) *clientv3.TxnResponse { return &clientv3.TxnResponse{Succeeded: true} })
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		return reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	register := mock.txns[1]
+	if len(register.ifCmps) != 2 {
+		t.Fatalf("expected the key compare and the fence, got %d compares", len(register.ifCmps))
+	}
+	fence := register.ifCmps[1]
+	if string(fence.Key) != "/locks/app.example.com" || fence.Target != etcdserverpb.Compare_CREATE ||
+		fence.TargetUnion.(*etcdserverpb.Compare_CreateRevision).CreateRevision != 7 {
+		t.Errorf("expected CreateRevision(lock) == 7, got %+v", fence)
+	}
+	if n := len(register.elseOps); n != 2 || string(register.elseOps[1].KeyBytes()) != "/locks/app.example.com" {
+		t.Errorf("expected the lock key to be read back on failure, got %d else ops", n)
+	}
+
+	release := mock.txns[2]
+	if len(release.ifCmps) != 1 || release.ifCmps[0].TargetUnion.(*etcdserverpb.Compare_CreateRevision).CreateRevision != 7 {
+		t.Errorf("expected the release to only delete the lock key we created, got %+v", release.ifCmps)
+	}
+}
+
+func TestEtcdRegistry_Register_RefusedAfterLockLost(t *testing.T) {
+	mock := newMockEtcdClient()
+	fencedTxns(mock, 7, func(*mockTxn) *clientv3.TxnResponse {
+		return &clientv3.TxnResponse{Succeeded: false, Responses: []*etcdserverpb.ResponseOp{emptyRange(), lockTakenOver(9)}}
+	})
+	m := &countingMetrics{}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	reg.SetMetrics(m)
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+		if ctx.Err() == nil {
+			t.Error("expected the critical section's context to be cancelled")
+		}
+		return err
+	})
+	var lost *domain.LockLostError
+	if !errors.As(err, &lost) || lost.Lock != "app.example.com" {
+		t.Fatalf("expected a lost lock on app.example.com, got %v", err)
+	}
+	if len(mock.txnPuts()) != 2 {
+		// The lock acquisition and the single refused register.
+		t.Errorf("expected the register not to be retried, got %d puts", len(mock.txnPuts()))
+	}
+	if _, lockFailures := m.snapshot(); lockFailures != 1 {
+		t.Errorf("expected 1 lock failure counted, got %d", lockFailures)
+	}
+}
+
+func TestEtcdRegistry_Remove_RefusedAfterLockLost(t *testing.T) {
+	mock := newMockEtcdClient()
+	ri := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{listedKV(t, "/skydns/com/example/app/x1", 3, ri)}}, nil
+	}
+	fencedTxns(mock, 7, func(*mockTxn) *clientv3.TxnResponse {
+		return &clientv3.TxnResponse{Succeeded: false, Responses: []*etcdserverpb.ResponseOp{emptyRange()}}
+	})
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		return reg.Remove(ctx, ri)
+	})
+	if !errors.As(err, new(*domain.LockLostError)) {
+		t.Fatalf("expected a lost lock, got %v", err)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_LockLostIsNotAConflict(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	actual := listAt(t, mock, reg, 10)
+	fencedTxns(mock, 7, func(*mockTxn) *clientv3.TxnResponse {
+		return &clientv3.TxnResponse{Succeeded: false, Header: &etcdserverpb.ResponseHeader{Revision: 12}, Responses: []*etcdserverpb.ResponseOp{lockTakenOver(11)}}
+	})
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		_, err := reg.ApplyPlan(ctx, []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, actual)
+		return err
+	})
+	if !errors.As(err, new(*domain.LockLostError)) {
+		t.Fatalf("expected a lost lock, got %v", err)
+	}
+	if errors.Is(err, domain.ErrPlanConflict) {
+		t.Error("a lost lock must not be reported as a plan conflict, which would be replanned")
+	}
+}
+
+func TestEtcdRegistry_LockTransaction_KeepAliveEndsCriticalSection(t *testing.T) {
+	mock := newMockEtcdClient()
+	kaCh := make(chan *clientv3.LeaseKeepAliveResponse)
+	mock.keepAliveFunc = func(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+		return kaCh, nil
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		// The lease expires: etcd stops answering keepalives.
+		close(kaCh)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			t.Error("expected the context to be cancelled once the lease was lost")
+			return nil
+		}
+	})
+	var lost *domain.LockLostError
+	if !errors.As(err, &lost) || lost.Lock != "app.example.com" {
+		t.Errorf("expected a lost lock on app.example.com, got %v", err)
+	}
+}
+
+func TestEtcdRegistry_Register_UnfencedOutsideLock(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(mock.txns[0].ifCmps); n != 1 {
+		t.Errorf("expected only the key compare outside a lock, got %d compares", n)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_FencesEachNameOnItsOwnLock(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		txn := &mockTxn{ctx: ctx}
+		txn.commitFunc = func() (*clientv3.TxnResponse, error) {
+			return &clientv3.TxnResponse{Succeeded: true, Header: &etcdserverpb.ResponseHeader{Revision: 7}}, nil
+		}
+		mock.mu.Lock()
+		mock.txns = append(mock.txns, txn)
+		mock.mu.Unlock()
+		return txn
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	actual := listAt(t, mock, reg, 5)
+	// More names, and so locks, than etcd allows compares in one transaction.
+	var names []string
+	var toAdd []*domain.RecordIntent
+	for i := range maxTxnOps + 10 {
+		name := fmt.Sprintf("app%d.example.com", i)
+		names = append(names, name)
+		toAdd = append(toAdd, makeIntent(name, "10.0.0.1", domain.RecordA))
+	}
+	mock.txns = nil
+
+	err := reg.LockTransaction(context.Background(), names, func(ctx context.Context) error {
+		_, err := reg.ApplyPlan(ctx, toAdd, actual)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var plans int
+	for _, txn := range mock.txns {
+		if len(txn.thenOps) != 1 || !txn.thenOps[0].IsPut() || strings.HasPrefix(string(txn.thenOps[0].KeyBytes()), "/locks/") {
+			continue
+		}
+		plans++
+		key := string(txn.thenOps[0].KeyBytes())
+		if len(txn.ifCmps) != 2 || len(txn.elseOps) != 1 {
+			t.Fatalf("%s: expected the name guard and one fence, got %d compares and %d else ops", key, len(txn.ifCmps), len(txn.elseOps))
+		}
+		name := fqdnFromKey("/skydns", key)
+		if lock := string(txn.ifCmps[1].Key); lock != "/locks/"+name {
+			t.Errorf("%s: expected to be fenced on the lock on %s, got %s", key, name, lock)
+		}
+	}
+	if plans != len(names) {
+		t.Errorf("expected a transaction per name, got %d", plans)
+	}
+}
@@ -0,0 +1,282 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTxnOps is etcd's default limit (--max-txn-ops) on the operations in one
+// branch of a transaction, which also applies to its compares.
+const maxTxnOps = 128
+
+// nameUnchanged compares true if none of the records of the name at base was
+// created or modified after rev. Records are stored at base/x<index>, so the
+// range stops short of the keys of subdomains, which a change to the name's
+// own records must not be confused with.
+func nameUnchanged(base string, rev int64) clientv3.Cmp {
+	return clientv3.Compare(clientv3.ModRevision(base+"/x0"), "<", rev+1).WithRange(base + "/x:")
+}
+
+// listedRecord is a record as listed from etcd: its key, the revision it was
+// last modified at, and its decoded intent.
+type listedRecord struct {
+	key    string
+	modRev int64
+	intent *domain.RecordIntent
+}
+
+// listSnapshot is a listing of the path prefix at a single revision, indexed
+// by the key base (see keyBaseForFQDN) of each record's name.
+type listSnapshot struct {
+	rev     int64
+	byBase  map[string][]listedRecord
+	intents []*domain.RecordIntent
+}
+
+func newListSnapshot(prefix string, records []listedRecord, rev int64) *listSnapshot {
+	snap := &listSnapshot{rev: rev, byBase: make(map[string][]listedRecord)}
+	for _, rec := range records {
+		base := keyBaseForFQDN(prefix, rec.intent.Record.Name)
+		snap.byBase[base] = append(snap.byBase[base], rec)
+		snap.intents = append(snap.intents, rec.intent)
+	}
+	return snap
+}
+
+func (er *EtcdRegistry) setSnapshot(snap *listSnapshot) {
+	er.snapMu.Lock()
+	er.snapshot = snap
+	er.snapMu.Unlock()
+}
+
+func (er *EtcdRegistry) takeSnapshot() *listSnapshot {
+	er.snapMu.Lock()
+	defer er.snapMu.Unlock()
+	snap := er.snapshot
+	er.snapshot = nil
+	return snap
+}
+
+// namePlan is the part of a reconciliation plan that touches one name.
+type namePlan struct {
+	fqdn     string
+	toAdd    []*domain.RecordIntent
+	toRemove []*domain.RecordIntent
+}
+
+// ApplyPlan applies a reconciliation plan computed from the preceding List.
+// Each name's removals and additions are committed in one transaction, so an
+// evicted record and its replacement change together and a crash never leaves
+// the name unresolvable. Every transaction only commits if none of the name's
+// records has changed since that List; otherwise the name is left untouched and
+// the returned error wraps domain.ErrPlanConflict, telling the caller to list
+// and plan again. A name gaining a CNAME is also guarded on the names along
+// the CNAME's chain. Inside a LockTransaction every transaction is also fenced
+// on the locks on those names. Names are applied independently: applied holds the
+// writes of the names that were committed, each at the revision of its
+// transaction, with removed records as they were listed.
+func (er *EtcdRegistry) ApplyPlan(ctx context.Context, toAdd, toRemove []*domain.RecordIntent) (applied []domain.Mutation, err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.apply_plan", trace.WithAttributes(
+		attribute.Int("plan.adds", len(toAdd)),
+		attribute.Int("plan.removes", len(toRemove)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("plan.applied", len(applied)))
+		tracing.End(span, err)
+	}()
+	snap := er.takeSnapshot()
+	if snap == nil {
+		return nil, fmt.Errorf("apply plan: no listing to guard against; List must be called first")
+	}
+	lease, err := er.recordLease()
+	if err != nil {
+		return nil, fmt.Errorf("apply plan: %w", err)
+	}
+
+	plans := map[string]*namePlan{}
+	planFor := func(fqdn string) *namePlan {
+		p, ok := plans[fqdn]
+		if !ok {
+			p = &namePlan{fqdn: fqdn}
+			plans[fqdn] = p
+		}
+		return p
+	}
+	for _, ri := range toRemove {
+		p := planFor(ri.Record.Name)
+		p.toRemove = append(p.toRemove, ri)
+	}
+	for _, ri := range toAdd {
+		p := planFor(ri.Record.Name)
+		p.toAdd = append(p.toAdd, ri)
+	}
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if ctx.Err() != nil {
+			// E.g. a lock was lost; nothing more can be written.
+			errs = append(errs, context.Cause(ctx))
+			break
+		}
+		m, err := er.applyNamePlan(ctx, snap, plans[name], lease)
+		applied = append(applied, m...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("apply %q: %w", name, err))
+		}
+	}
+	return applied, errors.Join(errs...)
+}
+
+// applyNamePlan commits one name's plan. The plan normally fits in a single
+// transaction; one that needs more than maxTxnOps operations or compares is
+// split, additions first, so the name keeps resolving throughout. Each
+// transaction carries the compares of the records it removes.
+func (er *EtcdRegistry) applyNamePlan(ctx context.Context, snap *listSnapshot, p *namePlan, lease clientv3.LeaseID) (applied []domain.Mutation, err error) {
+	base := keyBaseForFQDN(er.cfg.PathPrefix, p.fqdn)
+	listed := snap.byBase[base]
+
+	var deleteKeys []string
+	var deleted []*domain.RecordIntent
+	var deleteCmps []clientv3.Cmp
+	cmps := []clientv3.Cmp{
+		// None of the name's records was created or modified since the listing.
+		nameUnchanged(base, snap.rev),
+	}
+	// A CNAME is only valid given the records along its chain (e.g. it must
+	// not close a loop), so those names must not have changed either.
+	guarded := map[string]struct{}{base: {}}
+	fenced := []string{p.fqdn}
+	for _, ri := range p.toAdd {
+		if !ri.Record.IsCNAME() {
+			continue
+		}
+		for _, name := range domain.CNAMEChain(ri.Record.Value, snap.intents) {
+			b := keyBaseForFQDN(er.cfg.PathPrefix, name)
+			if _, ok := guarded[b]; ok {
+				continue
+			}
+			guarded[b] = struct{}{}
+			fenced = append(fenced, name)
+			cmps = append(cmps, nameUnchanged(b, snap.rev))
+		}
+	}
+	for _, ri := range p.toRemove {
+		matched := false
+		for _, rec := range listed {
+			if rec.intent.Key() == ri.Key() {
+				matched = true
+				deleteKeys = append(deleteKeys, rec.key)
+				deleted = append(deleted, rec.intent)
+				// ...and every record being removed still exists.
+				deleteCmps = append(deleteCmps, clientv3.Compare(clientv3.ModRevision(rec.key), "=", rec.modRev))
+			}
+		}
+		if !matched {
+			er.log(ctx).Debug().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Msg("apply plan: record to remove is not in the listing")
+		}
+	}
+
+	var opts []clientv3.OpOption
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+	taken := make([]*mvccpb.KeyValue, 0, len(listed)+len(p.toAdd))
+	for _, rec := range listed {
+		taken = append(taken, &mvccpb.KeyValue{Key: []byte(rec.key)})
+	}
+	var puts, deletes []clientv3.Op
+	var putKeys []string
+	for _, ri := range p.toAdd {
+		value, err := marshalEtcdValue(ri)
+		if err != nil {
+			return nil, fmt.Errorf("marshal etcd value: %w", err)
+		}
+		// Listed keys are never reused, even those being deleted: etcd
+		// rejects a transaction that touches one key twice.
+		key := nextIndexedKey(base, taken)
+		taken = append(taken, &mvccpb.KeyValue{Key: []byte(key)})
+		puts = append(puts, clientv3.OpPut(key, value, opts...))
+		putKeys = append(putKeys, key)
+	}
+	for _, key := range deleteKeys {
+		deletes = append(deletes, clientv3.OpDelete(key))
+	}
+
+	// Only the locks on the names guarded here fence the transactions.
+	fence := etcdFenceFrom(ctx).covering(fenced...)
+	ops := append(puts, deletes...)
+	// opRecords[i] is the record ops[i] writes or deletes.
+	opRecords := append(p.toAdd[:len(p.toAdd):len(p.toAdd)], deleted...)
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	fenceCmps, checks := fence.cmps(), fence.checks()
+	if len(checks) > maxTxnOps {
+		return nil, fmt.Errorf("apply plan: fenced on %d locks, more than etcd's limit of %d operations", len(checks), maxTxnOps)
+	}
+	for start := 0; start < len(ops); {
+		// Fill the transaction until either its operations or its compares
+		// reach the limit; each delete brings its own compare.
+		guards := append(cmps[:len(cmps):len(cmps)], fenceCmps...)
+		if len(guards) > maxTxnOps {
+			return applied, fmt.Errorf("apply plan: %d compares, more than etcd's limit of %d", len(guards), maxTxnOps)
+		}
+		end := start
+		for end < len(ops) && end-start < maxTxnOps {
+			if i := end - len(puts); i >= 0 {
+				if len(guards) >= maxTxnOps {
+					break
+				}
+				guards = append(guards, deleteCmps[i])
+			}
+			end++
+		}
+		if end == start {
+			return applied, fmt.Errorf("apply plan: %d compares leave no room for a delete under etcd's limit of %d", len(guards), maxTxnOps)
+		}
+		if start == 0 && end < len(ops) {
+			er.log(ctx).Warn().Str("fqdn", p.fqdn).Int("ops", len(ops)).Int("max_txn_ops", maxTxnOps).Msg("apply plan: name needs more operations or compares than one transaction allows; applying in several")
+		}
+		resp, err := er.client.Txn(ctx).If(guards...).Then(ops[start:end]...).Else(checks...).Commit()
+		if err != nil {
+			er.incEtcdError()
+			return applied, fmt.Errorf("commit: %w", err)
+		}
+		// A failed compare still reports the store's current revision, which a
+		// watch-cached List must reach before the name is planned again.
+		er.noteWrite(resp.Header)
+		if !resp.Succeeded {
+			if err := fence.lost(resp.Responses); err != nil {
+				return applied, err
+			}
+			return applied, fmt.Errorf("%w (keys under %s)", domain.ErrPlanConflict, base)
+		}
+		for i, op := range ops[start:end] {
+			m := domain.Mutation{Op: domain.MutationRemove, Record: opRecords[start+i], Revision: resp.Header.GetRevision()}
+			if op.IsPut() {
+				m.Op = domain.MutationRegister
+			}
+			applied = append(applied, m)
+		}
+		// Later chunks only require that nobody else touched the name since
+		// the previous one committed.
+		cmps = []clientv3.Cmp{nameUnchanged(base, resp.Header.GetRevision())}
+		start = end
+	}
+	er.log(ctx).Info().Str("fqdn", p.fqdn).Strs("registered_keys", putKeys).Strs("removed_keys", deleteKeys).Msg("applied plan for name")
+	return applied, nil
+}
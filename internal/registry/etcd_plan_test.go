@@ -0,0 +1,289 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// listedKV builds a listed etcd record for ri at key, last modified at modRev.
+func listedKV(t *testing.T, key string, modRev int64, ri *domain.RecordIntent) *mvccpb.KeyValue {
+	t.Helper()
+	v, err := marshalEtcdValue(ri)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v), ModRevision: modRev}
+}
+
+// listAt makes the registry's next List return kvs as of revision rev, and
+// lists it.
+func listAt(t *testing.T, mock *mockEtcdClient, reg *EtcdRegistry, rev int64, kvs ...*mvccpb.KeyValue) []*domain.RecordIntent {
+	t.Helper()
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: rev}, Kvs: kvs}, nil
+	}
+	actual, err := reg.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	return actual
+}
+
+func TestEtcdRegistry_ApplyPlan_RequiresListing(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	_, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, nil)
+	if err == nil {
+		t.Fatal("expected an error without a preceding List")
+	}
+	if len(mock.txns) != 0 {
+		t.Error("expected nothing to be written")
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_EvictionAndReplacementInOneTxn(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	cname := makeIntent("app.example.com", "target.example.com", domain.RecordCNAME)
+	actual := listAt(t, mock, reg, 10, listedKV(t, "/skydns/com/example/app/x1", 5, cname))
+
+	applied, err := reg.ApplyPlan(context.Background(),
+		[]*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)},
+		actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	added, removed := domain.SplitMutations(applied)
+	if len(added) != 1 || len(removed) != 1 {
+		t.Fatalf("expected 1 added and 1 removed, got %d and %d", len(added), len(removed))
+	}
+	if !added[0].Record.IsA() || removed[0].Key() != cname.Key() {
+		t.Errorf("expected the A record added and the listed CNAME removed, got %s and %s", added[0].Render(), removed[0].Render())
+	}
+	if len(mock.txns) != 1 {
+		t.Fatalf("expected the whole name to be applied in 1 transaction, got %d", len(mock.txns))
+	}
+	txn := mock.txns[0]
+	if len(txn.thenOps) != 2 {
+		t.Fatalf("expected a put and a delete, got %d ops", len(txn.thenOps))
+	}
+	put, del := txn.thenOps[0], txn.thenOps[1]
+	if !put.IsPut() || string(put.KeyBytes()) != "/skydns/com/example/app/x2" {
+		t.Errorf("expected the replacement at a fresh key x2, got %q", put.KeyBytes())
+	}
+	if !del.IsDelete() || string(del.KeyBytes()) != "/skydns/com/example/app/x1" {
+		t.Errorf("expected the evicted x1 to be deleted, got %q", del.KeyBytes())
+	}
+
+	if len(txn.ifCmps) != 2 {
+		t.Fatalf("expected 2 compares, got %d", len(txn.ifCmps))
+	}
+	guard := txn.ifCmps[0]
+	if string(guard.Key) != "/skydns/com/example/app/x0" || string(guard.RangeEnd) != "/skydns/com/example/app/x:" ||
+		guard.Target != etcdserverpb.Compare_MOD || guard.Result != etcdserverpb.Compare_LESS ||
+		guard.TargetUnion.(*etcdserverpb.Compare_ModRevision).ModRevision != 11 {
+		t.Errorf("expected ModRevision(name's records) < 11, got %+v", guard)
+	}
+	exists := txn.ifCmps[1]
+	if string(exists.Key) != "/skydns/com/example/app/x1" || exists.Result != etcdserverpb.Compare_EQUAL ||
+		exists.TargetUnion.(*etcdserverpb.Compare_ModRevision).ModRevision != 5 {
+		t.Errorf("expected ModRevision(x1) == 5, got %+v", exists)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_ReportsRevisions(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	stale := makeIntent("app.example.com", "10.0.0.9", domain.RecordA)
+	actual := listAt(t, mock, reg, 10, listedKV(t, "/skydns/com/example/app/x1", 3, stale))
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		return &mockTxn{commitFunc: func() (*clientv3.TxnResponse, error) {
+			return &clientv3.TxnResponse{Succeeded: true, Header: &etcdserverpb.ResponseHeader{Revision: 11}}, nil
+		}}
+	}
+
+	applied, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("expected a registration and a removal, got %+v", applied)
+	}
+	for _, m := range applied {
+		if m.Revision != 11 {
+			t.Errorf("expected the %s at the transaction's revision 11, got %d", m.Op, m.Revision)
+		}
+	}
+	if applied[0].Op != domain.MutationRegister || applied[1].Op != domain.MutationRemove || applied[1].Record.Key() != stale.Key() {
+		t.Errorf("expected the put then the delete of the listed record, got %+v", applied)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_OneTxnPerName(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	stale := makeIntent("old.example.com", "10.0.0.9", domain.RecordA)
+	actual := listAt(t, mock, reg, 10, listedKV(t, "/skydns/com/example/old/x1", 3, stale))
+
+	applied, err := reg.ApplyPlan(context.Background(),
+		[]*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA), makeIntent("web.example.com", "10.0.0.2", domain.RecordA)},
+		actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	added, removed := domain.SplitMutations(applied)
+	if len(added) != 2 || len(removed) != 1 {
+		t.Errorf("expected 2 added and 1 removed, got %d and %d", len(added), len(removed))
+	}
+	if len(mock.txns) != 3 {
+		t.Errorf("expected 1 transaction per name, got %d", len(mock.txns))
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_ConflictLeavesNameUntouched(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	actual := listAt(t, mock, reg, 10)
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		return &mockTxn{commitFunc: func() (*clientv3.TxnResponse, error) {
+			return &clientv3.TxnResponse{Succeeded: false, Header: &etcdserverpb.ResponseHeader{Revision: 12}}, nil
+		}}
+	}
+
+	applied, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, actual)
+	if !errors.Is(err, domain.ErrPlanConflict) {
+		t.Fatalf("expected a plan conflict, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing counted as applied, got %d writes", len(applied))
+	}
+	if got := reg.writeRev.Load(); got != 12 {
+		t.Errorf("expected the conflicting revision to be noted for the next listing, got %d", got)
+	}
+	if _, err := reg.ApplyPlan(context.Background(), nil, nil); err == nil {
+		t.Error("expected the listing to be used up, requiring a fresh List to replan")
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_LeaseRecords(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, leaseRecordsConfig(), "docker-host", 30, testLogger())
+	reg.hbLease, reg.hbActive = 42, true
+	actual := listAt(t, mock, reg, 10)
+
+	if _, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease := opLease(mock.txnPuts()[0]); lease != 42 {
+		t.Errorf("expected the record to be attached to lease 42, got %d", lease)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_SplitsOversizedName(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	actual := listAt(t, mock, reg, 10)
+
+	toAdd := make([]*domain.RecordIntent, 0, maxTxnOps+2)
+	for i := range maxTxnOps + 2 {
+		toAdd = append(toAdd, makeIntent("app.example.com", fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), domain.RecordA))
+	}
+	applied, err := reg.ApplyPlan(context.Background(), toAdd, actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != maxTxnOps+2 {
+		t.Errorf("expected all %d records added, got %d", maxTxnOps+2, len(applied))
+	}
+	if len(mock.txns) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(mock.txns))
+	}
+	if n := len(mock.txns[0].thenOps); n != maxTxnOps {
+		t.Errorf("expected the first transaction to be full, got %d ops", n)
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_SplitsOversizedRemovals(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	const n = maxTxnOps + 10
+	kvs := make([]*mvccpb.KeyValue, 0, n)
+	for i := range n {
+		ri := makeIntent("app.example.com", fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), domain.RecordA)
+		kvs = append(kvs, listedKV(t, fmt.Sprintf("/skydns/com/example/app/x%d", i+1), int64(i+1), ri))
+	}
+	actual := listAt(t, mock, reg, 1000, kvs...)
+
+	applied, err := reg.ApplyPlan(context.Background(), nil, actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != n {
+		t.Errorf("expected all %d records removed, got %d", n, len(applied))
+	}
+	if len(mock.txns) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(mock.txns))
+	}
+	// etcd rejects a transaction with more compares than --max-txn-ops too.
+	for i, txn := range mock.txns {
+		if len(txn.ifCmps) > maxTxnOps || len(txn.thenOps) > maxTxnOps {
+			t.Errorf("transaction %d: %d compares and %d ops exceed the limit of %d", i, len(txn.ifCmps), len(txn.thenOps), maxTxnOps)
+		}
+		// Each delete is guarded on its record, after the name guard.
+		if len(txn.ifCmps) != len(txn.thenOps)+1 {
+			t.Errorf("transaction %d: expected a compare per delete plus the name guard, got %d for %d ops", i, len(txn.ifCmps), len(txn.thenOps))
+		}
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_GuardExcludesSubdomains(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	actual := listAt(t, mock, reg, 10)
+
+	if _, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "10.0.0.1", domain.RecordA)}, actual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	guard := mock.txns[0].ifCmps[0]
+	from, to := string(guard.Key), string(guard.RangeEnd)
+	for key, want := range map[string]bool{
+		"/skydns/com/example/app/x1":      true,
+		"/skydns/com/example/app/x12":     true,
+		"/skydns/com/example/app/api/x1":  false,
+		"/skydns/com/example/app/www/x1":  false,
+		"/skydns/com/example/apps/x1":     false,
+		"/skydns/com/example/app/zeta/x1": false,
+	} {
+		if got := key >= from && key < to; got != want {
+			t.Errorf("guard [%s, %s) covers %s: expected %v, got %v", from, to, key, want, got)
+		}
+	}
+}
+
+func TestEtcdRegistry_ApplyPlan_GuardsCNAMEChain(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	// web -> api already exists; adding app -> web depends on web and api.
+	existing := makeIntent("web.example.com", "api.example.com", domain.RecordCNAME)
+	listAt(t, mock, reg, 10, listedKV(t, "/skydns/com/example/web/x1", 4, existing))
+
+	if _, err := reg.ApplyPlan(context.Background(), []*domain.RecordIntent{makeIntent("app.example.com", "web.example.com", domain.RecordCNAME)}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var guarded []string
+	for _, cmp := range mock.txns[0].ifCmps {
+		guarded = append(guarded, string(cmp.Key))
+	}
+	want := []string{"/skydns/com/example/app/x0", "/skydns/com/example/web/x0", "/skydns/com/example/api/x0"}
+	if fmt.Sprint(guarded) != fmt.Sprint(want) {
+		t.Errorf("expected guards on %v, got %v", want, guarded)
+	}
+}
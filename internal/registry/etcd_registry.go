@@ -3,19 +3,30 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
+	"github.com/auto-dns/docker-coredns-sync/internal/tracing"
 	"github.com/rs/zerolog"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerName is the instrumentation scope of the registries' spans.
+const tracerName = "github.com/auto-dns/docker-coredns-sync/internal/registry"
+
 // registryMetrics is an optional sink for etcd operation metrics. Implementations
 // must be safe for concurrent use.
 type registryMetrics interface {
@@ -23,6 +34,12 @@ type registryMetrics interface {
 	IncLockFailure()
 }
 
+// heartbeatMetrics is an optional sink for the age of every live host's
+// heartbeat. Implementations must be safe for concurrent use.
+type heartbeatMetrics interface {
+	SetHeartbeatAges(ages map[string]time.Duration)
+}
+
 // heartbeatPrefix is where per-host liveness keys live. It is deliberately
 // outside the SkyDNS path_prefix so CoreDNS never sees these keys and List()
 // never parses them as DNS records. Config validation enforces that path_prefix
@@ -36,6 +53,8 @@ type EtcdRegistry struct {
 	heartbeatTTL int
 	logger       zerolog.Logger
 	metrics      registryMetrics
+	hbMetrics    heartbeatMetrics
+	tracer       trace.Tracer
 
 	hbMu     sync.Mutex
 	hbLease  clientv3.LeaseID
@@ -44,15 +63,75 @@ type EtcdRegistry struct {
 	// gates cross-host GC: a host whose StartHeartbeat has not (yet) succeeded
 	// must not garbage-collect any peer's records.
 	hbActive bool
+	// gcCandidate is this host's key in the GC leader election under the
+	// current heartbeat lease, or empty while it is not campaigning.
+	gcCandidate string
+	// status is published as the heartbeat value.
+	status *hostStatus
+
+	// cache, when etcd.watch_cache is set, serves List. writeRev is the
+	// revision of this registry's latest write, which List waits for the cache
+	// to reach so a pass always sees the previous pass's changes.
+	cache    *etcdCache
+	writeRev atomic.Int64
+
+	// snapshot is the latest List, which ApplyPlan's transactions compare
+	// against. It is cleared once a plan has been applied.
+	snapMu   sync.Mutex
+	snapshot *listSnapshot
 }
 
 func NewEtcdRegistry(client etcdClient, cfg *config.EtcdConfig, hostname string, heartbeatTTL int, logger zerolog.Logger) *EtcdRegistry {
-	return &EtcdRegistry{
+	er := &EtcdRegistry{
 		client:       client,
 		cfg:          cfg,
 		hostname:     hostname,
 		heartbeatTTL: heartbeatTTL,
 		logger:       logger.With().Str("component", "etcd_registry").Logger(),
+		tracer:       tracing.Tracer(nil, tracerName),
+		status:       newHostStatus(hostname),
+	}
+	if cfg.WatchCache {
+		er.cache = newEtcdCache(client, cfg.PathPrefix, logger)
+	}
+	return er
+}
+
+// log returns the logger for work done on behalf of ctx, tagged with the
+// reconcile pass id ctx carries, if any.
+func (er *EtcdRegistry) log(ctx context.Context) *zerolog.Logger {
+	l := logger.FromContext(ctx, er.logger)
+	return &l
+}
+
+// SetCacheMetrics registers an optional sink for watch-cache metrics. Safe to
+// leave unset, and a no-op without etcd.watch_cache.
+func (er *EtcdRegistry) SetCacheMetrics(m cacheMetrics) {
+	if er.cache != nil {
+		er.cache.metrics = m
+	}
+}
+
+// StartWatchCache starts maintaining the watch cache for the lifetime of ctx.
+// Until its first load completes, List reads etcd directly. A no-op without
+// etcd.watch_cache.
+func (er *EtcdRegistry) StartWatchCache(ctx context.Context) {
+	if er.cache != nil {
+		go er.cache.run(ctx)
+	}
+}
+
+// noteWrite records the revision of a write so List does not serve a cache
+// that has not yet seen it.
+func (er *EtcdRegistry) noteWrite(h *etcdserverpb.ResponseHeader) {
+	if h == nil {
+		return
+	}
+	for {
+		cur := er.writeRev.Load()
+		if h.Revision <= cur || er.writeRev.CompareAndSwap(cur, h.Revision) {
+			return
+		}
 	}
 }
 
@@ -62,6 +141,19 @@ func (er *EtcdRegistry) SetMetrics(m registryMetrics) {
 	er.metrics = m
 }
 
+// SetHeartbeatMetrics registers an optional sink for the age of every live
+// host's heartbeat, reported whenever GetLiveHostnames runs. Safe to leave
+// unset, which saves GetLiveHostnames a lease lookup per host.
+func (er *EtcdRegistry) SetHeartbeatMetrics(m heartbeatMetrics) {
+	er.hbMetrics = m
+}
+
+// SetTracerProvider traces every etcd operation, and the wait for each lock,
+// with tp. Safe to leave unset.
+func (er *EtcdRegistry) SetTracerProvider(tp trace.TracerProvider) {
+	er.tracer = tracing.Tracer(tp, tracerName)
+}
+
 func (er *EtcdRegistry) incEtcdError() {
 	if er.metrics != nil {
 		er.metrics.IncEtcdError()
@@ -74,6 +166,13 @@ func (er *EtcdRegistry) incLockFailure() {
 	}
 }
 
+// SetHostStatus sets the static details this host publishes in its heartbeat
+// (see domain.HostStatus). Call it before StartHeartbeat; the hostname is
+// always the registry's own.
+func (er *EtcdRegistry) SetHostStatus(s domain.HostStatus) {
+	er.status.setInfo(s)
+}
+
 func heartbeatKey(hostname string) string {
 	return fmt.Sprintf("%s/%s", heartbeatPrefix, hostname)
 }
@@ -97,8 +196,15 @@ func (er *EtcdRegistry) StartHeartbeat(ctx context.Context) error {
 	er.hbLease = leaseID
 	er.hbCancel = cancel
 	er.hbActive = true
+	er.gcCandidate = ""
 	er.hbMu.Unlock()
 
+	// Records left by a previous run of this host may still be attached to its
+	// old lease, or be in an older wire format; move them to the new lease
+	// before the old one expires, and upgrade them.
+	er.refreshOwnRecords(kaCtx, leaseID)
+	er.campaign(kaCtx, leaseID)
+
 	// Maintain the lease for the lifetime of kaCtx, re-establishing it if it is
 	// lost, so cross-host GC self-heals after a transient etcd outage.
 	go er.maintainHeartbeat(kaCtx, key, kaCh)
@@ -115,10 +221,12 @@ func (er *EtcdRegistry) grantAndKeepAlive(ctx context.Context, key string) (<-ch
 	if err != nil {
 		return nil, 0, fmt.Errorf("grant heartbeat lease: %w", err)
 	}
-	if _, err := er.client.Put(ctx, key, er.hostname, clientv3.WithLease(leaseResp.ID)); err != nil {
+	value, published := er.status.value()
+	if _, err := er.client.Put(ctx, key, value, clientv3.WithLease(leaseResp.ID)); err != nil {
 		er.bestEffortCleanup(leaseResp.ID, key)
 		return nil, 0, fmt.Errorf("put heartbeat key %q: %w", key, err)
 	}
+	er.status.markPublished(published)
 	kaCh, err := er.client.KeepAlive(ctx, leaseResp.ID)
 	if err != nil {
 		er.bestEffortCleanup(leaseResp.ID, key)
@@ -143,6 +251,8 @@ func (er *EtcdRegistry) maintainHeartbeat(kaCtx context.Context, key string, kaC
 		}
 		er.hbMu.Lock()
 		er.hbActive = false
+		// The candidacy expired with the lease.
+		er.gcCandidate = ""
 		er.hbMu.Unlock()
 		er.logger.Warn().Str("key", key).Msg("heartbeat lease lost; cross-host GC disabled until re-established")
 
@@ -174,6 +284,8 @@ func (er *EtcdRegistry) reestablishHeartbeat(kaCtx context.Context, key string)
 			er.hbActive = true
 			er.hbMu.Unlock()
 			er.logger.Info().Str("key", key).Msg("heartbeat re-established")
+			er.refreshOwnRecords(kaCtx, leaseID)
+			er.campaign(kaCtx, leaseID)
 			return kaCh, true
 		}
 		er.incEtcdError()
@@ -191,6 +303,101 @@ func (er *EtcdRegistry) reestablishHeartbeat(kaCtx context.Context, key string)
 	}
 }
 
+// refreshOwnRecords rewrites the records owned by this host that need it
+// whenever a new heartbeat lease is obtained:
+//   - With etcd.lease_records, records still attached to the previous lease
+//     are moved onto lease; they would otherwise be deleted when it expires.
+//     Records the old lease already took with it are re-registered by the next
+//     reconciliation pass, which finds them missing.
+//   - Records stored in an older wire format are upgraded to this release's
+//     (see domain.RecordSchema), so that peers only find unversioned records
+//     under owners that have not been upgraded, which they never
+//     garbage-collect.
+//
+// Each key is rewritten only if unchanged since it was read, so a concurrent
+// Remove is never undone.
+func (er *EtcdRegistry) refreshOwnRecords(ctx context.Context, lease clientv3.LeaseID) {
+	prefix := er.cfg.PathPrefix
+	resp, err := er.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		er.incEtcdError()
+		er.logger.Warn().Err(err).Msg("refresh own records: list failed; they are refreshed when the heartbeat is next re-established")
+		return
+	}
+	var moved, upgraded int
+	for _, kv := range resp.Kvs {
+		var wire etcdRecord
+		if err := json.Unmarshal(kv.Value, &wire); err != nil || wire.OwnerHostname != er.hostname {
+			continue
+		}
+		key := string(kv.Key)
+		move := er.cfg.LeaseRecords && clientv3.LeaseID(kv.Lease) != lease
+		upgrade := wire.Schema != domain.RecordSchema
+		if !move && !upgrade {
+			continue
+		}
+		value := string(kv.Value)
+		if upgrade {
+			ri, err := unmarshalEtcdValue(key, value, prefix)
+			if err != nil {
+				continue
+			}
+			if value, err = marshalEtcdValue(ri); err != nil {
+				continue
+			}
+		}
+		// Without lease_records a record keeps whatever lease it had.
+		recordLease := clientv3.LeaseID(kv.Lease)
+		if er.cfg.LeaseRecords {
+			recordLease = lease
+		}
+		var opts []clientv3.OpOption
+		if recordLease != 0 {
+			opts = append(opts, clientv3.WithLease(recordLease))
+		}
+		txnResp, err := er.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, value, opts...)).
+			Commit()
+		if err != nil {
+			er.incEtcdError()
+			er.logger.Warn().Err(err).Str("key", key).Msg("refresh own records: put failed")
+			continue
+		}
+		if txnResp.Succeeded {
+			er.noteWrite(txnResp.Header)
+			if move {
+				moved++
+			}
+			if upgrade {
+				upgraded++
+			}
+		}
+	}
+	if moved > 0 {
+		er.logger.Info().Int("records", moved).Msg("reattached records to the new heartbeat lease")
+	}
+	if upgraded > 0 {
+		er.logger.Info().Int("records", upgraded).Int("schema", domain.RecordSchema).Msg("upgraded records to the current wire schema")
+	}
+}
+
+// recordLease returns the lease a newly registered record must be attached
+// to, or 0 when etcd.lease_records is off. With it on, writing requires a live
+// heartbeat lease: an unleased record would outlive this host.
+func (er *EtcdRegistry) recordLease() (clientv3.LeaseID, error) {
+	if !er.cfg.LeaseRecords {
+		return 0, nil
+	}
+	er.hbMu.Lock()
+	lease, active := er.hbLease, er.hbActive
+	er.hbMu.Unlock()
+	if !active || lease == 0 {
+		return 0, fmt.Errorf("no live heartbeat lease to attach the record to")
+	}
+	return lease, nil
+}
+
 // bestEffortCleanup removes a partially-created heartbeat key/lease using a
 // short background context so it runs even when the caller's context is done.
 func (er *EtcdRegistry) bestEffortCleanup(lease clientv3.LeaseID, key string) {
@@ -200,7 +407,8 @@ func (er *EtcdRegistry) bestEffortCleanup(lease clientv3.LeaseID, key string) {
 	_, _ = er.client.Revoke(ctx, lease)
 }
 
-// stopHeartbeat cancels the keepalive and best-effort removes the liveness key.
+// stopHeartbeat cancels the keepalive and best-effort removes the liveness key,
+// unless etcd.lease_records leaves both to expire with the lease.
 func (er *EtcdRegistry) stopHeartbeat() {
 	er.hbMu.Lock()
 	cancel := er.hbCancel
@@ -217,7 +425,16 @@ func (er *EtcdRegistry) stopHeartbeat() {
 		return
 	}
 	cancel()
-
+	er.resign()
+
+	// With lease_records the lease also carries this host's records. Revoking
+	// it would drop them on every restart, so it is left to expire instead: a
+	// host that comes back within the TTL reattaches them to its new lease.
+	// The heartbeat key expires with it, so until then the GC leader still
+	// sees the host as live and leaves its records alone.
+	if er.cfg.LeaseRecords {
+		return
+	}
 	ctx, cancelTimeout := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancelTimeout()
 	if _, err := er.client.Delete(ctx, heartbeatKey(er.hostname)); err != nil {
@@ -228,6 +445,57 @@ func (er *EtcdRegistry) stopHeartbeat() {
 	}
 }
 
+// UpdateHeartbeat records a successful reconciliation in this host's
+// heartbeat. The key is rewritten, under the current lease, only when the
+// number of records owned changed or the published reconcile time is a third
+// of the heartbeat TTL old. Without a live heartbeat it only records the
+// outcome, which is published once the heartbeat is re-established.
+func (er *EtcdRegistry) UpdateHeartbeat(ctx context.Context, recordsOwned int, reconciledAt time.Time) (err error) {
+	refresh := time.Duration(er.heartbeatTTL) * time.Second / 3
+	if !er.status.update(recordsOwned, reconciledAt, refresh) {
+		return nil
+	}
+	ctx, span := er.tracer.Start(ctx, "etcd.update_heartbeat")
+	defer func() { tracing.End(span, err) }()
+	er.hbMu.Lock()
+	lease, active := er.hbLease, er.hbActive
+	er.hbMu.Unlock()
+	if !active {
+		return nil
+	}
+	key := heartbeatKey(er.hostname)
+	value, published := er.status.value()
+	if _, err := er.client.Put(ctx, key, value, clientv3.WithLease(lease)); err != nil {
+		er.incEtcdError()
+		return fmt.Errorf("update heartbeat key %q: %w", key, err)
+	}
+	er.status.markPublished(published)
+	return nil
+}
+
+// GetFleet returns the status every heartbeating host publishes, sorted by
+// hostname. It includes this host only while it is heartbeating.
+func (er *EtcdRegistry) GetFleet(ctx context.Context) (_ []domain.HostStatus, err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.get_fleet")
+	defer func() { tracing.End(span, err) }()
+	base := heartbeatPrefix
+	resp, err := er.client.Get(ctx, base+"/", clientv3.WithPrefix())
+	if err != nil {
+		er.incEtcdError()
+		return nil, fmt.Errorf("list heartbeat keys under %q: %w", base, err)
+	}
+	hosts := make([]domain.HostStatus, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		hostname := strings.TrimPrefix(string(kv.Key), base+"/")
+		if hostname == "" {
+			continue
+		}
+		hosts = append(hosts, decodeHeartbeat(hostname, kv.Value))
+	}
+	sortFleet(hosts)
+	return hosts, nil
+}
+
 // GetLiveHostnames returns the set of hostnames with a live heartbeat key —
 // the hosts whose records must not be garbage-collected.
 //
@@ -239,13 +507,15 @@ func (er *EtcdRegistry) stopHeartbeat() {
 // The read is linearizable (no WithSerializable): it authorizes deletions, so a
 // stale read from a lagging member that omitted a live host could otherwise
 // destroy that host's records.
-func (er *EtcdRegistry) GetLiveHostnames(ctx context.Context) (map[string]struct{}, error) {
+func (er *EtcdRegistry) GetLiveHostnames(ctx context.Context) (_ map[string]struct{}, err error) {
 	er.hbMu.Lock()
 	active := er.hbActive
 	er.hbMu.Unlock()
 	if !active {
 		return nil, nil
 	}
+	ctx, span := er.tracer.Start(ctx, "etcd.get_live_hostnames")
+	defer func() { tracing.End(span, err) }()
 
 	base := heartbeatPrefix
 	resp, err := er.client.Get(ctx, base+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
@@ -255,29 +525,71 @@ func (er *EtcdRegistry) GetLiveHostnames(ctx context.Context) (map[string]struct
 	}
 
 	live := make(map[string]struct{}, len(resp.Kvs))
+	leases := make(map[string]clientv3.LeaseID, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
 		hostname := strings.TrimPrefix(string(kv.Key), base+"/")
 		if hostname == "" {
 			continue
 		}
 		live[hostname] = struct{}{}
+		leases[hostname] = clientv3.LeaseID(kv.Lease)
+	}
+	if er.hbMetrics != nil {
+		er.hbMetrics.SetHeartbeatAges(er.heartbeatAges(ctx, leases))
 	}
 	// This host is always considered live while it is reconciling.
 	live[er.hostname] = struct{}{}
+	span.SetAttributes(attribute.Int("etcd.live_hosts", len(live)))
 	return live, nil
 }
 
+// heartbeatAges returns how long ago each host's heartbeat lease was last
+// kept alive: the time the lease was granted for less the time it has left.
+// A host whose lease cannot be looked up, or has just expired, is left out.
+func (er *EtcdRegistry) heartbeatAges(ctx context.Context, leases map[string]clientv3.LeaseID) map[string]time.Duration {
+	ages := make(map[string]time.Duration, len(leases))
+	for host, lease := range leases {
+		if lease == clientv3.NoLease {
+			continue
+		}
+		resp, err := er.client.TimeToLive(ctx, lease)
+		if err != nil {
+			er.log(ctx).Debug().Err(err).Str("owner_hostname", host).Msg("could not look up the heartbeat lease")
+			continue
+		}
+		if resp.TTL < 0 {
+			continue
+		}
+		ages[host] = time.Duration(resp.GrantedTTL-resp.TTL) * time.Second
+	}
+	return ages
+}
+
+// registerMaxAttempts bounds how many candidate keys Register tries before
+// giving up. Each conflict means another writer created the candidate between
+// our read and our write, which is rare even with external tools writing under
+// the same prefix.
+const registerMaxAttempts = 5
+
 // getNextIndexedKey generates a new etcd key for a record based on its fully qualified domain name (fqdn).
+// The read is linearizable so the candidate reflects every committed write;
+// Register still guards the write with a compare-and-swap, as a concurrent
+// writer can take the key before it is used.
 func (er *EtcdRegistry) getNextIndexedKey(ctx context.Context, fqdn string) (string, error) {
 	base := keyBaseForFQDN(er.cfg.PathPrefix, fqdn)
-	existing := make(map[int]struct{})
-
-	resp, err := er.client.Get(ctx, base, clientv3.WithPrefix(), clientv3.WithKeysOnly(), clientv3.WithSerializable())
+	resp, err := er.client.Get(ctx, base, clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
 		er.incEtcdError()
 		return "", fmt.Errorf("list existing indices under %q: %w", base, err)
 	}
-	for _, kv := range resp.Kvs {
+	return nextIndexedKey(base, resp.Kvs), nil
+}
+
+// nextIndexedKey returns the lowest free base/xN key given the keys that exist
+// under base.
+func nextIndexedKey(base string, kvs []*mvccpb.KeyValue) string {
+	existing := make(map[int]struct{})
+	for _, kv := range kvs {
 		keyStr := string(kv.Key)
 		// ensure we're only looking at immediate children under base
 		if !strings.HasPrefix(keyStr, base+"/") {
@@ -298,11 +610,19 @@ func (er *EtcdRegistry) getNextIndexedKey(ctx context.Context, fqdn string) (str
 		}
 		idx++
 	}
-	return fmt.Sprintf("%s/x%d", base, idx), nil
+	return fmt.Sprintf("%s/x%d", base, idx)
 }
 
-// Register stores the record intent in etcd.
-func (er *EtcdRegistry) Register(ctx context.Context, ri *domain.RecordIntent) error {
+// Register stores the record intent in etcd under the lowest free indexed
+// key. The key is claimed with a transaction that only writes if the key does
+// not exist yet (CreateRevision == 0), so a record is never written over
+// another, even one written by a process that does not hold our lock. On a
+// conflict the transaction returns the keys now under the name, and the next
+// free one is tried.
+// Inside a LockTransaction the write is also fenced on the lock on the name.
+func (er *EtcdRegistry) Register(ctx context.Context, ri *domain.RecordIntent) (err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.register", trace.WithAttributes(attribute.String("record", ri.Render())))
+	defer func() { tracing.End(span, err) }()
 	fqdn := ri.Record.Name
 	key, err := er.getNextIndexedKey(ctx, fqdn)
 	if err != nil {
@@ -312,12 +632,50 @@ func (er *EtcdRegistry) Register(ctx context.Context, ri *domain.RecordIntent) e
 	if err != nil {
 		return fmt.Errorf("marshal etcd value for %q: %w", fqdn, err)
 	}
-	if _, err := er.client.Put(ctx, key, value); err != nil {
-		er.incEtcdError()
-		return fmt.Errorf("put key %q: %w", key, err)
+	var opts []clientv3.OpOption
+	lease, err := er.recordLease()
+	if err != nil {
+		return fmt.Errorf("register %q: %w", fqdn, err)
+	}
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+	base := keyBaseForFQDN(er.cfg.PathPrefix, fqdn)
+	fence := etcdFenceFrom(ctx).covering(fqdn)
+	for attempt := 1; ; attempt++ {
+		resp, err := er.client.Txn(ctx).
+			If(append([]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(key), "=", 0)}, fence.cmps()...)...).
+			Then(clientv3.OpPut(key, value, opts...)).
+			Else(append([]clientv3.Op{clientv3.OpGet(base, clientv3.WithPrefix(), clientv3.WithKeysOnly())}, fence.checks()...)...).
+			Commit()
+		if err != nil {
+			er.incEtcdError()
+			return fmt.Errorf("put key %q: %w", key, err)
+		}
+		if resp.Succeeded {
+			span.SetAttributes(attribute.String("etcd.key", key), attribute.Int("etcd.attempts", attempt))
+			er.noteWrite(resp.Header)
+			er.log(ctx).Info().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Str("key", key).Msg("registered record")
+			return nil
+		}
+		if err := fence.lost(resp.Responses); err != nil {
+			return fmt.Errorf("register %q: %w", fqdn, err)
+		}
+		if attempt >= registerMaxAttempts {
+			return fmt.Errorf("register %q: key allocation conflicted %d times", fqdn, attempt)
+		}
+		er.log(ctx).Debug().Str("fqdn", fqdn).Str("key", key).Int("attempt", attempt).Msg("register: key was taken concurrently; retrying with the next free index")
+		var kvs []*mvccpb.KeyValue
+		if len(resp.Responses) > 0 {
+			if rr := resp.Responses[0].GetResponseRange(); rr != nil {
+				kvs = rr.Kvs
+			}
+		}
+		// Never retry the candidate that just failed, whatever the listing
+		// says.
+		kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(key)})
+		key = nextIndexedKey(base, kvs)
 	}
-	er.logger.Info().Str("fqdn", ri.Record.Name).Str("kind", string(ri.Record.Kind)).Str("host", ri.Record.Value).Str("owner_hostname", ri.Hostname).Str("owner_container_id", ri.ContainerId).Str("key", key).Msg("registered record")
-	return nil
 }
 
 func (er *EtcdRegistry) recordMatches(w etcdRecord, ri *domain.RecordIntent) bool {
@@ -328,8 +686,11 @@ func (er *EtcdRegistry) recordMatches(w etcdRecord, ri *domain.RecordIntent) boo
 		(ri.ContainerId == "" || w.OwnerContainerId == ri.ContainerId)
 }
 
-// Remove finds and deletes the etcd key that matches the record domain.
-func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) error {
+// Remove finds and deletes the etcd key that matches the record domain. Inside
+// a LockTransaction the deletes are fenced on the lock on the name.
+func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) (err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.remove", trace.WithAttributes(attribute.String("record", ri.Render())))
+	defer func() { tracing.End(span, err) }()
 	base := keyBaseForFQDN(er.cfg.PathPrefix, ri.Record.Name)
 
 	resp, err := er.client.Get(ctx, base, clientv3.WithPrefix())
@@ -347,7 +708,7 @@ func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) err
 		}
 		var wire etcdRecord
 		if err := json.Unmarshal(kv.Value, &wire); err != nil {
-			er.logger.Warn().Err(err).Str("key", keyStr).Msg("unmarshal etcd record")
+			er.log(ctx).Warn().Err(err).Str("key", keyStr).Msg("unmarshal etcd record")
 			continue
 		}
 		if er.recordMatches(wire, ri) {
@@ -356,18 +717,19 @@ func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) err
 	}
 
 	if len(toDelete) == 0 {
-		er.logger.Debug().
-			Str("fqdn", ri.Record.Name).Str("kind", string(ri.Record.Kind)).
-			Str("host", ri.Record.Value).Str("owner_hostname", ri.Hostname).
-			Str("owner_container_name", ri.ContainerName).
+		er.log(ctx).Debug().
+			Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).
+			Str("container_id", ri.ContainerId).Str("owner_container_name", ri.ContainerName).
 			Msg("remove: no matching keys")
 		return nil
 	}
 
+	span.SetAttributes(attribute.Int("etcd.keys", len(toDelete)))
 	// Delete all matches (keep going on errors)
 	// delete in batches to avoid overly-large transactions
 	const batchSize = 64
 	var firstErr error
+	fence := etcdFenceFrom(ctx).covering(ri.Record.Name)
 
 	for i := 0; i < len(toDelete); i += batchSize {
 		end := i + batchSize
@@ -376,20 +738,29 @@ func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) err
 		}
 		batch := toDelete[i:end]
 
-		txn := er.client.Txn(ctx)
 		ops := make([]clientv3.Op, 0, len(batch))
 		for _, k := range batch {
 			ops = append(ops, clientv3.OpDelete(k))
 		}
-		if _, err := txn.Then(ops...).Commit(); err != nil {
+		txnResp, err := er.client.Txn(ctx).If(fence.cmps()...).Then(ops...).Else(fence.checks()...).Commit()
+		if err == nil && !txnResp.Succeeded {
+			// Only the fence's compares can fail.
+			err = fence.lost(txnResp.Responses)
+			if err == nil {
+				err = errors.New("fenced delete was refused")
+			}
+			return fmt.Errorf("batch delete [%d:%d]: %w", i, end, err)
+		}
+		if err != nil {
 			er.incEtcdError()
-			er.logger.Warn().Err(err).Int("batch_start", i).Int("batch_end", end).Msg("remove: batch delete failed")
+			er.log(ctx).Warn().Err(err).Int("batch_start", i).Int("batch_end", end).Msg("remove: batch delete failed")
 			if firstErr == nil {
 				firstErr = fmt.Errorf("batch delete [%d:%d]: %w", i, end, err)
 			}
 		} else {
+			er.noteWrite(txnResp.Header)
 			for _, k := range batch {
-				er.logger.Info().Str("key", k).Str("fqdn", ri.Record.Name).Str("kind", string(ri.Record.Kind)).Str("host", ri.Record.Value).Str("owner_hostname", ri.Hostname).Str("owner_container_id", ri.ContainerId).Msg("remove: deleted record")
+				er.log(ctx).Info().Str("key", k).Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Msg("remove: deleted record")
 			}
 		}
 	}
@@ -398,29 +769,69 @@ func (er *EtcdRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) err
 }
 
 // List retrieves all record intents stored in etcd under the configured prefix.
-func (er *EtcdRegistry) List(ctx context.Context) ([]*domain.RecordIntent, error) {
+// With etcd.watch_cache it is served from the watch cache once that is synced
+// and has caught up with this registry's own writes. The listing, with each
+// record's key and revision, is kept for ApplyPlan to guard against.
+func (er *EtcdRegistry) List(ctx context.Context) (_ []*domain.RecordIntent, err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.list")
+	defer func() { tracing.End(span, err) }()
+	records, rev, err := er.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("etcd.records", len(records)), attribute.Int64("etcd.revision", rev))
+	er.setSnapshot(newListSnapshot(er.cfg.PathPrefix, records, rev))
+	intents := make([]*domain.RecordIntent, 0, len(records))
+	for _, rec := range records {
+		intents = append(intents, rec.intent)
+	}
+	return intents, nil
+}
+
+func (er *EtcdRegistry) listRecords(ctx context.Context) ([]listedRecord, int64, error) {
+	if er.cache != nil {
+		if records, rev, ok := er.cache.list(ctx, er.writeRev.Load()); ok {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("etcd.watch_cache", true))
+			return records, rev, nil
+		}
+		er.log(ctx).Debug().Msg("watch cache not synced; listing etcd directly")
+	}
 	prefix := er.cfg.PathPrefix
 	resp, err := er.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSerializable())
 	if err != nil {
 		er.incEtcdError()
-		return nil, fmt.Errorf("list under prefix %q: %w", prefix, err)
+		return nil, 0, fmt.Errorf("list under prefix %q: %w", prefix, err)
 	}
-	intents := make([]*domain.RecordIntent, 0, len(resp.Kvs))
+	records := make([]listedRecord, 0, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
 		ri, err := unmarshalEtcdValue(string(kv.Key), string(kv.Value), er.cfg.PathPrefix)
 		if err != nil {
-			er.logger.Warn().Err(err).Msgf("Failed to parse key: %s", kv.Key)
+			er.log(ctx).Warn().Err(err).Msgf("Failed to parse key: %s", kv.Key)
 			continue
 		}
-		intents = append(intents, ri)
+		records = append(records, listedRecord{key: string(kv.Key), modRev: kv.ModRevision, intent: ri})
 	}
-	return intents, nil
+	var rev int64
+	if resp.Header != nil {
+		rev = resp.Header.Revision
+	}
+	return records, rev, nil
 }
 
 // LockTransaction provides a distributed lock using etcd transactions.
 // It takes keys (as a slice of string), tries to acquire locks on all of them,
-// runs the function, and finally releases all locks.
-func (er *EtcdRegistry) LockTransaction(ctx context.Context, keys []string, fn func() error) error {
+// runs the function, and finally releases all locks. Keys are acquired in
+// sorted order so callers locking overlapping sets cannot deadlock, and locks
+// already held are released if a later one cannot be acquired.
+//
+// fn must make its writes with the context it is given. The registry's writes
+// under that context are fenced: each only commits while every lock is still
+// held (see etcdFence). If a lock's lease stops being kept alive, or a fenced
+// write finds a lock gone, the context is cancelled and LockTransaction
+// returns a *domain.LockLostError.
+func (er *EtcdRegistry) LockTransaction(ctx context.Context, keys []string, fn func(ctx context.Context) error) (err error) {
+	ctx, span := er.tracer.Start(ctx, "etcd.lock_transaction", trace.WithAttributes(attribute.Int("lock.count", len(keys))))
+	defer func() { tracing.End(span, err) }()
 	// Ensure unique sorted keys.
 	uniq := make(map[string]struct{}, len(keys))
 	for _, k := range keys {
@@ -432,82 +843,145 @@ func (er *EtcdRegistry) LockTransaction(ctx context.Context, keys []string, fn f
 	}
 	sort.Strings(uniqueKeys)
 
+	lockCtx, cancelLock := context.WithCancelCause(ctx)
+	defer cancelLock(nil)
+
 	leases := make([]heldLease, 0, len(uniqueKeys))
+	// Release the locks in reverse order. This runs even when ctx is done, so
+	// it uses its own deadline rather than ctx.
+	release := func() {
+		relCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		relCtx, span := er.tracer.Start(relCtx, "etcd.release_locks", trace.WithAttributes(attribute.Int("lock.count", len(leases))))
+		defer span.End()
+		for i := len(leases) - 1; i >= 0; i-- {
+			l := leases[i]
+			l.cancel() // Stop the keepalive first
+			// Only delete the key if it is still ours: once our lease has
+			// expired it may belong to another holder.
+			if _, e := er.client.Txn(relCtx).
+				If(clientv3.Compare(clientv3.CreateRevision(l.lockKey), "=", l.rev)).
+				Then(clientv3.OpDelete(l.lockKey)).
+				Commit(); e != nil {
+				er.log(ctx).Warn().Err(e).Msgf("failed to delete lock key %s", l.lockKey)
+			}
+			if _, e := er.client.Revoke(relCtx, l.lease); e != nil {
+				er.log(ctx).Warn().Err(e).Msgf("failed to revoke lease for %s", l.lockKey)
+			}
+		}
+	}
 
 	for _, key := range uniqueKeys {
-		lockKey := fmt.Sprintf("/locks/%s", key)
-		leaseResp, err := er.client.Grant(ctx, int64(er.cfg.LockTTL))
+		held, err := er.acquireLock(ctx, key, func() {
+			cancelLock(&domain.LockLostError{Lock: key})
+		})
 		if err != nil {
-			er.incEtcdError()
-			return fmt.Errorf("failed to create lease: %w", err)
-		}
-		acquired := false
-		start := time.Now()
-		for time.Since(start) < time.Duration(er.cfg.LockTimeout)*time.Second {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-
-			txnResp, err := er.client.Txn(ctx).
-				If(clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)).
-				Then(clientv3.OpPut(lockKey, er.hostname, clientv3.WithLease(leaseResp.ID))).
-				Commit()
-			if err != nil {
-				er.incEtcdError()
-				return fmt.Errorf("acquire lock %q: %w", lockKey, err)
-			}
-			if txnResp.Succeeded {
-				acquired = true
-
-				// Start keepalive for this lease
-				kaCtx, cancel := context.WithCancel(ctx)
-				kaCh, err := er.client.KeepAlive(kaCtx, leaseResp.ID)
-				if err != nil {
-					er.incEtcdError()
-					cancel()
-					// best-effort cleanup
-					_, _ = er.client.Delete(ctx, lockKey)
-					_, _ = er.client.Revoke(ctx, leaseResp.ID)
-					return fmt.Errorf("keepalive for lock %q: %w", lockKey, err)
-				}
-
-				// Drain keepalive responses until cancel
-				go func() {
-					for range kaCh {
-						// noop; presence keeps the lease alive
-					}
-				}()
-
-				leases = append(leases, heldLease{lockKey: lockKey, lease: leaseResp.ID, cancel: cancel})
-				break
-			}
-			time.Sleep(time.Duration(er.cfg.LockRetryInterval * float64(time.Second)))
+			release()
+			return err
 		}
-		if !acquired {
-			er.incLockFailure()
-			if _, e := er.client.Revoke(ctx, leaseResp.ID); e != nil {
-				er.logger.Warn().Err(e).Str("lock", lockKey).Msg("revoke unused lease after acquire timeout")
-			}
-			return fmt.Errorf("failed to acquire lock on %s", key)
+		leases = append(leases, held)
+	}
+
+	err = fn(withEtcdFence(lockCtx, &etcdFence{locks: leases, cancel: cancelLock}))
+	release()
+	var lost *domain.LockLostError
+	if errors.As(context.Cause(lockCtx), &lost) {
+		er.incLockFailure()
+		er.log(ctx).Error().Str("lock", lost.Lock).Msg("lock was lost before the transaction finished; its remaining writes were refused")
+		if !errors.As(err, new(*domain.LockLostError)) {
+			err = errors.Join(lost, err)
 		}
 	}
+	return err
+}
+
+// acquireLock takes the lock on key, retrying until etcd.lock_timeout, and
+// keeps its lease alive until the returned lock's cancel is called. onLost is
+// called if the lease stops being kept alive before then. The wait between
+// attempts ends as soon as ctx is done, and the lease is revoked whenever the
+// lock is not taken.
+func (er *EtcdRegistry) acquireLock(ctx context.Context, key string, onLost func()) (_ heldLease, err error) {
+	lockKey := fmt.Sprintf("/locks/%s", key)
+	// The span covers the wait for the lock, which other hosts may hold.
+	ctx, span := er.tracer.Start(ctx, "etcd.acquire_lock", trace.WithAttributes(attribute.String("lock.key", lockKey)))
+	defer func() { tracing.End(span, err) }()
+	leaseResp, err := er.client.Grant(ctx, int64(er.cfg.LockTTL))
+	if err != nil {
+		er.incEtcdError()
+		return heldLease{}, fmt.Errorf("failed to create lease: %w", err)
+	}
+	acquired := false
+	defer func() {
+		if acquired {
+			return
+		}
+		// ctx may be done, so the lease is revoked with its own deadline.
+		revCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if _, e := er.client.Revoke(revCtx, leaseResp.ID); e != nil {
+			er.log(ctx).Warn().Err(e).Str("lock", lockKey).Msg("revoke unused lock lease")
+		}
+	}()
 
-	err := fn()
+	deadline := time.NewTimer(time.Duration(er.cfg.LockTimeout * float64(time.Second)))
+	defer deadline.Stop()
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return heldLease{}, ctx.Err()
+		case <-deadline.C:
+			er.incLockFailure()
+			return heldLease{}, fmt.Errorf("failed to acquire lock on %s", key)
+		case <-retry.C:
+		}
+		// select picks at random among ready cases; never try once ctx is done.
+		if err := ctx.Err(); err != nil {
+			return heldLease{}, err
+		}
 
-	// Release the locks in reverse order
-	for i := len(leases) - 1; i >= 0; i-- {
-		l := leases[i]
-		l.cancel() // Stop the keepalive first
-		if _, e := er.client.Delete(ctx, l.lockKey); e != nil {
-			er.logger.Warn().Err(e).Msgf("failed to delete lock key %s", l.lockKey)
+		txnResp, err := er.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)).
+			Then(clientv3.OpPut(lockKey, er.hostname, clientv3.WithLease(leaseResp.ID))).
+			Commit()
+		if err != nil {
+			er.incEtcdError()
+			return heldLease{}, fmt.Errorf("acquire lock %q: %w", lockKey, err)
+		}
+		if !txnResp.Succeeded {
+			retry.Reset(time.Duration(er.cfg.LockRetryInterval * float64(time.Second)))
+			continue
 		}
-		if _, e := er.client.Revoke(ctx, l.lease); e != nil {
-			er.logger.Warn().Err(e).Msgf("failed to revoke lease for %s", l.lockKey)
+
+		// Start keepalive for this lease. Should it fail, revoking the lease
+		// also removes the lock key attached to it.
+		kaCtx, cancel := context.WithCancel(ctx)
+		kaCh, err := er.client.KeepAlive(kaCtx, leaseResp.ID)
+		if err != nil {
+			er.incEtcdError()
+			cancel()
+			return heldLease{}, fmt.Errorf("keepalive for lock %q: %w", lockKey, err)
 		}
+
+		// Drain keepalive responses until cancel. The channel closing
+		// while the lock is still wanted means the lease has expired or
+		// can no longer be renewed.
+		go func() {
+			for range kaCh {
+				// noop; presence keeps the lease alive
+			}
+			if kaCtx.Err() == nil {
+				er.log(ctx).Warn().Str("lock", lockKey).Msg("lock lease is no longer kept alive")
+				onLost()
+			}
+		}()
+
+		// The key was created by this transaction, so its create
+		// revision is the transaction's revision.
+		acquired = true
+		return heldLease{name: key, lockKey: lockKey, lease: leaseResp.ID, rev: txnResp.Header.GetRevision(), cancel: cancel}, nil
 	}
-	return err
 }
 
 // StopHeartbeat tears down this host's heartbeat (cancels keepalive, removes the
@@ -6,14 +6,18 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/auto-dns/docker-coredns-sync/internal/config"
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"github.com/rs/zerolog"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func testLogger() zerolog.Logger {
@@ -84,17 +88,18 @@ func TestEtcdRegistry_Register_CreatesKey(t *testing.T) {
 	if !mock.getCalled {
 		t.Error("expected Get to be called for index lookup")
 	}
-	if !mock.putCalled {
-		t.Error("expected Put to be called")
+	if mock.putCalled {
+		t.Error("expected the record to be written through a transaction, not a bare Put")
 	}
-	if len(mock.putKeys) != 1 {
-		t.Fatalf("expected 1 put key, got %d", len(mock.putKeys))
+	puts := mock.txnPuts()
+	if len(puts) != 1 {
+		t.Fatalf("expected 1 put, got %d", len(puts))
 	}
 
 	// Key should be /skydns/com/example/app/x1
 	expectedKeyPrefix := "/skydns/com/example/app/x"
-	if !strings.HasPrefix(mock.putKeys[0], expectedKeyPrefix) {
-		t.Errorf("expected key to start with %q, got %q", expectedKeyPrefix, mock.putKeys[0])
+	if key := string(puts[0].KeyBytes()); !strings.HasPrefix(key, expectedKeyPrefix) {
+		t.Errorf("expected key to start with %q, got %q", expectedKeyPrefix, key)
 	}
 }
 
@@ -112,12 +117,13 @@ func TestEtcdRegistry_Register_ValueContainsRecordData(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if len(mock.putValues) != 1 {
-		t.Fatalf("expected 1 put value, got %d", len(mock.putValues))
+	puts := mock.txnPuts()
+	if len(puts) != 1 {
+		t.Fatalf("expected 1 put value, got %d", len(puts))
 	}
 
 	var wire etcdRecord
-	if err := json.Unmarshal([]byte(mock.putValues[0]), &wire); err != nil {
+	if err := json.Unmarshal(puts[0].ValueBytes(), &wire); err != nil {
 		t.Fatalf("invalid JSON in put value: %v", err)
 	}
 
@@ -158,8 +164,8 @@ func TestEtcdRegistry_Register_IncrementsIndex(t *testing.T) {
 
 	// Should use x3 since x1 and x2 exist
 	expectedKey := "/skydns/com/example/app/x3"
-	if mock.putKeys[0] != expectedKey {
-		t.Errorf("expected key %q, got %q", expectedKey, mock.putKeys[0])
+	if key := string(mock.txnPuts()[0].KeyBytes()); key != expectedKey {
+		t.Errorf("expected key %q, got %q", expectedKey, key)
 	}
 }
 
@@ -187,8 +193,10 @@ func TestEtcdRegistry_Register_GetError(t *testing.T) {
 
 func TestEtcdRegistry_Register_PutError(t *testing.T) {
 	mock := newMockEtcdClient()
-	mock.putFunc = func(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
-		return nil, errors.New("write failed")
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		return &mockTxn{commitFunc: func() (*clientv3.TxnResponse, error) {
+			return nil, errors.New("write failed")
+		}}
 	}
 
 	cfg := testConfig()
@@ -207,6 +215,121 @@ func TestEtcdRegistry_Register_PutError(t *testing.T) {
 	}
 }
 
+func TestEtcdRegistry_Register_ClaimsKeyOnlyIfAbsent(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "192.168.1.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	txn := mock.txns[0]
+	if len(txn.ifCmps) != 1 {
+		t.Fatalf("expected 1 compare, got %d", len(txn.ifCmps))
+	}
+	cmp := txn.ifCmps[0]
+	if string(cmp.Key) != "/skydns/com/example/app/x1" ||
+		cmp.Target != etcdserverpb.Compare_CREATE ||
+		cmp.Result != etcdserverpb.Compare_EQUAL ||
+		cmp.TargetUnion.(*etcdserverpb.Compare_CreateRevision).CreateRevision != 0 {
+		t.Errorf("expected CreateRevision(x1) == 0, got %+v", cmp)
+	}
+}
+
+// conflictingTxns makes the first conflicts commits fail their compare,
+// returning keys as the Else listing, and lets later commits succeed.
+func conflictingTxns(mock *mockEtcdClient, conflicts int, keys ...string) *[]*mockTxn {
+	var txns []*mockTxn
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		txn := &mockTxn{ctx: ctx}
+		n := len(txns)
+		txn.commitFunc = func() (*clientv3.TxnResponse, error) {
+			if n >= conflicts {
+				return &clientv3.TxnResponse{Succeeded: true, Header: &etcdserverpb.ResponseHeader{}}, nil
+			}
+			kvs := make([]*mvccpb.KeyValue, 0, len(keys))
+			for _, k := range keys {
+				kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(k)})
+			}
+			return &clientv3.TxnResponse{
+				Header: &etcdserverpb.ResponseHeader{},
+				Responses: []*etcdserverpb.ResponseOp{{
+					Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: &etcdserverpb.RangeResponse{Kvs: kvs}},
+				}},
+			}, nil
+		}
+		txns = append(txns, txn)
+		return txn
+	}
+	return &txns
+}
+
+func TestEtcdRegistry_Register_RetriesWithNextFreeKeyOnConflict(t *testing.T) {
+	mock := newMockEtcdClient()
+	// Our read saw nothing, but an external writer created x1 and x2 before
+	// our transaction committed.
+	txns := conflictingTxns(mock, 1, "/skydns/com/example/app/x1", "/skydns/com/example/app/x2")
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "192.168.1.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*txns) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(*txns))
+	}
+	if key := string((*txns)[1].thenOps[0].KeyBytes()); key != "/skydns/com/example/app/x3" {
+		t.Errorf("expected the retry to claim x3, got %q", key)
+	}
+	if !(*txns)[1].elseOps[0].IsGet() {
+		t.Error("expected the transaction to list the name's keys on conflict")
+	}
+}
+
+func TestEtcdRegistry_Register_NeverRetriesTheConflictingKey(t *testing.T) {
+	mock := newMockEtcdClient()
+	// A conflict with no listing must still move past the taken key.
+	txns := conflictingTxns(mock, 1)
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "192.168.1.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key := string((*txns)[1].thenOps[0].KeyBytes()); key != "/skydns/com/example/app/x2" {
+		t.Errorf("expected the retry to claim x2, got %q", key)
+	}
+}
+
+func TestEtcdRegistry_Register_GivesUpAfterRepeatedConflicts(t *testing.T) {
+	mock := newMockEtcdClient()
+	txns := conflictingTxns(mock, registerMaxAttempts)
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	err := reg.Register(context.Background(), makeIntent("app.example.com", "192.168.1.1", domain.RecordA))
+	if err == nil {
+		t.Fatal("expected an error after every attempt conflicted")
+	}
+	if len(*txns) != registerMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", registerMaxAttempts, len(*txns))
+	}
+}
+
+func TestEtcdRegistry_getNextIndexedKey_IsLinearizable(t *testing.T) {
+	mock := newMockEtcdClient()
+	var serializable bool
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		serializable = clientv3.OpGet(key, opts...).IsSerializable()
+		return &clientv3.GetResponse{}, nil
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+
+	if _, err := reg.getNextIndexedKey(context.Background(), "app.example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if serializable {
+		t.Error("expected a linearizable read so the candidate reflects every committed write")
+	}
+}
+
 func TestEtcdRegistry_Remove_DeletesMatchingKey(t *testing.T) {
 	mock := newMockEtcdClient()
 	cfg := testConfig()
@@ -465,7 +588,7 @@ func TestEtcdRegistry_LockTransaction_Success(t *testing.T) {
 	executed := false
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1", "key2"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1", "key2"}, func(context.Context) error {
 		executed = true
 		return nil
 	})
@@ -493,7 +616,7 @@ func TestEtcdRegistry_LockTransaction_FunctionError(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return errors.New("function error")
 	})
 
@@ -505,8 +628,8 @@ func TestEtcdRegistry_LockTransaction_FunctionError(t *testing.T) {
 	}
 
 	// Locks should still be released
-	if !mock.deleteCalled {
-		t.Error("expected Delete to be called to release lock")
+	if dels := mock.txnDeletes(); len(dels) != 1 || string(dels[0].KeyBytes()) != "/locks/key1" {
+		t.Errorf("expected the lock key to be deleted on release, got %d deletes", len(dels))
 	}
 	if !mock.revokeCalled {
 		t.Error("expected Revoke to be called to release lease")
@@ -526,7 +649,7 @@ func TestEtcdRegistry_LockTransaction_DeduplicatesKeys(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1", "key1", "key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1", "key1", "key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -553,7 +676,7 @@ func TestEtcdRegistry_LockTransaction_ContextCancellation(t *testing.T) {
 		return &clientv3.LeaseGrantResponse{ID: 1}, nil
 	}
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -589,7 +712,7 @@ func TestEtcdRegistry_Register_DifferentRecordTypes(t *testing.T) {
 			}
 
 			var wire etcdRecord
-			json.Unmarshal([]byte(mock.putValues[0]), &wire)
+			json.Unmarshal(mock.txnPuts()[0].ValueBytes(), &wire)
 
 			if wire.Kind != tt.kind {
 				t.Errorf("expected Kind %v, got %v", tt.kind, wire.Kind)
@@ -870,7 +993,7 @@ func TestEtcdRegistry_LockTransaction_GrantError(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -898,7 +1021,7 @@ func TestEtcdRegistry_LockTransaction_TxnError(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -907,6 +1030,39 @@ func TestEtcdRegistry_LockTransaction_TxnError(t *testing.T) {
 	}
 }
 
+func TestEtcdRegistry_LockTransaction_ReleasesHeldLocksOnFailure(t *testing.T) {
+	mock := newMockEtcdClient()
+	var deleted []string
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		txn := &mockTxn{ctx: ctx}
+		txn.commitFunc = func() (*clientv3.TxnResponse, error) {
+			for _, op := range txn.thenOps {
+				if op.IsDelete() {
+					deleted = append(deleted, string(op.KeyBytes()))
+				}
+			}
+			// key1 is free; key2 is held by another host until the timeout.
+			return &clientv3.TxnResponse{Succeeded: string(txn.ifCmps[0].Key) == "/locks/key1"}, nil
+		}
+		return txn
+	}
+	cfg := testConfig()
+	cfg.LockTimeout = 0.2
+	cfg.LockRetryInterval = 0.05
+	reg := NewEtcdRegistry(mock, cfg, "docker-host", 0, testLogger())
+
+	err := reg.LockTransaction(context.Background(), []string{"key2", "key1"}, func(context.Context) error {
+		t.Error("expected fn not to run without every lock")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error when a lock cannot be acquired")
+	}
+	if len(deleted) != 1 || deleted[0] != "/locks/key1" {
+		t.Errorf("expected the already-held key1 lock to be released, got %v", deleted)
+	}
+}
+
 func TestEtcdRegistry_LockTransaction_KeepAliveError(t *testing.T) {
 	mock := newMockEtcdClient()
 	mock.keepAliveFunc = func(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
@@ -918,7 +1074,7 @@ func TestEtcdRegistry_LockTransaction_KeepAliveError(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -938,7 +1094,7 @@ func TestEtcdRegistry_LockTransaction_EmptyKeys(t *testing.T) {
 	executed := false
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{}, func() error {
+	err := reg.LockTransaction(ctx, []string{}, func(context.Context) error {
 		executed = true
 		return nil
 	})
@@ -970,7 +1126,7 @@ func TestEtcdRegistry_LockTransaction_MultipleKeys(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1", "key2", "key3"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1", "key2", "key3"}, func(context.Context) error {
 		return nil
 	})
 
@@ -1121,7 +1277,7 @@ func TestEtcdRegistry_LockTransaction_ContextCancelDuringRetry(t *testing.T) {
 		cancel()
 	}()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -1133,6 +1289,44 @@ func TestEtcdRegistry_LockTransaction_ContextCancelDuringRetry(t *testing.T) {
 	}
 }
 
+func TestEtcdRegistry_LockTransaction_CancelEndsWaitAndRevokesLease(t *testing.T) {
+	mock := newMockEtcdClient()
+	cfg := testConfig()
+	cfg.LockTimeout = 30
+	cfg.LockRetryInterval = 30 // Only a ctx-aware wait returns before the test times out.
+	reg := NewEtcdRegistry(mock, cfg, "docker-host", 0, testLogger())
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		return &mockTxn{
+			commitFunc: func() (*clientv3.TxnResponse, error) {
+				return &clientv3.TxnResponse{Succeeded: false}, nil
+			},
+		}
+	}
+	var revoked atomic.Int32
+	mock.revokeFunc = func(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+		// The lease is revoked even though the caller's ctx is done.
+		if ctx.Err() == nil {
+			revoked.Add(1)
+		}
+		return &clientv3.LeaseRevokeResponse{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error { return nil })
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the ctx error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the wait to end with ctx, took %v", elapsed)
+	}
+	if revoked.Load() != 1 {
+		t.Errorf("expected the unused lease to be revoked once, got %d", revoked.Load())
+	}
+}
+
 func TestEtcdRegistry_LockTransaction_AcquireTimeout(t *testing.T) {
 	mock := newMockEtcdClient()
 	cfg := &config.EtcdConfig{
@@ -1155,7 +1349,7 @@ func TestEtcdRegistry_LockTransaction_AcquireTimeout(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -1192,7 +1386,7 @@ func TestEtcdRegistry_LockTransaction_RevokeTimeoutError(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		return nil
 	})
 
@@ -1233,7 +1427,7 @@ func TestEtcdRegistry_LockTransaction_DeleteAndRevokeErrorsDuringRelease(t *test
 
 	ctx := context.Background()
 
-	err := reg.LockTransaction(ctx, []string{"key1"}, func() error {
+	err := reg.LockTransaction(ctx, []string{"key1"}, func(context.Context) error {
 		executed = true
 		return nil
 	})
@@ -1353,3 +1547,36 @@ func TestEtcdRegistry_Remove_ContainerIdEmpty(t *testing.T) {
 		t.Error("expected Txn to be called for delete")
 	}
 }
+
+func TestEtcdRegistry_TracesOperations(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 0, testLogger())
+	exporter := tracetest.NewInMemoryExporter()
+	reg.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		return reg.Register(ctx, makeIntent("app.example.com", "192.168.1.1", domain.RecordA))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range exporter.GetSpans().Snapshots() {
+		spans[s.Name()] = s
+	}
+	txn, ok := spans["etcd.lock_transaction"]
+	if !ok {
+		t.Fatalf("expected a lock transaction span, got %v", spans)
+	}
+	for _, name := range []string{"etcd.acquire_lock", "etcd.register", "etcd.release_locks"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("expected a %s span", name)
+			continue
+		}
+		if s.Parent().SpanID() != txn.SpanContext().SpanID() {
+			t.Errorf("expected %s within the lock transaction", name)
+		}
+	}
+}
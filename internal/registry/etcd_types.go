@@ -7,7 +7,10 @@ import (
 )
 
 type heldLease struct {
+	name    string
 	lockKey string
 	lease   clientv3.LeaseID
-	cancel  context.CancelFunc
+	// rev is the revision the lock key was created at, its fencing token.
+	rev    int64
+	cancel context.CancelFunc
 }
@@ -8,7 +8,12 @@ import (
 	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 )
 
+// etcdRecord is the JSON value of a record key. CoreDNS reads host and ttl;
+// the rest is ownership metadata. Schema is the wire format version
+// (domain.RecordSchema when written by this release), absent from records
+// written before formats were versioned.
 type etcdRecord struct {
+	Schema             int               `json:"schema,omitempty"`
 	Host               string            `json:"host"`
 	TTL                uint32            `json:"ttl,omitempty"`
 	Kind               domain.RecordKind `json:"record_type"`
@@ -19,8 +24,11 @@ type etcdRecord struct {
 	Force              bool              `json:"force"`
 }
 
+// marshalEtcdValue renders ri as a record value in this release's wire format.
+// Fields a newer release stored alongside the record are kept.
 func marshalEtcdValue(ri *domain.RecordIntent) (string, error) {
 	wire := etcdRecord{
+		Schema:             domain.RecordSchema,
 		Host:               ri.Record.Value,
 		TTL:                ri.TTL,
 		Kind:               ri.Record.Kind,
@@ -30,13 +38,15 @@ func marshalEtcdValue(ri *domain.RecordIntent) (string, error) {
 		Created:            ri.Created,
 		Force:              ri.Force,
 	}
-	b, err := json.Marshal(wire)
+	b, err := marshalWithUnknown(wire, ri.Wire.Unknown)
 	if err != nil {
 		return "", err
 	}
 	return string(b), nil
 }
 
+// unmarshalEtcdValue decodes the record value stored under key. The record's
+// wire schema and any fields this release does not know are kept in its Wire.
 func unmarshalEtcdValue(key string, raw string, prefix string) (*domain.RecordIntent, error) {
 	fqdn := fqdnFromKey(prefix, key)
 
@@ -44,6 +54,10 @@ func unmarshalEtcdValue(key string, raw string, prefix string) (*domain.RecordIn
 	if err := json.Unmarshal([]byte(raw), &wire); err != nil {
 		return nil, fmt.Errorf("decode etcd value: %w", err)
 	}
+	unknown, err := unknownFields([]byte(raw), wire)
+	if err != nil {
+		return nil, fmt.Errorf("decode etcd value: %w", err)
+	}
 
 	rec, err := domain.NewFromKind(wire.Kind, fqdn, wire.Host)
 	if err != nil {
@@ -58,5 +72,6 @@ func unmarshalEtcdValue(key string, raw string, prefix string) (*domain.RecordIn
 		Force:         wire.Force,
 		TTL:           wire.TTL,
 		Record:        rec,
+		Wire:          domain.WireInfo{Schema: wire.Schema, Unknown: unknown},
 	}, nil
 }
@@ -491,3 +491,59 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestMarshalEtcdValue_StampsSchema(t *testing.T) {
+	value, err := marshalEtcdValue(makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if !contains(value, `"schema":1`) {
+		t.Errorf("expected the wire schema to be stamped, got %s", value)
+	}
+}
+
+func TestUnmarshalEtcdValue_Schema(t *testing.T) {
+	legacy := `{"host":"10.0.0.1","record_type":"A","owner_hostname":"old-host","owner_container_id":"c1","owner_container_name":"app","created":"2026-01-01T00:00:00Z","force":false}`
+	ri, err := unmarshalEtcdValue("/skydns/com/example/app/x1", legacy, "/skydns")
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if ri.Wire.Schema != 0 || ri.Wire.Recognized() {
+		t.Errorf("expected an unversioned record to read as schema 0, got %+v", ri.Wire)
+	}
+
+	current, _ := marshalEtcdValue(makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+	ri, err = unmarshalEtcdValue("/skydns/com/example/app/x1", current, "/skydns")
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if !ri.Wire.Recognized() || ri.Wire.Unknown != nil {
+		t.Errorf("expected this release's record to be recognized with no unknown fields, got %+v", ri.Wire)
+	}
+}
+
+func TestMarshalUnmarshal_KeepsUnknownFields(t *testing.T) {
+	newer := `{"schema":2,"host":"10.0.0.1","record_type":"A","owner_hostname":"new-host","owner_container_id":"c1","owner_container_name":"app","created":"2026-01-01T00:00:00Z","force":false,"priority":10,"meta":{"zone":"b"}}`
+	ri, err := unmarshalEtcdValue("/skydns/com/example/app/x1", newer, "/skydns")
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if ri.Wire.Schema != 2 || ri.Wire.Recognized() {
+		t.Errorf("expected a newer schema not to be recognized, got %+v", ri.Wire)
+	}
+
+	value, err := marshalEtcdValue(ri)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(got["priority"]) != "10" || string(got["meta"]) != `{"zone":"b"}` {
+		t.Errorf("expected unknown fields to round-trip, got %s", value)
+	}
+	if string(got["host"]) != `"10.0.0.1"` || string(got["owner_hostname"]) != `"new-host"` {
+		t.Errorf("expected known fields to be kept, got %s", value)
+	}
+}
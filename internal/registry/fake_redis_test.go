@@ -0,0 +1,428 @@
+package registry
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal in-process server speaking the Redis protocol (RESP2)
+// with just enough of the command set for RedisRegistry: strings with expiry,
+// hashes, SCAN, and WATCH/MULTI/EXEC optimistic transactions.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	strs    map[string]string
+	hashes  map[string]map[string]string
+	expires map[string]time.Time
+	// versions is bumped on every write to a key; WATCH compares it at EXEC.
+	versions map[string]uint64
+	// failNext makes the next n commands named cmd return an error.
+	failNext map[string]int
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{
+		ln:       ln,
+		strs:     map[string]string{},
+		hashes:   map[string]map[string]string{},
+		expires:  map[string]time.Time{},
+		versions: map[string]uint64{},
+		failNext: map[string]int{},
+	}
+	go f.serve()
+	t.Cleanup(func() { _ = ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) failCommand(cmd string, n int) {
+	f.mu.Lock()
+	f.failNext[strings.ToUpper(cmd)] = n
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) hget(key, field string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.hashes[key][field]
+	return v, ok
+}
+
+func (f *fakeRedis) hset(key, field, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hashes[key] == nil {
+		f.hashes[key] = map[string]string{}
+	}
+	f.hashes[key][field] = value
+	f.versions[key]++
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireLocked(key)
+	v, ok := f.strs[key]
+	return v, ok
+}
+
+func (f *fakeRedis) set(key, value string, ttl time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.strs[key] = value
+	delete(f.expires, key)
+	if ttl > 0 {
+		f.expires[key] = time.Now().Add(ttl)
+	}
+	f.versions[key]++
+}
+
+func (f *fakeRedis) ttl(key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if exp, ok := f.expires[key]; ok {
+		return time.Until(exp)
+	}
+	return 0
+}
+
+func (f *fakeRedis) sawCommand(cmd string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// connState is the per-connection transaction state.
+type connState struct {
+	watched map[string]uint64
+	queued  [][]string
+	inMulti bool
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	cs := &connState{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.dispatch(cs, args, w)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		hdr, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(hdr, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// reply values: string = simple string, []byte = bulk, nil-bulk = nilBulk,
+// int64 = integer, error = error, []any = array, nilArray = null array.
+type nilBulk struct{}
+type nilArray struct{}
+
+func writeReply(w *bufio.Writer, v any) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case nilBulk:
+		w.WriteString("$-1\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+func (f *fakeRedis) dispatch(cs *connState, args []string, w *bufio.Writer) {
+	if len(args) == 0 {
+		return
+	}
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "MULTI":
+		cs.inMulti = true
+		cs.queued = nil
+		writeReply(w, "OK")
+		return
+	case "DISCARD":
+		cs.inMulti = false
+		cs.queued = nil
+		cs.watched = nil
+		writeReply(w, "OK")
+		return
+	case "EXEC":
+		f.mu.Lock()
+		aborted := false
+		for k, v := range cs.watched {
+			f.expireLocked(k)
+			if f.versions[k] != v {
+				aborted = true
+			}
+		}
+		var results []any
+		if !aborted {
+			for _, q := range cs.queued {
+				results = append(results, f.execLocked(q))
+			}
+		}
+		f.mu.Unlock()
+		cs.inMulti = false
+		cs.queued = nil
+		cs.watched = nil
+		if aborted {
+			writeReply(w, nilArray{})
+			return
+		}
+		writeReply(w, results)
+		return
+	case "WATCH":
+		f.mu.Lock()
+		if cs.watched == nil {
+			cs.watched = map[string]uint64{}
+		}
+		for _, k := range args[1:] {
+			f.expireLocked(k)
+			cs.watched[k] = f.versions[k]
+		}
+		f.mu.Unlock()
+		writeReply(w, "OK")
+		return
+	case "UNWATCH":
+		cs.watched = nil
+		writeReply(w, "OK")
+		return
+	}
+	if cs.inMulti {
+		cs.queued = append(cs.queued, args)
+		writeReply(w, "QUEUED")
+		return
+	}
+	f.mu.Lock()
+	reply := f.execLocked(args)
+	f.mu.Unlock()
+	writeReply(w, reply)
+}
+
+func (f *fakeRedis) expireLocked(key string) {
+	if exp, ok := f.expires[key]; ok && !time.Now().Before(exp) {
+		delete(f.strs, key)
+		delete(f.expires, key)
+		f.versions[key]++
+	}
+}
+
+func (f *fakeRedis) execLocked(args []string) any {
+	cmd := strings.ToUpper(args[0])
+	f.commands = append(f.commands, cmd)
+	if n := f.failNext[cmd]; n > 0 {
+		f.failNext[cmd] = n - 1
+		return errors.New("ERR injected failure")
+	}
+	switch cmd {
+	case "PING":
+		return "PONG"
+	case "SELECT", "AUTH":
+		return "OK"
+	case "GET":
+		f.expireLocked(args[1])
+		if v, ok := f.strs[args[1]]; ok {
+			return []byte(v)
+		}
+		return nilBulk{}
+	case "SET":
+		key, val := args[1], args[2]
+		f.expireLocked(key)
+		var ttl time.Duration
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(ms) * time.Millisecond
+				i++
+			case "EX":
+				s, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(s) * time.Second
+				i++
+			}
+		}
+		if _, exists := f.strs[key]; nx && exists {
+			return nilBulk{}
+		}
+		f.strs[key] = val
+		delete(f.expires, key)
+		if ttl > 0 {
+			f.expires[key] = time.Now().Add(ttl)
+		}
+		f.versions[key]++
+		return "OK"
+	case "DEL":
+		var n int64
+		for _, k := range args[1:] {
+			f.expireLocked(k)
+			if _, ok := f.strs[k]; ok {
+				delete(f.strs, k)
+				delete(f.expires, k)
+				n++
+			}
+			if _, ok := f.hashes[k]; ok {
+				delete(f.hashes, k)
+				n++
+			}
+			f.versions[k]++
+		}
+		return n
+	case "PEXPIRE":
+		f.expireLocked(args[1])
+		if _, ok := f.strs[args[1]]; !ok {
+			return int64(0)
+		}
+		ms, _ := strconv.Atoi(args[2])
+		f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return int64(1)
+	case "HGET":
+		if v, ok := f.hashes[args[1]][args[2]]; ok {
+			return []byte(v)
+		}
+		return nilBulk{}
+	case "HSET":
+		if f.hashes[args[1]] == nil {
+			f.hashes[args[1]] = map[string]string{}
+		}
+		var n int64
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := f.hashes[args[1]][args[i]]; !ok {
+				n++
+			}
+			f.hashes[args[1]][args[i]] = args[i+1]
+		}
+		f.versions[args[1]]++
+		return n
+	case "HDEL":
+		var n int64
+		for _, field := range args[2:] {
+			if _, ok := f.hashes[args[1]][field]; ok {
+				delete(f.hashes[args[1]], field)
+				n++
+			}
+		}
+		if len(f.hashes[args[1]]) == 0 {
+			delete(f.hashes, args[1])
+		}
+		f.versions[args[1]]++
+		return n
+	case "HGETALL":
+		h := f.hashes[args[1]]
+		fields := make([]string, 0, len(h))
+		for k := range h {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		out := make([]any, 0, 2*len(h))
+		for _, k := range fields {
+			out = append(out, []byte(k), []byte(h[k]))
+		}
+		return out
+	case "SCAN":
+		match := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				match = args[i+1]
+			}
+		}
+		var keys []any
+		for k := range f.strs {
+			f.expireLocked(k)
+		}
+		for k := range f.strs {
+			if ok, _ := path.Match(match, k); ok {
+				keys = append(keys, []byte(k))
+			}
+		}
+		for k := range f.hashes {
+			if ok, _ := path.Match(match, k); ok {
+				keys = append(keys, []byte(k))
+			}
+		}
+		return []any{[]byte("0"), keys}
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+}
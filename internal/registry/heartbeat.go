@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// hostStatus is the status a registry publishes as its heartbeat value: the
+// host's static details, set once at startup, and the outcome of its latest
+// successful reconciliation. Both backends store it as JSON.
+type hostStatus struct {
+	mu      sync.Mutex
+	current domain.HostStatus
+	// published is the status last written to the heartbeat key.
+	published domain.HostStatus
+}
+
+func newHostStatus(hostname string) *hostStatus {
+	return &hostStatus{current: domain.HostStatus{Hostname: hostname}}
+}
+
+// setInfo replaces the static details. The hostname is always the registry's
+// own, and the reconciliation outcome is kept.
+func (h *hostStatus) setInfo(s domain.HostStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.Hostname = h.current.Hostname
+	s.RecordsOwned = h.current.RecordsOwned
+	s.LastReconcile = h.current.LastReconcile
+	h.current = s
+}
+
+// value returns the heartbeat value to write, and the status it encodes for
+// markPublished.
+func (h *hostStatus) value() (string, domain.HostStatus) {
+	h.mu.Lock()
+	s := h.current
+	h.mu.Unlock()
+	return encodeHeartbeat(s), s
+}
+
+func (h *hostStatus) markPublished(s domain.HostStatus) {
+	h.mu.Lock()
+	h.published = s
+	h.mu.Unlock()
+}
+
+// update records a successful reconciliation and reports whether the
+// heartbeat should be rewritten: when the number of records owned changed, or
+// the published reconcile time is older than refresh. Rewriting on every pass
+// would cost a write per host per poll interval for no new information.
+func (h *hostStatus) update(recordsOwned int, reconciledAt time.Time, refresh time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.current.RecordsOwned = recordsOwned
+	h.current.LastReconcile = reconciledAt
+	return recordsOwned != h.published.RecordsOwned || reconciledAt.Sub(h.published.LastReconcile) >= refresh
+}
+
+func encodeHeartbeat(s domain.HostStatus) string {
+	s.Schema = domain.HeartbeatSchema
+	b, _ := json.Marshal(s) // HostStatus always marshals
+	return string(b)
+}
+
+// decodeHeartbeat parses the heartbeat value of hostname, which is taken from
+// the key rather than trusted from the value. Instances predating the JSON
+// payload store just their hostname and are reported with nothing else, and
+// schema zero. A payload in a newer format is read as far as it is understood.
+//
+// Liveness never depends on the payload: a heartbeat key in any format marks
+// its host as live (see GetLiveHostnames), so a format change can never make
+// a peer look dead.
+func decodeHeartbeat(hostname string, value []byte) domain.HostStatus {
+	var s domain.HostStatus
+	if err := json.Unmarshal(value, &s); err != nil {
+		s = domain.HostStatus{}
+	}
+	s.Hostname = hostname
+	return s
+}
+
+func sortFleet(hosts []domain.HostStatus) {
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Hostname < hosts[j].Hostname })
+}
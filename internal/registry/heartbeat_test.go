@@ -2,11 +2,16 @@ package registry
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -28,15 +33,19 @@ func TestEtcdRegistry_StartHeartbeat_WritesLeasedKey(t *testing.T) {
 	if !mock.keepAliveCalled {
 		t.Error("expected KeepAlive to be called")
 	}
-	if len(mock.putKeys) != 1 {
-		t.Fatalf("expected 1 put, got %d", len(mock.putKeys))
+	if len(mock.putKeys) != 2 {
+		t.Fatalf("expected the heartbeat and GC candidate puts, got %d", len(mock.putKeys))
 	}
 	wantKey := "/docker-coredns-sync/heartbeat/docker-host"
 	if mock.putKeys[0] != wantKey {
 		t.Errorf("expected heartbeat key %q, got %q", wantKey, mock.putKeys[0])
 	}
-	if mock.putValues[0] != "docker-host" {
-		t.Errorf("expected heartbeat value 'docker-host', got %q", mock.putValues[0])
+	var payload domain.HostStatus
+	if err := json.Unmarshal([]byte(mock.putValues[0]), &payload); err != nil || payload.Hostname != "docker-host" {
+		t.Errorf("expected this host's status as the heartbeat value, got %q", mock.putValues[0])
+	}
+	if mock.putKeys[1] != "/docker-coredns-sync/gc-leader/1" {
+		t.Errorf("expected the GC candidate key under lease 1, got %q", mock.putKeys[1])
 	}
 	if reg.hbLease == 0 {
 		t.Error("expected heartbeat lease to be recorded")
@@ -172,6 +181,57 @@ func TestEtcdRegistry_GetLiveHostnames_ParsesKeysAndIncludesSelf(t *testing.T) {
 	}
 }
 
+type recordingHeartbeatMetrics struct {
+	ages map[string]time.Duration
+}
+
+func (r *recordingHeartbeatMetrics) SetHeartbeatAges(ages map[string]time.Duration) { r.ages = ages }
+
+func TestEtcdRegistry_GetLiveHostnames_ReportsHeartbeatAges(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{
+			{Key: []byte("/docker-coredns-sync/heartbeat/host-a"), Lease: 1},
+			{Key: []byte("/docker-coredns-sync/heartbeat/host-b"), Lease: 2},
+			{Key: []byte("/docker-coredns-sync/heartbeat/host-c"), Lease: 3},
+			{Key: []byte("/docker-coredns-sync/heartbeat/host-d")},
+		}}, nil
+	}
+	var lookups atomic.Int32
+	mock.timeToLiveFunc = func(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseTimeToLiveResponse, error) {
+		lookups.Add(1)
+		switch id {
+		case 1:
+			return &clientv3.LeaseTimeToLiveResponse{ID: id, GrantedTTL: 30, TTL: 22}, nil
+		case 2:
+			return &clientv3.LeaseTimeToLiveResponse{ID: id, TTL: -1}, nil
+		}
+		return nil, errors.New("boom")
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	reg.hbActive = true
+
+	if _, err := reg.GetLiveHostnames(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups.Load() != 0 {
+		t.Errorf("expected no lease lookups without heartbeat metrics, got %d", lookups.Load())
+	}
+
+	m := &recordingHeartbeatMetrics{}
+	reg.SetHeartbeatMetrics(m)
+	live, err := reg.GetLiveHostnames(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(live) != 5 {
+		t.Errorf("expected a failed lease lookup to leave the live set alone, got %v", live)
+	}
+	if len(m.ages) != 1 || m.ages["host-a"] != 8*time.Second {
+		t.Errorf("expected only host-a's age of 8s, got %v", m.ages)
+	}
+}
+
 func TestEtcdRegistry_GetLiveHostnames_SkipsEmptySuffix(t *testing.T) {
 	mock := newMockEtcdClient()
 	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
@@ -290,3 +350,347 @@ func TestEtcdRegistry_Close_StopsHeartbeat(t *testing.T) {
 		t.Error("expected underlying client to be closed")
 	}
 }
+
+// opLease extracts the lease an Op is attached to. clientv3.Op keeps it in an
+// unexported field, so it is read via reflection.
+func opLease(op clientv3.Op) clientv3.LeaseID {
+	return clientv3.LeaseID(reflect.ValueOf(op).FieldByName("leaseID").Int())
+}
+
+func leaseRecordsConfig() *config.EtcdConfig {
+	cfg := testConfig()
+	cfg.LeaseRecords = true
+	return cfg
+}
+
+func TestEtcdRegistry_Register_LeaseRecordsAttachesHeartbeatLease(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.grantFunc = func(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+		return &clientv3.LeaseGrantResponse{ID: 42}, nil
+	}
+	reg := NewEtcdRegistry(mock, leaseRecordsConfig(), "docker-host", 30, testLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	puts := mock.txnPuts()
+	if len(puts) != 1 {
+		t.Fatalf("expected 1 record write, got %d", len(puts))
+	}
+	if lease := opLease(puts[0]); lease != 42 {
+		t.Errorf("expected record to be attached to heartbeat lease 42, got %d", lease)
+	}
+}
+
+func TestEtcdRegistry_Register_LeaseRecordsRequiresHeartbeat(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, leaseRecordsConfig(), "docker-host", 30, testLogger())
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err == nil {
+		t.Fatal("expected error when no heartbeat lease is held")
+	}
+	if len(mock.txnPuts()) != 0 {
+		t.Error("expected no unleased record to be written")
+	}
+}
+
+func TestEtcdRegistry_Register_WithoutLeaseRecordsIsUnleased(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	reg.hbLease, reg.hbActive = 7, true
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease := opLease(mock.txnPuts()[0]); lease != 0 {
+		t.Errorf("expected an unleased record by default, got lease %d", lease)
+	}
+}
+
+func TestEtcdRegistry_Heartbeat_ReattachesRecordsToNewLease(t *testing.T) {
+	mock := newMockEtcdClient()
+
+	own, _ := marshalEtcdValue(makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+	foreign := makeIntent("other.example.com", "10.0.0.2", domain.RecordA)
+	foreign.Hostname = "other-host"
+	foreignVal, _ := marshalEtcdValue(foreign)
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{
+			{Key: []byte("/skydns/com/example/app/x1"), Value: []byte(own), Lease: 1, ModRevision: 10},
+			{Key: []byte("/skydns/com/example/other/x1"), Value: []byte(foreignVal), Lease: 9, ModRevision: 11},
+		}}, nil
+	}
+	var nextLease atomic.Int64
+	mock.grantFunc = func(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+		return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(nextLease.Add(1))}, nil
+	}
+	firstCh := make(chan *clientv3.LeaseKeepAliveResponse)
+	var kaCalls atomic.Int32
+	mock.keepAliveFunc = func(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+		if kaCalls.Add(1) == 1 {
+			return firstCh, nil
+		}
+		ch := make(chan *clientv3.LeaseKeepAliveResponse)
+		go func() {
+			<-ctx.Done()
+			close(ch)
+		}()
+		return ch, nil
+	}
+	type reattach struct {
+		key   string
+		lease clientv3.LeaseID
+		cmps  int
+	}
+	reattached := make(chan reattach, 4)
+	mock.txnFunc = func(ctx context.Context) clientv3.Txn {
+		txn := &mockTxn{ctx: ctx}
+		txn.commitFunc = func() (*clientv3.TxnResponse, error) {
+			for _, op := range txn.thenOps {
+				reattached <- reattach{key: string(op.KeyBytes()), lease: opLease(op), cmps: len(txn.ifCmps)}
+			}
+			return &clientv3.TxnResponse{Succeeded: true}, nil
+		}
+		return txn
+	}
+
+	reg := NewEtcdRegistry(mock, leaseRecordsConfig(), "docker-host", 30, testLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// On start, the record still held by an older lease (1 == the new lease
+	// here) is left alone; the foreign record is never touched.
+	select {
+	case r := <-reattached:
+		t.Fatalf("unexpected reattach on start: %+v", r)
+	default:
+	}
+
+	close(firstCh) // lose the lease; the next grant returns lease 2
+
+	select {
+	case r := <-reattached:
+		if r.key != "/skydns/com/example/app/x1" || r.lease != 2 {
+			t.Errorf("expected own record reattached to lease 2, got %+v", r)
+		}
+		if r.cmps != 1 {
+			t.Errorf("expected the reattach to be guarded by a mod-revision compare, got %d compares", r.cmps)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected records to be reattached after the heartbeat was re-established")
+	}
+	select {
+	case r := <-reattached:
+		t.Errorf("expected only this host's record to be reattached, also got %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEtcdRegistry_StartHeartbeat_UpgradesOwnLegacyRecords(t *testing.T) {
+	mock := newMockEtcdClient()
+	legacy := `{"host":"10.0.0.1","record_type":"A","owner_hostname":"docker-host","owner_container_id":"c1","owner_container_name":"app","created":"2026-01-01T00:00:00Z","force":false}`
+	foreign := `{"host":"10.0.0.2","record_type":"A","owner_hostname":"old-host","owner_container_id":"c2","owner_container_name":"other","created":"2026-01-01T00:00:00Z","force":false}`
+	current, _ := marshalEtcdValue(makeIntent("new.example.com", "10.0.0.3", domain.RecordA))
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{
+			{Key: []byte("/skydns/com/example/app/x1"), Value: []byte(legacy), ModRevision: 10},
+			{Key: []byte("/skydns/com/example/other/x1"), Value: []byte(foreign), ModRevision: 11},
+			{Key: []byte("/skydns/com/example/new/x1"), Value: []byte(current), ModRevision: 12},
+		}}, nil
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	puts := mock.txnPuts()
+	if len(puts) != 1 {
+		t.Fatalf("expected only this host's legacy record to be rewritten, got %d writes", len(puts))
+	}
+	if key := string(puts[0].KeyBytes()); key != "/skydns/com/example/app/x1" {
+		t.Errorf("expected the legacy record to be rewritten, got %s", key)
+	}
+	if lease := opLease(puts[0]); lease != 0 {
+		t.Errorf("expected the record to stay unleased without lease_records, got lease %d", lease)
+	}
+	if value := string(puts[0].ValueBytes()); !contains(value, `"schema":1`) || !contains(value, `"host":"10.0.0.1"`) {
+		t.Errorf("expected the record rewritten in the current schema, got %s", value)
+	}
+	if n := len(mock.txns[0].ifCmps); n != 1 {
+		t.Errorf("expected the upgrade to be guarded by a mod-revision compare, got %d compares", n)
+	}
+}
+
+func TestEtcdRegistry_StopHeartbeat_LeaseRecordsKeepsLease(t *testing.T) {
+	mock := newMockEtcdClient()
+	// The heartbeat keys in etcd, shared by both hosts.
+	var mu sync.Mutex
+	heartbeats := map[string]bool{}
+	mock.putFunc = func(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+		mu.Lock()
+		heartbeats[key] = true
+		mu.Unlock()
+		return &clientv3.PutResponse{}, nil
+	}
+	mock.deleteFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+		mu.Lock()
+		delete(heartbeats, key)
+		mu.Unlock()
+		return &clientv3.DeleteResponse{}, nil
+	}
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var kvs []*mvccpb.KeyValue
+		for k := range heartbeats {
+			kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(k)})
+		}
+		return &clientv3.GetResponse{Kvs: kvs}, nil
+	}
+	stopping := NewEtcdRegistry(mock, leaseRecordsConfig(), "docker-host", 30, testLogger())
+	gc := NewEtcdRegistry(mock, leaseRecordsConfig(), "gc-host", 30, testLogger())
+	for _, reg := range []*EtcdRegistry{stopping, gc} {
+		if err := reg.StartHeartbeat(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	mock.reset()
+
+	stopping.StopHeartbeat()
+	if mock.revokeCalled {
+		t.Error("expected the lease carrying the records not to be revoked on shutdown")
+	}
+	// Until the lease expires, a GC pass must not treat the stopped host's
+	// records as orphaned.
+	live, err := gc.GetLiveHostnames(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := live["docker-host"]; !ok {
+		t.Errorf("expected the stopped host to stay live until its lease expires, got %v", live)
+	}
+}
+
+func TestEtcdRegistry_StartHeartbeat_PublishesHostStatus(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	reg.SetHostStatus(domain.HostStatus{Hostname: "ignored", Version: "v1.2.3", StartedAt: started, HostIPv4: "10.0.0.1"})
+	if err := reg.StartHeartbeat(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := decodeHeartbeat("docker-host", []byte(mock.putValues[0]))
+	want := domain.HostStatus{Schema: domain.HeartbeatSchema, Hostname: "docker-host", Version: "v1.2.3", StartedAt: started, HostIPv4: "10.0.0.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected heartbeat payload %+v, got %+v", want, got)
+	}
+}
+
+func TestEtcdRegistry_UpdateHeartbeat_RewritesOnlyOnChange(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := heartbeatingRegistry(t, mock)
+	mock.reset()
+	now := time.Now()
+
+	if err := reg.UpdateHeartbeat(context.Background(), 3, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.putKeys) != 1 || mock.putKeys[0] != "/docker-coredns-sync/heartbeat/docker-host" {
+		t.Fatalf("expected the heartbeat key to be rewritten, got %v", mock.putKeys)
+	}
+	got := decodeHeartbeat("docker-host", []byte(mock.putValues[0]))
+	if got.RecordsOwned != 3 || !got.LastReconcile.Equal(now) {
+		t.Errorf("expected 3 records reconciled at %v, got %+v", now, got)
+	}
+
+	// Same count, a pass later: nothing new worth a write.
+	if err := reg.UpdateHeartbeat(context.Background(), 3, now.Add(time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.putKeys) != 1 {
+		t.Errorf("expected an unchanged count not to be rewritten within a third of the TTL, got %d puts", len(mock.putKeys))
+	}
+	// The reconcile time goes stale after a third of the TTL.
+	if err := reg.UpdateHeartbeat(context.Background(), 3, now.Add(10*time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.putKeys) != 2 {
+		t.Errorf("expected the reconcile time to be refreshed, got %d puts", len(mock.putKeys))
+	}
+	if err := reg.UpdateHeartbeat(context.Background(), 4, now.Add(11*time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.putKeys) != 3 {
+		t.Errorf("expected a changed count to be rewritten at once, got %d puts", len(mock.putKeys))
+	}
+}
+
+func TestEtcdRegistry_UpdateHeartbeat_WaitsForHeartbeat(t *testing.T) {
+	mock := newMockEtcdClient()
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+
+	if err := reg.UpdateHeartbeat(context.Background(), 2, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mock.putCalled {
+		t.Fatal("expected no write without a heartbeat lease")
+	}
+	if err := reg.StartHeartbeat(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := decodeHeartbeat("docker-host", []byte(mock.putValues[0])); got.RecordsOwned != 2 {
+		t.Errorf("expected the recorded outcome to be published with the heartbeat, got %+v", got)
+	}
+}
+
+func TestEtcdRegistry_GetFleet(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		if key != "/docker-coredns-sync/heartbeat/" {
+			return &clientv3.GetResponse{}, nil
+		}
+		return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{
+			{Key: []byte("/docker-coredns-sync/heartbeat/peer"), Value: []byte(`{"hostname":"spoofed","version":"v1.0.0","records_owned":4}`)},
+			// An instance predating the JSON payload.
+			{Key: []byte("/docker-coredns-sync/heartbeat/old-host"), Value: []byte("old-host")},
+		}}, nil
+	}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+
+	hosts, err := reg.GetFleet(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []domain.HostStatus{{Hostname: "old-host"}, {Hostname: "peer", Version: "v1.0.0", RecordsOwned: 4}}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("expected %+v, got %+v", want, hosts)
+	}
+}
+
+func TestEtcdRegistry_GetFleet_Error(t *testing.T) {
+	mock := newMockEtcdClient()
+	mock.getFunc = func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+		return nil, errors.New("etcd unavailable")
+	}
+	m := &countingMetrics{}
+	reg := NewEtcdRegistry(mock, testConfig(), "docker-host", 30, testLogger())
+	reg.SetMetrics(m)
+
+	if _, err := reg.GetFleet(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if etcdErrors, _ := m.snapshot(); etcdErrors != 1 {
+		t.Errorf("expected 1 etcd error counted, got %d", etcdErrors)
+	}
+}
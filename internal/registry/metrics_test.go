@@ -65,7 +65,7 @@ func TestEtcdRegistry_Metrics_LockFailureOnTimeout(t *testing.T) {
 	m := &countingMetrics{}
 	reg.SetMetrics(m)
 
-	err := reg.LockTransaction(context.Background(), []string{"k"}, func() error { return nil })
+	err := reg.LockTransaction(context.Background(), []string{"k"}, func(context.Context) error { return nil })
 	if err == nil {
 		t.Fatal("expected lock acquisition to fail")
 	}
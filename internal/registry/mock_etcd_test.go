@@ -42,14 +42,16 @@ func (m *mockTxn) Commit() (*clientv3.TxnResponse, error) {
 type mockEtcdClient struct {
 	mu sync.Mutex
 
-	getFunc       func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
-	putFunc       func(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
-	deleteFunc    func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error)
-	grantFunc     func(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error)
-	txnFunc       func(ctx context.Context) clientv3.Txn
-	revokeFunc    func(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error)
-	keepAliveFunc func(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error)
-	closeFunc     func() error
+	getFunc        func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+	putFunc        func(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	deleteFunc     func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error)
+	grantFunc      func(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error)
+	txnFunc        func(ctx context.Context) clientv3.Txn
+	revokeFunc     func(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error)
+	keepAliveFunc  func(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error)
+	timeToLiveFunc func(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseTimeToLiveResponse, error)
+	watchFunc      func(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan
+	closeFunc      func() error
 
 	getCalled       bool
 	putCalled       bool
@@ -62,6 +64,9 @@ type mockEtcdClient struct {
 
 	putKeys   []string
 	putValues []string
+	// txns records every transaction built through the default Txn, so tests
+	// can inspect what was committed.
+	txns []*mockTxn
 }
 
 func newMockEtcdClient() *mockEtcdClient {
@@ -125,7 +130,43 @@ func (m *mockEtcdClient) Txn(ctx context.Context) clientv3.Txn {
 	if m.txnFunc != nil {
 		return m.txnFunc(ctx)
 	}
-	return &mockTxn{ctx: ctx}
+	txn := &mockTxn{ctx: ctx}
+	m.mu.Lock()
+	m.txns = append(m.txns, txn)
+	m.mu.Unlock()
+	return txn
+}
+
+// txnDeletes returns the Delete operations of every transaction built through
+// the default Txn, in order.
+func (m *mockEtcdClient) txnDeletes() []clientv3.Op {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dels []clientv3.Op
+	for _, txn := range m.txns {
+		for _, op := range txn.thenOps {
+			if op.IsDelete() {
+				dels = append(dels, op)
+			}
+		}
+	}
+	return dels
+}
+
+// txnPuts returns the Put operations of every transaction built through the
+// default Txn, in order.
+func (m *mockEtcdClient) txnPuts() []clientv3.Op {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var puts []clientv3.Op
+	for _, txn := range m.txns {
+		for _, op := range txn.thenOps {
+			if op.IsPut() {
+				puts = append(puts, op)
+			}
+		}
+	}
+	return puts
 }
 
 func (m *mockEtcdClient) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
@@ -155,6 +196,29 @@ func (m *mockEtcdClient) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-
 	return ch, nil
 }
 
+func (m *mockEtcdClient) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	if m.timeToLiveFunc != nil {
+		return m.timeToLiveFunc(ctx, id)
+	}
+	return &clientv3.LeaseTimeToLiveResponse{ID: id, TTL: -1}, nil
+}
+
+func (m *mockEtcdClient) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	if m.watchFunc != nil {
+		return m.watchFunc(ctx, key, opts...)
+	}
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch
+}
+
+func (m *mockEtcdClient) RequestProgress(ctx context.Context) error {
+	return nil
+}
+
 func (m *mockEtcdClient) Close() error {
 	m.mu.Lock()
 	m.closeCalled = true
@@ -179,4 +243,5 @@ func (m *mockEtcdClient) reset() {
 	m.closeCalled = false
 	m.putKeys = []string{}
 	m.putValues = []string{}
+	m.txns = nil
 }
@@ -0,0 +1,53 @@
+package registry
+
+import (
+	"strings"
+)
+
+// redisApex is the hash field the coredns-redis plugin reads for records at
+// the zone apex itself.
+const redisApex = "@"
+
+// normalizeZone returns zone in the fully qualified, trailing-dot form the
+// coredns-redis plugin uses in its hash keys.
+func normalizeZone(zone string) string {
+	return strings.TrimSuffix(strings.TrimSpace(zone), ".") + "."
+}
+
+// zoneKey is the hash key holding every record of zone.
+func zoneKey(prefix, suffix, zone string) string {
+	return prefix + normalizeZone(zone) + suffix
+}
+
+// zoneAndField finds the longest configured zone that fqdn falls under and
+// returns it (normalized) with the hash field for fqdn relative to it. ok is
+// false when fqdn is outside every zone.
+func zoneAndField(zones []string, fqdn string) (zone, field string, ok bool) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(fqdn), "."))
+	best := ""
+	for _, z := range zones {
+		bare := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(z), "."))
+		if bare == "" {
+			continue
+		}
+		if (name == bare || strings.HasSuffix(name, "."+bare)) && len(bare) > len(best) {
+			best = bare
+		}
+	}
+	if best == "" {
+		return "", "", false
+	}
+	if name == best {
+		return best + ".", redisApex, true
+	}
+	return best + ".", strings.TrimSuffix(name, "."+best), true
+}
+
+// fqdnFromField is the inverse of zoneAndField.
+func fqdnFromField(zone, field string) string {
+	bare := strings.TrimSuffix(zone, ".")
+	if field == redisApex || field == "" {
+		return bare
+	}
+	return field + "." + bare
+}
@@ -0,0 +1,52 @@
+package registry
+
+import "testing"
+
+func TestZoneAndField(t *testing.T) {
+	zones := []string{"example.com", "sub.example.com.", "other.org"}
+	tests := []struct {
+		fqdn      string
+		wantZone  string
+		wantField string
+		wantOK    bool
+	}{
+		{"app.example.com", "example.com.", "app", true},
+		{"example.com", "example.com.", "@", true},
+		{"a.b.example.com", "example.com.", "a.b", true},
+		{"web.sub.example.com", "sub.example.com.", "web", true},
+		{"sub.example.com.", "sub.example.com.", "@", true},
+		{"App.Example.com", "example.com.", "app", true},
+		{"notexample.com", "", "", false},
+		{"app.unknown.net", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fqdn, func(t *testing.T) {
+			zone, field, ok := zoneAndField(zones, tt.fqdn)
+			if ok != tt.wantOK || zone != tt.wantZone || field != tt.wantField {
+				t.Errorf("zoneAndField(%q) = (%q, %q, %t), want (%q, %q, %t)", tt.fqdn, zone, field, ok, tt.wantZone, tt.wantField, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFqdnFromField_Roundtrip(t *testing.T) {
+	zones := []string{"example.com"}
+	for _, fqdn := range []string{"example.com", "app.example.com", "a.b.example.com"} {
+		zone, field, ok := zoneAndField(zones, fqdn)
+		if !ok {
+			t.Fatalf("expected %q to be in zone", fqdn)
+		}
+		if got := fqdnFromField(zone, field); got != fqdn {
+			t.Errorf("roundtrip %q -> (%q, %q) -> %q", fqdn, zone, field, got)
+		}
+	}
+}
+
+func TestZoneKey(t *testing.T) {
+	if got := zoneKey("_dns:", "", "example.com"); got != "_dns:example.com." {
+		t.Errorf("zoneKey = %q, want %q", got, "_dns:example.com.")
+	}
+	if got := zoneKey("pre:", ":suf", "example.com."); got != "pre:example.com.:suf" {
+		t.Errorf("zoneKey = %q, want %q", got, "pre:example.com.:suf")
+	}
+}
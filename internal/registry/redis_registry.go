@@ -0,0 +1,665 @@
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/auto-dns/docker-coredns-sync/internal/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// redisMetrics is an optional sink for Redis operation metrics.
+// Implementations must be safe for concurrent use.
+type redisMetrics interface {
+	IncRedisError()
+	IncLockFailure()
+}
+
+const (
+	redisHeartbeatPrefix = config.RedisMetaKeyPrefix + "heartbeat:"
+	redisLockPrefix      = config.RedisMetaKeyPrefix + "lock:"
+
+	// redisMaxTxRetries bounds the optimistic WATCH/MULTI retries of a single
+	// hash-field update before giving up.
+	redisMaxTxRetries = 10
+)
+
+// errRedisLockNotHeld reports that a lock key no longer holds the token of the
+// call that acquired it.
+var errRedisLockNotHeld = errors.New("lock is no longer held")
+
+// RedisRegistry publishes records in the hash layout read by the external
+// coredns-redis plugin: one hash per zone, one field per name, the field value
+// a JSON object of record lists. Ownership metadata is stored in each record
+// entry alongside the fields the plugin reads.
+//
+// Locks are SET NX PX keys renewed while held, and host heartbeats are keys
+// with an expiry refreshed at a third of the heartbeat TTL.
+type RedisRegistry struct {
+	client       redisClient
+	cfg          *config.RedisConfig
+	hostname     string
+	heartbeatTTL int
+	logger       zerolog.Logger
+	metrics      redisMetrics
+
+	hbMu     sync.Mutex
+	hbCancel context.CancelFunc
+	// hbActive mirrors EtcdRegistry.hbActive: it is true only while this
+	// host's heartbeat key is known to be fresh, and gates cross-host GC.
+	hbActive bool
+	// status is published as the heartbeat value.
+	status *hostStatus
+}
+
+func NewRedisRegistry(client redisClient, cfg *config.RedisConfig, hostname string, heartbeatTTL int, logger zerolog.Logger) *RedisRegistry {
+	return &RedisRegistry{
+		client:       client,
+		cfg:          cfg,
+		hostname:     hostname,
+		heartbeatTTL: heartbeatTTL,
+		logger:       logger.With().Str("component", "redis_registry").Logger(),
+		status:       newHostStatus(hostname),
+	}
+}
+
+// log returns the logger for work done on behalf of ctx, tagged with the
+// reconcile pass id ctx carries, if any.
+func (rr *RedisRegistry) log(ctx context.Context) *zerolog.Logger {
+	l := logger.FromContext(ctx, rr.logger)
+	return &l
+}
+
+// SetMetrics registers an optional sink for Redis operation/lock metrics. Safe
+// to leave unset.
+func (rr *RedisRegistry) SetMetrics(m redisMetrics) {
+	rr.metrics = m
+}
+
+func (rr *RedisRegistry) incRedisError() {
+	if rr.metrics != nil {
+		rr.metrics.IncRedisError()
+	}
+}
+
+func (rr *RedisRegistry) incLockFailure() {
+	if rr.metrics != nil {
+		rr.metrics.IncLockFailure()
+	}
+}
+
+// SetHostStatus sets the static details this host publishes in its heartbeat
+// (see domain.HostStatus). Call it before StartHeartbeat; the hostname is
+// always the registry's own.
+func (rr *RedisRegistry) SetHostStatus(s domain.HostStatus) {
+	rr.status.setInfo(s)
+}
+
+func redisHeartbeatKey(hostname string) string {
+	return redisHeartbeatPrefix + hostname
+}
+
+// StartHeartbeat writes this host's expiring liveness key and refreshes it for
+// the lifetime of ctx. As with the etcd backend, a host only participates in
+// cross-host GC while its heartbeat is known to be fresh.
+func (rr *RedisRegistry) StartHeartbeat(ctx context.Context) error {
+	key := redisHeartbeatKey(rr.hostname)
+	ttl := time.Duration(rr.heartbeatTTL) * time.Second
+	if err := rr.setHeartbeat(ctx, key, ttl); err != nil {
+		rr.incRedisError()
+		return fmt.Errorf("set heartbeat key %q: %w", key, err)
+	}
+
+	hbCtx, cancel := context.WithCancel(ctx)
+	rr.hbMu.Lock()
+	rr.hbCancel = cancel
+	rr.hbActive = true
+	rr.hbMu.Unlock()
+
+	go rr.maintainHeartbeat(hbCtx, key, ttl)
+	rr.upgradeOwnRecords(ctx)
+
+	rr.logger.Info().Str("key", key).Int("ttl", rr.heartbeatTTL).Msg("heartbeat started")
+	return nil
+}
+
+// upgradeOwnRecords stamps the entries this host owns that are in another
+// wire format with this release's (see domain.RecordSchema), so that peers
+// only find unversioned entries under owners that have not been upgraded,
+// which they never garbage-collect. Failures are only logged: the entries are
+// upgraded on the next start.
+func (rr *RedisRegistry) upgradeOwnRecords(ctx context.Context) {
+	var upgraded int
+	for _, z := range rr.cfg.Zones {
+		key := zoneKey(rr.cfg.KeyPrefix, rr.cfg.KeySuffix, normalizeZone(z))
+		fields, err := rr.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			rr.incRedisError()
+			rr.logger.Warn().Err(err).Str("key", key).Msg("upgrade own records: list failed")
+			continue
+		}
+		for field, raw := range fields {
+			if f, err := decodeRedisField(raw); err != nil || f.upgradeOwned(rr.hostname) == 0 {
+				continue
+			}
+			var n int
+			err := rr.updateField(ctx, key, field, func(f *redisField) bool {
+				n = f.upgradeOwned(rr.hostname)
+				return n > 0
+			})
+			if err != nil {
+				rr.incRedisError()
+				rr.logger.Warn().Err(err).Str("key", key).Str("field", field).Msg("upgrade own records: update failed")
+				continue
+			}
+			upgraded += n
+		}
+	}
+	if upgraded > 0 {
+		rr.logger.Info().Int("records", upgraded).Int("schema", domain.RecordSchema).Msg("upgraded records to the current wire schema")
+	}
+}
+
+// maintainHeartbeat refreshes the liveness key every third of its TTL. A
+// failed refresh marks the host inactive (disabling cross-host GC) until a
+// later refresh succeeds.
+func (rr *RedisRegistry) maintainHeartbeat(ctx context.Context, key string, ttl time.Duration) {
+	interval := ttl / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		err := rr.setHeartbeat(ctx, key, ttl)
+		if ctx.Err() != nil {
+			return
+		}
+		rr.hbMu.Lock()
+		wasActive := rr.hbActive
+		rr.hbActive = err == nil
+		rr.hbMu.Unlock()
+		switch {
+		case err != nil && wasActive:
+			rr.incRedisError()
+			rr.logger.Warn().Err(err).Str("key", key).Msg("heartbeat refresh failed; cross-host GC disabled until re-established")
+		case err != nil:
+			rr.incRedisError()
+		case !wasActive:
+			rr.logger.Info().Str("key", key).Msg("heartbeat re-established")
+		}
+	}
+}
+
+// setHeartbeat writes this host's current status to its liveness key.
+func (rr *RedisRegistry) setHeartbeat(ctx context.Context, key string, ttl time.Duration) error {
+	value, published := rr.status.value()
+	if err := rr.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return err
+	}
+	rr.status.markPublished(published)
+	return nil
+}
+
+// UpdateHeartbeat records a successful reconciliation in this host's
+// heartbeat. The periodic refresh publishes it; the key is only rewritten at
+// once when the number of records owned changed. Without a fresh heartbeat it
+// only records the outcome, which the next successful refresh publishes.
+func (rr *RedisRegistry) UpdateHeartbeat(ctx context.Context, recordsOwned int, reconciledAt time.Time) error {
+	ttl := time.Duration(rr.heartbeatTTL) * time.Second
+	if !rr.status.update(recordsOwned, reconciledAt, ttl/3) {
+		return nil
+	}
+	rr.hbMu.Lock()
+	active := rr.hbActive
+	rr.hbMu.Unlock()
+	if !active {
+		return nil
+	}
+	key := redisHeartbeatKey(rr.hostname)
+	if err := rr.setHeartbeat(ctx, key, ttl); err != nil {
+		rr.incRedisError()
+		return fmt.Errorf("update heartbeat key %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetFleet returns the status every heartbeating host publishes, sorted by
+// hostname. A host whose key expires while the fleet is read is left out.
+func (rr *RedisRegistry) GetFleet(ctx context.Context) ([]domain.HostStatus, error) {
+	hosts := []domain.HostStatus{}
+	var cursor uint64
+	for {
+		keys, next, err := rr.client.Scan(ctx, cursor, redisHeartbeatPrefix+"*", 100).Result()
+		if err != nil {
+			rr.incRedisError()
+			return nil, fmt.Errorf("scan heartbeat keys: %w", err)
+		}
+		for _, k := range keys {
+			hostname := strings.TrimPrefix(k, redisHeartbeatPrefix)
+			if hostname == "" {
+				continue
+			}
+			value, err := rr.client.Get(ctx, k).Bytes()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				rr.incRedisError()
+				return nil, fmt.Errorf("get heartbeat key %q: %w", k, err)
+			}
+			hosts = append(hosts, decodeHeartbeat(hostname, value))
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	sortFleet(hosts)
+	return hosts, nil
+}
+
+// StopHeartbeat stops refreshing the liveness key and best-effort deletes it so
+// peers notice the host is gone promptly. Safe to call when no heartbeat was
+// started.
+func (rr *RedisRegistry) StopHeartbeat() {
+	rr.hbMu.Lock()
+	cancel := rr.hbCancel
+	rr.hbCancel = nil
+	rr.hbActive = false
+	rr.hbMu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelTimeout()
+	if err := rr.client.Del(ctx, redisHeartbeatKey(rr.hostname)).Err(); err != nil {
+		rr.logger.Warn().Err(err).Msg("delete heartbeat key on shutdown")
+	}
+}
+
+// GetLiveHostnames returns the set of hostnames with an unexpired heartbeat
+// key. Like the etcd backend it returns (nil, nil) unless this host is itself
+// heartbeating, which callers treat as "cross-host GC disabled".
+func (rr *RedisRegistry) GetLiveHostnames(ctx context.Context) (map[string]struct{}, error) {
+	rr.hbMu.Lock()
+	active := rr.hbActive
+	rr.hbMu.Unlock()
+	if !active {
+		return nil, nil
+	}
+
+	live := map[string]struct{}{}
+	var cursor uint64
+	for {
+		keys, next, err := rr.client.Scan(ctx, cursor, redisHeartbeatPrefix+"*", 100).Result()
+		if err != nil {
+			rr.incRedisError()
+			return nil, fmt.Errorf("scan heartbeat keys: %w", err)
+		}
+		for _, k := range keys {
+			if hostname := strings.TrimPrefix(k, redisHeartbeatPrefix); hostname != "" {
+				live[hostname] = struct{}{}
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	live[rr.hostname] = struct{}{}
+	return live, nil
+}
+
+// updateField applies mutate to the decoded value of a zone hash field inside
+// an optimistic WATCH/MULTI transaction, retrying when another writer changes
+// the hash concurrently. An emptied field is deleted. Inside a LockTransaction
+// the lock keys are watched too, and the update is refused once any of them
+// no longer holds this call's token.
+func (rr *RedisRegistry) updateField(ctx context.Context, key, field string, mutate func(f *redisField) bool) error {
+	fence := redisFenceFrom(ctx)
+	txf := func(tx *redis.Tx) error {
+		if err := fence.check(ctx, tx); err != nil {
+			return err
+		}
+		raw, err := tx.HGet(ctx, key, field).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		f, err := decodeRedisField(raw)
+		if err != nil {
+			return err
+		}
+		if !mutate(f) {
+			return nil
+		}
+		val, keep, err := f.encode()
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			if keep {
+				p.HSet(ctx, key, field, val)
+			} else {
+				p.HDel(ctx, key, field)
+			}
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < redisMaxTxRetries; i++ {
+		err := rr.client.Watch(ctx, txf, append([]string{key}, fence.keys()...)...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("update %s[%s]: too many concurrent modifications", key, field)
+}
+
+// Serves reports whether fqdn is under one of the configured zones, which are
+// the only names the registry can hold.
+func (rr *RedisRegistry) Serves(fqdn string) bool {
+	_, _, ok := zoneAndField(rr.cfg.Zones, fqdn)
+	return ok
+}
+
+// Register adds the record to its zone's hash field.
+func (rr *RedisRegistry) Register(ctx context.Context, ri *domain.RecordIntent) error {
+	zone, field, ok := zoneAndField(rr.cfg.Zones, ri.Record.Name)
+	if !ok {
+		return fmt.Errorf("%q is not under any configured redis.zones", ri.Record.Name)
+	}
+	key := zoneKey(rr.cfg.KeyPrefix, rr.cfg.KeySuffix, zone)
+	if err := rr.updateField(ctx, key, field, func(f *redisField) bool {
+		f.add(ri)
+		return true
+	}); err != nil {
+		rr.incRedisError()
+		return fmt.Errorf("register %s in %s[%s]: %w", ri.Record.Render(), key, field, err)
+	}
+	rr.log(ctx).Info().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Str("key", key).Str("field", field).Msg("registered record")
+	return nil
+}
+
+// Remove deletes every entry matching the record and its owner from its zone's
+// hash field.
+func (rr *RedisRegistry) Remove(ctx context.Context, ri *domain.RecordIntent) error {
+	zone, field, ok := zoneAndField(rr.cfg.Zones, ri.Record.Name)
+	if !ok {
+		rr.log(ctx).Debug().Str("fqdn", ri.Record.Name).Msg("remove: name is not under any configured zone")
+		return nil
+	}
+	key := zoneKey(rr.cfg.KeyPrefix, rr.cfg.KeySuffix, zone)
+	removed := 0
+	if err := rr.updateField(ctx, key, field, func(f *redisField) bool {
+		removed = f.remove(ri)
+		return removed > 0
+	}); err != nil {
+		rr.incRedisError()
+		return fmt.Errorf("remove %s from %s[%s]: %w", ri.Record.Render(), key, field, err)
+	}
+	if removed == 0 {
+		rr.log(ctx).Debug().Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Msg("remove: no matching entries")
+		return nil
+	}
+	rr.log(ctx).Info().Str("key", key).Str("field", field).Str("record", ri.Record.Render()).Str("owner_hostname", ri.Hostname).Str("container_id", ri.ContainerId).Msg("remove: deleted record")
+	return nil
+}
+
+// List retrieves all owned record intents stored in the configured zones.
+func (rr *RedisRegistry) List(ctx context.Context) ([]*domain.RecordIntent, error) {
+	var intents []*domain.RecordIntent
+	for _, z := range rr.cfg.Zones {
+		zone := normalizeZone(z)
+		key := zoneKey(rr.cfg.KeyPrefix, rr.cfg.KeySuffix, zone)
+		fields, err := rr.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			rr.incRedisError()
+			return nil, fmt.Errorf("list zone %q: %w", key, err)
+		}
+		for field, raw := range fields {
+			f, err := decodeRedisField(raw)
+			if err != nil {
+				rr.log(ctx).Warn().Err(err).Str("key", key).Str("field", field).Msg("Failed to parse zone field")
+				continue
+			}
+			ris, errs := f.intents(fqdnFromField(zone, field))
+			for _, err := range errs {
+				rr.log(ctx).Warn().Err(err).Str("key", key).Str("field", field).Msg("Failed to parse record entry")
+			}
+			intents = append(intents, ris...)
+		}
+	}
+	return intents, nil
+}
+
+// redisHeldLock is a lock key held by this process together with the random
+// token that proves ownership, and the cancel for its renewal goroutine.
+type redisHeldLock struct {
+	name   string
+	key    string
+	token  string
+	cancel context.CancelFunc
+}
+
+// redisFence is the set of locks a LockTransaction holds, which the
+// registry's writes inside it are conditioned on.
+type redisFence struct {
+	locks []redisHeldLock
+	// cancel ends the critical section's context once a lock is known to be
+	// lost, so the section's remaining writes are abandoned.
+	cancel context.CancelCauseFunc
+}
+
+type redisFenceKey struct{}
+
+// redisFenceFrom returns the fence carried by ctx, or nil outside a
+// LockTransaction.
+func redisFenceFrom(ctx context.Context) *redisFence {
+	f, _ := ctx.Value(redisFenceKey{}).(*redisFence)
+	return f
+}
+
+// keys returns the lock keys a fenced transaction must watch. Nil-safe.
+func (f *redisFence) keys() []string {
+	if f == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(f.locks))
+	for _, l := range f.locks {
+		keys = append(keys, l.key)
+	}
+	return keys
+}
+
+// check verifies, inside a transaction watching keys, that every lock still
+// holds its token, ending the critical section if one does not. Nil-safe.
+func (f *redisFence) check(ctx context.Context, tx *redis.Tx) error {
+	if f == nil {
+		return nil
+	}
+	for _, l := range f.locks {
+		cur, err := tx.Get(ctx, l.key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if cur != l.token {
+			lost := &domain.LockLostError{Lock: l.name}
+			f.cancel(lost)
+			return lost
+		}
+	}
+	return nil
+}
+
+func newLockToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// compareAndDo runs op on key only while it still holds token.
+func (rr *RedisRegistry) compareAndDo(ctx context.Context, key, token string, op func(p redis.Pipeliner)) error {
+	return rr.client.Watch(ctx, func(tx *redis.Tx) error {
+		cur, err := tx.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if cur != token {
+			return fmt.Errorf("%q: %w", key, errRedisLockNotHeld)
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			op(p)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// LockTransaction acquires a SET NX PX lock on each key (deduplicated and
+// sorted so concurrent callers cannot deadlock), renews them while fn runs,
+// and releases them afterwards. Release only deletes a key that still holds
+// this call's token, so an expired lock re-acquired by a peer is left alone.
+//
+// The registry's writes under the context given to fn are fenced on the locks
+// (see redisFence). If a lock is found to be lost, the context is cancelled
+// and LockTransaction returns a *domain.LockLostError.
+func (rr *RedisRegistry) LockTransaction(ctx context.Context, keys []string, fn func(ctx context.Context) error) error {
+	uniq := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		uniq[k] = struct{}{}
+	}
+	uniqueKeys := make([]string, 0, len(uniq))
+	for k := range uniq {
+		uniqueKeys = append(uniqueKeys, k)
+	}
+	sort.Strings(uniqueKeys)
+
+	lockCtx, cancelLock := context.WithCancelCause(ctx)
+	defer cancelLock(nil)
+
+	ttl := time.Duration(rr.cfg.LockTTL * float64(time.Second))
+	held := make([]redisHeldLock, 0, len(uniqueKeys))
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			l := held[i]
+			l.cancel()
+			relCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if err := rr.compareAndDo(relCtx, l.key, l.token, func(p redis.Pipeliner) { p.Del(relCtx, l.key) }); err != nil {
+				rr.log(ctx).Warn().Err(err).Msgf("failed to release lock %s", l.key)
+			}
+			cancel()
+		}
+	}
+
+	for _, key := range uniqueKeys {
+		l, err := rr.acquireLock(ctx, key, ttl, func() {
+			cancelLock(&domain.LockLostError{Lock: key})
+		})
+		if err != nil {
+			release()
+			return err
+		}
+		held = append(held, l)
+	}
+
+	err := fn(context.WithValue(lockCtx, redisFenceKey{}, &redisFence{locks: held, cancel: cancelLock}))
+	release()
+	var lost *domain.LockLostError
+	if errors.As(context.Cause(lockCtx), &lost) {
+		rr.incLockFailure()
+		rr.log(ctx).Error().Str("lock", lost.Lock).Msg("lock was lost before the transaction finished; its remaining writes were refused")
+		if !errors.As(err, new(*domain.LockLostError)) {
+			err = errors.Join(lost, err)
+		}
+	}
+	return err
+}
+
+// acquireLock takes the lock on key, retrying until redis.lock_timeout, and
+// renews it until the returned lock's cancel is called. onLost is called if
+// the lock is found to be lost before then. The wait between attempts ends as
+// soon as ctx is done.
+func (rr *RedisRegistry) acquireLock(ctx context.Context, key string, ttl time.Duration, onLost func()) (redisHeldLock, error) {
+	lockKey := redisLockPrefix + key
+	token := newLockToken()
+	deadline := time.NewTimer(time.Duration(rr.cfg.LockTimeout * float64(time.Second)))
+	defer deadline.Stop()
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return redisHeldLock{}, ctx.Err()
+		case <-deadline.C:
+			rr.incLockFailure()
+			return redisHeldLock{}, fmt.Errorf("failed to acquire lock on %s", key)
+		case <-retry.C:
+		}
+		// select picks at random among ready cases; never try once ctx is done.
+		if err := ctx.Err(); err != nil {
+			return redisHeldLock{}, err
+		}
+		ok, err := rr.client.SetNX(ctx, lockKey, token, ttl).Result()
+		if err != nil {
+			rr.incRedisError()
+			return redisHeldLock{}, fmt.Errorf("acquire lock %q: %w", lockKey, err)
+		}
+		if !ok {
+			retry.Reset(time.Duration(rr.cfg.LockRetryInterval * float64(time.Second)))
+			continue
+		}
+		kaCtx, cancel := context.WithCancel(ctx)
+		go rr.renewLock(kaCtx, lockKey, token, ttl, onLost)
+		return redisHeldLock{name: key, key: lockKey, token: token, cancel: cancel}, nil
+	}
+}
+
+// renewLock extends the lock's expiry every third of its TTL while it is held,
+// calling onLost and stopping if the key no longer holds token.
+func (rr *RedisRegistry) renewLock(ctx context.Context, key, token string, ttl time.Duration, onLost func()) {
+	interval := ttl / 3
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			err := rr.compareAndDo(ctx, key, token, func(p redis.Pipeliner) { p.PExpire(ctx, key, ttl) })
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			if errors.Is(err, errRedisLockNotHeld) {
+				rr.log(ctx).Warn().Str("lock", key).Msg("lock expired or was taken over before it could be renewed")
+				onLost()
+				return
+			}
+			rr.incRedisError()
+			rr.log(ctx).Warn().Err(err).Str("lock", key).Msg("failed to renew lock")
+		}
+	}
+}
+
+func (rr *RedisRegistry) Close() error {
+	rr.StopHeartbeat()
+	return rr.client.Close()
+}
@@ -0,0 +1,500 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+func testRedisConfig() *config.RedisConfig {
+	return &config.RedisConfig{
+		KeyPrefix:         "_dns:",
+		Zones:             []string{"example.com"},
+		LockTTL:           5.0,
+		LockTimeout:       0.5,
+		LockRetryInterval: 0.01,
+	}
+}
+
+func newTestRedisRegistry(t *testing.T, hostname string, heartbeatTTL int) (*RedisRegistry, *fakeRedis) {
+	t.Helper()
+	srv := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisRegistry(client, testRedisConfig(), hostname, heartbeatTTL, testLogger()), srv
+}
+
+func TestRedisRegistry_Register_WritesZoneHashField(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx := context.Background()
+
+	if err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.2", domain.RecordA)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, ok := srv.hget("_dns:example.com.", "app")
+	if !ok {
+		t.Fatal("expected field 'app' in hash '_dns:example.com.'")
+	}
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(f.a) != 2 {
+		t.Errorf("expected 2 A entries in one field, got %d", len(f.a))
+	}
+}
+
+func TestRedisRegistry_Serves(t *testing.T) {
+	reg, _ := newTestRedisRegistry(t, "docker-host", 30)
+	for fqdn, want := range map[string]bool{
+		"app.example.com":    true,
+		"example.com":        true,
+		"app.example.org":    false,
+		"app.notexample.com": false,
+	} {
+		if got := reg.Serves(fqdn); got != want {
+			t.Errorf("Serves(%q): expected %v, got %v", fqdn, want, got)
+		}
+	}
+}
+
+func TestRedisRegistry_Register_OutsideZonesErrors(t *testing.T) {
+	reg, _ := newTestRedisRegistry(t, "docker-host", 30)
+
+	err := reg.Register(context.Background(), makeIntent("app.other.org", "10.0.0.1", domain.RecordA))
+	if err == nil {
+		t.Fatal("expected error for a name outside every configured zone")
+	}
+}
+
+func TestRedisRegistry_List_RoundTripsRecords(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx := context.Background()
+	srv.hset("_dns:example.com.", "static", `{"a":[{"ip":"10.9.9.9","ttl":300}]}`)
+	srv.hset("_dns:example.com.", "broken", `not json`)
+
+	want := []*domain.RecordIntent{
+		makeIntent("example.com", "10.0.0.1", domain.RecordA),
+		makeIntent("app.example.com", "fd00::1", domain.RecordAAAA),
+		makeIntent("alias.example.com", "app.example.com", domain.RecordCNAME),
+	}
+	for _, ri := range want {
+		ri.Created = ri.Created.Truncate(time.Second).UTC()
+		if err := reg.Register(ctx, ri); err != nil {
+			t.Fatalf("register %s: %v", ri.Render(), err)
+		}
+	}
+
+	got, err := reg.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The static entry is listed without an owner; the broken field is
+	// skipped.
+	if len(got) != len(want)+1 {
+		t.Fatalf("expected %d records, got %d", len(want)+1, len(got))
+	}
+	byKey := map[string]*domain.RecordIntent{}
+	var unowned []*domain.RecordIntent
+	for _, ri := range got {
+		byKey[ri.Key()] = ri
+		if ri.Hostname == "" {
+			unowned = append(unowned, ri)
+		}
+	}
+	if len(unowned) != 1 || unowned[0].Record.Render() != "[A] static.example.com -> 10.9.9.9" || unowned[0].Wire.Recognized() {
+		t.Errorf("expected the static entry listed without an owner, got %v", unowned)
+	}
+	for _, ri := range want {
+		g, ok := byKey[ri.Key()]
+		if !ok {
+			t.Errorf("missing %s", ri.Render())
+			continue
+		}
+		if !g.Created.Equal(ri.Created) {
+			t.Errorf("created for %s = %v, want %v", ri.Record.Render(), g.Created, ri.Created)
+		}
+	}
+}
+
+func TestRedisRegistry_Remove_KeepsOtherEntries(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx := context.Background()
+	srv.hset("_dns:example.com.", "app", `{"txt":[{"text":"keep"}],"a":[{"ip":"10.9.9.9"}]}`)
+
+	ri := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	if err := reg.Register(ctx, ri); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := reg.Remove(ctx, ri); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	raw, ok := srv.hget("_dns:example.com.", "app")
+	if !ok {
+		t.Fatal("expected field to survive while foreign entries remain")
+	}
+	f, _ := decodeRedisField(raw)
+	if len(f.a) != 1 || f.a[0].IP != "10.9.9.9" {
+		t.Errorf("expected only the foreign A entry to remain, got %+v", f.a)
+	}
+	if _, ok := f.other["txt"]; !ok {
+		t.Error("expected txt entries to be preserved")
+	}
+}
+
+func TestRedisRegistry_Remove_DeletesEmptiedField(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx := context.Background()
+	ri := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	if err := reg.Register(ctx, ri); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := reg.Remove(ctx, ri); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, ok := srv.hget("_dns:example.com.", "app"); ok {
+		t.Error("expected the emptied field to be deleted")
+	}
+	// Removing again is a no-op, not an error.
+	if err := reg.Remove(ctx, ri); err != nil {
+		t.Errorf("expected no error removing a missing record, got %v", err)
+	}
+}
+
+func TestRedisRegistry_ConcurrentRegisterNoLostUpdates(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ri := makeIntent("app.example.com", "10.0.0."+string(rune('0'+i)), domain.RecordA)
+			if err := reg.Register(ctx, ri); err != nil {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if failed.Load() != 0 {
+		t.Fatalf("%d concurrent registrations failed", failed.Load())
+	}
+	raw, _ := srv.hget("_dns:example.com.", "app")
+	f, _ := decodeRedisField(raw)
+	if len(f.a) != 8 {
+		t.Errorf("expected 8 A entries after concurrent registration, got %d", len(f.a))
+	}
+}
+
+func TestRedisRegistry_Register_CountsRedisError(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	m := &countingRedisMetrics{}
+	reg.SetMetrics(m)
+	srv.failCommand("HGET", 1)
+
+	if err := reg.Register(context.Background(), makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err == nil {
+		t.Fatal("expected error when HGET fails")
+	}
+	if m.redisErrors.Load() != 1 {
+		t.Errorf("redis errors = %d, want 1", m.redisErrors.Load())
+	}
+}
+
+func TestRedisRegistry_Heartbeat_WritesExpiringKey(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	reg.SetHostStatus(domain.HostStatus{Version: "v1.0.0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if live, err := reg.GetLiveHostnames(ctx); err != nil || live != nil {
+		t.Fatalf("expected (nil, nil) before heartbeat starts, got (%v, %v)", live, err)
+	}
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key := "docker-coredns-sync:heartbeat:docker-host"
+	v, ok := srv.get(key)
+	if !ok {
+		t.Fatalf("expected heartbeat key %q to be set", key)
+	}
+	if decodeHeartbeat("docker-host", []byte(v)).Version != "v1.0.0" {
+		t.Errorf("expected the host status as the heartbeat value, got %q", v)
+	}
+	if ttl := srv.ttl(key); ttl <= 0 || ttl > 30*time.Second {
+		t.Errorf("expected heartbeat key to expire within 30s, ttl=%v", ttl)
+	}
+
+	srv.set("docker-coredns-sync:heartbeat:peer", "peer", time.Minute)
+	live, err := reg.GetLiveHostnames(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, h := range []string{"docker-host", "peer"} {
+		if _, ok := live[h]; !ok {
+			t.Errorf("expected %q in live set %v", h, live)
+		}
+	}
+
+	reg.StopHeartbeat()
+	if _, ok := srv.get(key); ok {
+		t.Error("expected heartbeat key to be deleted on StopHeartbeat")
+	}
+	if live, _ := reg.GetLiveHostnames(ctx); live != nil {
+		t.Errorf("expected GC disabled after StopHeartbeat, got %v", live)
+	}
+}
+
+func TestRedisRegistry_StartHeartbeat_UpgradesOwnLegacyEntries(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	srv.hset("_dns:example.com.", "app", `{"a":[{"ip":"10.0.0.1","owner_hostname":"docker-host","created":"2026-01-01T00:00:00Z"},{"ip":"10.0.0.2","owner_hostname":"old-host","created":"2026-01-01T00:00:00Z"}]}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	raw, _ := srv.hget("_dns:example.com.", "app")
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(f.a) != 2 || f.a[0].Schema != domain.RecordSchema || f.a[1].Schema != 0 {
+		t.Errorf("expected only this host's entry upgraded, got %s", raw)
+	}
+}
+
+func TestRedisRegistry_Heartbeat_ExpiredPeerIsNotLive(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv.set("docker-coredns-sync:heartbeat:dead", "dead", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	live, err := reg.GetLiveHostnames(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := live["dead"]; ok {
+		t.Error("expected expired heartbeat not to count as live")
+	}
+}
+
+func TestRedisRegistry_StartHeartbeat_ErrorLeavesGCDisabled(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	srv.failCommand("SET", 1)
+
+	if err := reg.StartHeartbeat(context.Background()); err == nil {
+		t.Fatal("expected error when the heartbeat SET fails")
+	}
+	if live, _ := reg.GetLiveHostnames(context.Background()); live != nil {
+		t.Errorf("expected GC disabled after a failed heartbeat, got %v", live)
+	}
+}
+
+func TestRedisRegistry_LockTransaction_AcquiresAndReleases(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	lockKey := "docker-coredns-sync:lock:__global__"
+
+	ran := false
+	err := reg.LockTransaction(context.Background(), []string{"__global__", "__global__"}, func(context.Context) error {
+		ran = true
+		if _, ok := srv.get(lockKey); !ok {
+			t.Error("expected lock key to be held while fn runs")
+		}
+		if ttl := srv.ttl(lockKey); ttl <= 0 {
+			t.Error("expected lock key to carry an expiry")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ran {
+		t.Fatal("expected fn to run")
+	}
+	if _, ok := srv.get(lockKey); ok {
+		t.Error("expected lock key to be released")
+	}
+}
+
+func TestRedisRegistry_LockTransaction_CancelEndsWait(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	reg.cfg.LockTimeout = 30
+	reg.cfg.LockRetryInterval = 30 // Only a ctx-aware wait returns before the test times out.
+	srv.set("docker-coredns-sync:lock:k", "peer", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := reg.LockTransaction(ctx, []string{"k"}, func(context.Context) error { return nil })
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the ctx error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the wait to end with ctx, took %v", elapsed)
+	}
+}
+
+func TestRedisRegistry_LockTransaction_PropagatesFnError(t *testing.T) {
+	reg, _ := newTestRedisRegistry(t, "docker-host", 30)
+	want := errors.New("boom")
+	if err := reg.LockTransaction(context.Background(), []string{"k"}, func(context.Context) error { return want }); !errors.Is(err, want) {
+		t.Errorf("expected fn error, got %v", err)
+	}
+}
+
+func TestRedisRegistry_LockTransaction_TimeoutWhenHeld(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	m := &countingRedisMetrics{}
+	reg.SetMetrics(m)
+	srv.set("docker-coredns-sync:lock:k", "someone-else", time.Minute)
+
+	ran := false
+	err := reg.LockTransaction(context.Background(), []string{"k"}, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected lock acquisition to time out")
+	}
+	if ran {
+		t.Error("fn must not run without the lock")
+	}
+	if m.lockFailures.Load() != 1 {
+		t.Errorf("lock failures = %d, want 1", m.lockFailures.Load())
+	}
+	if v, _ := srv.get("docker-coredns-sync:lock:k"); v != "someone-else" {
+		t.Error("a lock held by someone else must not be released")
+	}
+}
+
+func TestRedisRegistry_LockTransaction_DoesNotReleaseForeignToken(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	lockKey := "docker-coredns-sync:lock:k"
+
+	err := reg.LockTransaction(context.Background(), []string{"k"}, func(context.Context) error {
+		// Simulate our lock expiring and a peer acquiring it mid-transaction.
+		srv.set(lockKey, "peer-token", time.Minute)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, ok := srv.get(lockKey); !ok || v != "peer-token" {
+		t.Errorf("expected peer's lock to survive our release, got %q (present=%t)", v, ok)
+	}
+}
+
+func TestRedisRegistry_LockTransaction_FencesWrites(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	m := &countingRedisMetrics{}
+	reg.SetMetrics(m)
+
+	err := reg.LockTransaction(context.Background(), []string{"app.example.com"}, func(ctx context.Context) error {
+		if err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.1", domain.RecordA)); err != nil {
+			t.Fatalf("unexpected error while the lock is held: %v", err)
+		}
+		// Our lock expires and a peer acquires it.
+		srv.set("docker-coredns-sync:lock:app.example.com", "peer-token", time.Minute)
+		err := reg.Register(ctx, makeIntent("app.example.com", "10.0.0.2", domain.RecordA))
+		var lost *domain.LockLostError
+		if !errors.As(err, &lost) || lost.Lock != "app.example.com" {
+			t.Errorf("expected a lost lock on app.example.com, got %v", err)
+		}
+		if ctx.Err() == nil {
+			t.Error("expected the critical section's context to be cancelled")
+		}
+		return err
+	})
+	var lost *domain.LockLostError
+	if !errors.As(err, &lost) {
+		t.Fatalf("expected LockTransaction to report the lost lock, got %v", err)
+	}
+	raw, _ := srv.hget("_dns:example.com.", "app")
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(f.a) != 1 {
+		t.Errorf("expected only the write made under the lock, got %d A entries", len(f.a))
+	}
+	if m.lockFailures.Load() != 1 {
+		t.Errorf("lock failures = %d, want 1", m.lockFailures.Load())
+	}
+}
+
+func TestRedisRegistry_LockTransaction_RenewalNoticesLostLock(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	reg.cfg.LockTTL = 0.15
+
+	err := reg.LockTransaction(context.Background(), []string{"k"}, func(ctx context.Context) error {
+		srv.set("docker-coredns-sync:lock:k", "peer-token", time.Minute)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			t.Error("expected the context to be cancelled once renewal found the lock gone")
+			return nil
+		}
+	})
+	var lost *domain.LockLostError
+	if !errors.As(err, &lost) || lost.Lock != "k" {
+		t.Errorf("expected a lost lock on k, got %v", err)
+	}
+}
+
+func TestRedisRegistry_Close(t *testing.T) {
+	reg, _ := newTestRedisRegistry(t, "docker-host", 30)
+	if err := reg.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type countingRedisMetrics struct {
+	redisErrors  atomic.Int32
+	lockFailures atomic.Int32
+}
+
+func (c *countingRedisMetrics) IncRedisError()  { c.redisErrors.Add(1) }
+func (c *countingRedisMetrics) IncLockFailure() { c.lockFailures.Add(1) }
+
+func TestRedisRegistry_GetFleet(t *testing.T) {
+	reg, srv := newTestRedisRegistry(t, "docker-host", 30)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.StartHeartbeat(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reg.UpdateHeartbeat(ctx, 2, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv.set("docker-coredns-sync:heartbeat:old-host", "old-host", time.Minute)
+
+	hosts, err := reg.GetFleet(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Hostname != "docker-host" || hosts[1] != (domain.HostStatus{Hostname: "old-host"}) {
+		t.Fatalf("expected this host and the legacy one, sorted, got %+v", hosts)
+	}
+	if hosts[0].RecordsOwned != 2 || hosts[0].LastReconcile.IsZero() {
+		t.Errorf("expected the reconciliation outcome to be published at once, got %+v", hosts[0])
+	}
+}
@@ -0,0 +1,245 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+// redisOwner is the ownership metadata stored alongside each record entry.
+// The coredns-redis plugin ignores these fields when decoding. Schema is the
+// wire format version (domain.RecordSchema when written by this release).
+type redisOwner struct {
+	Schema             int       `json:"schema,omitempty"`
+	OwnerHostname      string    `json:"owner_hostname,omitempty"`
+	OwnerContainerId   string    `json:"owner_container_id,omitempty"`
+	OwnerContainerName string    `json:"owner_container_name,omitempty"`
+	Created            time.Time `json:"created"`
+	Force              bool      `json:"force,omitempty"`
+}
+
+type redisAddrEntry struct {
+	IP  string `json:"ip"`
+	TTL uint32 `json:"ttl,omitempty"`
+	redisOwner
+	// unknown holds the fields a newer release wrote, kept on every rewrite.
+	unknown map[string]json.RawMessage
+}
+
+func (e redisAddrEntry) MarshalJSON() ([]byte, error) {
+	type plain redisAddrEntry
+	return marshalWithUnknown(plain(e), e.unknown)
+}
+
+func (e *redisAddrEntry) UnmarshalJSON(b []byte) error {
+	type plain redisAddrEntry
+	if err := json.Unmarshal(b, (*plain)(e)); err != nil {
+		return err
+	}
+	unknown, err := unknownFields(b, plain{})
+	e.unknown = unknown
+	return err
+}
+
+type redisCNAMEEntry struct {
+	Host string `json:"host"`
+	TTL  uint32 `json:"ttl,omitempty"`
+	redisOwner
+	// unknown holds the fields a newer release wrote, kept on every rewrite.
+	unknown map[string]json.RawMessage
+}
+
+func (e redisCNAMEEntry) MarshalJSON() ([]byte, error) {
+	type plain redisCNAMEEntry
+	return marshalWithUnknown(plain(e), e.unknown)
+}
+
+func (e *redisCNAMEEntry) UnmarshalJSON(b []byte) error {
+	type plain redisCNAMEEntry
+	if err := json.Unmarshal(b, (*plain)(e)); err != nil {
+		return err
+	}
+	unknown, err := unknownFields(b, plain{})
+	e.unknown = unknown
+	return err
+}
+
+// redisField is the decoded JSON value of one zone hash field: every record
+// for a single name. Record types this registry does not manage (txt, mx,
+// soa, ...) are kept verbatim in other so a write never drops them.
+type redisField struct {
+	a     []redisAddrEntry
+	aaaa  []redisAddrEntry
+	cname []redisCNAMEEntry
+	other map[string]json.RawMessage
+}
+
+func decodeRedisField(raw string) (*redisField, error) {
+	f := &redisField{other: map[string]json.RawMessage{}}
+	if raw == "" {
+		return f, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &f.other); err != nil {
+		return nil, fmt.Errorf("decode redis field: %w", err)
+	}
+	for key, dst := range map[string]any{"a": &f.a, "aaaa": &f.aaaa, "cname": &f.cname} {
+		if v, ok := f.other[key]; ok {
+			if err := json.Unmarshal(v, dst); err != nil {
+				return nil, fmt.Errorf("decode redis field %q entries: %w", key, err)
+			}
+			delete(f.other, key)
+		}
+	}
+	return f, nil
+}
+
+// encode renders the field back to JSON. ok is false when no records remain,
+// in which case the caller should delete the hash field.
+func (f *redisField) encode() (string, bool, error) {
+	out := make(map[string]any, len(f.other)+3)
+	for k, v := range f.other {
+		out[k] = v
+	}
+	if len(f.a) > 0 {
+		out["a"] = f.a
+	}
+	if len(f.aaaa) > 0 {
+		out["aaaa"] = f.aaaa
+	}
+	if len(f.cname) > 0 {
+		out["cname"] = f.cname
+	}
+	if len(out) == 0 {
+		return "", false, nil
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
+
+func ownerFromIntent(ri *domain.RecordIntent) redisOwner {
+	return redisOwner{
+		Schema:             domain.RecordSchema,
+		OwnerHostname:      ri.Hostname,
+		OwnerContainerId:   ri.ContainerId,
+		OwnerContainerName: ri.ContainerName,
+		Created:            ri.Created,
+		Force:              ri.Force,
+	}
+}
+
+func (o redisOwner) matches(ri *domain.RecordIntent) bool {
+	return o.OwnerHostname == ri.Hostname &&
+		o.OwnerContainerName == ri.ContainerName &&
+		(ri.ContainerId == "" || o.OwnerContainerId == ri.ContainerId)
+}
+
+// add appends ri as a new entry of its kind.
+func (f *redisField) add(ri *domain.RecordIntent) {
+	switch ri.Record.Kind {
+	case domain.RecordA:
+		f.a = append(f.a, redisAddrEntry{IP: ri.Record.Value, TTL: ri.TTL, redisOwner: ownerFromIntent(ri), unknown: ri.Wire.Unknown})
+	case domain.RecordAAAA:
+		f.aaaa = append(f.aaaa, redisAddrEntry{IP: ri.Record.Value, TTL: ri.TTL, redisOwner: ownerFromIntent(ri), unknown: ri.Wire.Unknown})
+	case domain.RecordCNAME:
+		f.cname = append(f.cname, redisCNAMEEntry{Host: normalizeZone(ri.Record.Value), TTL: ri.TTL, redisOwner: ownerFromIntent(ri), unknown: ri.Wire.Unknown})
+	}
+}
+
+// upgradeOwned stamps the entries owned by hostname that are in another wire
+// format with this release's, and returns how many it changed.
+func (f *redisField) upgradeOwned(hostname string) int {
+	var n int
+	upgrade := func(o *redisOwner) {
+		if o.OwnerHostname == hostname && o.Schema != domain.RecordSchema {
+			o.Schema = domain.RecordSchema
+			n++
+		}
+	}
+	for i := range f.a {
+		upgrade(&f.a[i].redisOwner)
+	}
+	for i := range f.aaaa {
+		upgrade(&f.aaaa[i].redisOwner)
+	}
+	for i := range f.cname {
+		upgrade(&f.cname[i].redisOwner)
+	}
+	return n
+}
+
+// remove drops every entry matching ri (same value, kind and owner) and
+// returns how many were dropped.
+func (f *redisField) remove(ri *domain.RecordIntent) int {
+	keepAddr := func(entries []redisAddrEntry) ([]redisAddrEntry, int) {
+		kept := entries[:0]
+		n := 0
+		for _, e := range entries {
+			if e.IP == ri.Record.Value && e.matches(ri) {
+				n++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		return kept, n
+	}
+	var n int
+	switch ri.Record.Kind {
+	case domain.RecordA:
+		f.a, n = keepAddr(f.a)
+	case domain.RecordAAAA:
+		f.aaaa, n = keepAddr(f.aaaa)
+	case domain.RecordCNAME:
+		kept := f.cname[:0]
+		for _, e := range f.cname {
+			if strings.TrimSuffix(e.Host, ".") == strings.TrimSuffix(ri.Record.Value, ".") && e.matches(ri) {
+				n++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		f.cname = kept
+	}
+	return n
+}
+
+// intents converts the entries of the field into record intents. Entries
+// without an owner were written by another tool; they have no Hostname, so
+// they block conflicting records but are never stale, garbage-collected or
+// evicted.
+func (f *redisField) intents(fqdn string) ([]*domain.RecordIntent, []error) {
+	var out []*domain.RecordIntent
+	var errs []error
+	build := func(kind domain.RecordKind, value string, ttl uint32, o redisOwner, unknown map[string]json.RawMessage) {
+		rec, err := domain.NewFromKind(kind, fqdn, value)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		out = append(out, &domain.RecordIntent{
+			ContainerId:   o.OwnerContainerId,
+			ContainerName: o.OwnerContainerName,
+			Created:       o.Created,
+			Hostname:      o.OwnerHostname,
+			Force:         o.Force,
+			TTL:           ttl,
+			Record:        rec,
+			Wire:          domain.WireInfo{Schema: o.Schema, Unknown: unknown},
+		})
+	}
+	for _, e := range f.a {
+		build(domain.RecordA, e.IP, e.TTL, e.redisOwner, e.unknown)
+	}
+	for _, e := range f.aaaa {
+		build(domain.RecordAAAA, e.IP, e.TTL, e.redisOwner, e.unknown)
+	}
+	for _, e := range f.cname {
+		build(domain.RecordCNAME, strings.TrimSuffix(e.Host, "."), e.TTL, e.redisOwner, e.unknown)
+	}
+	return out, errs
+}
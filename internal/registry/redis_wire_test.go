@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/domain"
+)
+
+func TestRedisField_AddEncodesPluginLayout(t *testing.T) {
+	f, err := decodeRedisField("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	a.TTL = 60
+	f.add(a)
+	f.add(makeIntent("alias.example.com", "app.example.com", domain.RecordCNAME))
+
+	raw, keep, err := f.encode()
+	if err != nil || !keep {
+		t.Fatalf("encode: keep=%t err=%v", keep, err)
+	}
+	var decoded map[string][]map[string]any
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := decoded["a"][0]["ip"]; got != "10.0.0.1" {
+		t.Errorf("a[0].ip = %v, want 10.0.0.1", got)
+	}
+	if got := decoded["a"][0]["ttl"]; got != float64(60) {
+		t.Errorf("a[0].ttl = %v, want 60", got)
+	}
+	if got := decoded["a"][0]["owner_hostname"]; got != "docker-host" {
+		t.Errorf("a[0].owner_hostname = %v, want docker-host", got)
+	}
+	// The plugin expects fully qualified CNAME targets.
+	if got := decoded["cname"][0]["host"]; got != "app.example.com." {
+		t.Errorf("cname[0].host = %v, want app.example.com.", got)
+	}
+}
+
+func TestRedisField_PreservesUnmanagedTypes(t *testing.T) {
+	raw := `{"txt":[{"text":"hello","ttl":300}],"a":[{"ip":"10.0.0.9","ttl":300}]}`
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.add(makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+	out, _, err := f.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded map[string][]map[string]any
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(decoded["txt"]) != 1 || decoded["txt"][0]["text"] != "hello" {
+		t.Errorf("expected txt entry to be preserved, got %v", decoded["txt"])
+	}
+	if len(decoded["a"]) != 2 {
+		t.Errorf("expected foreign and new A entries, got %v", decoded["a"])
+	}
+}
+
+func TestRedisField_RemoveOnlyMatchingOwner(t *testing.T) {
+	f, _ := decodeRedisField("")
+	mine := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	theirs := makeIntent("app.example.com", "10.0.0.1", domain.RecordA)
+	theirs.Hostname = "other-host"
+	f.add(mine)
+	f.add(theirs)
+
+	if n := f.remove(mine); n != 1 {
+		t.Fatalf("removed %d entries, want 1", n)
+	}
+	if len(f.a) != 1 || f.a[0].OwnerHostname != "other-host" {
+		t.Errorf("expected only other-host's entry to remain, got %+v", f.a)
+	}
+	f.remove(theirs)
+	if _, keep, _ := f.encode(); keep {
+		t.Error("expected an emptied field to report keep=false")
+	}
+}
+
+func TestRedisField_IntentsListsUnownedWithoutHostname(t *testing.T) {
+	raw := `{"a":[{"ip":"10.0.0.9"},{"ip":"10.0.0.1","owner_hostname":"h1","owner_container_name":"web","force":true}],"cname":[{"host":"t.example.com.","owner_hostname":"h2"}]}`
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ris, errs := f.intents("app.example.com")
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(ris) != 3 {
+		t.Fatalf("expected 3 intents, got %d", len(ris))
+	}
+	if ris[0].Record.Value != "10.0.0.9" || ris[0].Hostname != "" {
+		t.Errorf("expected the unowned A intent without a hostname, got %s", ris[0].Render())
+	}
+	if ris[1].Record.Value != "10.0.0.1" || ris[1].Hostname != "h1" || !ris[1].Force {
+		t.Errorf("unexpected A intent: %s", ris[1].Render())
+	}
+	if ris[2].Record.Value != "t.example.com" || !ris[2].Record.IsCNAME() {
+		t.Errorf("unexpected CNAME intent: %s", ris[2].Render())
+	}
+}
+
+func TestDecodeRedisField_InvalidJSON(t *testing.T) {
+	if _, err := decodeRedisField("not json"); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if _, err := decodeRedisField(`{"a":"nope"}`); err == nil {
+		t.Error("expected error for malformed a entries")
+	}
+}
+
+func TestRedisField_KeepsUnknownEntryFields(t *testing.T) {
+	raw := `{"a":[{"ip":"10.0.0.9","schema":2,"owner_hostname":"new-host","created":"2026-01-01T00:00:00Z","weight":5}]}`
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ris, _ := f.intents("app.example.com")
+	if len(ris) != 1 || ris[0].Wire.Schema != 2 || string(ris[0].Wire.Unknown["weight"]) != "5" {
+		t.Fatalf("expected the entry's schema and unknown fields on its intent, got %+v", ris)
+	}
+	// Another write to the same field must not drop the newer release's field.
+	f.add(makeIntent("app.example.com", "10.0.0.1", domain.RecordA))
+
+	out, _, err := f.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded map[string][]map[string]any
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := decoded["a"][0]["weight"]; got != float64(5) {
+		t.Errorf("expected the unknown field to be kept, got %s", out)
+	}
+	if got := decoded["a"][1]["schema"]; got != float64(domain.RecordSchema) {
+		t.Errorf("expected the new entry to be stamped with the wire schema, got %s", out)
+	}
+}
+
+func TestRedisField_UpgradeOwned(t *testing.T) {
+	raw := `{"a":[{"ip":"10.0.0.1","owner_hostname":"docker-host","created":"2026-01-01T00:00:00Z"},{"ip":"10.0.0.2","owner_hostname":"old-host","created":"2026-01-01T00:00:00Z"}]}`
+	f, err := decodeRedisField(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := f.upgradeOwned("docker-host"); n != 1 {
+		t.Fatalf("expected one entry upgraded, got %d", n)
+	}
+	if f.a[0].Schema != domain.RecordSchema || f.a[1].Schema != 0 {
+		t.Errorf("expected only this host's entry upgraded, got %+v", f.a)
+	}
+	if n := f.upgradeOwned("docker-host"); n != 0 {
+		t.Errorf("expected nothing left to upgrade, got %d", n)
+	}
+}
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// unknownFields returns the members of the JSON object raw that the struct
+// type of v does not declare, or nil if there are none. Newer releases may add
+// fields to a stored value; keeping them lets this release write the value
+// back without dropping them.
+func unknownFields(raw []byte, v any) (map[string]json.RawMessage, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+	for name := range jsonFieldNames(reflect.TypeOf(v)) {
+		delete(all, name)
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	return all, nil
+}
+
+// marshalWithUnknown marshals v and adds back the unknown fields it was read
+// with. The fields v declares always win.
+func marshalWithUnknown(v any, unknown map[string]json.RawMessage) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(unknown) == 0 {
+		return b, err
+	}
+	var known map[string]json.RawMessage
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, err
+	}
+	merged := make(map[string]json.RawMessage, len(known)+len(unknown))
+	for name, value := range unknown {
+		merged[name] = value
+	}
+	for name, value := range known {
+		merged[name] = value
+	}
+	return json.Marshal(merged)
+}
+
+// jsonFieldNames returns the JSON member names declared by struct type t,
+// including those of embedded structs.
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := map[string]struct{}{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n := range jsonFieldNames(f.Type) {
+				names[n] = struct{}{}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = struct{}{}
+	}
+	return names
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type embeddedWire struct {
+	Owner string `json:"owner"`
+}
+
+type testWire struct {
+	Host     string `json:"host"`
+	TTL      uint32 `json:"ttl,omitempty"`
+	Skipped  string `json:"-"`
+	Untagged string
+	embeddedWire
+	hidden int
+}
+
+func TestJSONFieldNames(t *testing.T) {
+	got := jsonFieldNames(reflect.TypeOf(testWire{}))
+	want := map[string]struct{}{"host": {}, "ttl": {}, "Untagged": {}, "owner": {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	raw := []byte(`{"host":"a","owner":"b","ttl":0,"extra":[1,2]}`)
+	got, err := unknownFields(raw, testWire{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || string(got["extra"]) != "[1,2]" {
+		t.Errorf("expected only the undeclared field, got %v", got)
+	}
+
+	if got, _ := unknownFields([]byte(`{"host":"a"}`), testWire{}); got != nil {
+		t.Errorf("expected nil without unknown fields, got %v", got)
+	}
+	if _, err := unknownFields([]byte(`[]`), testWire{}); err == nil {
+		t.Error("expected an error for a value that is not an object")
+	}
+}
+
+func TestMarshalWithUnknown_KnownFieldsWin(t *testing.T) {
+	unknown := map[string]json.RawMessage{"extra": json.RawMessage(`true`), "host": json.RawMessage(`"stale"`)}
+	b, err := marshalWithUnknown(testWire{Host: "fresh"}, unknown)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["host"] != "fresh" || got["extra"] != true {
+		t.Errorf("expected the declared field to win and the unknown one to be kept, got %s", b)
+	}
+}
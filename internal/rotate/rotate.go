@@ -0,0 +1,110 @@
+// Package rotate provides a file writer that rotates the file by size:
+// once a write would take it past its limit, file is renamed file.1,
+// file.1 file.2, and so on, and a new file is started. The oldest backups
+// beyond the limit are deleted.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Writer appends to a file, rotating it by size. It is safe for concurrent
+// use; each Write reaches the file whole, in one piece.
+type Writer struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens path for appending, creating it and its directory if need be.
+// The file is rotated once it would exceed maxSizeMB megabytes, keeping
+// maxBackups rotated files; maxSizeMB 0 never rotates.
+func Open(path string, maxSizeMB, maxBackups int) (*Writer, error) {
+	w := &Writer{path: path, maxSize: int64(maxSizeMB) << 20, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating the directory of %s: %w", path, err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", w.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("opening %s: %w", w.path, err)
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it past its
+// size limit. A write larger than the limit goes to a fresh file of its own.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups up by one, deletes the ones past maxBackups and
+// starts a new file. Called with mu held.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("rotating %s: %w", w.path, err)
+	}
+	w.file = nil
+	_ = os.Remove(w.backup(w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(w.backup(i), w.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotating %s: %w", w.path, err)
+		}
+	}
+	if w.maxBackups > 0 {
+		if err := os.Rename(w.path, w.backup(1)); err != nil {
+			return fmt.Errorf("rotating %s: %w", w.path, err)
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return fmt.Errorf("rotating %s: %w", w.path, err)
+	}
+	return w.open()
+}
+
+// backup returns the path of the i-th most recent rotated file.
+func (w *Writer) backup(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+// Close closes the file. Writes after Close fail.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,113 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(b)
+}
+
+// openSmall opens path with a limit of limit bytes rather than megabytes.
+func openSmall(t *testing.T, path string, limit int64, backups int) *Writer {
+	t.Helper()
+	w, err := Open(path, 0, backups)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.maxSize = limit
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func TestOpen_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "audit.log")
+	w, err := Open(path, 1, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = w.Write([]byte("one\n"))
+	_ = w.Close()
+	w, _ = Open(path, 1, 1)
+	_, _ = w.Write([]byte("two\n"))
+	_ = w.Close()
+
+	if got := read(t, path); got != "one\ntwo\n" {
+		t.Errorf("expected both writes appended, got %q", got)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("expected a write after Close to fail")
+	}
+}
+
+func TestWriter_RotatesKeepingBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	w := openSmall(t, path, 8, 2)
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := read(t, path); got != "dddd\n" {
+		t.Errorf("expected the latest line in the file, got %q", got)
+	}
+	if got := read(t, path+".1"); got != "cccc\n" {
+		t.Errorf("expected the previous line in the first backup, got %q", got)
+	}
+	if got := read(t, path+".2"); got != "bbbb\n" {
+		t.Errorf("expected the line before in the second backup, got %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third backup, got %v", err)
+	}
+}
+
+func TestWriter_NoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	w := openSmall(t, path, 4, 0)
+
+	_, _ = w.Write([]byte("aaaa"))
+	_, _ = w.Write([]byte("bbbb"))
+
+	if got := read(t, path); got != "bbbb" {
+		t.Errorf("expected the file restarted, got %q", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("expected no backup, got %v", err)
+	}
+}
+
+func TestWriter_ConcurrentWritesStayWhole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	w := openSmall(t, path, 1<<20, 1)
+	line := strings.Repeat("x", 100) + "\n"
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				_, _ = w.Write([]byte(line))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, got := range strings.Split(strings.TrimSuffix(read(t, path), "\n"), "\n") {
+		if got+"\n" != line {
+			t.Fatalf("expected whole lines, got %q", got)
+		}
+	}
+}
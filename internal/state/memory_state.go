@@ -1,6 +1,7 @@
 package state
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -107,3 +108,28 @@ func (s *MemoryState) GetAllDesiredRecordIntents() []*domain.RecordIntent {
 	}
 	return intents
 }
+
+// Containers returns every tracked container, sorted by name. The intents are
+// shared with the tracker and must not be mutated.
+func (s *MemoryState) Containers() []domain.TrackedContainer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.TrackedContainer, 0, len(s.containers))
+	for _, cs := range s.containers {
+		out = append(out, domain.TrackedContainer{
+			Id:          cs.ContainerId,
+			Name:        cs.ContainerName,
+			Created:     cs.Created,
+			LastUpdated: cs.LastUpdated,
+			Status:      cs.Status,
+			Intents:     cs.RecordIntents,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Id < out[j].Id
+	})
+	return out
+}
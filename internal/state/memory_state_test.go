@@ -327,3 +327,22 @@ func TestMemoryState_ReaddAfterRemove(t *testing.T) {
 		t.Errorf("expected new value '192.168.1.2', got %q", result[0].Record.Value)
 	}
 }
+
+func TestMemoryState_Containers_SortedByName(t *testing.T) {
+	state := NewMemoryState()
+	created := time.Now()
+	state.Upsert("container-2", "web", created, []*domain.RecordIntent{makeTestIntent("web.example.com", "192.168.1.2")}, domain.StatusRunning)
+	state.Upsert("container-1", "api", created, []*domain.RecordIntent{makeTestIntent("api.example.com", "192.168.1.1")}, domain.StatusRunning)
+
+	containers := state.Containers()
+
+	if len(containers) != 2 {
+		t.Fatalf("expected 2 containers, got %d", len(containers))
+	}
+	if containers[0].Name != "api" || containers[1].Name != "web" {
+		t.Errorf("expected containers sorted by name, got %q then %q", containers[0].Name, containers[1].Name)
+	}
+	if c := containers[0]; c.Id != "container-1" || !c.Created.Equal(created) || c.Status != domain.StatusRunning || len(c.Intents) != 1 {
+		t.Errorf("unexpected container %+v", c)
+	}
+}
@@ -0,0 +1,84 @@
+// Package tracing sets up OpenTelemetry tracing: an OTLP/HTTP exporter fed by
+// a sampled tracer provider, which the engine, the registries and the Docker
+// generator are handed to trace event handling, reconciliation and their
+// etcd and Docker calls. Tracing is off unless tracing.enabled is set; the
+// components then trace with a no-op provider.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/buildinfo"
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// ServiceName is the service.name spans are exported under.
+const ServiceName = "docker-coredns-sync"
+
+// Tracer returns the tracer of the instrumentation scope name from tp, or a
+// no-op tracer if tp is nil.
+func Tracer(tp trace.TracerProvider, name string) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(name)
+}
+
+// End ends span, first marking it failed with err if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewProvider returns a tracer provider exporting the spans it samples over
+// OTLP/HTTP as cfg says, identified as this service on hostname. Spans are
+// exported in batches in the background; Shutdown flushes them.
+//
+// Without an endpoint the exporter follows the OTEL_EXPORTER_OTLP_* variables,
+// and defaults to http://localhost:4318.
+func NewProvider(ctx context.Context, cfg *config.TracingConfig, hostname string) (*sdktrace.TracerProvider, error) {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithTimeout(time.Duration(cfg.Timeout * float64(time.Second))),
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: create the OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(ServiceName),
+			semconv.ServiceVersion(buildinfo.Version()),
+			semconv.HostName(hostname),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: describe the service: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// A span whose parent was sampled is always kept, so a sampled pass
+		// is traced whole.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	), nil
+}
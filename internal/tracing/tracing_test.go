@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/auto-dns/docker-coredns-sync/internal/config"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer_NilProviderIsNoop(t *testing.T) {
+	_, span := Tracer(nil, "test").Start(context.Background(), "op")
+	defer span.End()
+
+	if span.SpanContext().IsValid() || span.IsRecording() {
+		t.Error("expected a no-op span without a provider")
+	}
+}
+
+func TestEnd_RecordsError(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	_, ok := Tracer(tp, "test").Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Tracer(tp, "test").Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 ended spans, got %d", len(spans))
+	}
+	if spans[0].Status.Code != codes.Unset {
+		t.Errorf("expected no status on success, got %v", spans[0].Status)
+	}
+	if spans[1].Status.Code != codes.Error || spans[1].Status.Description != "boom" || len(spans[1].Events) != 1 {
+		t.Errorf("expected the error recorded, got %v with %d events", spans[1].Status, len(spans[1].Events))
+	}
+}
+
+func TestNewProvider_ExportsOverOTLP(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+	cfg := &config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    srv.URL + "/v1/traces",
+		SampleRatio: 1,
+		Timeout:     5,
+		Headers:     map[string]string{"authorization": "Bearer abc"},
+	}
+
+	tp, err := NewProvider(t.Context(), cfg, "host-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, span := tp.Tracer("test").Start(t.Context(), "reconcile")
+	span.End()
+	if err := tp.Shutdown(t.Context()); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+
+	select {
+	case r := <-received:
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer abc" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export request %s %v", r.URL.Path, r.Header)
+		}
+	default:
+		t.Fatal("expected the span exported on shutdown")
+	}
+}
+
+func TestNewProvider_SamplesNothingAtZero(t *testing.T) {
+	cfg := &config.TracingConfig{Enabled: true, Endpoint: "http://127.0.0.1:0/v1/traces", SampleRatio: 0, Timeout: 1}
+	tp, err := NewProvider(t.Context(), cfg, "host-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	_, span := tp.Tracer("test").Start(t.Context(), "reconcile")
+	defer span.End()
+	if span.SpanContext().IsSampled() {
+		t.Error("expected no span sampled at a ratio of 0")
+	}
+}